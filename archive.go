@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/* a member of a static archive, the data of thin archive members lives in a separate file */
+type ArMember struct {
+	name   string
+	offset int64 /* offset of the member data in the archive */
+	size   int64
+	mode   int64
+	path   string /* thin archives only: the file holding the member */
+}
+
+/* an entry of the archive symbol index: the member at offset defines name */
+type ArSymbol struct {
+	name   string
+	offset int64 /* offset of the member header in the archive */
+}
+
+type ArchiveParser struct {
+	file     ElfReader
+	path     string
+	thin     bool
+	members  []*ArMember
+	symbols  []*ArSymbol
+	symsize  int64 /* size of the symbol index member */
+	headers  map[int64]*ArMember
+	demangle bool /* PrintArmap shows C++ and Rust names demangled */
+}
+
+/* reports whether the file starts with the magic string of a regular or thin archive */
+func IsArchive(file ElfReader) bool {
+	magic := make([]byte, SARMAG)
+	if _, err := file.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return string(magic) == ARMAG || string(magic) == THINMAG
+}
+
+/*
+reads the member list and symbol index of an ar(1) archive, supporting GNU and BSD
+long names, thin archives, and the "/", "/SYM64/" and "__.SYMDEF" symbol indexes
+*/
+func LoadArchive(file ElfReader, path string) (*ArchiveParser, error) {
+	a := new(ArchiveParser)
+	a.file = file
+	a.path = path
+	a.headers = map[int64]*ArMember{}
+
+	magic := make([]byte, SARMAG)
+	if _, err := file.ReadAt(magic, 0); err != nil {
+		return nil, err
+	}
+	switch string(magic) {
+	case ARMAG:
+	case THINMAG:
+		a.thin = true
+	default:
+		return nil, fmt.Errorf("error: not an archive - it has the wrong magic bytes at the start")
+	}
+
+	filesize, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	var longnames []byte
+	var symtab []byte
+	symtabKind := ""
+
+	hdrsize := int64(binary.Size(ArHeader{}))
+	pos := int64(SARMAG)
+	for {
+		hdr := new(ArHeader)
+		if _, err := file.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(file, binary.LittleEndian, hdr); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error: truncated archive member header at offset 0x%x", pos)
+		}
+		if string(hdr.AR_fmag[:]) != ARFMAG {
+			return nil, fmt.Errorf("error: bad archive member header at offset 0x%x", pos)
+		}
+
+		size, err := strconv.ParseInt(arField(hdr.AR_size[:]), 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("error: bad archive member size at offset 0x%x", pos)
+		}
+		mode, _ := strconv.ParseInt(arField(hdr.AR_mode[:]), 8, 64)
+		name := arField(hdr.AR_name[:])
+		dataoff := pos + hdrsize
+		// the members of a thin archive live elsewhere, but its index and name table do not
+		if size > filesize-dataoff && (!a.thin || name == "/" || name == "//" || name == "/SYM64/") {
+			return nil, fmt.Errorf("error: archive member at offset 0x%x extends past the end of the file", pos)
+		}
+		next := dataoff + size
+
+		if strings.HasPrefix(name, "#1/") {
+			// BSD: the name is stored in front of the data and counted in its size
+			n, err := strconv.ParseInt(name[3:], 10, 64)
+			if err != nil || n < 0 || n > size {
+				return nil, fmt.Errorf("error: bad BSD member name at offset 0x%x", pos)
+			}
+			buf := make([]byte, n)
+			if _, err := file.ReadAt(buf, dataoff); err != nil {
+				return nil, err
+			}
+			name = strings.TrimRight(string(buf), "\x00")
+			dataoff += n
+			size -= n
+		}
+
+		switch name {
+		case "/", "/SYM64/", "__.SYMDEF", "__.SYMDEF SORTED", "__.SYMDEF_64", "__.SYMDEF_64 SORTED":
+			symtabKind = strings.TrimSuffix(name, " SORTED")
+			symtab = make([]byte, size)
+			if _, err := file.ReadAt(symtab, dataoff); err != nil {
+				return nil, fmt.Errorf("error: truncated archive symbol index")
+			}
+			a.symsize = size
+		case "//":
+			longnames = make([]byte, size)
+			if _, err := file.ReadAt(longnames, dataoff); err != nil {
+				return nil, fmt.Errorf("error: truncated archive name table")
+			}
+		default:
+			member := new(ArMember)
+			member.offset = dataoff
+			member.size = size
+			member.mode = mode
+			member.name = strings.TrimSuffix(name, "/")
+
+			if strings.HasPrefix(name, "/") && len(name) > 1 {
+				// GNU: "/123" is an offset into the "//" name table
+				n, err := strconv.ParseInt(name[1:], 10, 64)
+				if err != nil || n < 0 || n >= int64(len(longnames)) {
+					return nil, fmt.Errorf("error: bad long name reference %q at offset 0x%x", name, pos)
+				}
+				end := strings.Index(string(longnames[n:]), "/\n")
+				if end < 0 {
+					end = strings.IndexByte(string(longnames[n:]), '\n')
+				}
+				if end < 0 {
+					end = len(longnames) - int(n)
+				}
+				member.name = string(longnames[n : n+int64(end)])
+			}
+
+			if a.thin {
+				// the header size is the size of the external file, nothing follows the header
+				member.path = member.name
+				if !filepath.IsAbs(member.path) {
+					member.path = filepath.Join(filepath.Dir(path), member.path)
+				}
+				next = dataoff
+			}
+
+			a.members = append(a.members, member)
+			a.headers[pos] = member
+		}
+
+		pos = next + next%2
+	}
+
+	symbols, err := parseArSymbols(symtabKind, symtab)
+	if err != nil {
+		return nil, err
+	}
+	a.symbols = symbols
+	return a, nil
+}
+
+/* decodes the archive symbol index: big-endian for GNU/SysV, little-endian ranlib structs for BSD */
+func parseArSymbols(kind string, data []byte) ([]*ArSymbol, error) {
+	symbols := []*ArSymbol{}
+	bad := fmt.Errorf("error: malformed archive symbol index")
+
+	switch kind {
+	case "/", "/SYM64/":
+		wordsize := 4
+		if kind == "/SYM64/" {
+			wordsize = 8
+		}
+		word := func(b []byte) int64 {
+			if wordsize == 8 {
+				return int64(binary.BigEndian.Uint64(b))
+			}
+			return int64(binary.BigEndian.Uint32(b))
+		}
+
+		if len(data) < wordsize {
+			return nil, bad
+		}
+		count := word(data)
+		if count < 0 || count >= int64(len(data)/wordsize) {
+			return nil, bad
+		}
+		names := data[wordsize*int(count+1):]
+		for i := 0; i < int(count); i++ {
+			end := strings.IndexByte(string(names), 0)
+			if end < 0 {
+				return nil, bad
+			}
+			symbols = append(symbols, &ArSymbol{string(names[:end]), word(data[wordsize*(i+1):])})
+			names = names[end+1:]
+		}
+	case "__.SYMDEF", "__.SYMDEF_64":
+		wordsize := 4
+		if kind == "__.SYMDEF_64" {
+			wordsize = 8
+		}
+		word := func(b []byte) int64 {
+			if wordsize == 8 {
+				return int64(binary.LittleEndian.Uint64(b))
+			}
+			return int64(binary.LittleEndian.Uint32(b))
+		}
+
+		if len(data) < wordsize {
+			return nil, bad
+		}
+		ransize := word(data)
+		if ransize < 0 || ransize%int64(2*wordsize) != 0 || ransize > int64(len(data)-2*wordsize) {
+			return nil, bad
+		}
+		strtab := data[2*wordsize+int(ransize):]
+		for i := 0; i < int(ransize)/(2*wordsize); i++ {
+			entry := data[wordsize+2*wordsize*i:]
+			strx := word(entry)
+			offset := word(entry[wordsize:])
+			if strx < 0 || strx >= int64(len(strtab)) {
+				return nil, bad
+			}
+			end := strings.IndexByte(string(strtab[strx:]), 0)
+			if end < 0 {
+				end = len(strtab) - int(strx)
+			}
+			symbols = append(symbols, &ArSymbol{string(strtab[strx : strx+int64(end)]), offset})
+		}
+	}
+	return symbols, nil
+}
+
+/* opens the data of a member, from inside the archive or from the external file of a thin archive */
+func (a *ArchiveParser) Open(member *ArMember) (ElfReader, io.Closer, error) {
+	if a.thin {
+		file, err := os.Open(member.path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, file, nil
+	}
+	return io.NewSectionReader(a.file, member.offset, member.size), io.NopCloser(nil), nil
+}
+
+/* returns the member whose header starts at offset, as referenced by the symbol index */
+func (a *ArchiveParser) MemberAt(offset int64) *ArMember {
+	return a.headers[offset]
+}
+
+func (a *ArchiveParser) PrintArmap() {
+	fmt.Println("Archive index:")
+	for _, sym := range a.symbols {
+		name := "?"
+		if member := a.MemberAt(sym.offset); member != nil {
+			name = member.name
+		}
+		symbol := sym.name
+		if a.demangle {
+			symbol = demangled(symbol, true)
+		}
+		fmt.Printf("%s in %s\n", symbol, name)
+	}
+	fmt.Println()
+}
+
+func arField(field []byte) string {
+	return strings.TrimRight(string(field), " ")
+}
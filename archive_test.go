@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/* a member as stored in the archive: the raw ar_name field, the data and the size written in the header */
+type fixtureArMember struct {
+	name string
+	data []byte
+	size int /* -1 for len(data) */
+}
+
+/* lays out an archive and returns it with the offset of each member header */
+func fixtureArchive(magic string, members []fixtureArMember) ([]byte, []int64) {
+	buf := bytes.NewBufferString(magic)
+	offsets := []int64{}
+	for _, m := range members {
+		offsets = append(offsets, int64(buf.Len()))
+		size := m.size
+		if size < 0 {
+			size = len(m.data)
+		}
+		fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8o%-10d%s", m.name, 0, 0, 0, 0644, size, ARFMAG)
+		buf.Write(m.data)
+		if buf.Len()%2 != 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), offsets
+}
+
+/* a GNU armap: big-endian count and header offsets, then the names */
+func gnuArmap(names []string, offsets []int64) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, uint32(len(names)))
+	for _, offset := range offsets {
+		binary.Write(buf, binary.BigEndian, uint32(offset))
+	}
+	for _, name := range names {
+		buf.WriteString(name + "\x00")
+	}
+	return buf.Bytes()
+}
+
+/* a BSD __.SYMDEF: little-endian ranlib structs (name offset, header offset) and their string table */
+func bsdArmap(names []string, offsets []int64) []byte {
+	strtab := new(bytes.Buffer)
+	ranlib := new(bytes.Buffer)
+	for i, name := range names {
+		binary.Write(ranlib, binary.LittleEndian, []uint32{uint32(strtab.Len()), uint32(offsets[i])})
+		strtab.WriteString(name + "\x00")
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint32(ranlib.Len()))
+	buf.Write(ranlib.Bytes())
+	binary.Write(buf, binary.LittleEndian, uint32(strtab.Len()))
+	buf.Write(strtab.Bytes())
+	return buf.Bytes()
+}
+
+/* a BSD member whose name is stored in front of its data */
+func bsdMember(name string, data []byte) fixtureArMember {
+	stored := name + strings.Repeat("\x00", 8-len(name)%8)
+	return fixtureArMember{fmt.Sprintf("#1/%d", len(stored)), append([]byte(stored), data...), -1}
+}
+
+/*
+builds an archive twice: once to find where the member headers land and once with the
+symbol index pointing at them, which works because the index does not change size.
+The owners of the symbols are counted from the first member, after any name table.
+*/
+func buildArchive(magic string, armap func(offsets []int64) fixtureArMember, members []fixtureArMember, owners []int) ([]byte, []int64) {
+	index := func(offsets []int64) []int64 {
+		headers := []int64{}
+		for _, owner := range owners {
+			headers = append(headers, offsets[owner])
+		}
+		return headers
+	}
+	skip := 1
+	if members[0].name == "//" {
+		skip++
+	}
+	_, offsets := fixtureArchive(magic, append([]fixtureArMember{armap(make([]int64, len(owners)))}, members...))
+	return fixtureArchive(magic, append([]fixtureArMember{armap(index(offsets[skip:]))}, members...))
+}
+
+func loadArchive(t *testing.T, data []byte, path string) *ArchiveParser {
+	t.Helper()
+	a, err := LoadArchive(bytes.NewReader(data), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+/* the symbols and members of the archive fixtures, the second member has a name too long for ar_name */
+var (
+	fixtureArNames   = []string{"object_main", "counter", "function_000", "function_001"}
+	fixtureArOwners  = []int{0, 0, 1, 1}
+	fixtureArMembers = []string{"object.o", "a_long_member_name.o"}
+)
+
+/* checks the member list and the symbol index, and that every member reads as an ELF file */
+func checkArchive(t *testing.T, flavour string, a *ArchiveParser, wantData [][]byte) {
+	t.Helper()
+	if len(a.members) != len(fixtureArMembers) {
+		t.Fatalf("%s: %d members, want %d", flavour, len(a.members), len(fixtureArMembers))
+	}
+	for i, member := range a.members {
+		if member.name != fixtureArMembers[i] || member.size != int64(len(wantData[i])) {
+			t.Errorf("%s: member %d is %q of size %d", flavour, i, member.name, member.size)
+		}
+		reader, closer, err := a.Open(member)
+		if err != nil {
+			t.Fatalf("%s: %v", flavour, err)
+		}
+		data := make([]byte, len(wantData[i]))
+		reader.ReadAt(data, 0)
+		closer.Close()
+		if !bytes.Equal(data, wantData[i]) {
+			t.Errorf("%s: the data of %s differs", flavour, member.name)
+		}
+		if _, err := LoadData(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: %s: %v", flavour, member.name, err)
+		}
+	}
+	armap := ""
+	for i, name := range fixtureArNames {
+		armap += fmt.Sprintf("%s in %s\n", name, fixtureArMembers[fixtureArOwners[i]])
+	}
+	if out := captureStdout(t, a.PrintArmap); string(out) != "Archive index:\n"+armap+"\n" {
+		t.Errorf("%s: the armap is\n%s", flavour, out)
+	}
+}
+
+func TestArchiveGnu(t *testing.T) {
+	objects := [][]byte{fixtureRelocatable().Bytes(), fixtureManySections(2).Bytes()}
+	data, offsets := buildArchive(ARMAG, func(offsets []int64) fixtureArMember {
+		return fixtureArMember{"/", gnuArmap(fixtureArNames, offsets), -1}
+	}, []fixtureArMember{
+		{"//", []byte("a_long_member_name.o/\n"), -1},
+		{"object.o/", objects[0], -1},
+		{"/0", objects[1], -1},
+	}, fixtureArOwners)
+
+	a := loadArchive(t, data, "libfixture.a")
+	checkArchive(t, "GNU", a, objects)
+	// the data follows the 60-byte header, members start on even offsets
+	for i, member := range a.members {
+		if member.offset != offsets[i+2]+60 || a.MemberAt(offsets[i+2]) != member {
+			t.Errorf("%s at 0x%x, its header at 0x%x", member.name, member.offset, offsets[i+2])
+		}
+	}
+}
+
+func TestArchiveBsd(t *testing.T) {
+	// an odd size makes the first member padded
+	objects := [][]byte{append(fixtureRelocatable().Bytes(), 0), fixtureManySections(2).Bytes()}
+	data, offsets := buildArchive(ARMAG, func(offsets []int64) fixtureArMember {
+		return bsdMember("__.SYMDEF SORTED", bsdArmap(fixtureArNames, offsets))
+	}, []fixtureArMember{
+		bsdMember("object.o", objects[0]),
+		bsdMember("a_long_member_name.o", objects[1]),
+	}, fixtureArOwners)
+
+	a := loadArchive(t, data, "libfixture.a")
+	checkArchive(t, "BSD", a, objects)
+	// the name stored in front of the data is not part of the member
+	for i, member := range a.members {
+		name := len(member.name) + 8 - len(member.name)%8
+		if member.offset != offsets[i+1]+60+int64(name) {
+			t.Errorf("%s at 0x%x, its header at 0x%x", member.name, member.offset, offsets[i+1])
+		}
+	}
+}
+
+func TestArchiveThin(t *testing.T) {
+	dir := t.TempDir()
+	objects := [][]byte{fixtureRelocatable().Bytes(), fixtureManySections(2).Bytes()}
+	os.Mkdir(filepath.Join(dir, "obj"), 0755)
+	for i, name := range fixtureArMembers {
+		os.WriteFile(filepath.Join(dir, "obj", name), objects[i], 0644)
+	}
+	// the header gives the size of the external file, nothing follows it
+	data, _ := buildArchive(THINMAG, func(offsets []int64) fixtureArMember {
+		return fixtureArMember{"/", gnuArmap(fixtureArNames, offsets), -1}
+	}, []fixtureArMember{
+		{"//", []byte("obj/object.o/\nobj/a_long_member_name.o/\n"), -1},
+		{"/0", nil, len(objects[0])},
+		{"/14", nil, len(objects[1])},
+	}, fixtureArOwners)
+
+	a := loadArchive(t, data, filepath.Join(dir, "libfixture.a"))
+	if !a.thin {
+		t.Fatalf("the archive is not thin")
+	}
+	// thin members are named by their path relative to the archive
+	for i := range fixtureArMembers {
+		if want := filepath.Join(dir, "obj", fixtureArMembers[i]); a.members[i].path != want {
+			t.Errorf("member %d is at %s, want %s", i, a.members[i].path, want)
+		}
+		a.members[i].name = filepath.Base(a.members[i].name)
+	}
+	checkArchive(t, "thin", a, objects)
+}
+
+func TestArchiveDamaged(t *testing.T) {
+	object := fixtureRelocatable().Bytes()
+	tests := []struct {
+		name    string
+		members []fixtureArMember
+		err     string
+	}{
+		{"size past EOF", []fixtureArMember{{"object.o/", object, len(object) + 1}},
+			"error: archive member at offset 0x8 extends past the end of the file"},
+		{"bad size", []fixtureArMember{{"object.o/", object, -1}, {"bad.o/", nil, -1}},
+			""},
+		{"long name without a name table", []fixtureArMember{{"/0", object, -1}},
+			`error: bad long name reference "/0" at offset 0x8`},
+		{"BSD name longer than the member", []fixtureArMember{{"#1/64", []byte("short.o\x00"), -1}},
+			"error: bad BSD member name at offset 0x8"},
+		{"truncated symbol index", []fixtureArMember{{"/", []byte{0, 0, 0, 9, 0, 0, 0, 0}, -1}},
+			"error: malformed archive symbol index"},
+	}
+	for _, test := range tests {
+		data, offsets := fixtureArchive(ARMAG, test.members)
+		if test.name == "bad size" {
+			copy(data[offsets[1]+48:], "12x       ")
+			test.err = fmt.Sprintf("error: bad archive member size at offset 0x%x", offsets[1])
+		}
+		if _, err := LoadArchive(bytes.NewReader(data), "damaged.a"); err == nil || err.Error() != test.err {
+			t.Errorf("%s: %v, want %s", test.name, err, test.err)
+		}
+	}
+	// a member that ends the file without its header is truncated
+	data, _ := fixtureArchive(ARMAG, []fixtureArMember{{"object.o/", object, -1}})
+	if _, err := LoadArchive(bytes.NewReader(append(data, "object.o/   0 "...)), "damaged.a"); err == nil ||
+		err.Error() != fmt.Sprintf("error: truncated archive member header at offset 0x%x", len(data)) {
+		t.Errorf("a truncated header returned %v", err)
+	}
+}
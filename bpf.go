@@ -0,0 +1,647 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+/* relocation types of EM_BPF */
+var r_bpf_type = map[uint32]string{
+	0:  "R_BPF_NONE",
+	1:  "R_BPF_64_64",
+	2:  "R_BPF_64_ABS64",
+	3:  "R_BPF_64_ABS32",
+	4:  "R_BPF_64_NODYLD32",
+	10: "R_BPF_64_32",
+}
+
+/* enum bpf_map_type, as bpftool names them */
+var bpf_map_type = map[uint32]string{
+	0:  "unspec",
+	1:  "hash",
+	2:  "array",
+	3:  "prog_array",
+	4:  "perf_event_array",
+	5:  "percpu_hash",
+	6:  "percpu_array",
+	7:  "stack_trace",
+	8:  "cgroup_array",
+	9:  "lru_hash",
+	10: "lru_percpu_hash",
+	11: "lpm_trie",
+	12: "array_of_maps",
+	13: "hash_of_maps",
+	14: "devmap",
+	15: "sockmap",
+	16: "cpumap",
+	17: "xskmap",
+	18: "sockhash",
+	19: "cgroup_storage",
+	20: "reuseport_sockarray",
+	21: "percpu_cgroup_storage",
+	22: "queue",
+	23: "stack",
+	24: "sk_storage",
+	25: "devmap_hash",
+	26: "struct_ops",
+	27: "ringbuf",
+	28: "inode_storage",
+	29: "task_storage",
+	30: "bloom_filter",
+	31: "user_ringbuf",
+	32: "cgrp_storage",
+	33: "arena",
+}
+
+/*
+the program type libbpf gives a section by its name, the more specific prefixes first.
+A leading ? only turns off autoloading.
+*/
+var bpf_section_type = [][2]string{
+	{"socket", "socket_filter"},
+	{"sk_reuseport", "sk_reuseport"},
+	{"kprobe", "kprobe"},
+	{"kretprobe", "kprobe"},
+	{"uprobe", "kprobe"},
+	{"uretprobe", "kprobe"},
+	{"ksyscall", "kprobe"},
+	{"kretsyscall", "kprobe"},
+	{"usdt", "kprobe"},
+	{"tc", "sched_cls"},
+	{"classifier", "sched_cls"},
+	{"netkit", "sched_cls"},
+	{"action", "sched_act"},
+	{"tp_btf", "tracing"},
+	{"tracepoint", "tracepoint"},
+	{"tp", "tracepoint"},
+	{"raw_tracepoint.w", "raw_tracepoint_writable"},
+	{"raw_tp.w", "raw_tracepoint_writable"},
+	{"raw_tracepoint", "raw_tracepoint"},
+	{"raw_tp", "raw_tracepoint"},
+	{"fentry", "tracing"},
+	{"fmod_ret", "tracing"},
+	{"fexit", "tracing"},
+	{"iter", "tracing"},
+	{"freplace", "ext"},
+	{"lsm", "lsm"},
+	{"xdp", "xdp"},
+	{"perf_event", "perf_event"},
+	{"lwt_in", "lwt_in"},
+	{"lwt_out", "lwt_out"},
+	{"lwt_xmit", "lwt_xmit"},
+	{"lwt_seg6local", "lwt_seg6local"},
+	{"sockops", "sock_ops"},
+	{"sk_skb", "sk_skb"},
+	{"sk_msg", "sk_msg"},
+	{"lirc_mode2", "lirc_mode2"},
+	{"flow_dissector", "flow_dissector"},
+	{"cgroup_skb", "cgroup_skb"},
+	{"cgroup/skb", "cgroup_skb"},
+	{"cgroup/sock", "cgroup_sock"},
+	{"cgroup/post_bind", "cgroup_sock"},
+	{"cgroup/dev", "cgroup_device"},
+	{"cgroup/sysctl", "cgroup_sysctl"},
+	{"cgroup/getsockopt", "cgroup_sockopt"},
+	{"cgroup/setsockopt", "cgroup_sockopt"},
+	{"cgroup/", "cgroup_sock_addr"},
+	{"struct_ops", "struct_ops"},
+	{"sk_lookup", "sk_lookup"},
+	{"syscall", "syscall"},
+	{"netfilter", "netfilter"},
+}
+
+/* a function in a program section, or a subprogram in .text */
+type BpfProgram struct {
+	Section   string `json:"section"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Offset    uint64 `json:"insn"` /* the first instruction in the section */
+	Insns     uint64 `json:"insns"`
+	Signature string `json:"signature,omitempty"` /* from the BTF FUNC */
+}
+
+/* a map defined in .maps with BTF, in the legacy maps section, or the array libbpf makes of a global data section */
+type BpfMap struct {
+	Name       string `json:"name"`
+	Section    string `json:"section"`
+	Type       string `json:"type"`
+	KeySize    uint32 `json:"key_size"`
+	ValueSize  uint32 `json:"value_size"`
+	MaxEntries uint32 `json:"max_entries"`
+	Flags      uint32 `json:"map_flags"`
+	Key        string `json:"key,omitempty"` /* the C types of the BTF map definition */
+	Value      string `json:"value,omitempty"`
+}
+
+/* a relocation of a program section: the map or function an instruction refers to */
+type BpfReloc struct {
+	Offset uint64
+	Type   string
+	Symbol string
+}
+
+/* what a BPF object file holds for the loader */
+type BpfObject struct {
+	File      string           `json:"file"`
+	License   string           `json:"license,omitempty"`
+	Version   uint32           `json:"kern_version,omitempty"`
+	Programs  []*BpfProgram    `json:"programs"`
+	Maps      []*BpfMap        `json:"maps"`
+	BtfTypes  int              `json:"btf_types"`
+	Ext       []*BtfExtSection `json:"btf_ext,omitempty"`
+	btf       *Btf
+	order     binary.ByteOrder
+	relocs    map[string][]BpfReloc
+	sections  map[string][]byte /* the program sections */
+	text      []string          /* their names in section header order */
+	demangle  bool              /* Disassemble shows C++ and Rust names demangled */
+	functions map[string]map[uint64]string
+}
+
+/* the program type of a section name, "" for .text and unknown names */
+func bpfSectionType(name string) string {
+	name = strings.TrimPrefix(name, "?")
+	for _, prefix := range bpf_section_type {
+		if strings.HasPrefix(name, prefix[0]) {
+			return prefix[1]
+		}
+	}
+	return ""
+}
+
+/* the symbol name of a relocation, a section symbol is named after its section */
+func (p *ElfParser) bpfSymbolName(desp *Elf64SymbolHeaderDesp) string {
+	name := strings.TrimRight(desp.name, "\x00")
+	if desp.sym.ST_info&0xf == STT_SECTION {
+		if shdrs := p.GetShdrs(); int(desp.sym.ST_shndx) < len(shdrs) {
+			name = strings.TrimRight(shdrs[desp.sym.ST_shndx].name, "\x00")
+		}
+	}
+	return name
+}
+
+/* decodes the programs, maps, BTF and relocations of an EM_BPF relocatable object */
+func (p *ElfParser) GetBpfObject() (*BpfObject, error) {
+	if p.GetEhdr().E_machine != EM_BPF {
+		return nil, fmt.Errorf("error: not a BPF object")
+	}
+	o := &BpfObject{Programs: []*BpfProgram{}, Maps: []*BpfMap{}, order: p.order, relocs: map[string][]BpfReloc{},
+		sections: map[string][]byte{}, functions: map[string]map[uint64]string{}}
+
+	var btf *Btf
+	if data, _ := p.sectionData(".BTF"); data != nil {
+		var err error
+		if btf, err = p.GetBtf(); err != nil {
+			p.fail("%v", err)
+		}
+	}
+	if btf != nil {
+		o.btf, o.BtfTypes = btf, len(btf.Types)-1
+		ext, err := p.GetBtfExt(btf)
+		if err != nil {
+			p.fail("%v", err)
+		}
+		o.Ext = ext
+	}
+
+	shdrs := p.GetShdrs()
+	names := make([]string, len(shdrs))
+	for i, desp := range shdrs {
+		names[i] = strings.TrimRight(desp.name, "\x00")
+		shdr := desp.shdr
+		switch {
+		case names[i] == "license":
+			data, _ := p.sectionData(names[i])
+			o.License = cString(data)
+		case names[i] == "version":
+			if data, _ := p.sectionData(names[i]); len(data) >= 4 {
+				o.Version = p.order.Uint32(data)
+			}
+		case shdr.SH_flags&SHF_EXECINSTR != 0 && shdr.SH_type == SHT_PROGBITS && shdr.SH_size != 0:
+			o.sections[names[i]] = p.readBytes(int64(shdr.SH_offset), int64(shdr.SH_size))
+			o.text = append(o.text, names[i])
+			o.functions[names[i]] = map[uint64]string{}
+		case shdr.SH_flags&SHF_ALLOC != 0 && shdr.SH_flags&SHF_EXECINSTR == 0 && bpfDataSection(names[i]):
+			o.Maps = append(o.Maps, &BpfMap{Name: names[i], Section: names[i], Type: "array", KeySize: 4,
+				ValueSize: uint32(shdr.SH_size), MaxEntries: 1})
+		}
+	}
+
+	// func_info tells the BTF type of each function
+	funcTypes := map[string]map[uint64]uint32{}
+	for _, ext := range o.Ext {
+		funcTypes[ext.Section] = map[uint64]uint32{}
+		for _, info := range ext.FuncInfo {
+			funcTypes[ext.Section][uint64(info.Insn)] = info.Type
+		}
+	}
+	for _, desp := range p.GetSyms() {
+		sym := desp.sym
+		if desp.tab.shdr.SH_type != SHT_SYMTAB || int(sym.ST_shndx) >= len(names) || sym.ST_shndx == 0 {
+			continue
+		}
+		section := names[sym.ST_shndx]
+		name := strings.TrimRight(desp.name, "\x00")
+		if _, ok := o.sections[section]; ok && name != "" && sym.ST_info&0xf != STT_SECTION {
+			o.functions[section][uint64(sym.ST_value)] = name
+		}
+		switch {
+		case sym.ST_info&0xf == STT_FUNC && o.sections[section] != nil:
+			prog := &BpfProgram{Section: section, Name: name, Type: bpfSectionType(section),
+				Offset: uint64(sym.ST_value) / 8, Insns: uint64(sym.ST_size) / 8}
+			if section == ".text" {
+				prog.Type = "subprogram"
+			}
+			if btf != nil {
+				if id, ok := funcTypes[section][prog.Offset]; ok {
+					prog.Signature = btf.FuncSignature(id)
+				}
+			}
+			o.Programs = append(o.Programs, prog)
+		case section == "maps" || strings.HasPrefix(section, "maps/"):
+			o.Maps = append(o.Maps, p.legacyMap(name, section, desp))
+		}
+	}
+	sort.SliceStable(o.Programs, func(i, j int) bool {
+		a, b := o.Programs[i], o.Programs[j]
+		return a.Section < b.Section || a.Section == b.Section && a.Offset < b.Offset
+	})
+	if btf != nil {
+		o.Maps = append(btfMaps(btf), o.Maps...)
+	}
+
+	for _, desp := range shdrs {
+		target := int(desp.shdr.SH_info)
+		if desp.shdr.SH_type != SHT_REL || target >= len(names) || o.sections[names[target]] == nil {
+			continue
+		}
+		o.relocs[names[target]] = p.bpfRelocs(desp)
+	}
+	return o, nil
+}
+
+/* the sections libbpf turns into array maps of one element */
+func bpfDataSection(name string) bool {
+	for _, prefix := range []string{".data", ".rodata", ".bss", ".kconfig", ".ksyms"} {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+/* a struct bpf_map_def of the maps section: type, key_size, value_size, max_entries, map_flags */
+func (p *ElfParser) legacyMap(name, section string, desp *Elf64SymbolHeaderDesp) *BpfMap {
+	m := &BpfMap{Name: name, Section: section}
+	data, shdr := p.sectionData(section)
+	value := uint64(desp.sym.ST_value)
+	if shdr == nil || value+20 > uint64(len(data)) {
+		p.fail("error: the map %s extends past the end of %s", name, section)
+		return m
+	}
+	def := data[value:]
+	m.Type = bpfMapType(p.order.Uint32(def))
+	m.KeySize, m.ValueSize = p.order.Uint32(def[4:]), p.order.Uint32(def[8:])
+	m.MaxEntries, m.Flags = p.order.Uint32(def[12:]), p.order.Uint32(def[16:])
+	return m
+}
+
+func bpfMapType(typ uint32) string {
+	if name, ok := bpf_map_type[typ]; ok {
+		return name
+	}
+	return fmt.Sprintf("type %d", typ)
+}
+
+/*
+the maps of the .maps DATASEC: each variable is a struct whose members encode the
+definition, __uint(name, n) as a pointer to an array of n elements and __type(name, t)
+as a pointer to t
+*/
+func btfMaps(btf *Btf) []*BpfMap {
+	maps := []*BpfMap{}
+	for _, datasec := range btf.Types {
+		if datasec.kind != BTF_KIND_DATASEC || datasec.Name != ".maps" {
+			continue
+		}
+		for _, v := range datasec.Members {
+			variable := btf.Type(v.Type)
+			def := btf.resolve(v.Type)
+			if variable == nil || def == nil || def.kind != BTF_KIND_STRUCT {
+				continue
+			}
+			m := &BpfMap{Name: variable.Name, Section: ".maps"}
+			for _, member := range def.Members {
+				ptr := btf.resolve(member.Type)
+				if ptr == nil || ptr.kind != BTF_KIND_PTR {
+					continue
+				}
+				number := uint32(0)
+				if array := btf.resolve(ptr.Type); array != nil && array.kind == BTF_KIND_ARRAY {
+					number = array.NrElems
+				}
+				switch member.Name {
+				case "type":
+					m.Type = bpfMapType(number)
+				case "key_size":
+					m.KeySize = number
+				case "value_size":
+					m.ValueSize = number
+				case "max_entries":
+					m.MaxEntries = number
+				case "map_flags":
+					m.Flags = number
+				case "key":
+					m.Key, m.KeySize = btf.TypeName(ptr.Type), uint32(btf.TypeSize(ptr.Type))
+				case "value":
+					m.Value, m.ValueSize = btf.TypeName(ptr.Type), uint32(btf.TypeSize(ptr.Type))
+				}
+			}
+			maps = append(maps, m)
+		}
+	}
+	return maps
+}
+
+/* the relocations of a program section, whose REL entries name the symbol of a map, a function or a section */
+func (p *ElfParser) bpfRelocs(rel *Elf64SectionHeaderDesp) []BpfReloc {
+	symtab := []*Elf64SymbolHeaderDesp{}
+	for _, desp := range p.GetSyms() {
+		if desp.tab.idx == int(rel.shdr.SH_link) {
+			symtab = append(symtab, desp)
+		}
+	}
+	relocs := []BpfReloc{}
+	data := p.readBytes(int64(rel.shdr.SH_offset), int64(rel.shdr.SH_size))
+	for i := 0; i+16 <= len(data); i += 16 {
+		info := p.order.Uint64(data[i+8:])
+		r := BpfReloc{Offset: p.order.Uint64(data[i:]), Type: r_bpf_type[uint32(info)]}
+		if r.Type == "" {
+			r.Type = fmt.Sprintf("type %d", uint32(info))
+		}
+		if idx := info >> 32; idx < uint64(len(symtab)) {
+			r.Symbol = p.bpfSymbolName(symtab[idx])
+		}
+		relocs = append(relocs, r)
+	}
+	return relocs
+}
+
+/* the summary: programs with their types and BTF signatures, maps, and how much BTF there is */
+func (o *BpfObject) String() string {
+	builder := new(strings.Builder)
+	fmt.Fprintf(builder, "%s: BPF object", o.File)
+	if o.License != "" {
+		fmt.Fprintf(builder, ", license %s", o.License)
+	}
+	if o.Version != 0 {
+		fmt.Fprintf(builder, ", kernel version 0x%x", o.Version)
+	}
+	if o.btf != nil {
+		fmt.Fprintf(builder, ", %d BTF types", o.BtfTypes)
+	} else {
+		fmt.Fprintf(builder, ", no BTF")
+	}
+	builder.WriteString("\n")
+
+	if len(o.Programs) != 0 {
+		builder.WriteString("Programs:\n")
+	}
+	for _, prog := range o.Programs {
+		typ := prog.Type
+		if typ == "" {
+			typ = "unknown"
+		}
+		fmt.Fprintf(builder, "  %-24s %-24s %-16s %5d insns", prog.Section, prog.Name, typ, prog.Insns)
+		if prog.Signature != "" {
+			fmt.Fprintf(builder, "  %s", prog.Signature)
+		}
+		builder.WriteString("\n")
+	}
+	if len(o.Maps) != 0 {
+		builder.WriteString("Maps:\n")
+	}
+	for _, m := range o.Maps {
+		key, value := fmt.Sprint(m.KeySize), fmt.Sprint(m.ValueSize)
+		if m.Key != "" {
+			key += " (" + m.Key + ")"
+		}
+		if m.Value != "" {
+			value += " (" + m.Value + ")"
+		}
+		fmt.Fprintf(builder, "  %-24s %-16s key %s value %s max_entries %d", m.Name, m.Type, key, value, m.MaxEntries)
+		if m.Flags != 0 {
+			fmt.Fprintf(builder, " flags 0x%x", m.Flags)
+		}
+		builder.WriteString("\n")
+	}
+	for _, ext := range o.Ext {
+		fmt.Fprintf(builder, ".BTF.ext of %s: %d func_info, %d line_info, %d CO-RE relocations\n",
+			ext.Section, len(ext.FuncInfo), len(ext.LineInfo), len(ext.CoreRelos))
+	}
+	return builder.String()
+}
+
+/* the func_info, line_info and CO-RE records of .BTF.ext, by section and instruction */
+func (o *BpfObject) DumpExt() string {
+	builder := new(strings.Builder)
+	for _, ext := range o.Ext {
+		if len(ext.FuncInfo) != 0 {
+			fmt.Fprintf(builder, "func_info of %s:\n", ext.Section)
+		}
+		for _, info := range ext.FuncInfo {
+			fmt.Fprintf(builder, "  insn %-5d [%d] %s\n", info.Insn, info.Type, o.btf.FuncSignature(info.Type))
+		}
+		if len(ext.LineInfo) != 0 {
+			fmt.Fprintf(builder, "line_info of %s:\n", ext.Section)
+		}
+		for _, info := range ext.LineInfo {
+			line := fmt.Sprintf("  insn %-5d %s:%d:%d  %s", info.Insn, info.File, info.Line, info.Column, strings.TrimSpace(info.Source))
+			fmt.Fprintln(builder, strings.TrimRight(line, " "))
+		}
+		if len(ext.CoreRelos) != 0 {
+			fmt.Fprintf(builder, "core_relo of %s:\n", ext.Section)
+		}
+		for _, r := range ext.CoreRelos {
+			fmt.Fprintf(builder, "  insn %-5d <%s> %s\n", r.Insn, r.Kind, r.Spec)
+		}
+	}
+	return builder.String()
+}
+
+/*
+disassembles the program sections as llvm-objdump -dr does, with the source lines of
+line_info before the instructions compiled from them
+*/
+func (o *BpfObject) Disassemble() string {
+	builder := new(strings.Builder)
+	for _, name := range o.text {
+		data, functions := o.sections[name], o.functions[name]
+		lines := map[uint32]BtfLineInfo{}
+		for _, ext := range o.Ext {
+			if ext.Section == name {
+				for _, info := range ext.LineInfo {
+					lines[info.Insn] = info
+				}
+			}
+		}
+		relocs := map[uint64][]BpfReloc{}
+		for _, r := range o.relocs[name] {
+			relocs[r.Offset] = append(relocs[r.Offset], r)
+		}
+		labels := []uint64{}
+		for offset := range functions {
+			labels = append(labels, offset)
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i] < labels[j] })
+		symbol := func(name string) string {
+			if o.demangle {
+				return demangled(name, true)
+			}
+			return name
+		}
+		// a jump or a call is labeled with the symbol at or before its target
+		label := func(target uint64) string {
+			i := sort.Search(len(labels), func(i int) bool { return labels[i] > target }) - 1
+			if i < 0 {
+				return ""
+			}
+			if labels[i] == target {
+				return fmt.Sprintf(" <%s>", symbol(functions[labels[i]]))
+			}
+			return fmt.Sprintf(" <%s+0x%x>", symbol(functions[labels[i]]), target-labels[i])
+		}
+
+		fmt.Fprintf(builder, "\nDisassembly of section %s:\n", name)
+		source := ""
+		for pc := 0; pc*8+8 <= len(data); {
+			offset := uint64(pc) * 8
+			if function, ok := functions[offset]; ok {
+				fmt.Fprintf(builder, "\n%016x <%s>:\n", offset, symbol(function))
+				source = ""
+			}
+			// a line is shown again only after another one
+			if line, ok := lines[uint32(pc)]; ok && strings.TrimSpace(line.Source) != "" && strings.TrimSpace(line.Source) != source {
+				source = strings.TrimSpace(line.Source)
+				fmt.Fprintf(builder, "; %s\n", source)
+			}
+			insn := decodeBpfInsn(data[pc*8:], o.order)
+			size := insn.slots() * 8
+			if pc*8+size > len(data) {
+				size = 8
+			}
+			raw := []string{}
+			for _, b := range data[pc*8 : pc*8+size] {
+				raw = append(raw, fmt.Sprintf("%02x", b))
+			}
+			text := insn.String()
+			if target, ok := insn.target(pc); ok {
+				text += label(uint64(target) * 8)
+			}
+			fmt.Fprintf(builder, "%8d:\t%s\t%s\n", pc, strings.Join(raw, " "), text)
+			for _, r := range relocs[offset] {
+				fmt.Fprintf(builder, "\t\t%016x:  %s\t%s\n", r.Offset, r.Type, symbol(r.Symbol))
+			}
+			pc += size / 8
+		}
+	}
+	return builder.String()
+}
+
+func runBpf(args []string) error {
+	asJson, dumpBtf, dumpExt, disassemble, demangle := false, false, false, false, false
+	paths := []string{}
+	for _, arg := range args {
+		switch arg {
+		case "--json":
+			asJson = true
+		case "--btf":
+			dumpBtf = true
+		case "--ext":
+			dumpExt = true
+		case "-d", "--disassemble":
+			disassemble = true
+		case "-C", "--demangle":
+			demangle = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+
+	results := []any{}
+	for _, path := range paths {
+		o, err := bpfFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			continue
+		}
+		o.demangle = demangle
+		if asJson {
+			result := map[string]any{"object": o}
+			if dumpBtf && o.btf != nil {
+				result["btf"] = o.btf.Types[1:]
+			}
+			results = append(results, result)
+			continue
+		}
+
+		if !dumpBtf && !dumpExt && !disassemble {
+			fmt.Print(o)
+		}
+		if dumpBtf && o.btf == nil {
+			fmt.Fprintf(os.Stderr, "%s: error: no .BTF in this file\n", path)
+		} else if dumpBtf {
+			for _, t := range o.btf.Types[1:] {
+				fmt.Println(o.btf.Dump(t))
+			}
+		}
+		if dumpExt {
+			fmt.Print(o.DumpExt())
+		}
+		if disassemble {
+			fmt.Printf("\n%s:\tfile format elf64-bpf\n", path)
+			fmt.Print(o.Disassemble())
+		}
+	}
+
+	if asJson {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	}
+	return nil
+}
+
+func bpfFile(path string) (*BpfObject, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	parser, err := LoadData(file)
+	if err != nil {
+		return nil, err
+	}
+	o, err := parser.GetBpfObject()
+	if err != nil {
+		return nil, err
+	}
+	o.File = path
+	for _, err := range parser.Errors() {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+	return o, nil
+}
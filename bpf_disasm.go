@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/* instruction classes, the low 3 bits of the opcode */
+const (
+	BPF_LD    = 0x00
+	BPF_LDX   = 0x01
+	BPF_ST    = 0x02
+	BPF_STX   = 0x03
+	BPF_ALU   = 0x04
+	BPF_JMP   = 0x05
+	BPF_JMP32 = 0x06
+	BPF_ALU64 = 0x07
+)
+
+/* load and store modes */
+const (
+	BPF_IMM    = 0x00
+	BPF_ABS    = 0x20
+	BPF_IND    = 0x40
+	BPF_MEM    = 0x60
+	BPF_MEMSX  = 0x80
+	BPF_ATOMIC = 0xc0
+)
+
+/* the operation of an atomic instruction, in its immediate */
+const (
+	BPF_FETCH   = 0x01
+	BPF_XCHG    = 0xe0 | BPF_FETCH
+	BPF_CMPXCHG = 0xf0 | BPF_FETCH
+)
+
+/* the assignment operators of the ALU operations, as LLVM writes them */
+var bpf_alu_op = map[uint8]string{
+	0x00: "+=",
+	0x10: "-=",
+	0x20: "*=",
+	0x30: "/=",
+	0x40: "|=",
+	0x50: "&=",
+	0x60: "<<=",
+	0x70: ">>=",
+	0x90: "%=",
+	0xa0: "^=",
+	0xb0: "=",
+	0xc0: "s>>=",
+}
+
+/* the comparisons of the conditional jumps */
+var bpf_jmp_op = map[uint8]string{
+	0x10: "==",
+	0x20: ">",
+	0x30: ">=",
+	0x40: "&",
+	0x50: "!=",
+	0x60: "s>",
+	0x70: "s>=",
+	0xa0: "<",
+	0xb0: "<=",
+	0xc0: "s<",
+	0xd0: "s<=",
+}
+
+/* the atomic read-modify-write operations without BPF_FETCH */
+var bpf_atomic_op = map[int32]string{
+	0x00: "+=",
+	0x40: "|=",
+	0x50: "&=",
+	0xa0: "^=",
+}
+
+var bpf_atomic_fetch = map[int32]string{
+	0x00 | BPF_FETCH: "add",
+	0x40 | BPF_FETCH: "or",
+	0x50 | BPF_FETCH: "and",
+	0xa0 | BPF_FETCH: "xor",
+}
+
+/* the access size of a load or store in bits, from bits 3-4 of the opcode */
+var bpf_size = [4]int{32, 16, 8, 64}
+
+/* a decoded instruction, ld_imm64 takes two slots and has its value in imm64 */
+type bpfInsn struct {
+	code  uint8
+	dst   uint8
+	src   uint8
+	off   int16
+	imm   int32
+	imm64 uint64
+}
+
+/* decodes the instruction at data, the register nibbles are swapped in big endian objects */
+func decodeBpfInsn(data []byte, order binary.ByteOrder) bpfInsn {
+	i := bpfInsn{code: data[0], off: int16(order.Uint16(data[2:])), imm: int32(order.Uint32(data[4:]))}
+	if order == binary.BigEndian {
+		i.dst, i.src = data[1]>>4, data[1]&0xf
+	} else {
+		i.dst, i.src = data[1]&0xf, data[1]>>4
+	}
+	if i.code == BPF_LD|BPF_IMM|0x18 && len(data) >= 16 {
+		i.imm64 = uint64(uint32(i.imm)) | uint64(order.Uint32(data[12:]))<<32
+	}
+	return i
+}
+
+/* the number of 8 byte slots of the instruction */
+func (i bpfInsn) slots() int {
+	if i.code == BPF_LD|BPF_IMM|0x18 {
+		return 2
+	}
+	return 1
+}
+
+/* the instruction a jump goes to, counted from the start of the section */
+func (i bpfInsn) target(pc int) (int, bool) {
+	class, op := i.code&7, i.code&0xf0
+	if class != BPF_JMP && class != BPF_JMP32 || op == 0x80 || op == 0x90 {
+		return 0, false
+	}
+	if class == BPF_JMP32 && op == 0x00 {
+		return pc + 1 + int(i.imm), true // gotol
+	}
+	return pc + 1 + int(i.off), true
+}
+
+/* (r1 + 8), (r10 - 4) */
+func bpfMemOperand(reg uint8, off int16) string {
+	if off < 0 {
+		return fmt.Sprintf("r%d - %d", reg, -int(off))
+	}
+	return fmt.Sprintf("r%d + %d", reg, off)
+}
+
+/* the instruction in the syntax of llvm-objdump, without the label of a jump target */
+func (i bpfInsn) String() string {
+	class, op := i.code&7, i.code&0xf0
+	size := bpf_size[i.code>>3&3]
+	switch class {
+	case BPF_ALU, BPF_ALU64:
+		reg := "r"
+		if class == BPF_ALU {
+			reg = "w"
+		}
+		dst := fmt.Sprintf("%s%d", reg, i.dst)
+		src := fmt.Sprint(i.imm)
+		if i.code&0x08 != 0 {
+			src = fmt.Sprintf("%s%d", reg, i.src)
+		}
+		switch op {
+		case 0x80:
+			return fmt.Sprintf("%s = -%s", dst, dst)
+		case 0xd0:
+			switch {
+			case class == BPF_ALU64:
+				return fmt.Sprintf("r%d = bswap%d r%d", i.dst, i.imm, i.dst)
+			case i.code&0x08 != 0:
+				return fmt.Sprintf("r%d = be%d r%d", i.dst, i.imm, i.dst)
+			}
+			return fmt.Sprintf("r%d = le%d r%d", i.dst, i.imm, i.dst)
+		}
+		if name, ok := bpf_alu_op[op]; ok {
+			return fmt.Sprintf("%s %s %s", dst, name, src)
+		}
+	case BPF_JMP, BPF_JMP32:
+		switch {
+		case op == 0x00 && class == BPF_JMP:
+			return fmt.Sprintf("goto %+d", i.off)
+		case op == 0x00:
+			return fmt.Sprintf("gotol %+d", i.imm)
+		case op == 0x80 && class == BPF_JMP:
+			return fmt.Sprintf("call %d", i.imm)
+		case op == 0x90 && class == BPF_JMP:
+			return "exit"
+		}
+		reg := "r"
+		if class == BPF_JMP32 {
+			reg = "w"
+		}
+		src := fmt.Sprint(i.imm)
+		if i.code&0x08 != 0 {
+			src = fmt.Sprintf("%s%d", reg, i.src)
+		}
+		if name, ok := bpf_jmp_op[op]; ok {
+			return fmt.Sprintf("if %s%d %s %s goto %+d", reg, i.dst, name, src, i.off)
+		}
+	case BPF_LD:
+		switch i.code & 0xe0 {
+		case BPF_IMM:
+			if size == 64 {
+				return fmt.Sprintf("r%d = %d ll", i.dst, i.imm64)
+			}
+		case BPF_ABS:
+			return fmt.Sprintf("r0 = *(u%d *)skb[%d]", size, i.imm)
+		case BPF_IND:
+			return fmt.Sprintf("r0 = *(u%d *)skb[r%d]", size, i.src)
+		}
+	case BPF_LDX:
+		switch i.code & 0xe0 {
+		case BPF_MEM:
+			return fmt.Sprintf("r%d = *(u%d *)(%s)", i.dst, size, bpfMemOperand(i.src, i.off))
+		case BPF_MEMSX:
+			return fmt.Sprintf("r%d = *(s%d *)(%s)", i.dst, size, bpfMemOperand(i.src, i.off))
+		}
+	case BPF_ST:
+		if i.code&0xe0 == BPF_MEM {
+			return fmt.Sprintf("*(u%d *)(%s) = %d", size, bpfMemOperand(i.dst, i.off), i.imm)
+		}
+	case BPF_STX:
+		switch i.code & 0xe0 {
+		case BPF_MEM:
+			return fmt.Sprintf("*(u%d *)(%s) = r%d", size, bpfMemOperand(i.dst, i.off), i.src)
+		case BPF_ATOMIC:
+			return i.atomic(size)
+		}
+	}
+	return "<unknown>"
+}
+
+/* the atomic instructions, 32 bit ones operate on the w registers */
+func (i bpfInsn) atomic(size int) string {
+	if size != 32 && size != 64 {
+		return "<unknown>"
+	}
+	reg := "r"
+	if size == 32 {
+		reg = "w"
+	}
+	addr := bpfMemOperand(i.dst, i.off)
+	if name, ok := bpf_atomic_op[i.imm]; ok {
+		return fmt.Sprintf("lock *(u%d *)(%s) %s %s%d", size, addr, name, reg, i.src)
+	}
+	if name, ok := bpf_atomic_fetch[i.imm]; ok {
+		return fmt.Sprintf("%s%d = atomic_fetch_%s((u%d *)(%s), %s%d)", reg, i.src, name, size, addr, reg, i.src)
+	}
+	prefix := "_"
+	if size == 32 {
+		prefix = "32_"
+	}
+	switch i.imm {
+	case BPF_XCHG:
+		return fmt.Sprintf("%s%d = xchg%s%d(%s, %s%d)", reg, i.src, prefix, size, addr, reg, i.src)
+	case BPF_CMPXCHG:
+		return fmt.Sprintf("%s0 = cmpxchg%s%d(%s, %s0, %s%d)", reg, prefix, size, addr, reg, reg, i.src)
+	}
+	return "<unknown>"
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/* encodes an instruction, big endian objects swap the register nibbles */
+func bpfEncode(order binary.ByteOrder, code, dst, src uint8, off int16, imm int32) []byte {
+	insn := make([]byte, 8)
+	insn[0], insn[1] = code, src<<4|dst
+	if order == binary.BigEndian {
+		insn[1] = dst<<4 | src
+	}
+	order.PutUint16(insn[2:], uint16(off))
+	order.PutUint32(insn[4:], uint32(imm))
+	return insn
+}
+
+/* a .BTF section being built, types are numbered from 1 in the order they are added */
+type btfFixture struct {
+	order   binary.ByteOrder
+	types   *bytes.Buffer
+	strings *ElfStrtab
+}
+
+func newBtfFixture(order binary.ByteOrder) *btfFixture {
+	return &btfFixture{order: order, types: new(bytes.Buffer), strings: NewElfStrtab()}
+}
+
+func (b *btfFixture) str(s string) uint32 {
+	if s == "" {
+		return 0
+	}
+	return uint32(b.strings.Add(s))
+}
+
+/* a btf_type with its kind specific words, vlen is the count of entries in words */
+func (b *btfFixture) add(name string, kind, vlen, sizeOrType uint32, words ...uint32) {
+	binary.Write(b.types, b.order, []uint32{b.str(name), kind<<24 | vlen, sizeOrType})
+	binary.Write(b.types, b.order, words)
+}
+
+func (b *btfFixture) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, b.order, []uint16{BTF_MAGIC})
+	binary.Write(buf, b.order, []uint8{1, 0})
+	binary.Write(buf, b.order, []uint32{24, 0, uint32(b.types.Len()), uint32(b.types.Len()), uint32(len(b.strings.data))})
+	buf.Write(b.types.Bytes())
+	buf.Write(b.strings.data)
+	return buf.Bytes()
+}
+
+/* a CO-RE kprobe counting exits per pid in a BTF defined hash map, as clang -g builds it */
+func fixtureBpf(order binary.ByteOrder) *fixture {
+	f := newFixture(ET_REL, EM_BPF, order)
+	text := [][]byte{
+		bpfEncode(order, BPF_LDX|BPF_MEM|0x00, 1, 1, 0, 0),   // r1 = *(u32 *)(r1 + 0)
+		bpfEncode(order, BPF_STX|BPF_MEM|0x00, 10, 1, -4, 0), // *(u32 *)(r10 - 4) = r1
+		bpfEncode(order, BPF_ALU64|0xb0|0x08, 2, 10, 0, 0),   // r2 = r10
+		bpfEncode(order, BPF_ALU64|0x00, 2, 0, 0, -4),        // r2 += -4
+		bpfEncode(order, BPF_LD|BPF_IMM|0x18, 1, 0, 0, 0),    // r1 = counts ll
+		make([]byte, 8),
+		bpfEncode(order, BPF_JMP|0x80, 0, 0, 0, 1),            // call bpf_map_lookup_elem
+		bpfEncode(order, BPF_JMP|0x10, 0, 0, 2, 0),            // if r0 == 0 goto +2
+		bpfEncode(order, BPF_ALU64|0xb0, 1, 0, 0, 1),          // r1 = 1
+		bpfEncode(order, BPF_STX|BPF_ATOMIC|0x18, 0, 1, 0, 0), // lock *(u64 *)(r0 + 0) += r1
+		bpfEncode(order, BPF_ALU|0xb0, 0, 0, 0, 0),            // w0 = 0
+		bpfEncode(order, BPF_JMP|0x90, 0, 0, 0, 0),            // exit
+	}
+	f.add(&fixtureSection{name: ".text", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 4, load: -1})
+	f.add(&fixtureSection{name: "kprobe/do_exit", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 8, load: -1,
+		data: bytes.Join(text, nil)})
+	// R_BPF_64_64 against counts at the ld_imm64, its symbol index is 3
+	rel := new(bytes.Buffer)
+	binary.Write(rel, order, []uint64{0x20, 3<<32 | 1})
+	f.add(&fixtureSection{name: ".relkprobe/do_exit", typ: SHT_REL, flags: SHF_INFO_LINK, align: 8, entsize: 16,
+		link: ".symtab", load: -1, data: rel.Bytes(), fill: func(f *fixture) []byte {
+			f.section(".relkprobe/do_exit").info = f.index("kprobe/do_exit")
+			return rel.Bytes()
+		}})
+	f.add(&fixtureSection{name: ".maps", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_WRITE, align: 8, load: -1, data: make([]byte, 32)})
+	f.add(&fixtureSection{name: "license", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_WRITE, load: -1, data: []byte("GPL\x00")})
+
+	b := newBtfFixture(order)
+	b.add("", BTF_KIND_PTR, 0, 3)                        // [1]
+	b.add("int", BTF_KIND_INT, 0, 4, 1<<24|32)           // [2]
+	b.add("", BTF_KIND_ARRAY, 0, 0, 2, 4, 1)             // [3] a hash map
+	b.add("__ARRAY_SIZE_TYPE__", BTF_KIND_INT, 0, 4, 32) // [4]
+	b.add("", BTF_KIND_PTR, 0, 6)                        // [5]
+	b.add("", BTF_KIND_ARRAY, 0, 0, 2, 4, 1024)          // [6]
+	b.add("", BTF_KIND_PTR, 0, 2)                        // [7]
+	b.add("", BTF_KIND_PTR, 0, 9)                        // [8]
+	b.add("u64", BTF_KIND_TYPEDEF, 0, 10)                // [9]
+	b.add("unsigned long long", BTF_KIND_INT, 0, 8, 64)  // [10]
+	b.add("", BTF_KIND_STRUCT, 4, 32, b.str("type"), 1, 0, b.str("max_entries"), 5, 64,
+		b.str("key"), 7, 128, b.str("value"), 8, 192) // [11]
+	b.add("counts", BTF_KIND_VAR, 0, 11, 1)                  // [12]
+	b.add("", BTF_KIND_PTR, 0, 14)                           // [13]
+	b.add("task", BTF_KIND_STRUCT, 1, 4, b.str("pid"), 2, 0) // [14]
+	b.add("", BTF_KIND_FUNC_PROTO, 1, 2, b.str("t"), 13)     // [15]
+	b.add("handle_exit", BTF_KIND_FUNC, 1, 15)               // [16]
+	b.add(".maps", BTF_KIND_DATASEC, 1, 0, 12, 0, 32)        // [17]
+	// func_info, line_info and core_relo of the program section, in bytes of instructions
+	section, file := b.str("kprobe/do_exit"), b.str("/src/prog.c")
+	records := [][]uint32{
+		{8, section, 1, 0, 16},
+		{16, section, 2, 0, file, b.str("int pid = BPF_CORE_READ(t, pid);"), 13<<10 | 12,
+			32, file, b.str("u64 *v = bpf_map_lookup_elem(&counts, &pid);"), 14<<10 | 11},
+		{16, section, 1, 0, 14, b.str("0:0"), 0},
+	}
+	ext := new(bytes.Buffer)
+	binary.Write(ext, order, []uint16{BTF_MAGIC})
+	binary.Write(ext, order, []uint8{1, 0})
+	header := []uint32{32}
+	off := uint32(0)
+	for _, r := range records {
+		header = append(header, off, uint32(4*len(r)))
+		off += uint32(4 * len(r))
+	}
+	binary.Write(ext, order, header)
+	for _, r := range records {
+		binary.Write(ext, order, r)
+	}
+	// the strings of .BTF.ext live in .BTF
+	f.add(&fixtureSection{name: ".BTF", typ: SHT_PROGBITS, align: 4, load: -1, data: b.Bytes()})
+	f.add(&fixtureSection{name: ".BTF.ext", typ: SHT_PROGBITS, align: 4, load: -1, data: ext.Bytes()})
+
+	f.addSymbols(".symtab", ".strtab", []fixtureSymbol{
+		{name: "LBB0_2", bind: STB_LOCAL, typ: STT_NOTYPE, section: "kprobe/do_exit", value: 0x50},
+		{name: "handle_exit", bind: STB_GLOBAL, typ: STT_FUNC, section: "kprobe/do_exit", size: 96},
+		{name: "counts", bind: STB_GLOBAL, typ: STT_OBJECT, section: ".maps", size: 32},
+	}, -1)
+	return f
+}
+
+func TestBpfObject(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prog.o")
+	os.WriteFile(path, fixtureBpf(binary.LittleEndian).Bytes(), 0644)
+
+	out := captureStdout(t, func() {
+		if err := runBpf([]string{path}); err != nil {
+			t.Fatal(err)
+		}
+		if err := runBpf([]string{"--btf", "--ext", "-d", path}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	checkGolden(t, "bpf", bytes.ReplaceAll(out, []byte(dir), []byte("DIR")))
+
+	// a big endian object decodes the same, only the bytes of the instructions differ
+	o, err := bpfFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, fixtureBpf(binary.BigEndian).Bytes(), 0644)
+	big, err := bpfFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if big.String() != o.String() || big.DumpExt() != o.DumpExt() {
+		t.Errorf("the big endian object reads as\n%s%s\nwant\n%s%s", big, big.DumpExt(), o, o.DumpExt())
+	}
+	text := func(o *BpfObject) []string {
+		lines := strings.Split(o.Disassemble(), "\n")
+		for i, line := range lines {
+			if fields := strings.Split(line, "\t"); len(fields) == 3 {
+				lines[i] = fields[0] + fields[2]
+			}
+		}
+		return lines
+	}
+	if got, want := strings.Join(text(big), "\n"), strings.Join(text(o), "\n"); got != want {
+		t.Errorf("the big endian object disassembles as\n%s\nwant\n%s", got, want)
+	}
+}
+
+/* little endian instructions as llvm-objdump -d prints them, the 32 bit atomics as with --mattr=+alu32 */
+func TestBpfInsn(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"bf10000000000000", "r0 = r1"},
+		{"2700000003000000", "r0 *= 3"},
+		{"9500000000000000", "exit"},
+		{"3f24000000000000", "r4 /= r2"},
+		{"cf24000000000000", "r4 s>>= r2"},
+		{"8702000000000000", "r2 = -r2"},
+		{"27020000f9ffffff", "r2 *= -7"},
+		{"18020000efcdab890000000067452301", "r2 = 81985529216486895 ll"},
+		{"b7020000ffffffff", "r2 = -1"},
+		{"dc02000040000000", "r2 = be64 r2"},
+		{"b401000007000000", "w1 = 7"},
+		{"7313fdff00000000", "*(u8 *)(r3 - 3) = r1"},
+		{"7131fdff00000000", "r1 = *(u8 *)(r3 - 3)"},
+		{"3c21000000000000", "w1 /= w2"},
+		{"04010000fbffffff", "w1 += -5"},
+		{"db51000001000000", "r5 = atomic_fetch_add((u64 *)(r1 + 0), r5)"},
+		{"db410000a1000000", "r4 = atomic_fetch_xor((u64 *)(r1 + 0), r4)"},
+		{"db410000e1000000", "r4 = xchg_64(r1 + 0, r4)"},
+		{"db310000f1000000", "r0 = cmpxchg_64(r1 + 0, r0, r3)"},
+		{"c372000001000000", "w7 = atomic_fetch_add((u32 *)(r2 + 0), w7)"},
+		{"c3620000e1000000", "w6 = xchg32_32(r2 + 0, w6)"},
+		{"c3820000f1000000", "w0 = cmpxchg32_32(r2 + 0, w0, w8)"},
+		{"db21000000000000", "lock *(u64 *)(r1 + 0) += r2"},
+		{"db31000050000000", "lock *(u64 *)(r1 + 0) &= r3"},
+		{"79a1f8ff00000000", "r1 = *(u64 *)(r10 - 8)"},
+		{"25010b0064000000", "if r1 > 100 goto +11"},
+		{"c5010900f7ffffff", "if r1 s< -9 goto +9"},
+		{"bd21060000000000", "if r1 <= r2 goto +6"},
+		{"a603020011000000", "if w3 < 17 goto +2"},
+		{"66030300fdffffff", "if w3 s> -3 goto +3"},
+		{"85100000ffffffff", "call -1"},
+	}
+	for _, test := range tests {
+		raw, err := hex.DecodeString(test.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decodeBpfInsn(raw, binary.LittleEndian).String(); got != test.want {
+			t.Errorf("%s disassembles as %q, want %q", test.raw, got, test.want)
+		}
+	}
+}
+
+/* -C demangles the function labels, the jump targets and the relocation symbols of the disassembly */
+func TestBpfDemangle(t *testing.T) {
+	f := fixtureBpf(binary.LittleEndian)
+	mangled := map[string]string{"LBB0_2": "_ZN4prog4doneE", "handle_exit": "_Z11handle_exitP4task", "counts": "_ZN5stats6countsE"}
+	syms := []fixtureSymbol{}
+	for _, sym := range f.symbols[".symtab"] {
+		sym.name = mangled[sym.name]
+		syms = append(syms, sym)
+	}
+	sections := []*fixtureSection{}
+	for _, s := range f.sections {
+		if s.name != ".symtab" && s.name != ".strtab" {
+			sections = append(sections, s)
+		}
+	}
+	f.sections = sections
+	f.addSymbols(".symtab", ".strtab", syms, -1)
+	path := filepath.Join(t.TempDir(), "prog.o")
+	os.WriteFile(path, f.Bytes(), 0644)
+
+	for _, test := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-d", path}, []string{"<_Z11handle_exitP4task>:", "goto +2 <_ZN4prog4doneE>", "R_BPF_64_64\t_ZN5stats6countsE"}},
+		{[]string{"-C", "-d", path}, []string{"<handle_exit(task*)>:", "goto +2 <prog::done>", "R_BPF_64_64\tstats::counts"}},
+	} {
+		out := captureStdout(t, func() {
+			if err := runBpf(test.args); err != nil {
+				t.Fatal(err)
+			}
+		})
+		for _, want := range test.want {
+			if !bytes.Contains(out, []byte(want)) {
+				t.Errorf("bpf %s: no %q in\n%s", strings.Join(test.args[:len(test.args)-1], " "), want, out)
+			}
+		}
+	}
+}
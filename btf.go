@@ -0,0 +1,613 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* the magic of .BTF and .BTF.ext, in the byte order of the object */
+const BTF_MAGIC = 0xeb9f
+
+/* type kinds, bits 24-28 of btf_type.info */
+const (
+	BTF_KIND_UNKN       = 0
+	BTF_KIND_INT        = 1
+	BTF_KIND_PTR        = 2
+	BTF_KIND_ARRAY      = 3
+	BTF_KIND_STRUCT     = 4
+	BTF_KIND_UNION      = 5
+	BTF_KIND_ENUM       = 6
+	BTF_KIND_FWD        = 7
+	BTF_KIND_TYPEDEF    = 8
+	BTF_KIND_VOLATILE   = 9
+	BTF_KIND_CONST      = 10
+	BTF_KIND_RESTRICT   = 11
+	BTF_KIND_FUNC       = 12
+	BTF_KIND_FUNC_PROTO = 13
+	BTF_KIND_VAR        = 14
+	BTF_KIND_DATASEC    = 15
+	BTF_KIND_FLOAT      = 16
+	BTF_KIND_DECL_TAG   = 17
+	BTF_KIND_TYPE_TAG   = 18
+	BTF_KIND_ENUM64     = 19
+)
+
+/* the limit on types read from .BTF, vmlinux has about 150000 */
+const MAX_BTF_TYPES = 1 << 20
+
+var btf_kind = map[int]string{
+	BTF_KIND_UNKN:       "UNKNOWN",
+	BTF_KIND_INT:        "INT",
+	BTF_KIND_PTR:        "PTR",
+	BTF_KIND_ARRAY:      "ARRAY",
+	BTF_KIND_STRUCT:     "STRUCT",
+	BTF_KIND_UNION:      "UNION",
+	BTF_KIND_ENUM:       "ENUM",
+	BTF_KIND_FWD:        "FWD",
+	BTF_KIND_TYPEDEF:    "TYPEDEF",
+	BTF_KIND_VOLATILE:   "VOLATILE",
+	BTF_KIND_CONST:      "CONST",
+	BTF_KIND_RESTRICT:   "RESTRICT",
+	BTF_KIND_FUNC:       "FUNC",
+	BTF_KIND_FUNC_PROTO: "FUNC_PROTO",
+	BTF_KIND_VAR:        "VAR",
+	BTF_KIND_DATASEC:    "DATASEC",
+	BTF_KIND_FLOAT:      "FLOAT",
+	BTF_KIND_DECL_TAG:   "DECL_TAG",
+	BTF_KIND_TYPE_TAG:   "TYPE_TAG",
+	BTF_KIND_ENUM64:     "ENUM64",
+}
+
+/* the linkage of a FUNC, in its vlen, and of a VAR */
+var btf_func_linkage = map[uint32]string{0: "static", 1: "global", 2: "extern"}
+var btf_var_linkage = map[uint32]string{0: "static", 1: "global", 2: "extern"}
+
+/* enum bpf_core_relo_kind, named as libbpf logs them */
+var btf_core_relo_kind = map[uint32]string{
+	0:  "byte_off",
+	1:  "byte_sz",
+	2:  "field_exists",
+	3:  "signed",
+	4:  "lshift_u64",
+	5:  "rshift_u64",
+	6:  "local_type_id",
+	7:  "target_type_id",
+	8:  "type_exists",
+	9:  "type_size",
+	10: "enumval_exists",
+	11: "enumval_value",
+	12: "type_matches",
+}
+
+/* a member of a struct or union, a value of an enum, a parameter of a function or a variable of a DATASEC */
+type BtfMember struct {
+	Name   string `json:"name,omitempty"`
+	Type   uint32 `json:"type_id"`
+	Offset uint32 `json:"offset,omitempty"` /* in bits in a struct or union, in bytes in a DATASEC */
+	Size   uint32 `json:"size,omitempty"`   /* the bitfield size, or the variable size in a DATASEC */
+	Value  uint64 `json:"value,omitempty"`  /* of an enum value, sign extended when the enum is signed */
+}
+
+/* a type of .BTF, the fields a kind does not have are zero */
+type BtfType struct {
+	ID           uint32      `json:"id"`
+	Kind         string      `json:"kind"`
+	Name         string      `json:"name"`
+	Size         uint32      `json:"size,omitempty"`
+	Type         uint32      `json:"type_id,omitempty"`
+	Encoding     string      `json:"encoding,omitempty"`
+	BitsOffset   uint32      `json:"bits_offset,omitempty"`
+	NrBits       uint32      `json:"nr_bits,omitempty"`
+	IndexType    uint32      `json:"index_type_id,omitempty"`
+	NrElems      uint32      `json:"nr_elems,omitempty"`
+	Linkage      string      `json:"linkage,omitempty"`
+	FwdKind      string      `json:"fwd_kind,omitempty"`
+	ComponentIdx int32       `json:"component_idx,omitempty"`
+	Members      []BtfMember `json:"members,omitempty"`
+	kind         int
+	kindFlag     bool
+}
+
+/* the decoded .BTF section, Types[0] is void */
+type Btf struct {
+	Types   []*BtfType
+	strings []byte
+}
+
+/* an instruction of a program section and the function type starting there */
+type BtfFuncInfo struct {
+	Insn uint32 `json:"insn"`
+	Type uint32 `json:"type_id"`
+}
+
+/* the source line an instruction was compiled from, the line text is in the string table */
+type BtfLineInfo struct {
+	Insn   uint32 `json:"insn"`
+	File   string `json:"file"`
+	Source string `json:"source"`
+	Line   uint32 `json:"line"`
+	Column uint32 `json:"column"`
+}
+
+/* a CO-RE relocation: the instruction libbpf adjusts to the kernel's layout of a type */
+type BtfCoreRelo struct {
+	Insn   uint32 `json:"insn"`
+	Type   uint32 `json:"type_id"`
+	Access string `json:"access"`
+	Kind   string `json:"kind"`
+	Spec   string `json:"spec"` /* the access string resolved to names, as libbpf logs it */
+}
+
+/* the .BTF.ext records of one program section, instructions are counted from its start */
+type BtfExtSection struct {
+	Section   string        `json:"section"`
+	FuncInfo  []BtfFuncInfo `json:"func_info"`
+	LineInfo  []BtfLineInfo `json:"line_info"`
+	CoreRelos []BtfCoreRelo `json:"core_relos"`
+}
+
+/* the strings are NUL terminated, offset 0 is the empty name */
+func (b *Btf) name(offset uint32) string {
+	if uint64(offset) >= uint64(len(b.strings)) {
+		return ""
+	}
+	s := b.strings[offset:]
+	if end := bytes.IndexByte(s, 0); end >= 0 {
+		s = s[:end]
+	}
+	return string(s)
+}
+
+/* the type by ID, nil for void and for IDs past the end */
+func (b *Btf) Type(id uint32) *BtfType {
+	if id == 0 || uint64(id) >= uint64(len(b.Types)) {
+		return nil
+	}
+	return b.Types[id]
+}
+
+/* decodes the header, the type section and the string section of .BTF */
+func (p *ElfParser) GetBtf() (*Btf, error) {
+	data, _ := p.sectionData(".BTF")
+	if data == nil {
+		return nil, fmt.Errorf("error: no .BTF in this file")
+	}
+	if len(data) < 24 || p.order.Uint16(data) != BTF_MAGIC {
+		return nil, fmt.Errorf("error: bad .BTF magic")
+	}
+	hdrLen := uint64(p.order.Uint32(data[4:]))
+	typeOff, typeLen := uint64(p.order.Uint32(data[8:])), uint64(p.order.Uint32(data[12:]))
+	strOff, strLen := uint64(p.order.Uint32(data[16:])), uint64(p.order.Uint32(data[20:]))
+	if hdrLen < 24 || hdrLen+typeOff+typeLen > uint64(len(data)) || hdrLen+strOff+strLen > uint64(len(data)) {
+		return nil, fmt.Errorf("error: the .BTF sections extend past its end")
+	}
+
+	b := &Btf{Types: []*BtfType{{Kind: "UNKNOWN", Name: "void"}}}
+	b.strings = data[hdrLen+strOff : hdrLen+strOff+strLen]
+	types := data[hdrLen+typeOff : hdrLen+typeOff+typeLen]
+	for len(types) != 0 {
+		if len(b.Types) > MAX_BTF_TYPES {
+			return b, fmt.Errorf("error: .BTF has more than %d types", MAX_BTF_TYPES)
+		}
+		t, size, err := b.decodeType(types, p.order)
+		if err != nil {
+			return b, fmt.Errorf("error: type %d of .BTF: %v", len(b.Types), err)
+		}
+		t.ID = uint32(len(b.Types))
+		b.Types = append(b.Types, t)
+		types = types[size:]
+	}
+	return b, nil
+}
+
+/* decodes the btf_type at the start of data and what follows it, returns the bytes used */
+func (b *Btf) decodeType(data []byte, order binary.ByteOrder) (*BtfType, int, error) {
+	if len(data) < 12 {
+		return nil, 0, fmt.Errorf("truncated")
+	}
+	info := order.Uint32(data[4:])
+	t := &BtfType{Name: b.name(order.Uint32(data)), kind: int(info >> 24 & 0x1f), kindFlag: info>>31 != 0}
+	vlen := int(info & 0xffff)
+	sizeType := order.Uint32(data[8:])
+	t.Kind = btf_kind[t.kind]
+	if t.Kind == "" {
+		return nil, 0, fmt.Errorf("unknown kind %d", t.kind)
+	}
+
+	extra := map[int]int{
+		BTF_KIND_INT: 4, BTF_KIND_ARRAY: 12, BTF_KIND_VAR: 4, BTF_KIND_DECL_TAG: 4,
+		BTF_KIND_STRUCT: 12 * vlen, BTF_KIND_UNION: 12 * vlen, BTF_KIND_ENUM: 8 * vlen, BTF_KIND_ENUM64: 12 * vlen,
+		BTF_KIND_FUNC_PROTO: 8 * vlen, BTF_KIND_DATASEC: 12 * vlen,
+	}[t.kind]
+	if len(data) < 12+extra {
+		return nil, 0, fmt.Errorf("truncated %s", t.Kind)
+	}
+	word := func(i int) uint32 { return order.Uint32(data[12+4*i:]) }
+
+	switch t.kind {
+	case BTF_KIND_INT:
+		t.Size = sizeType
+		t.Encoding = "(none)"
+		switch v := word(0); v >> 24 & 0xf {
+		case 1:
+			t.Encoding = "SIGNED"
+		case 2:
+			t.Encoding = "CHAR"
+		case 4:
+			t.Encoding = "BOOL"
+		}
+		t.BitsOffset, t.NrBits = word(0)>>16&0xff, word(0)&0xff
+	case BTF_KIND_PTR, BTF_KIND_TYPEDEF, BTF_KIND_VOLATILE, BTF_KIND_CONST, BTF_KIND_RESTRICT, BTF_KIND_TYPE_TAG:
+		t.Type = sizeType
+	case BTF_KIND_ARRAY:
+		t.Type, t.IndexType, t.NrElems = word(0), word(1), word(2)
+	case BTF_KIND_STRUCT, BTF_KIND_UNION:
+		t.Size = sizeType
+		for i := range vlen {
+			m := BtfMember{Name: b.name(word(3 * i)), Type: word(3*i + 1), Offset: word(3*i + 2)}
+			if t.kindFlag {
+				m.Size, m.Offset = m.Offset>>24, m.Offset&0xffffff
+			}
+			t.Members = append(t.Members, m)
+		}
+	case BTF_KIND_ENUM, BTF_KIND_ENUM64:
+		t.Size = sizeType
+		t.Encoding = "UNSIGNED"
+		if t.kindFlag {
+			t.Encoding = "SIGNED"
+		}
+		for i := range vlen {
+			m := BtfMember{}
+			if t.kind == BTF_KIND_ENUM {
+				m.Name, m.Value = b.name(word(2*i)), uint64(word(2*i+1))
+				if t.kindFlag {
+					m.Value = uint64(int64(int32(m.Value)))
+				}
+			} else {
+				m.Name, m.Value = b.name(word(3*i)), uint64(word(3*i+1))|uint64(word(3*i+2))<<32
+			}
+			t.Members = append(t.Members, m)
+		}
+	case BTF_KIND_FWD:
+		t.FwdKind = "struct"
+		if t.kindFlag {
+			t.FwdKind = "union"
+		}
+	case BTF_KIND_FUNC:
+		t.Type = sizeType
+		if t.Linkage = btf_func_linkage[uint32(vlen)]; t.Linkage == "" {
+			t.Linkage = "(unknown)"
+		}
+	case BTF_KIND_FUNC_PROTO:
+		t.Type = sizeType
+		for i := range vlen {
+			t.Members = append(t.Members, BtfMember{Name: b.name(word(2 * i)), Type: word(2*i + 1)})
+		}
+	case BTF_KIND_VAR:
+		t.Type = sizeType
+		if t.Linkage = btf_var_linkage[word(0)]; t.Linkage == "" {
+			t.Linkage = "(unknown)"
+		}
+	case BTF_KIND_DATASEC:
+		t.Size = sizeType
+		for i := range vlen {
+			t.Members = append(t.Members, BtfMember{Type: word(3 * i), Offset: word(3*i + 1), Size: word(3*i + 2)})
+		}
+	case BTF_KIND_FLOAT:
+		t.Size = sizeType
+	case BTF_KIND_DECL_TAG:
+		t.Type, t.ComponentIdx = sizeType, int32(word(0))
+	}
+	return t, 12 + extra, nil
+}
+
+/* the line of `bpftool btf dump file` for the type, members on the following lines indented by a tab */
+func (b *Btf) Dump(t *BtfType) string {
+	builder := new(strings.Builder)
+	name := t.Name
+	if name == "" {
+		name = "(anon)"
+	}
+	fmt.Fprintf(builder, "[%d] %s '%s'", t.ID, t.Kind, name)
+	switch t.kind {
+	case BTF_KIND_INT:
+		fmt.Fprintf(builder, " size=%d bits_offset=%d nr_bits=%d encoding=%s", t.Size, t.BitsOffset, t.NrBits, t.Encoding)
+	case BTF_KIND_PTR, BTF_KIND_TYPEDEF, BTF_KIND_VOLATILE, BTF_KIND_CONST, BTF_KIND_RESTRICT, BTF_KIND_TYPE_TAG:
+		fmt.Fprintf(builder, " type_id=%d", t.Type)
+	case BTF_KIND_ARRAY:
+		fmt.Fprintf(builder, " type_id=%d index_type_id=%d nr_elems=%d", t.Type, t.IndexType, t.NrElems)
+	case BTF_KIND_STRUCT, BTF_KIND_UNION:
+		fmt.Fprintf(builder, " size=%d vlen=%d", t.Size, len(t.Members))
+		for _, m := range t.Members {
+			fmt.Fprintf(builder, "\n\t'%s' type_id=%d bits_offset=%d", m.Name, m.Type, m.Offset)
+			if m.Size != 0 {
+				fmt.Fprintf(builder, " bitfield_size=%d", m.Size)
+			}
+		}
+	case BTF_KIND_ENUM, BTF_KIND_ENUM64:
+		fmt.Fprintf(builder, " encoding=%s size=%d vlen=%d", t.Encoding, t.Size, len(t.Members))
+		for _, m := range t.Members {
+			if t.kindFlag {
+				fmt.Fprintf(builder, "\n\t'%s' val=%d", m.Name, int64(m.Value))
+			} else {
+				fmt.Fprintf(builder, "\n\t'%s' val=%d", m.Name, m.Value)
+			}
+		}
+	case BTF_KIND_FWD:
+		fmt.Fprintf(builder, " fwd_kind=%s", t.FwdKind)
+	case BTF_KIND_FUNC:
+		fmt.Fprintf(builder, " type_id=%d linkage=%s", t.Type, t.Linkage)
+	case BTF_KIND_FUNC_PROTO:
+		fmt.Fprintf(builder, " ret_type_id=%d vlen=%d", t.Type, len(t.Members))
+		for _, m := range t.Members {
+			fmt.Fprintf(builder, "\n\t'%s' type_id=%d", m.Name, m.Type)
+		}
+	case BTF_KIND_VAR:
+		fmt.Fprintf(builder, " type_id=%d, linkage=%s", t.Type, t.Linkage)
+	case BTF_KIND_DATASEC:
+		fmt.Fprintf(builder, " size=%d vlen=%d", t.Size, len(t.Members))
+		for _, m := range t.Members {
+			fmt.Fprintf(builder, "\n\ttype_id=%d offset=%d size=%d", m.Type, m.Offset, m.Size)
+			if v := b.Type(m.Type); v != nil {
+				fmt.Fprintf(builder, " (%s '%s')", v.Kind, v.Name)
+			}
+		}
+	case BTF_KIND_FLOAT:
+		fmt.Fprintf(builder, " size=%d", t.Size)
+	case BTF_KIND_DECL_TAG:
+		fmt.Fprintf(builder, " type_id=%d component_idx=%d", t.Type, t.ComponentIdx)
+	}
+	return builder.String()
+}
+
+/* skips typedefs, qualifiers and type tags, the type a value has in memory */
+func (b *Btf) resolve(id uint32) *BtfType {
+	for range MAX_BTF_TYPES {
+		t := b.Type(id)
+		if t == nil {
+			return nil
+		}
+		switch t.kind {
+		case BTF_KIND_TYPEDEF, BTF_KIND_VOLATILE, BTF_KIND_CONST, BTF_KIND_RESTRICT, BTF_KIND_TYPE_TAG, BTF_KIND_VAR:
+			id = t.Type
+		default:
+			return t
+		}
+	}
+	return nil
+}
+
+/* the size of a value of the type in bytes, 0 for void, functions and loops */
+func (b *Btf) TypeSize(id uint32) uint64 {
+	return b.typeSize(id, 0)
+}
+
+func (b *Btf) typeSize(id uint32, depth int) uint64 {
+	t := b.resolve(id)
+	if t == nil || depth > 32 {
+		return 0
+	}
+	switch t.kind {
+	case BTF_KIND_PTR:
+		return 8
+	case BTF_KIND_ARRAY:
+		return uint64(t.NrElems) * b.typeSize(t.Type, depth+1)
+	case BTF_KIND_INT, BTF_KIND_STRUCT, BTF_KIND_UNION, BTF_KIND_ENUM, BTF_KIND_ENUM64, BTF_KIND_FLOAT, BTF_KIND_DATASEC:
+		return uint64(t.Size)
+	}
+	return 0
+}
+
+/* the C name of a type, like `struct task *` or `char[16]` */
+func (b *Btf) TypeName(id uint32) string {
+	return b.typeName(id, 0)
+}
+
+func (b *Btf) typeName(id uint32, depth int) string {
+	t := b.Type(id)
+	if t == nil {
+		return "void"
+	}
+	if depth > 32 {
+		return "..."
+	}
+	switch t.kind {
+	case BTF_KIND_PTR:
+		return strings.TrimSuffix(b.typeName(t.Type, depth+1), " ") + " *"
+	case BTF_KIND_ARRAY:
+		return fmt.Sprintf("%s[%d]", b.typeName(t.Type, depth+1), t.NrElems)
+	case BTF_KIND_STRUCT, BTF_KIND_UNION, BTF_KIND_ENUM, BTF_KIND_ENUM64, BTF_KIND_FWD:
+		kind := map[int]string{BTF_KIND_STRUCT: "struct", BTF_KIND_UNION: "union", BTF_KIND_ENUM: "enum", BTF_KIND_ENUM64: "enum"}[t.kind]
+		if t.kind == BTF_KIND_FWD {
+			kind = t.FwdKind
+		}
+		if t.Name == "" {
+			return kind + " (anon)"
+		}
+		return kind + " " + t.Name
+	case BTF_KIND_CONST, BTF_KIND_VOLATILE, BTF_KIND_RESTRICT:
+		return strings.ToLower(t.Kind) + " " + b.typeName(t.Type, depth+1)
+	case BTF_KIND_TYPE_TAG, BTF_KIND_VAR, BTF_KIND_DECL_TAG:
+		return b.typeName(t.Type, depth+1)
+	case BTF_KIND_FUNC_PROTO:
+		params := []string{}
+		for _, m := range t.Members {
+			params = append(params, b.typeName(m.Type, depth+1))
+		}
+		return fmt.Sprintf("%s (*)(%s)", b.typeName(t.Type, depth+1), strings.Join(params, ", "))
+	}
+	return t.Name
+}
+
+/* the C declaration of a FUNC: int handle_exit(struct task *t) */
+func (b *Btf) FuncSignature(id uint32) string {
+	fn := b.Type(id)
+	if fn == nil || fn.kind != BTF_KIND_FUNC {
+		return ""
+	}
+	proto := b.Type(fn.Type)
+	if proto == nil || proto.kind != BTF_KIND_FUNC_PROTO {
+		return fn.Name + "()"
+	}
+	params := []string{}
+	for _, m := range proto.Members {
+		param := b.TypeName(m.Type)
+		switch {
+		case m.Type == 0 && m.Name == "":
+			param = "..."
+		case m.Name != "" && strings.HasSuffix(param, "*"):
+			param += m.Name
+		case m.Name != "":
+			param += " " + m.Name
+		}
+		params = append(params, param)
+	}
+	ret := b.TypeName(proto.Type)
+	if !strings.HasSuffix(ret, "*") {
+		ret += " "
+	}
+	return fmt.Sprintf("%s%s(%s)", ret, fn.Name, strings.Join(params, ", "))
+}
+
+/*
+resolves the access string of a CO-RE relocation as libbpf logs it: [2] struct task.pid
+(0:0 @ offset 0). The first index steps over the root as an array, the others select
+members or array elements; a type relocation names the type and an enum relocation
+the enumerator.
+*/
+func (b *Btf) CoreSpec(r BtfCoreRelo, kind uint32) string {
+	root := b.Type(r.Type)
+	if root == nil {
+		return fmt.Sprintf("[%d] (%s)", r.Type, r.Access)
+	}
+	spec := fmt.Sprintf("[%d] %s", r.Type, b.TypeName(r.Type))
+	indices := []uint64{}
+	for _, field := range strings.Split(r.Access, ":") {
+		n, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return spec + " (" + r.Access + ")"
+		}
+		indices = append(indices, n)
+	}
+
+	switch {
+	case kind >= 6 && kind <= 9 || kind == 12:
+		return spec
+	case kind == 10 || kind == 11:
+		t := b.resolve(r.Type)
+		if t == nil || (t.kind != BTF_KIND_ENUM && t.kind != BTF_KIND_ENUM64) || indices[0] >= uint64(len(t.Members)) {
+			return spec + " (" + r.Access + ")"
+		}
+		m := t.Members[indices[0]]
+		value := fmt.Sprint(m.Value)
+		if t.kindFlag {
+			value = fmt.Sprint(int64(m.Value))
+		}
+		return fmt.Sprintf("%s::%s = %s", spec, m.Name, value)
+	}
+
+	offset := indices[0] * b.TypeSize(r.Type) * 8
+	t := b.resolve(r.Type)
+	for _, index := range indices[1:] {
+		if t == nil {
+			break
+		}
+		switch t.kind {
+		case BTF_KIND_STRUCT, BTF_KIND_UNION:
+			if index >= uint64(len(t.Members)) {
+				return spec + " (" + r.Access + ")"
+			}
+			m := t.Members[index]
+			if m.Name != "" {
+				spec += "." + m.Name
+			}
+			offset += uint64(m.Offset)
+			t = b.resolve(m.Type)
+		case BTF_KIND_ARRAY:
+			spec += fmt.Sprintf("[%d]", index)
+			offset += index * b.TypeSize(t.Type) * 8
+			t = b.resolve(t.Type)
+		default:
+			return spec + " (" + r.Access + ")"
+		}
+	}
+	return fmt.Sprintf("%s (%s @ offset %d)", spec, r.Access, offset/8)
+}
+
+/*
+decodes .BTF.ext: per program section the func_info, line_info and CO-RE relocation
+records, whose section names and strings are in .BTF. Instruction offsets are in bytes
+in an object file and are returned as instruction indices.
+*/
+func (p *ElfParser) GetBtfExt(b *Btf) ([]*BtfExtSection, error) {
+	data, _ := p.sectionData(".BTF.ext")
+	if data == nil {
+		return nil, nil
+	}
+	if len(data) < 24 || p.order.Uint16(data) != BTF_MAGIC {
+		return nil, fmt.Errorf("error: bad .BTF.ext magic")
+	}
+	hdrLen := uint64(p.order.Uint32(data[4:]))
+	if hdrLen < 24 || hdrLen > uint64(len(data)) {
+		return nil, fmt.Errorf("error: bad .BTF.ext header length %d", hdrLen)
+	}
+	sections := []*BtfExtSection{}
+	section := func(name string) *BtfExtSection {
+		for _, s := range sections {
+			if s.Section == name {
+				return s
+			}
+		}
+		s := &BtfExtSection{Section: name, FuncInfo: []BtfFuncInfo{}, LineInfo: []BtfLineInfo{}, CoreRelos: []BtfCoreRelo{}}
+		sections = append(sections, s)
+		return s
+	}
+
+	// func_info, line_info, then core_relo in headers of 32 bytes
+	for kind := 0; kind < 3 && 8+8*uint64(kind)+8 <= hdrLen; kind++ {
+		off := uint64(p.order.Uint32(data[8+8*kind:]))
+		size := uint64(p.order.Uint32(data[12+8*kind:]))
+		if size == 0 {
+			continue
+		}
+		if hdrLen+off+size > uint64(len(data)) || size < 4 {
+			return sections, fmt.Errorf("error: the .BTF.ext records extend past its end")
+		}
+		info := data[hdrLen+off : hdrLen+off+size]
+		recSize := uint64(p.order.Uint32(info))
+		if recSize < []uint64{8, 16, 16}[kind] {
+			return sections, fmt.Errorf("error: bad .BTF.ext record size %d", recSize)
+		}
+		info = info[4:]
+		for len(info) >= 8 {
+			s := section(b.name(p.order.Uint32(info)))
+			count := uint64(p.order.Uint32(info[4:]))
+			info = info[8:]
+			if count*recSize > uint64(len(info)) {
+				return sections, fmt.Errorf("error: the .BTF.ext records of %s extend past its end", s.Section)
+			}
+			for range count {
+				word := func(i int) uint32 { return p.order.Uint32(info[4*i:]) }
+				insn := word(0) / 8
+				switch kind {
+				case 0:
+					s.FuncInfo = append(s.FuncInfo, BtfFuncInfo{insn, word(1)})
+				case 1:
+					s.LineInfo = append(s.LineInfo, BtfLineInfo{insn, b.name(word(1)), b.name(word(2)), word(3) >> 10, word(3) & 0x3ff})
+				case 2:
+					r := BtfCoreRelo{Insn: insn, Type: word(1), Access: b.name(word(2)), Kind: btf_core_relo_kind[word(3)]}
+					if r.Kind == "" {
+						r.Kind = fmt.Sprintf("kind %d", word(3))
+					}
+					r.Spec = b.CoreSpec(r, word(3))
+					s.CoreRelos = append(s.CoreRelos, r)
+				}
+				info = info[recSize:]
+			}
+		}
+	}
+	return sections, nil
+}
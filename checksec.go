@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+/* security hardening properties of a single ELF file, as reported by `checksec` */
+type Checksec struct {
+	File      string   `json:"file"`
+	RELRO     string   `json:"relro"`
+	Canary    bool     `json:"canary"`
+	NX        bool     `json:"nx"`
+	PIE       string   `json:"pie"`
+	RPATH     string   `json:"rpath"`
+	RUNPATH   string   `json:"runpath"`
+	Stripped  bool     `json:"stripped"`
+	Fortify   bool     `json:"fortify_source"`
+	Fortified []string `json:"fortified"`
+	CET       []string `json:"cet"`
+}
+
+func (p *ElfParser) GetChecksec() *Checksec {
+	c := new(Checksec)
+	c.RELRO = p.relro()
+	c.NX = p.nx()
+	c.PIE = p.pie()
+	c.RPATH = strings.Join(p.GetDynStrings(DT_RPATH), ":")
+	c.RUNPATH = strings.Join(p.GetDynStrings(DT_RUNPATH), ":")
+	c.CET = p.cet()
+	c.Fortified = []string{}
+
+	c.Stripped = true
+	for _, shdrDesp := range p.GetShdrs() {
+		if shdrDesp.shdr.SH_type == SHT_SYMTAB {
+			c.Stripped = false
+			break
+		}
+	}
+
+	fortified := map[string]bool{}
+	for _, desp := range p.GetSyms() {
+		name := strings.Trim(desp.name, "\x00")
+		switch {
+		case name == "__stack_chk_fail" || name == "__stack_chk_guard" || name == "__intel_security_cookie":
+			c.Canary = true
+		case strings.HasPrefix(name, "__") && strings.HasSuffix(name, "_chk") && desp.sym.ST_shndx == SHN_UNDEF:
+			fortified[name] = true
+		}
+	}
+	for name := range fortified {
+		c.Fortified = append(c.Fortified, name)
+	}
+	sort.Strings(c.Fortified)
+	c.Fortify = len(c.Fortified) != 0
+
+	return c
+}
+
+/* Full RELRO needs PT_GNU_RELRO and immediate binding, otherwise the GOT stays writable */
+func (p *ElfParser) relro() string {
+	hasRelro := false
+	for _, phdr := range p.GetPhdrs() {
+		if phdr.P_type == PT_GNU_RELRO {
+			hasRelro = true
+			break
+		}
+	}
+	if !hasRelro {
+		return "No RELRO"
+	}
+
+	if _, ok := p.GetDynVal(DT_BIND_NOW); ok {
+		return "Full RELRO"
+	}
+	if flags, ok := p.GetDynVal(DT_FLAGS); ok && flags&DF_BIND_NOW != 0 {
+		return "Full RELRO"
+	}
+	if flags, ok := p.GetDynVal(DT_FLAGS_1); ok && flags&DF_1_NOW != 0 {
+		return "Full RELRO"
+	}
+	return "Partial RELRO"
+}
+
+/* without PT_GNU_STACK the loader falls back to an executable stack */
+func (p *ElfParser) nx() bool {
+	for _, phdr := range p.GetPhdrs() {
+		if phdr.P_type == PT_GNU_STACK {
+			return phdr.P_flags&PF_X == 0
+		}
+	}
+	return false
+}
+
+func (p *ElfParser) pie() string {
+	switch p.ehdr.E_type {
+	case ET_EXEC:
+		return "No PIE"
+	case ET_REL:
+		return "REL"
+	case ET_DYN:
+		if flags, ok := p.GetDynVal(DT_FLAGS_1); ok && flags&DF_1_PIE != 0 {
+			return "PIE enabled"
+		}
+		// linkers older than binutils 2.26 do not set DF_1_PIE
+		for _, phdr := range p.GetPhdrs() {
+			if phdr.P_type == PT_INTERP {
+				return "PIE enabled"
+			}
+		}
+		return "DSO"
+	}
+	return "Not an executable"
+}
+
+/* reads the x86 and AArch64 feature bits from the .note.gnu.property note */
+func (p *ElfParser) cet() []string {
+	features := []string{}
+	for _, note := range p.GetNotes() {
+		if note.name != "GNU" || note.typ != NT_GNU_PROPERTY_TYPE_0 {
+			continue
+		}
+
+		desc := note.desc
+		for len(desc) >= 8 {
+			prType := p.order.Uint32(desc[0:4])
+			prDatasz := int(p.order.Uint32(desc[4:8]))
+			if 8+prDatasz > len(desc) {
+				break
+			}
+			data := desc[8 : 8+prDatasz]
+
+			if prDatasz >= 4 {
+				bits := p.order.Uint32(data)
+				switch prType {
+				case GNU_PROPERTY_X86_FEATURE_1_AND:
+					if bits&GNU_PROPERTY_X86_FEATURE_1_IBT != 0 {
+						features = append(features, "IBT")
+					}
+					if bits&GNU_PROPERTY_X86_FEATURE_1_SHSTK != 0 {
+						features = append(features, "SHSTK")
+					}
+				case GNU_PROPERTY_AARCH64_FEATURE_1_AND:
+					if bits&GNU_PROPERTY_AARCH64_FEATURE_1_BTI != 0 {
+						features = append(features, "BTI")
+					}
+					if bits&GNU_PROPERTY_AARCH64_FEATURE_1_PAC != 0 {
+						features = append(features, "PAC")
+					}
+				}
+			}
+
+			// property entries are padded to 8 bytes in ELF64
+			desc = desc[alignUp(int64(8+prDatasz), 8):]
+		}
+	}
+	return features
+}
+
+func (c Checksec) String() string {
+	canary := "No canary found"
+	if c.Canary {
+		canary = "Canary found"
+	}
+	nx := "NX disabled"
+	if c.NX {
+		nx = "NX enabled"
+	}
+	rpath := "No RPATH"
+	if c.RPATH != "" {
+		rpath = "RPATH"
+	}
+	runpath := "No RUNPATH"
+	if c.RUNPATH != "" {
+		runpath = "RUNPATH"
+	}
+	symbols := "Symbols"
+	if c.Stripped {
+		symbols = "No Symbols"
+	}
+	fortify := "No"
+	if c.Fortify {
+		fortify = "Yes"
+	}
+	cet := "No CET"
+	if len(c.CET) != 0 {
+		cet = strings.Join(c.CET, ",")
+	}
+
+	builder := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(builder, "%-15s", c.RELRO)
+	fmt.Fprintf(builder, "%-17s", canary)
+	fmt.Fprintf(builder, "%-13s", nx)
+	fmt.Fprintf(builder, "%-18s", c.PIE)
+	fmt.Fprintf(builder, "%-10s", rpath)
+	fmt.Fprintf(builder, "%-12s", runpath)
+	fmt.Fprintf(builder, "%-12s", symbols)
+	fmt.Fprintf(builder, "%-9s", fortify)
+	fmt.Fprintf(builder, "%-11d", len(c.Fortified))
+	fmt.Fprintf(builder, "%-12s", cet)
+	fmt.Fprintf(builder, "%s", c.File)
+	return builder.String()
+}
+
+func runChecksec(args []string) error {
+	asJson := false
+	paths := []string{}
+	for _, arg := range args {
+		switch arg {
+		case "--json":
+			asJson = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+
+	results := []*Checksec{}
+	for _, path := range paths {
+		c, err := checksecFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			continue
+		}
+		results = append(results, c)
+	}
+
+	if asJson {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	fmt.Println("RELRO          STACK CANARY     NX           PIE               RPATH     RUNPATH     Symbols     FORTIFY  Fortified  CET         FILE")
+	for _, c := range results {
+		fmt.Println(c)
+	}
+	return nil
+}
+
+func checksecFile(path string) (*Checksec, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	parser, err := LoadData(file)
+	if err != nil {
+		return nil, err
+	}
+	c := parser.GetChecksec()
+	c.File = path
+	return c, nil
+}
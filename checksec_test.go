@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestChecksec(t *testing.T) {
+	program := fixtureLink{interp: "/lib64/ld-linux-x86-64.so.2", needed: []string{"libc.so.6"},
+		imports: []fixtureSymbol{{name: "puts", bind: STB_GLOBAL, typ: STT_FUNC}}}
+	// edit copies the link description so the cases do not share slices
+	edit := func(change func(l *fixtureLink)) fixtureLink {
+		l := program
+		l.imports = append([]fixtureSymbol{}, program.imports...)
+		change(&l)
+		return l
+	}
+	nowFlags := []Elf64Dyn{{D_tag: DT_FLAGS, D_val: DF_BIND_NOW}, {D_tag: DT_FLAGS_1, D_val: DF_1_NOW | DF_1_PIE}}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		check func(c *Checksec) bool
+	}{
+		{"no RELRO", fixtureExec(binary.LittleEndian, EM_X86_64, false).Bytes(),
+			func(c *Checksec) bool { return c.RELRO == "No RELRO" }},
+		{"partial RELRO", fixtureDynamic(ET_DYN, program).Bytes(),
+			func(c *Checksec) bool { return c.RELRO == "Partial RELRO" }},
+		{"full RELRO by DT_FLAGS", fixtureDynamic(ET_DYN, edit(func(l *fixtureLink) { l.dyns = nowFlags[:1] })).Bytes(),
+			func(c *Checksec) bool { return c.RELRO == "Full RELRO" }},
+		{"full RELRO by DT_BIND_NOW", fixtureDynamic(ET_DYN, edit(func(l *fixtureLink) { l.dyns = []Elf64Dyn{{D_tag: DT_BIND_NOW}} })).Bytes(),
+			func(c *Checksec) bool { return c.RELRO == "Full RELRO" }},
+		{"full RELRO by DT_FLAGS_1", fixtureDynamic(ET_DYN, edit(func(l *fixtureLink) { l.dyns = nowFlags[1:] })).Bytes(),
+			func(c *Checksec) bool { return c.RELRO == "Full RELRO" && c.PIE == "PIE enabled" }},
+		{"ET_EXEC", fixtureDynamic(ET_EXEC, program).Bytes(),
+			func(c *Checksec) bool { return c.PIE == "No PIE" }},
+		// without DF_1_PIE an ET_DYN with an interpreter is still a program
+		{"PIE", fixtureDynamic(ET_DYN, program).Bytes(),
+			func(c *Checksec) bool { return c.PIE == "PIE enabled" }},
+		{"DSO", fixtureShared().Bytes(),
+			func(c *Checksec) bool { return c.PIE == "DSO" }},
+		{"REL", fixtureRelocatable().Bytes(),
+			func(c *Checksec) bool { return c.PIE == "REL" }},
+		{"NX", fixtureDynamic(ET_DYN, program).Bytes(),
+			func(c *Checksec) bool { return c.NX }},
+		{"no canary", fixtureDynamic(ET_DYN, program).Bytes(),
+			func(c *Checksec) bool { return !c.Canary && !c.Fortify && len(c.Fortified) == 0 }},
+		{"canary", fixtureDynamic(ET_DYN, edit(func(l *fixtureLink) {
+			l.imports = append(l.imports, fixtureSymbol{name: "__stack_chk_fail", bind: STB_GLOBAL, typ: STT_FUNC})
+		})).Bytes(),
+			func(c *Checksec) bool { return c.Canary }},
+		{"FORTIFY", fixtureDynamic(ET_DYN, edit(func(l *fixtureLink) {
+			l.imports = append(l.imports, fixtureSymbol{name: "__printf_chk", bind: STB_GLOBAL, typ: STT_FUNC},
+				fixtureSymbol{name: "__memcpy_chk", bind: STB_GLOBAL, typ: STT_FUNC})
+		})).Bytes(),
+			func(c *Checksec) bool {
+				return c.Fortify && reflect.DeepEqual(c.Fortified, []string{"__memcpy_chk", "__printf_chk"})
+			}},
+		// a library that implements a checked function does not use it
+		{"FORTIFY provider", fixtureDynamic(ET_DYN, edit(func(l *fixtureLink) {
+			l.exports = []fixtureSymbol{{name: "__printf_chk", bind: STB_GLOBAL, typ: STT_FUNC, size: 9}}
+		})).Bytes(),
+			func(c *Checksec) bool { return !c.Fortify }},
+		{"RPATH", fixtureDynamic(ET_DYN, edit(func(l *fixtureLink) { l.rpath = "/opt/lib:$ORIGIN/../lib" })).Bytes(),
+			func(c *Checksec) bool { return c.RPATH == "/opt/lib:$ORIGIN/../lib" && c.RUNPATH == "" }},
+		{"RUNPATH", fixtureDynamic(ET_DYN, edit(func(l *fixtureLink) { l.runpath = "$ORIGIN" })).Bytes(),
+			func(c *Checksec) bool { return c.RPATH == "" && c.RUNPATH == "$ORIGIN" }},
+		{"stripped", fixtureExec(binary.LittleEndian, EM_X86_64, true).Bytes(),
+			func(c *Checksec) bool { return c.Stripped }},
+		{"symbols", fixtureExec(binary.LittleEndian, EM_X86_64, false).Bytes(),
+			func(c *Checksec) bool { return !c.Stripped }},
+	}
+	for _, test := range tests {
+		p, err := LoadData(bytes.NewReader(test.data))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if c := p.GetChecksec(); !test.check(c) {
+			t.Errorf("%s: %+v", test.name, *c)
+		}
+	}
+}
+
+/* the loader gives a program without PT_GNU_STACK, or with an executable one, an executable stack */
+func TestChecksecExecStack(t *testing.T) {
+	data := fixtureDynamic(ET_DYN, fixtureLink{interp: "/lib/ld.so"}).Bytes()
+	e := loadElfFile(t, data)
+	for _, phdr := range e.phdrs {
+		if phdr.P_type == PT_GNU_STACK {
+			phdr.P_flags |= PF_X
+		}
+	}
+	if c := writeAndLoad(t, e).GetChecksec(); c.NX {
+		t.Errorf("an executable PT_GNU_STACK reported NX")
+	}
+
+	e = loadElfFile(t, data)
+	for _, phdr := range e.phdrs {
+		if phdr.P_type == PT_GNU_STACK {
+			phdr.P_type = PT_NULL
+		}
+	}
+	if c := writeAndLoad(t, e).GetChecksec(); c.NX {
+		t.Errorf("a file without PT_GNU_STACK reported NX")
+	}
+}
@@ -22,6 +22,14 @@ const (
 	SELFMAG = 4
 )
 
+/* Archive files start with the ARMAG identifying string, thin archives with THINMAG.  */
+const (
+	ARMAG   = "!<arch>\n" /* String that begins an archive file.  */
+	THINMAG = "!<thin>\n" /* String that begins a thin archive file.  */
+	SARMAG  = 8           /* Size of that string.  */
+	ARFMAG  = "`\n"       /* String in ar_fmag at end of each header.  */
+)
+
 /* File class byte index */
 const EI_CLASS = 4
 const (
@@ -54,6 +62,10 @@ var ei_data = map[Elf_UChar]string{
 
 /* File version byte index */
 const EI_VERSION = 6
+const (
+	EV_NONE    = 0 /* Invalid ELF version */
+	EV_CURRENT = 1 /* Current version */
+)
 
 /* OS ABI identification */
 const EI_OSABI = 7
@@ -315,6 +327,8 @@ const (
 
 	EM_BPF  = 247 /* Linux BPF -- in-kernel virtual machine */
 	EM_CSKY = 252 /* C-SKY */
+
+	EM_LOONGARCH = 258 /* LoongArch */
 )
 
 var e_machine = map[Elf64_Half]string{
@@ -498,6 +512,7 @@ var e_machine = map[Elf64_Half]string{
 	EM_RISCV:         "RISC-V",
 	EM_BPF:           "Linux BPF -- in-kernel virtual machine",
 	EM_CSKY:          "C-SKY",
+	EM_LOONGARCH:     "LoongArch",
 }
 
 /* Program segment header.  */
@@ -518,6 +533,9 @@ const (
 	PT_GNU_STACK    = 0x6474e551 /* Indicates stack executability */
 	PT_GNU_RELRO    = 0x6474e552 /* Read-only after relocation */
 	PT_GNU_PROPERTY = 0x6474e553 /* GNU property */
+	PT_GNU_SFRAME   = 0x6474e554 /* SFrame segment */
+	PT_GNU_MBIND_LO = 0x6474e555 /* Memory binding segments */
+	PT_GNU_MBIND_HI = 0x6474f554
 	PT_LOSUNW       = 0x6ffffffa /* Reserved for Sun-specific semantics */
 	PT_SUNWBSS      = 0x6ffffffa /* Sun Specific segment */
 	PT_SUNWSTACK    = 0x6ffffffb /* Stack segment */
@@ -592,6 +610,13 @@ const (
 	SHT_GROUP         = 17 /* Section contains a section group */
 	SHT_SYMTAB_SHNDX  = 18 /* Indices for SHN_XINDEX entries */
 	SHT_RELR          = 19 /* RELR relative relocations */
+
+	SHT_GNU_ATTRIBUTES = 0x6ffffff5 /* Object attributes.  */
+	SHT_GNU_HASH       = 0x6ffffff6 /* GNU-style hash table.  */
+	SHT_GNU_LIBLIST    = 0x6ffffff7 /* Prelink library list */
+	SHT_GNU_verdef     = 0x6ffffffd /* Version definition section.  */
+	SHT_GNU_verneed    = 0x6ffffffe /* Version needs section.  */
+	SHT_GNU_versym     = 0x6fffffff /* Version symbol table.  */
 )
 
 var sh_type = map[Elf64_Word]string{
@@ -613,6 +638,13 @@ var sh_type = map[Elf64_Word]string{
 	SHT_GROUP:         "GROUP",
 	SHT_SYMTAB_SHNDX:  "SYMTAB_SHNDX",
 	SHT_RELR:          "RELR",
+
+	SHT_GNU_ATTRIBUTES: "GNU_ATTRIBUTES",
+	SHT_GNU_HASH:       "GNU_HASH",
+	SHT_GNU_LIBLIST:    "GNU_LIBLIST",
+	SHT_GNU_verdef:     "VERDEF",
+	SHT_GNU_verneed:    "VERNEED",
+	SHT_GNU_versym:     "VERSYM",
 }
 
 /* Legal values for sh_flags (section flags).  */
@@ -628,6 +660,14 @@ const (
 	SHF_GROUP            = (1 << 9)  /* Section is member of a group.  */
 	SHF_TLS              = (1 << 10) /* Section hold thread-local data.  */
 	SHF_COMPRESSED       = (1 << 11) /* Section with compressed data. */
+	SHF_EXCLUDE          = (1 << 31) /* Section is excluded unless referenced or allocated (Solaris).*/
+
+	SHF_MASKOS     = 0x0ff00000 /* OS-specific.  */
+	SHF_MASKPROC   = 0xf0000000 /* Processor-specific */
+	SHF_GNU_RETAIN = (1 << 21)  /* Not to be GCed by linker.  */
+	SHF_GNU_MBIND  = (1 << 24)  /* Memory binding.  */
+
+	SHF_X86_64_LARGE = 0x10000000 /* x86-64 section beyond the 2GB medium model range */
 )
 
 func getSectionFlags(sh_flags Elf64_XWord) string {
@@ -666,9 +706,15 @@ func getSectionFlags(sh_flags Elf64_XWord) string {
 	if sh_flags&SHF_COMPRESSED != 0 {
 		flags += "C"
 	}
+	if sh_flags&SHF_EXCLUDE != 0 {
+		flags += "E"
+	}
 	return flags
 }
 
+/* Section group flags.  */
+const GRP_COMDAT = 0x1 /* Mark group as COMDAT.  */
+
 /* Symbol Table */
 
 /* Legal values for ST_BIND subfield of st_info (symbol binding).  */
@@ -740,10 +786,17 @@ var sym_vis = map[Elf_UChar]string{
 
 /* Special section indices.  */
 const (
-	SHN_UNDEF  = 0      /* Undefined section */
-	SHN_ABS    = 0xfff1 /* Associated symbol is absolute */
-	SHN_COMMON = 0xfff2 /* Associated symbol is common */
-	SHN_XINDEX = 0xffff /* Index is in extra table.  */
+	SHN_UNDEF     = 0      /* Undefined section */
+	SHN_LORESERVE = 0xff00 /* Start of reserved indices */
+	SHN_LOPROC    = 0xff00 /* Start of processor-specific */
+	SHN_HIPROC    = 0xff1f /* End of processor-specific */
+	SHN_LOOS      = 0xff20 /* Start of OS-specific */
+	SHN_HIOS      = 0xff3f /* End of OS-specific */
+	SHN_ABS       = 0xfff1 /* Associated symbol is absolute */
+	SHN_COMMON    = 0xfff2 /* Associated symbol is common */
+	SHN_XINDEX    = 0xffff /* Index is in extra table.  */
+
+	SHN_X86_64_LCOMMON = 0xff02 /* x86-64 large common symbols */
 )
 
 var sym_idx = map[Elf64_Half]string{
@@ -752,3 +805,404 @@ var sym_idx = map[Elf64_Half]string{
 	SHN_COMMON: "COM",
 	// SHN_XINDEX: "COM",
 }
+
+/* Relocations */
+
+/* Copy relocations, which copy the initial value of a shared object's data symbol into the executable.  */
+const (
+	R_X86_64_COPY  = 5    /* Copy symbol at runtime */
+	R_AARCH64_COPY = 1024 /* Copy symbol at runtime */
+	R_PPC64_COPY   = 19   /* Copy symbol at runtime */
+	R_390_COPY     = 9    /* Copy symbol at runtime */
+	R_SPARC_COPY   = 19   /* Copy symbol at runtime */
+	R_RISCV_COPY   = 4    /* Copy symbol at runtime */
+	R_LARCH_COPY   = 4    /* Copy symbol at runtime */
+)
+
+var r_copy = map[Elf64_Half]uint32{
+	EM_X86_64:    R_X86_64_COPY,
+	EM_AARCH64:   R_AARCH64_COPY,
+	EM_PPC64:     R_PPC64_COPY,
+	EM_S390:      R_390_COPY,
+	EM_SPARCV9:   R_SPARC_COPY,
+	EM_RISCV:     R_RISCV_COPY,
+	EM_LOONGARCH: R_LARCH_COPY,
+}
+
+/* Dynamic section */
+
+/* Legal values for d_tag (dynamic entry type).  */
+const (
+	DT_NULL            = 0          /* Marks end of dynamic section */
+	DT_NEEDED          = 1          /* Name of needed library */
+	DT_PLTRELSZ        = 2          /* Size in bytes of PLT relocs */
+	DT_PLTGOT          = 3          /* Processor defined value */
+	DT_HASH            = 4          /* Address of symbol hash table */
+	DT_STRTAB          = 5          /* Address of string table */
+	DT_SYMTAB          = 6          /* Address of symbol table */
+	DT_RELA            = 7          /* Address of Rela relocs */
+	DT_RELASZ          = 8          /* Total size of Rela relocs */
+	DT_RELAENT         = 9          /* Size of one Rela reloc */
+	DT_STRSZ           = 10         /* Size of string table */
+	DT_SYMENT          = 11         /* Size of one symbol table entry */
+	DT_INIT            = 12         /* Address of init function */
+	DT_FINI            = 13         /* Address of termination function */
+	DT_SONAME          = 14         /* Name of shared object */
+	DT_RPATH           = 15         /* Library search path (deprecated) */
+	DT_SYMBOLIC        = 16         /* Start symbol search here */
+	DT_REL             = 17         /* Address of Rel relocs */
+	DT_RELSZ           = 18         /* Total size of Rel relocs */
+	DT_RELENT          = 19         /* Size of one Rel reloc */
+	DT_PLTREL          = 20         /* Type of reloc in PLT */
+	DT_DEBUG           = 21         /* For debugging; unspecified */
+	DT_TEXTREL         = 22         /* Reloc might modify .text */
+	DT_JMPREL          = 23         /* Address of PLT relocs */
+	DT_BIND_NOW        = 24         /* Process relocations of object */
+	DT_INIT_ARRAY      = 25         /* Array with addresses of init fct */
+	DT_FINI_ARRAY      = 26         /* Array with addresses of fini fct */
+	DT_INIT_ARRAYSZ    = 27         /* Size in bytes of DT_INIT_ARRAY */
+	DT_FINI_ARRAYSZ    = 28         /* Size in bytes of DT_FINI_ARRAY */
+	DT_RUNPATH         = 29         /* Library search path */
+	DT_FLAGS           = 30         /* Flags for the object being loaded */
+	DT_PREINIT_ARRAY   = 32         /* Array with addresses of preinit fct*/
+	DT_PREINIT_ARRAYSZ = 33         /* size in bytes of DT_PREINIT_ARRAY */
+	DT_SYMTAB_SHNDX    = 34         /* Address of SYMTAB_SHNDX section */
+	DT_RELRSZ          = 35         /* Total size of RELR relative relocations */
+	DT_RELR            = 36         /* Address of RELR relative relocations */
+	DT_RELRENT         = 37         /* Size of one RELR relative relocaction */
+	DT_GNU_HASH        = 0x6ffffef5 /* GNU-style hash table.  */
+	DT_VERSYM          = 0x6ffffff0
+	DT_RELACOUNT       = 0x6ffffff9
+	DT_RELCOUNT        = 0x6ffffffa
+	DT_FLAGS_1         = 0x6ffffffb /* State flags, see DF_1_* below.  */
+	DT_VERDEF          = 0x6ffffffc /* Address of version definition table */
+	DT_VERDEFNUM       = 0x6ffffffd /* Number of version definitions */
+	DT_VERNEED         = 0x6ffffffe /* Address of table with needed versions */
+	DT_VERNEEDNUM      = 0x6fffffff /* Number of needed versions */
+	DT_AUXILIARY       = 0x7ffffffd /* Shared object to load before self */
+	DT_FILTER          = 0x7fffffff /* Shared object to get values from */
+)
+
+var d_tag = map[Elf64_SXWord]string{
+	DT_NULL:            "NULL",
+	DT_NEEDED:          "NEEDED",
+	DT_PLTRELSZ:        "PLTRELSZ",
+	DT_PLTGOT:          "PLTGOT",
+	DT_HASH:            "HASH",
+	DT_STRTAB:          "STRTAB",
+	DT_SYMTAB:          "SYMTAB",
+	DT_RELA:            "RELA",
+	DT_RELASZ:          "RELASZ",
+	DT_RELAENT:         "RELAENT",
+	DT_STRSZ:           "STRSZ",
+	DT_SYMENT:          "SYMENT",
+	DT_INIT:            "INIT",
+	DT_FINI:            "FINI",
+	DT_SONAME:          "SONAME",
+	DT_RPATH:           "RPATH",
+	DT_SYMBOLIC:        "SYMBOLIC",
+	DT_REL:             "REL",
+	DT_RELSZ:           "RELSZ",
+	DT_RELENT:          "RELENT",
+	DT_PLTREL:          "PLTREL",
+	DT_DEBUG:           "DEBUG",
+	DT_TEXTREL:         "TEXTREL",
+	DT_JMPREL:          "JMPREL",
+	DT_BIND_NOW:        "BIND_NOW",
+	DT_INIT_ARRAY:      "INIT_ARRAY",
+	DT_FINI_ARRAY:      "FINI_ARRAY",
+	DT_INIT_ARRAYSZ:    "INIT_ARRAYSZ",
+	DT_FINI_ARRAYSZ:    "FINI_ARRAYSZ",
+	DT_RUNPATH:         "RUNPATH",
+	DT_FLAGS:           "FLAGS",
+	DT_PREINIT_ARRAY:   "PREINIT_ARRAY",
+	DT_PREINIT_ARRAYSZ: "PREINIT_ARRAYSZ",
+	DT_SYMTAB_SHNDX:    "SYMTAB_SHNDX",
+	DT_RELRSZ:          "RELRSZ",
+	DT_RELR:            "RELR",
+	DT_RELRENT:         "RELRENT",
+	DT_GNU_HASH:        "GNU_HASH",
+	DT_VERSYM:          "VERSYM",
+	DT_RELACOUNT:       "RELACOUNT",
+	DT_RELCOUNT:        "RELCOUNT",
+	DT_FLAGS_1:         "FLAGS_1",
+	DT_VERDEF:          "VERDEF",
+	DT_VERDEFNUM:       "VERDEFNUM",
+	DT_VERNEED:         "VERNEED",
+	DT_VERNEEDNUM:      "VERNEEDNUM",
+	DT_AUXILIARY:       "AUXILIARY",
+	DT_FILTER:          "FILTER",
+}
+
+/* Values of `d_un.d_val' in the DT_FLAGS entry.  */
+const (
+	DF_ORIGIN     = 0x00000001 /* Object may use DF_ORIGIN */
+	DF_SYMBOLIC   = 0x00000002 /* Symbol resolutions starts here */
+	DF_TEXTREL    = 0x00000004 /* Object contains text relocations */
+	DF_BIND_NOW   = 0x00000008 /* No lazy binding for this object */
+	DF_STATIC_TLS = 0x00000010 /* Module uses the static TLS model */
+)
+
+/* State flags selectable in the `d_un.d_val' element of the DT_FLAGS_1 entry.  */
+const (
+	DF_1_NOW    = 0x00000001 /* Set RTLD_NOW for this object.  */
+	DF_1_GLOBAL = 0x00000002 /* Set RTLD_GLOBAL for this object.  */
+	DF_1_NODEL  = 0x00000008 /* Set RTLD_NODELETE for this object.*/
+	DF_1_ORIGIN = 0x00000080 /* $ORIGIN must be handled.  */
+	DF_1_PIE    = 0x08000000 /* Object is a position-independent executable.  */
+)
+
+/* Notes */
+
+/* Legal values for note segment descriptor types for object files.  */
+const (
+	NT_GNU_ABI_TAG         = 1 /* ABI information */
+	NT_GNU_HWCAP           = 2 /* Synthetic hwcap information */
+	NT_GNU_BUILD_ID        = 3 /* Build ID bits as generated by ld --build-id */
+	NT_GNU_GOLD_VERSION    = 4 /* Version note generated by GNU gold */
+	NT_GNU_PROPERTY_TYPE_0 = 5 /* Program property */
+)
+
+/* Values used in GNU .note.gnu.property notes (NT_GNU_PROPERTY_TYPE_0).  */
+const (
+	GNU_PROPERTY_STACK_SIZE            = 1
+	GNU_PROPERTY_NO_COPY_ON_PROTECTED  = 2
+	GNU_PROPERTY_AARCH64_FEATURE_1_AND = 0xc0000000
+	GNU_PROPERTY_X86_FEATURE_1_AND     = 0xc0000002
+)
+
+/* Bits in GNU_PROPERTY_X86_FEATURE_1_AND.  */
+const (
+	GNU_PROPERTY_X86_FEATURE_1_IBT   = (1 << 0) /* Indirect branch tracking */
+	GNU_PROPERTY_X86_FEATURE_1_SHSTK = (1 << 1) /* Shadow stack */
+)
+
+/* Bits in GNU_PROPERTY_AARCH64_FEATURE_1_AND.  */
+const (
+	GNU_PROPERTY_AARCH64_FEATURE_1_BTI = (1 << 0) /* Branch target identification */
+	GNU_PROPERTY_AARCH64_FEATURE_1_PAC = (1 << 1) /* Pointer authentication */
+)
+
+/* Symbol versioning */
+
+/* Special version indices in the .gnu.version (versym) section.  */
+const (
+	VER_NDX_LOCAL     = 0      /* Symbol is local.  */
+	VER_NDX_GLOBAL    = 1      /* Symbol is global.  */
+	VER_NDX_LORESERVE = 0xff00 /* Beginning of reserved entries.  */
+	VER_NDX_ELIMINATE = 0xff01 /* Symbol is to be eliminated.  */
+	VERSYM_HIDDEN     = 0x8000 /* Hidden bit in versym entries. */
+	VERSYM_VERSION    = 0x7fff /* Version index mask. */
+)
+
+/* Legal values for vd_flags and vna_flags (version information flags).  */
+const (
+	VER_FLG_BASE = 0x1 /* Version definition of file itself */
+	VER_FLG_WEAK = 0x2 /* Weak version identifier */
+)
+
+/* Legal values for note segment descriptor types for core files. */
+const (
+	NT_PRSTATUS     = 1          /* Contains copy of prstatus struct */
+	NT_PRFPREG      = 2          /* Contains copy of fpregset struct */
+	NT_PRPSINFO     = 3          /* Contains copy of prpsinfo struct */
+	NT_TASKSTRUCT   = 4          /* Contains copy of task structure */
+	NT_AUXV         = 6          /* Contains copy of auxv array */
+	NT_SIGINFO      = 0x53494749 /* Contains copy of siginfo_t, size might increase */
+	NT_FILE         = 0x46494c45 /* Contains information about mapped files */
+	NT_X86_XSTATE   = 0x202      /* x86 extended state using xsave */
+	NT_ARM_TLS      = 0x401      /* ARM TLS register */
+	NT_ARM_PAC_MASK = 0x406      /* ARM pointer authentication code masks */
+)
+
+var nt_core_type = map[Elf64_Word]string{
+	NT_PRSTATUS:     "NT_PRSTATUS (prstatus structure)",
+	NT_PRFPREG:      "NT_FPREGSET (floating point registers)",
+	NT_PRPSINFO:     "NT_PRPSINFO (prpsinfo structure)",
+	NT_TASKSTRUCT:   "NT_TASKSTRUCT (task structure)",
+	NT_AUXV:         "NT_AUXV (auxiliary vector)",
+	NT_SIGINFO:      "NT_SIGINFO (siginfo_t data)",
+	NT_FILE:         "NT_FILE (mapped files)",
+	NT_X86_XSTATE:   "NT_X86_XSTATE (x86 XSAVE extended state)",
+	NT_ARM_TLS:      "NT_ARM_TLS (AArch TLS registers)",
+	NT_ARM_PAC_MASK: "NT_ARM_PAC_MASK (AArch pointer authentication code masks)",
+}
+
+/* Legal values for a_type (entry type) of the auxiliary vector.  */
+const (
+	AT_NULL          = 0  /* End of vector */
+	AT_IGNORE        = 1  /* Entry should be ignored */
+	AT_EXECFD        = 2  /* File descriptor of program */
+	AT_PHDR          = 3  /* Program headers for program */
+	AT_PHENT         = 4  /* Size of program header entry */
+	AT_PHNUM         = 5  /* Number of program headers */
+	AT_PAGESZ        = 6  /* System page size */
+	AT_BASE          = 7  /* Base address of interpreter */
+	AT_FLAGS         = 8  /* Flags */
+	AT_ENTRY         = 9  /* Entry point of program */
+	AT_NOTELF        = 10 /* Program is not ELF */
+	AT_UID           = 11 /* Real uid */
+	AT_EUID          = 12 /* Effective uid */
+	AT_GID           = 13 /* Real gid */
+	AT_EGID          = 14 /* Effective gid */
+	AT_CLKTCK        = 17 /* Frequency of times() */
+	AT_PLATFORM      = 15 /* String identifying platform.  */
+	AT_HWCAP         = 16 /* Machine-dependent hints about processor capabilities.  */
+	AT_SECURE        = 23 /* Boolean, was exec setuid-like?  */
+	AT_BASE_PLATFORM = 24 /* String identifying real platforms.*/
+	AT_RANDOM        = 25 /* Address of 16 random bytes.  */
+	AT_HWCAP2        = 26 /* More machine-dependent hints about processor capabilities.  */
+	AT_EXECFN        = 31 /* Filename of executable.  */
+	AT_SYSINFO       = 32
+	AT_SYSINFO_EHDR  = 33 /* Address of the vDSO */
+	AT_MINSIGSTKSZ   = 51 /* Minimal stack size for signal delivery.  */
+)
+
+var at_type = map[Elf64_XWord]string{
+	AT_NULL:          "AT_NULL",
+	AT_IGNORE:        "AT_IGNORE",
+	AT_EXECFD:        "AT_EXECFD",
+	AT_PHDR:          "AT_PHDR",
+	AT_PHENT:         "AT_PHENT",
+	AT_PHNUM:         "AT_PHNUM",
+	AT_PAGESZ:        "AT_PAGESZ",
+	AT_BASE:          "AT_BASE",
+	AT_FLAGS:         "AT_FLAGS",
+	AT_ENTRY:         "AT_ENTRY",
+	AT_NOTELF:        "AT_NOTELF",
+	AT_UID:           "AT_UID",
+	AT_EUID:          "AT_EUID",
+	AT_GID:           "AT_GID",
+	AT_EGID:          "AT_EGID",
+	AT_CLKTCK:        "AT_CLKTCK",
+	AT_PLATFORM:      "AT_PLATFORM",
+	AT_HWCAP:         "AT_HWCAP",
+	AT_SECURE:        "AT_SECURE",
+	AT_BASE_PLATFORM: "AT_BASE_PLATFORM",
+	AT_RANDOM:        "AT_RANDOM",
+	AT_HWCAP2:        "AT_HWCAP2",
+	AT_EXECFN:        "AT_EXECFN",
+	AT_SYSINFO:       "AT_SYSINFO",
+	AT_SYSINFO_EHDR:  "AT_SYSINFO_EHDR",
+	AT_MINSIGSTKSZ:   "AT_MINSIGSTKSZ",
+}
+
+/* Register names of the general purpose register set in NT_PRSTATUS, in user_regs_struct order.  */
+var x86_64_regs = []string{
+	"r15", "r14", "r13", "r12", "rbp", "rbx", "r11", "r10", "r9", "r8",
+	"rax", "rcx", "rdx", "rsi", "rdi", "orig_rax", "rip", "cs", "eflags", "rsp",
+	"ss", "fs_base", "gs_base", "ds", "es", "fs", "gs",
+}
+
+var aarch64_regs = []string{
+	"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9",
+	"x10", "x11", "x12", "x13", "x14", "x15", "x16", "x17", "x18", "x19",
+	"x20", "x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28", "x29",
+	"x30", "sp", "pc", "pstate",
+}
+
+/* The index in the NT_PRSTATUS register set of each DWARF register number, as .eh_frame names them.  */
+var x86_64_dwarf_regs = []int{10, 12, 11, 5, 13, 14, 4, 19, 9, 8, 7, 6, 3, 2, 1, 0, 16}
+
+var aarch64_dwarf_regs = []int{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+	16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+}
+
+/* Call frame information */
+
+/* Pointer encodings in .eh_frame and .eh_frame_hdr, the low nibble is the format and the high one how it applies.  */
+const (
+	DW_EH_PE_absptr  = 0x00 /* Pointer sized unsigned value */
+	DW_EH_PE_uleb128 = 0x01 /* Unsigned LE base-128 value */
+	DW_EH_PE_udata2  = 0x02 /* Unsigned 16-bit value */
+	DW_EH_PE_udata4  = 0x03 /* Unsigned 32-bit value */
+	DW_EH_PE_udata8  = 0x04 /* Unsigned 64-bit value */
+	DW_EH_PE_sleb128 = 0x09 /* Signed LE base-128 value */
+	DW_EH_PE_sdata2  = 0x0a /* Signed 16-bit value */
+	DW_EH_PE_sdata4  = 0x0b /* Signed 32-bit value */
+	DW_EH_PE_sdata8  = 0x0c /* Signed 64-bit value */
+	DW_EH_PE_pcrel   = 0x10 /* Relative to the address of the value */
+	DW_EH_PE_datarel = 0x30 /* Relative to the start of .eh_frame_hdr */
+	DW_EH_PE_omit    = 0xff /* No value */
+)
+
+/* Call frame instructions, the first three keep their operand in the low 6 bits.  */
+const (
+	DW_CFA_advance_loc        = 0x40
+	DW_CFA_offset             = 0x80
+	DW_CFA_restore            = 0xc0
+	DW_CFA_nop                = 0x00
+	DW_CFA_set_loc            = 0x01
+	DW_CFA_advance_loc1       = 0x02
+	DW_CFA_advance_loc2       = 0x03
+	DW_CFA_advance_loc4       = 0x04
+	DW_CFA_offset_extended    = 0x05
+	DW_CFA_restore_extended   = 0x06
+	DW_CFA_undefined          = 0x07
+	DW_CFA_same_value         = 0x08
+	DW_CFA_register           = 0x09
+	DW_CFA_remember_state     = 0x0a
+	DW_CFA_restore_state      = 0x0b
+	DW_CFA_def_cfa            = 0x0c
+	DW_CFA_def_cfa_register   = 0x0d
+	DW_CFA_def_cfa_offset     = 0x0e
+	DW_CFA_def_cfa_expression = 0x0f
+	DW_CFA_expression         = 0x10
+	DW_CFA_offset_extended_sf = 0x11
+	DW_CFA_def_cfa_sf         = 0x12
+	DW_CFA_def_cfa_offset_sf  = 0x13
+	DW_CFA_val_offset         = 0x14
+	DW_CFA_val_offset_sf      = 0x15
+	DW_CFA_val_expression     = 0x16
+	DW_CFA_GNU_args_size      = 0x2e
+)
+
+/* DWARF expression operations, those the CFA rules of compilers and libc use.  */
+const (
+	DW_OP_deref       = 0x06
+	DW_OP_const1u     = 0x08
+	DW_OP_const1s     = 0x09
+	DW_OP_const2u     = 0x0a
+	DW_OP_const2s     = 0x0b
+	DW_OP_const4u     = 0x0c
+	DW_OP_const4s     = 0x0d
+	DW_OP_const8u     = 0x0e
+	DW_OP_const8s     = 0x0f
+	DW_OP_constu      = 0x10
+	DW_OP_consts      = 0x11
+	DW_OP_dup         = 0x12
+	DW_OP_drop        = 0x13
+	DW_OP_over        = 0x14
+	DW_OP_swap        = 0x16
+	DW_OP_and         = 0x1a
+	DW_OP_minus       = 0x1c
+	DW_OP_mul         = 0x1e
+	DW_OP_neg         = 0x1f
+	DW_OP_not         = 0x20
+	DW_OP_or          = 0x21
+	DW_OP_plus        = 0x22
+	DW_OP_plus_uconst = 0x23
+	DW_OP_shl         = 0x24
+	DW_OP_shr         = 0x25
+	DW_OP_xor         = 0x27
+	DW_OP_eq          = 0x29
+	DW_OP_ge          = 0x2a
+	DW_OP_gt          = 0x2b
+	DW_OP_le          = 0x2c
+	DW_OP_lt          = 0x2d
+	DW_OP_ne          = 0x2e
+	DW_OP_lit0        = 0x30 /* up to DW_OP_lit31, pushing 0 to 31 */
+	DW_OP_breg0       = 0x70 /* up to DW_OP_breg31, pushing a register plus an offset */
+	DW_OP_bregx       = 0x92
+)
+
+/* Signal numbers, as reported in NT_PRSTATUS and NT_SIGINFO.  */
+var signal_name = map[int32]string{
+	1: "SIGHUP", 2: "SIGINT", 3: "SIGQUIT", 4: "SIGILL", 5: "SIGTRAP", 6: "SIGABRT",
+	7: "SIGBUS", 8: "SIGFPE", 9: "SIGKILL", 10: "SIGUSR1", 11: "SIGSEGV", 12: "SIGUSR2",
+	13: "SIGPIPE", 14: "SIGALRM", 15: "SIGTERM", 16: "SIGSTKFLT", 17: "SIGCHLD",
+	18: "SIGCONT", 19: "SIGSTOP", 20: "SIGTSTP", 21: "SIGTTIN", 22: "SIGTTOU",
+	23: "SIGURG", 24: "SIGXCPU", 25: "SIGXFSZ", 26: "SIGVTALRM", 27: "SIGPROF",
+	28: "SIGWINCH", 29: "SIGIO", 30: "SIGPWR", 31: "SIGSYS",
+}
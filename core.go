@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bytes"
+	"debug/gosym"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/* a thread of the crashed process: its NT_PRSTATUS note */
+type CoreThread struct {
+	status *Elf64Prstatus
+	regs   []Elf64_XWord
+}
+
+/* an executable or shared library mapped into the process, opened to symbolize addresses */
+type CoreImage struct {
+	path   string
+	file   *os.File
+	parser *ElfParser
+	funcs  []*Elf64SymbolHeaderDesp /* defined functions sorted by address */
+	gotab  *gosym.Table             /* the function table of a Go binary, kept when stripped */
+	fdes   []*EhFde                 /* the unwind rules of .eh_frame, sorted by address */
+}
+
+/* the decoded notes of an ET_CORE file */
+type CoreParser struct {
+	parser   *ElfParser
+	threads  []*CoreThread
+	psinfo   *Elf64Prpsinfo
+	siginfo  *Elf64Siginfo
+	auxv     []*Elf64Auxv
+	pagesize Elf64_XWord
+	files    []*Elf64FileMapping
+
+	exes    map[string]string /* basename => path of the original files given by the user */
+	sysroot string
+	images  map[string]*CoreImage
+}
+
+func LoadCore(parser *ElfParser) (*CoreParser, error) {
+	if parser.ehdr.E_type != ET_CORE {
+		return nil, fmt.Errorf("error: not a core file")
+	}
+	if parser.ehdr.E_machine != EM_X86_64 && parser.ehdr.E_machine != EM_AARCH64 {
+		return nil, fmt.Errorf("error: unsupported core file machine: %s", e_machine[parser.ehdr.E_machine])
+	}
+
+	c := new(CoreParser)
+	c.parser = parser
+	c.exes = map[string]string{}
+	c.images = map[string]*CoreImage{}
+
+	for _, note := range parser.GetNotes() {
+		if note.name != "CORE" && note.name != "LINUX" {
+			continue
+		}
+		reader := bytes.NewReader(note.desc)
+
+		switch note.typ {
+		case NT_PRSTATUS:
+			thread := new(CoreThread)
+			thread.status = new(Elf64Prstatus)
+			if err := binary.Read(reader, parser.order, thread.status); err != nil {
+				return nil, fmt.Errorf("error: truncated NT_PRSTATUS note")
+			}
+			thread.regs = make([]Elf64_XWord, len(c.regNames()))
+			if err := binary.Read(reader, parser.order, thread.regs); err != nil {
+				return nil, fmt.Errorf("error: truncated NT_PRSTATUS registers")
+			}
+			c.threads = append(c.threads, thread)
+		case NT_PRPSINFO:
+			c.psinfo = new(Elf64Prpsinfo)
+			if err := binary.Read(reader, parser.order, c.psinfo); err != nil {
+				c.psinfo = nil
+			}
+		case NT_SIGINFO:
+			c.siginfo = new(Elf64Siginfo)
+			if err := binary.Read(reader, parser.order, c.siginfo); err != nil {
+				c.siginfo = nil
+			}
+		case NT_AUXV:
+			for reader.Len() >= 16 {
+				auxv := new(Elf64Auxv)
+				binary.Read(reader, parser.order, auxv)
+				c.auxv = append(c.auxv, auxv)
+				if auxv.A_type == AT_NULL {
+					break
+				}
+			}
+		case NT_FILE:
+			c.files = c.parseFileNote(note.desc)
+		}
+	}
+
+	return c, nil
+}
+
+/* NT_FILE: count, page size, count (start, end, offset) triples and then count file names */
+func (c *CoreParser) parseFileNote(desc []byte) []*Elf64FileMapping {
+	order := c.parser.order
+	if len(desc) < 16 {
+		return nil
+	}
+	count := order.Uint64(desc)
+	c.pagesize = Elf64_XWord(order.Uint64(desc[8:]))
+	if count > uint64(len(desc)-16)/24 {
+		return nil
+	}
+
+	names := strings.Split(string(desc[16+24*count:]), "\x00")
+	files := []*Elf64FileMapping{}
+	for i := uint64(0); i < count; i++ {
+		entry := desc[16+24*i:]
+		mapping := new(Elf64FileMapping)
+		mapping.start = Elf64_Addr(order.Uint64(entry))
+		mapping.end = Elf64_Addr(order.Uint64(entry[8:]))
+		mapping.offset = Elf64_XWord(order.Uint64(entry[16:]))
+		if int(i) < len(names) {
+			mapping.path = names[i]
+		}
+		files = append(files, mapping)
+	}
+	return files
+}
+
+func (c *CoreParser) regNames() []string {
+	if c.parser.ehdr.E_machine == EM_AARCH64 {
+		return aarch64_regs
+	}
+	return x86_64_regs
+}
+
+/* returns the program counter, frame pointer and stack pointer of a thread */
+func (c *CoreParser) frameRegs(thread *CoreThread) (Elf64_Addr, Elf64_Addr, Elf64_Addr) {
+	if c.parser.ehdr.E_machine == EM_AARCH64 {
+		return Elf64_Addr(thread.regs[32]), Elf64_Addr(thread.regs[29]), Elf64_Addr(thread.regs[31])
+	}
+	return Elf64_Addr(thread.regs[16]), Elf64_Addr(thread.regs[4]), Elf64_Addr(thread.regs[19])
+}
+
+/* reads process memory from the core's PT_LOAD segments, or from the mapped file when the page was not dumped */
+func (c *CoreParser) readMemory(addr Elf64_Addr, size int64) ([]byte, bool) {
+	for _, phdr := range c.parser.GetPhdrs() {
+		if phdr.P_type != PT_LOAD || addr < phdr.P_vaddr {
+			continue
+		}
+		if addr+Elf64_Addr(size) <= phdr.P_vaddr+Elf64_Addr(phdr.P_filesz) {
+			buf := make([]byte, size)
+			if _, err := c.parser.file.ReadAt(buf, int64(phdr.P_offset)+int64(addr-phdr.P_vaddr)); err != nil {
+				return nil, false
+			}
+			return buf, true
+		}
+	}
+
+	mapping := c.mappingAt(addr)
+	if mapping == nil {
+		return nil, false
+	}
+	image := c.image(mapping.path)
+	if image == nil {
+		return nil, false
+	}
+	buf := make([]byte, size)
+	offset := int64(mapping.offset*c.pagesize) + int64(addr-mapping.start)
+	if _, err := image.file.ReadAt(buf, offset); err != nil {
+		return nil, false
+	}
+	return buf, true
+}
+
+func (c *CoreParser) mappingAt(addr Elf64_Addr) *Elf64FileMapping {
+	for _, mapping := range c.files {
+		if addr >= mapping.start && addr < mapping.end {
+			return mapping
+		}
+	}
+	return nil
+}
+
+/* opens the original file of a mapping: one given with --exe, or the same path below the sysroot */
+func (c *CoreParser) image(path string) *CoreImage {
+	if image, ok := c.images[path]; ok {
+		return image
+	}
+	c.images[path] = nil
+
+	local, ok := c.exes[filepath.Base(path)]
+	if !ok {
+		local = filepath.Join(c.sysroot, path)
+	}
+	file, err := os.Open(local)
+	if err != nil {
+		return nil
+	}
+	parser, err := LoadData(file)
+	if err != nil {
+		file.Close()
+		return nil
+	}
+
+	image := &CoreImage{path: local, file: file, parser: parser}
+	for _, desp := range parser.GetSyms() {
+		typ := desp.sym.ST_info & 0xf
+		if (typ == STT_FUNC || typ == STT_GNU_IFUNC) && desp.sym.ST_shndx != SHN_UNDEF && desp.sym.ST_value != 0 {
+			image.funcs = append(image.funcs, desp)
+		}
+	}
+	sort.SliceStable(image.funcs, func(i, j int) bool {
+		return image.funcs[i].sym.ST_value < image.funcs[j].sym.ST_value
+	})
+	if parser.IsGo() {
+		image.gotab, _, _ = parser.GetGoTable()
+	}
+	image.fdes = parser.GetEhFrame()
+
+	c.images[path] = image
+	return image
+}
+
+/* the difference between the addresses of a mapped file in the process and in the file */
+func (c *CoreParser) loadBias(mapping *Elf64FileMapping, image *CoreImage) Elf64_Addr {
+	// the mapping starts at the page holding the PT_LOAD whose file offset it maps
+	pagemask := Elf64_Addr(c.pagesize - 1)
+	for _, phdr := range image.parser.GetPhdrs() {
+		if phdr.P_type == PT_LOAD && Elf64_XWord(phdr.P_offset)&^Elf64_XWord(pagemask) == mapping.offset*c.pagesize {
+			return mapping.start - phdr.P_vaddr&^pagemask
+		}
+	}
+	return 0
+}
+
+/* describes addr as function+offset (file), using the load bias of the mapping containing it */
+func (c *CoreParser) symbolize(addr Elf64_Addr) string {
+	mapping := c.mappingAt(addr)
+	if mapping == nil {
+		return "??"
+	}
+	image := c.image(mapping.path)
+	if image == nil {
+		return fmt.Sprintf("?? (%s)", mapping.path)
+	}
+
+	vaddr := addr - c.loadBias(mapping, image)
+
+	if image.gotab != nil {
+		if file, line, fn := image.gotab.PCToLine(uint64(vaddr)); fn != nil {
+			return fmt.Sprintf("%s+0x%x %s:%d (%s)", fn.Name, uint64(vaddr)-fn.Entry, file, line, mapping.path)
+		}
+	}
+	// static functions of a stripped library have no symbol, give their address in the file as backtrace_symbols
+	i := sort.Search(len(image.funcs), func(i int) bool { return image.funcs[i].sym.ST_value > vaddr }) - 1
+	if i < 0 {
+		return fmt.Sprintf("+0x%x (%s)", vaddr, mapping.path)
+	}
+	sym := image.funcs[i]
+	if sym.sym.ST_size != 0 && vaddr >= sym.sym.ST_value+Elf64_Addr(sym.sym.ST_size) {
+		return fmt.Sprintf("+0x%x (%s)", vaddr, mapping.path)
+	}
+	return fmt.Sprintf("%s+0x%x (%s)", strings.Trim(sym.name, "\x00"), vaddr-sym.sym.ST_value, mapping.path)
+}
+
+/* a frame of a backtrace */
+type CoreFrame struct {
+	pc     Elf64_Addr
+	lookup Elf64_Addr /* the address to symbolize, the call itself for a return address */
+}
+
+/* the registers of a frame by DWARF number, those that cannot be recovered are missing */
+type unwindRegs map[uint64]Elf64_Addr
+
+/*
+unwinds the stack of a thread with the .eh_frame rules of the executable and the
+libraries it maps, the frame pointer chain is followed through code without them
+*/
+func (c *CoreParser) Backtrace(thread *CoreThread) []CoreFrame {
+	pc, _, _ := c.frameRegs(thread)
+	frames := []CoreFrame{{pc, pc}}
+
+	dwarf := x86_64_dwarf_regs
+	if c.parser.ehdr.E_machine == EM_AARCH64 {
+		dwarf = aarch64_dwarf_regs
+	}
+	regs := unwindRegs{}
+	for n, i := range dwarf {
+		regs[uint64(n)] = Elf64_Addr(thread.regs[i])
+	}
+
+	// the pc of the crashed frame is the faulting instruction, the others return addresses after a call
+	// except below a signal frame, where the kernel interrupted the code
+	lookup := pc
+	for i := 0; i < 256; i++ {
+		caller, ret, fde, outermost := c.unwindCfi(regs, lookup)
+		if outermost {
+			break
+		}
+		exact := fde != nil && fde.cie.signal
+		if fde == nil {
+			if caller, ret = c.unwindFramePointer(regs); caller == nil {
+				break
+			}
+		}
+		// the stack grows down, a caller below its callee would make the walk loop
+		sp := c.spReg()
+		if ret == 0 || caller[sp] <= regs[sp] {
+			break
+		}
+		lookup = ret
+		if !exact {
+			lookup--
+		}
+		frames = append(frames, CoreFrame{ret, lookup})
+		regs = caller
+	}
+	return frames
+}
+
+/* the DWARF numbers of the stack and frame pointers */
+func (c *CoreParser) spReg() uint64 {
+	if c.parser.ehdr.E_machine == EM_AARCH64 {
+		return 31
+	}
+	return 7
+}
+
+func (c *CoreParser) fpReg() uint64 {
+	if c.parser.ehdr.E_machine == EM_AARCH64 {
+		return 29
+	}
+	return 6
+}
+
+func (c *CoreParser) readWord(addr Elf64_Addr) (Elf64_Addr, bool) {
+	buf, ok := c.readMemory(addr, 8)
+	if !ok {
+		return 0, false
+	}
+	return Elf64_Addr(c.parser.order.Uint64(buf)), true
+}
+
+/*
+recovers the caller's registers and return address with the FDE covering pc. The
+FDE is nil when there is none or its rules cannot be applied, outermost is set when
+they mark the return address undefined, as at _start and thread entry points.
+*/
+func (c *CoreParser) unwindCfi(regs unwindRegs, pc Elf64_Addr) (unwindRegs, Elf64_Addr, *EhFde, bool) {
+	mapping := c.mappingAt(pc)
+	if mapping == nil {
+		return nil, 0, nil, false
+	}
+	image := c.image(mapping.path)
+	if image == nil {
+		return nil, 0, nil, false
+	}
+	vaddr := pc - c.loadBias(mapping, image)
+	fde := findFde(image.fdes, vaddr)
+	if fde == nil {
+		return nil, 0, nil, false
+	}
+	row, ok := fde.rowAt(vaddr, image.parser.order)
+	if !ok {
+		return nil, 0, nil, false
+	}
+
+	reg := func(n uint64) (uint64, bool) {
+		value, ok := regs[n]
+		return uint64(value), ok
+	}
+	deref := func(addr uint64) (uint64, bool) {
+		value, ok := c.readWord(Elf64_Addr(addr))
+		return uint64(value), ok
+	}
+	var cfa uint64
+	if row.cfaExpr != nil {
+		cfa, ok = evalExpr(row.cfaExpr, nil, c.parser.order, reg, deref)
+	} else {
+		cfa, ok = reg(row.cfaReg)
+		cfa += uint64(row.cfaOffset)
+	}
+	if !ok {
+		return nil, 0, nil, false
+	}
+
+	caller := unwindRegs{}
+	for n, value := range regs {
+		caller[n] = value
+	}
+	caller[c.spReg()] = Elf64_Addr(cfa)
+	for n, rule := range row.rules {
+		var value uint64
+		ok := true
+		switch rule.kind {
+		case ruleUndefined:
+			if n == fde.cie.raReg {
+				return nil, 0, nil, true
+			}
+			delete(caller, n)
+			continue
+		case ruleOffset:
+			value, ok = deref(cfa + uint64(rule.offset))
+		case ruleValOffset:
+			value = cfa + uint64(rule.offset)
+		case ruleRegister:
+			value, ok = reg(rule.reg)
+		case ruleExpr, ruleValExpr:
+			value, ok = evalExpr(rule.expr, []uint64{cfa}, c.parser.order, reg, deref)
+			if ok && rule.kind == ruleExpr {
+				value, ok = deref(value)
+			}
+		}
+		if !ok {
+			delete(caller, n)
+			continue
+		}
+		caller[n] = Elf64_Addr(value)
+	}
+
+	ret, ok := caller[fde.cie.raReg]
+	if !ok {
+		return nil, 0, nil, false
+	}
+	return caller, ret, fde, false
+}
+
+/* follows the frame record the frame pointer points to: the caller's frame pointer and the return address */
+func (c *CoreParser) unwindFramePointer(regs unwindRegs) (unwindRegs, Elf64_Addr) {
+	fp, ok := regs[c.fpReg()]
+	if !ok || fp == 0 {
+		return nil, 0
+	}
+	next, ok := c.readWord(fp)
+	if !ok {
+		return nil, 0
+	}
+	ret, ok := c.readWord(fp + 8)
+	if !ok {
+		return nil, 0
+	}
+
+	// the other registers the callee saved are unknown without its unwind rules
+	caller := unwindRegs{c.fpReg(): next, c.spReg(): fp + 16}
+	return caller, ret
+}
+
+func (c *CoreParser) Close() {
+	for _, image := range c.images {
+		if image != nil {
+			image.file.Close()
+		}
+	}
+}
+
+func (c *CoreParser) PrintCore() {
+	if c.psinfo != nil {
+		fmt.Printf("Process %s (pid %d, ppid %d, uid %d, gid %d)\n",
+			cString(c.psinfo.PR_fname[:]), c.psinfo.PR_pid, c.psinfo.PR_ppid, c.psinfo.PR_uid, c.psinfo.PR_gid)
+		fmt.Printf("Command line: %s\n", cString(c.psinfo.PR_psargs[:]))
+	}
+	if c.siginfo != nil {
+		fmt.Printf("Terminated by signal %d (%s), code %d", c.siginfo.SI_signo, signal_name[c.siginfo.SI_signo], c.siginfo.SI_code)
+		switch signal_name[c.siginfo.SI_signo] {
+		case "SIGSEGV", "SIGBUS", "SIGILL", "SIGFPE":
+			fmt.Printf(", fault address 0x%x", c.siginfo.SI_addr)
+		}
+		fmt.Println()
+	}
+
+	fmt.Println("\nAuxiliary vector:")
+	for _, auxv := range c.auxv {
+		name, ok := at_type[auxv.A_type]
+		if !ok {
+			name = fmt.Sprintf("AT_%d", auxv.A_type)
+		}
+		fmt.Printf("  %-18s 0x%x\n", name, auxv.A_val)
+	}
+
+	fmt.Printf("\nMapped files (page size %d):\n", c.pagesize)
+	fmt.Println("  Start              End                Page Offset        Path")
+	for _, mapping := range c.files {
+		fmt.Printf("  0x%016x 0x%016x 0x%016x %s\n", mapping.start, mapping.end, mapping.offset, mapping.path)
+	}
+
+	names := c.regNames()
+	for i, thread := range c.threads {
+		fmt.Printf("\nThread %d (LWP %d)", i+1, thread.status.PR_pid)
+		if thread.status.PR_cursig != 0 {
+			fmt.Printf(", signal %d (%s)", thread.status.PR_cursig, signal_name[int32(thread.status.PR_cursig)])
+		}
+		fmt.Println(":")
+
+		for j, reg := range thread.regs {
+			fmt.Printf("  %-8s 0x%016x", names[j], reg)
+			if j%3 == 2 || j == len(thread.regs)-1 {
+				fmt.Println()
+			}
+		}
+
+		fmt.Println("  Backtrace:")
+		for j, frame := range c.Backtrace(thread) {
+			fmt.Printf("  #%-3d 0x%016x in %s\n", j, frame.pc, c.symbolize(frame.lookup))
+		}
+	}
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func runCore(args []string) error {
+	exes := []string{}
+	sysroot := ""
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--exe", "--sysroot":
+			if i+1 >= len(args) {
+				return usageError("elfparser: option requires an argument: %s", arg)
+			}
+			i++
+			if arg == "--exe" {
+				exes = append(exes, args[i])
+			} else {
+				sysroot = args[i]
+			}
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		parser, err := LoadData(file)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		core, err := LoadCore(parser)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		core.sysroot = sysroot
+		for _, exe := range exes {
+			core.exes[filepath.Base(exe)] = exe
+		}
+
+		fmt.Printf("Core file: %s\n", path)
+		core.PrintCore()
+		core.Close()
+		file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+/* the unwind rules of a function, named by its symbol */
+type fixtureFde struct {
+	function string
+	insns    []byte
+}
+
+/*
+adds .eh_frame with one CIE as GCC emits it on x86-64: pc-relative FDE addresses, the CFA
+at rsp+8 and the return address below it, and an FDE per function
+*/
+func (f *fixture) addEhFrame(fdes []fixtureFde) {
+	cie := []byte{1, 'z', 'R', 0, 1, 0x78, 16, 1, DW_EH_PE_pcrel | DW_EH_PE_sdata4,
+		DW_CFA_def_cfa, 7, 8, DW_CFA_offset | 16, 1}
+	entry := func(buf *bytes.Buffer, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, DW_CFA_nop)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(body)))
+		buf.Write(body)
+	}
+	build := func(addr Elf64_Addr) []byte {
+		buf := new(bytes.Buffer)
+		entry(buf, append([]byte{0, 0, 0, 0}, cie...))
+		for _, fde := range fdes {
+			var start Elf64_Addr
+			var size Elf64_XWord
+			for _, syms := range f.symbols {
+				for _, sym := range syms {
+					if sym.name == fde.function {
+						start, size = f.section(sym.section).addr+sym.value, sym.size
+					}
+				}
+			}
+			body := binary.LittleEndian.AppendUint32(nil, uint32(buf.Len()+4))
+			pc := addr + Elf64_Addr(buf.Len()+8)
+			body = binary.LittleEndian.AppendUint32(body, uint32(start-pc))
+			body = binary.LittleEndian.AppendUint32(body, uint32(size))
+			entry(buf, append(append(body, 0), fde.insns...))
+		}
+		return append(buf.Bytes(), 0, 0, 0, 0)
+	}
+	f.add(&fixtureSection{name: ".eh_frame", typ: SHT_PROGBITS, flags: SHF_ALLOC, align: 8, data: build(0),
+		fill: func(f *fixture) []byte { return build(f.section(".eh_frame").addr) }})
+}
+
+/* a core file with a PT_NOTE segment holding notes and a PT_LOAD segment per dumped memory range */
+func fixtureCore(notes []*Elf64NoteDesp, memory map[Elf64_Addr][]byte) []byte {
+	note := new(bytes.Buffer)
+	for _, n := range notes {
+		binary.Write(note, binary.LittleEndian, Elf64Nhdr{N_namesz: Elf64_Word(len(n.name) + 1), N_descsz: Elf64_Word(len(n.desc)), N_type: n.typ})
+		note.WriteString(n.name + "\x00")
+		note.Write(make([]byte, alignUp(int64(note.Len()), 4)-int64(note.Len())))
+		note.Write(n.desc)
+		note.Write(make([]byte, alignUp(int64(note.Len()), 4)-int64(note.Len())))
+	}
+
+	ehsize := binary.Size(Elf64Header{})
+	phentsize := binary.Size(Elf64ProgramHeader{})
+	offset := Elf64_Off(ehsize + phentsize*(1+len(memory)))
+	phdrs := []Elf64ProgramHeader{{P_type: PT_NOTE, P_offset: offset, P_filesz: Elf64_XWord(note.Len()), P_align: 4}}
+	data := append([]byte{}, note.Bytes()...)
+	for addr, mem := range memory {
+		offset := offset + Elf64_Off(len(data))
+		phdrs = append(phdrs, Elf64ProgramHeader{P_type: PT_LOAD, P_flags: PF_R | PF_W, P_offset: offset, P_vaddr: addr,
+			P_filesz: Elf64_XWord(len(mem)), P_memsz: Elf64_XWord(len(mem)), P_align: 0x1000})
+		data = append(data, mem...)
+	}
+
+	ehdr := Elf64Header{E_type: ET_CORE, E_machine: EM_X86_64, E_version: EV_CURRENT, E_phoff: Elf64_Off(ehsize),
+		E_ehsize: Elf64_Half(ehsize), E_phentsize: Elf64_Half(phentsize), E_phnum: Elf64_Half(len(phdrs))}
+	copy(ehdr.E_ident[:], []Elf_UChar{ELFMAG0, ELFMAG1, ELFMAG2, ELFMAG3, ELFCLASS64, ELFDATA2LSB, EV_CURRENT})
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, ehdr)
+	binary.Write(buf, binary.LittleEndian, phdrs)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+/* a thread's NT_PRSTATUS note with the x86-64 registers given by name */
+func fixturePrstatus(pid int32, regs map[string]uint64) *Elf64NoteDesp {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, Elf64Prstatus{PR_cursig: 11, PR_pid: pid})
+	for _, name := range x86_64_regs {
+		binary.Write(buf, binary.LittleEndian, regs[name])
+	}
+	return &Elf64NoteDesp{name: "CORE", typ: NT_PRSTATUS, desc: buf.Bytes()}
+}
+
+/* an NT_FILE note mapping each file from its start, with 4096 byte pages */
+func fixtureFileNote(files []*Elf64FileMapping) *Elf64NoteDesp {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []uint64{uint64(len(files)), 0x1000})
+	for _, file := range files {
+		binary.Write(buf, binary.LittleEndian, []uint64{uint64(file.start), uint64(file.end), uint64(file.offset)})
+	}
+	for _, file := range files {
+		buf.WriteString(file.path + "\x00")
+	}
+	return &Elf64NoteDesp{name: "CORE", typ: NT_FILE, desc: buf.Bytes()}
+}
+
+/*
+a process that crashed in crash(), called by main() without a frame pointer, which was called
+back from libc through a static function without unwind rules that keeps a frame record
+*/
+func TestCoreBacktrace(t *testing.T) {
+	sysroot := t.TempDir()
+
+	exe := newFixture(ET_EXEC, EM_X86_64, binary.LittleEndian)
+	exe.loads = []Elf64_Word{PF_R | PF_X}
+	exe.add(&fixtureSection{name: ".text", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 16, data: make([]byte, 0x30)})
+	exe.entry = "_start"
+	exe.addSymbols(".symtab", ".strtab", []fixtureSymbol{
+		{name: "_start", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", value: 0x00, size: 0x10},
+		{name: "main", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", value: 0x10, size: 0x10},
+		{name: "crash", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", value: 0x20, size: 0x10},
+	}, -1)
+	exe.addEhFrame([]fixtureFde{
+		// the outermost frame has no return address
+		{"_start", []byte{DW_CFA_undefined, 16}},
+		// sub $24,%rsp
+		{"main", []byte{DW_CFA_advance_loc | 4, DW_CFA_def_cfa_offset, 32}},
+		// push %rbx
+		{"crash", []byte{DW_CFA_advance_loc | 1, DW_CFA_def_cfa_offset, 16, DW_CFA_offset | 3, 2}},
+	})
+	writeFixture(t, sysroot, "/usr/bin/crash", exe)
+
+	libc := newFixture(ET_DYN, EM_X86_64, binary.LittleEndian)
+	libc.loads = []Elf64_Word{PF_R | PF_X}
+	libc.addSymbols(".dynsym", ".dynstr", []fixtureSymbol{
+		{name: "__libc_start_main", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", value: 0x00, size: 0x20},
+	}, 0)
+	libc.add(&fixtureSection{name: ".text", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 16, data: make([]byte, 0x30)})
+	libc.addEhFrame([]fixtureFde{
+		// push %rbp; mov %rsp,%rbp
+		{"__libc_start_main", []byte{DW_CFA_advance_loc | 1, DW_CFA_def_cfa_offset, 16, DW_CFA_offset | 6, 2,
+			DW_CFA_advance_loc | 3, DW_CFA_def_cfa_register, 6}},
+	})
+	writeFixture(t, sysroot, "/lib/libc.so.6", libc)
+
+	text := exe.section(".text").addr
+	const base, stack, sp = 0x7f0000000000, 0x7ffd0000, 0x7ffd0800
+	libtext := base + libc.section(".text").addr
+
+	// the stack from the crashed frame up, one word per 8 bytes from sp
+	memory := make([]byte, 0x1000)
+	for offset, word := range map[Elf64_Addr]Elf64_Addr{
+		0:   0x2222,          // crash: main's rbx
+		8:   text + 0x10 + 9, // crash: return into main
+		40:  libtext + 0x2a,  // main: return into the static function
+		64:  sp + 96,         // the static function's frame record
+		72:  libtext + 0x14,  // return into __libc_start_main
+		96:  0,               // __libc_start_main: the saved rbp
+		104: text + 0x0a,     // return into _start
+	} {
+		binary.LittleEndian.PutUint64(memory[sp-stack+offset:], uint64(word))
+	}
+
+	core := fixtureCore([]*Elf64NoteDesp{
+		fixturePrstatus(4242, map[string]uint64{"rip": uint64(text) + 0x24, "rsp": sp, "rbp": sp + 64, "rbx": 0x1111}),
+		fixtureFileNote([]*Elf64FileMapping{
+			{start: 0x400000, end: 0x401000, path: "/usr/bin/crash"},
+			{start: base, end: base + 0x1000, path: "/lib/libc.so.6"},
+		}),
+	}, map[Elf64_Addr][]byte{stack: memory})
+
+	p, err := LoadData(bytes.NewReader(core))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadCore(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sysroot = sysroot
+	defer c.Close()
+
+	want := []string{
+		fmt.Sprintf("0x%x crash+0x4 (/usr/bin/crash)", text+0x24),
+		fmt.Sprintf("0x%x main+0x8 (/usr/bin/crash)", text+0x19),
+		fmt.Sprintf("0x%x +0x%x (/lib/libc.so.6)", libtext+0x2a, libtext-base+0x29),
+		fmt.Sprintf("0x%x __libc_start_main+0x13 (/lib/libc.so.6)", libtext+0x14),
+		fmt.Sprintf("0x%x _start+0x9 (/usr/bin/crash)", text+0x0a),
+	}
+	got := []string{}
+	for _, frame := range c.Backtrace(c.threads[0]) {
+		got = append(got, fmt.Sprintf("0x%x %s", frame.pc, c.symbolize(frame.lookup)))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("backtrace\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+}
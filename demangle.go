@@ -0,0 +1,1227 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* longest demangled name, substitutions let a short mangled name expand without bound */
+const MAX_DEMANGLED = 1 << 16
+
+/* nesting depth of the parser and the printer, hostile names must not exhaust the stack */
+const MAX_DEMANGLE_DEPTH = 256
+
+/*
+returns the demangled form of an Itanium C++ ABI (_Z) or Rust (_R, or legacy _ZN..17h<hash>E)
+symbol name, printed as GNU c++filt does
+*/
+func Demangle(name string) (string, error) {
+	return demangleName(name, true)
+}
+
+/*
+the verbose form is the one of c++filt, the other the one of readelf -C: std::string for
+std::basic_string<char, ...>, and Rust names without their hash, crate disambiguators and
+the types of constants
+*/
+func demangleName(name string, verbose bool) (string, error) {
+	// a symbol version such as @@GLIBCXX_3.4 is kept as it is
+	if i := strings.IndexByte(name, '@'); i > 0 {
+		s, err := demangleName(name[:i], verbose)
+		if err != nil {
+			return "", err
+		}
+		return s + name[i:], nil
+	}
+	if strings.HasPrefix(name, "_R") {
+		return demangleRust(name, verbose)
+	}
+	if !strings.HasPrefix(name, "_Z") {
+		return "", fmt.Errorf("error: %s is not a mangled name", name)
+	}
+	if s, ok := demangleRustLegacy(name, verbose); ok {
+		return s, nil
+	}
+	return demangleItanium(name, verbose)
+}
+
+/* returns the demangled form of name, or name itself when it cannot be demangled */
+func demangled(name string, verbose bool) string {
+	if s, err := demangleName(name, verbose); err == nil {
+		return s
+	}
+	return name
+}
+
+/* the demangler stops at the first error by panicking with it, Demangle recovers */
+type demangleError string
+
+func demangleItanium(name string, verbose bool) (s string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(demangleError)
+			if !ok {
+				panic(r)
+			}
+			s, err = "", fmt.Errorf("error: cannot demangle %s: %s", name, string(e))
+		}
+	}()
+
+	d := &demangler{s: name, pos: 2, verbose: verbose}
+	node := d.encoding(true)
+	// clone suffixes such as .cold or .isra.0, each printed as [clone ...]
+	for d.peek() == '.' && (isLower(d.peekAt(1)) || d.peekAt(1) == '_' || isDigit(d.peekAt(1))) {
+		start := d.pos
+		d.pos++
+		for isLower(d.peek()) || d.peek() == '_' {
+			d.pos++
+		}
+		for d.peek() == '.' && isDigit(d.peekAt(1)) {
+			d.pos++
+			for isDigit(d.peek()) {
+				d.pos++
+			}
+		}
+		node = &dclone{node, name[start:d.pos]}
+	}
+	if d.pos != len(name) {
+		d.fail("unexpected %q", name[d.pos:])
+	}
+	p := new(dprinter)
+	p.print(node)
+	if p.failed {
+		return "", fmt.Errorf("error: cannot demangle %s", name)
+	}
+	return p.buf.String(), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+/* the state of parsing one mangled name */
+type demangler struct {
+	s        string
+	pos      int
+	depth    int
+	subs     []dnode /* substitution candidates, referred to by S_, S0_, ... */
+	lastName string  /* the last source name, a constructor is named after it */
+	convert  bool    /* parsing the type of a conversion operator, where T_ I is not a template template parameter */
+	verbose  bool    /* std::basic_string<char, std::char_traits<char>, std::allocator<char> > rather than std::string */
+}
+
+func (d *demangler) fail(format string, args ...any) {
+	panic(demangleError(fmt.Sprintf(format, args...)))
+}
+
+func (d *demangler) peek() byte {
+	return d.peekAt(0)
+}
+
+func (d *demangler) peekAt(i int) byte {
+	if d.pos+i < len(d.s) {
+		return d.s[d.pos+i]
+	}
+	return 0
+}
+
+func (d *demangler) next() byte {
+	c := d.peek()
+	if c == 0 {
+		d.fail("unexpected end")
+	}
+	d.pos++
+	return c
+}
+
+func (d *demangler) consume(prefix string) bool {
+	if strings.HasPrefix(d.s[d.pos:], prefix) {
+		d.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (d *demangler) expect(c byte) {
+	if d.peek() != c {
+		d.fail("expected %q at %d", c, d.pos)
+	}
+	d.pos++
+}
+
+func (d *demangler) enter() {
+	d.depth++
+	if d.depth > MAX_DEMANGLE_DEPTH {
+		d.fail("too deeply nested")
+	}
+}
+
+func (d *demangler) leave() {
+	d.depth--
+}
+
+/* <number> ::= [n] <decimal> */
+func (d *demangler) number() int {
+	neg := d.consume("n")
+	start := d.pos
+	for isDigit(d.peek()) {
+		d.pos++
+	}
+	if start == d.pos || d.pos-start > 9 {
+		d.fail("bad number at %d", start)
+	}
+	n, _ := strconv.Atoi(d.s[start:d.pos])
+	if neg {
+		return -n
+	}
+	return n
+}
+
+/* _ is 0, <number>_ is number+1, as used by discriminators, lambdas and function parameters */
+func (d *demangler) compactNumber() int {
+	if d.consume("_") {
+		return 0
+	}
+	n := d.number()
+	if n < 0 {
+		d.fail("negative number")
+	}
+	d.expect('_')
+	return n + 1
+}
+
+/* <seq-id>: base 36 with digits and upper case letters, terminated by _ */
+func (d *demangler) seqID() int {
+	if d.consume("_") {
+		return 0
+	}
+	n := 0
+	for {
+		c := d.next()
+		switch {
+		case isDigit(c):
+			n = n*36 + int(c-'0')
+		case isUpper(c):
+			n = n*36 + int(c-'A') + 10
+		case c == '_':
+			return n + 1
+		default:
+			d.fail("bad sequence id")
+		}
+		if n > 1<<20 {
+			d.fail("bad sequence id")
+		}
+	}
+}
+
+func (d *demangler) addSub(n dnode) {
+	d.subs = append(d.subs, n)
+}
+
+/* <encoding> ::= <name> <bare-function-type> | <name> | <special-name> */
+func (d *demangler) encoding(top bool) dnode {
+	d.enter()
+	defer d.leave()
+
+	if c := d.peek(); c == 'G' || c == 'T' {
+		return d.specialName()
+	}
+	name, fn := d.name()
+	if c := d.peek(); c == 0 || c == 'E' || c == '.' {
+		return name
+	}
+
+	encoding := &dfunc{name: name, cv: fn.cv, ref: fn.ref}
+	if fn.template && !fn.ctor {
+		encoding.ret = d.typ()
+	}
+	encoding.params = d.params()
+	// the return type of the function a local name is in would read as the type of the local name
+	if !top {
+		if _, ok := name.(*dlocal); ok {
+			encoding.ret = nil
+		}
+	}
+	return encoding
+}
+
+/* what the name of an encoding tells about the function type that follows */
+type dnameInfo struct {
+	template bool   /* a template, its return type is mangled */
+	ctor     bool   /* a constructor, destructor or conversion operator, which have no return type */
+	cv       string /* the qualifiers of a member function */
+	ref      string
+}
+
+/* <bare-function-type>: the parameter types, a lone void means none */
+func (d *demangler) params() []dnode {
+	params := []dnode{}
+	for {
+		c := d.peek()
+		if c == 0 || c == 'E' || c == '.' || (c == 'R' || c == 'O') && d.peekAt(1) == 'E' {
+			break
+		}
+		params = append(params, d.typ())
+	}
+	if len(params) == 0 {
+		d.fail("no parameters")
+	}
+	if len(params) == 1 {
+		if b, ok := params[0].(*dname); ok && b.builtin && b.s == "void" {
+			return nil
+		}
+	}
+	return params
+}
+
+/* <special-name>: virtual tables, type information, thunks, guard variables */
+func (d *demangler) specialName() dnode {
+	if d.consume("T") {
+		switch c := d.next(); c {
+		case 'V':
+			return &dspecial{"vtable for ", d.typ()}
+		case 'T':
+			return &dspecial{"VTT for ", d.typ()}
+		case 'I':
+			return &dspecial{"typeinfo for ", d.typ()}
+		case 'S':
+			return &dspecial{"typeinfo name for ", d.typ()}
+		case 'F':
+			return &dspecial{"typeinfo fn for ", d.typ()}
+		case 'h':
+			d.callOffset('h')
+			return &dspecial{"non-virtual thunk to ", d.encoding(false)}
+		case 'v':
+			d.callOffset('v')
+			return &dspecial{"virtual thunk to ", d.encoding(false)}
+		case 'c':
+			d.callOffset(0)
+			d.callOffset(0)
+			return &dspecial{"covariant return thunk to ", d.encoding(false)}
+		case 'C':
+			derived := d.typ()
+			if d.number() < 0 {
+				d.fail("bad construction vtable offset")
+			}
+			d.expect('_')
+			return &dctorVtable{d.typ(), derived}
+		case 'H':
+			name, _ := d.name()
+			return &dspecial{"TLS init function for ", name}
+		case 'W':
+			name, _ := d.name()
+			return &dspecial{"TLS wrapper function for ", name}
+		case 'A':
+			return &dspecial{"template parameter object for ", d.templateArg()}
+		default:
+			d.fail("unknown special name T%c", c)
+		}
+	}
+	d.expect('G')
+	switch c := d.next(); c {
+	case 'V':
+		name, _ := d.name()
+		return &dspecial{"guard variable for ", name}
+	case 'R':
+		name, _ := d.name()
+		// c++filt reads a plain number here, not the seq-id of the ABI
+		num := 0
+		if isDigit(d.peek()) {
+			num = d.number()
+		}
+		return &dspecial{fmt.Sprintf("reference temporary #%d for ", num), name}
+	case 'A':
+		return &dspecial{"hidden alias for ", d.encoding(false)}
+	case 'T':
+		if d.consume("n") {
+			return &dspecial{"non-transaction clone for ", d.encoding(false)}
+		}
+		d.consume("t")
+		return &dspecial{"transaction clone for ", d.encoding(false)}
+	}
+	d.fail("unknown special name")
+	return nil
+}
+
+/* <call-offset> ::= h <number> _ | v <number> _ <number> _, the offsets are not printed */
+func (d *demangler) callOffset(c byte) {
+	if c == 0 {
+		c = d.next()
+	}
+	if c != 'h' && c != 'v' {
+		d.fail("bad call offset")
+	}
+	d.number()
+	d.expect('_')
+	if c == 'v' {
+		d.number()
+		d.expect('_')
+	}
+}
+
+/* <name> ::= <nested-name> | <local-name> | <unscoped-template-name> <template-args> | <unscoped-name> */
+func (d *demangler) name() (dnode, dnameInfo) {
+	d.enter()
+	defer d.leave()
+
+	var info dnameInfo
+	switch d.peek() {
+	case 'N':
+		return d.nestedName()
+	case 'Z':
+		return d.localName()
+	case 'S':
+		if d.peekAt(1) != 't' {
+			sub := d.substitution(false)
+			if d.peek() != 'I' {
+				return sub, info
+			}
+			info.template = true
+			return &dtemplate{sub, d.templateArgs()}, info
+		}
+	}
+
+	name := d.unscopedName(&info)
+	if d.peek() == 'I' {
+		d.addSub(name)
+		info.template = true
+		return &dtemplate{name, d.templateArgs()}, info
+	}
+	return name, info
+}
+
+/* <unscoped-name> ::= <unqualified-name> | St <unqualified-name> */
+func (d *demangler) unscopedName(info *dnameInfo) dnode {
+	if d.consume("St") {
+		return &dnested{&dname{s: "std"}, d.unqualifiedName(nil, info)}
+	}
+	return d.unqualifiedName(nil, info)
+}
+
+/* <nested-name> ::= N [<CV-qualifiers>] [<ref-qualifier>] <prefix> <unqualified-name> E */
+func (d *demangler) nestedName() (dnode, dnameInfo) {
+	d.expect('N')
+	var info dnameInfo
+	info.cv = d.cvQualifiers()
+	if d.consume("R") {
+		info.ref = " &"
+	} else if d.consume("O") {
+		info.ref = " &&"
+	}
+
+	var node dnode
+	for !d.consume("E") {
+		c := d.peek()
+		if c != 'I' {
+			info.template, info.ctor = false, false
+		}
+		switch {
+		case c == 0:
+			d.fail("unterminated nested name")
+		case c == 'S' && d.peekAt(1) == 't':
+			d.pos += 2
+			node = &dname{s: "std"}
+			continue
+		case c == 'S':
+			sub := d.substitution(true)
+			node = d.qualify(node, sub)
+			if node != sub {
+				d.addSub(node)
+			}
+			continue
+		case c == 'I':
+			if node == nil {
+				d.fail("template arguments without a name")
+			}
+			node = &dtemplate{node, d.templateArgs()}
+			info.template = true
+		case c == 'T':
+			node = d.qualify(node, d.templateParam())
+		case c == 'D' && (d.peekAt(1) == 't' || d.peekAt(1) == 'T'):
+			node = d.qualify(node, d.typ())
+		case c == 'M':
+			// the closure scope of a lambda in a member initializer, not printed
+			d.pos++
+			continue
+		default:
+			node = d.qualify(node, d.unqualifiedName(node, &info))
+		}
+		if d.peek() != 'E' {
+			d.addSub(node)
+		}
+	}
+	if node == nil {
+		d.fail("empty nested name")
+	}
+	return node, info
+}
+
+func (d *demangler) qualify(scope dnode, name dnode) dnode {
+	if scope == nil {
+		return name
+	}
+	return &dnested{scope, name}
+}
+
+/* <local-name> ::= Z <encoding> E <entity name> [<discriminator>] | Z <encoding> E s [<discriminator>] */
+func (d *demangler) localName() (dnode, dnameInfo) {
+	d.expect('Z')
+	fn := d.encoding(false)
+	d.expect('E')
+	if f, ok := fn.(*dfunc); ok {
+		f.ret = nil
+	}
+
+	var info dnameInfo
+	if d.consume("s") {
+		d.discriminator()
+		return &dlocal{fn, &dname{s: "string literal"}}, info
+	}
+	arg := -1
+	if d.consume("d") {
+		arg = d.compactNumber()
+	}
+	var name dnode
+	name, info = d.name()
+	switch name.(type) {
+	case *dlambda, *dunnamed:
+	default:
+		d.discriminator()
+	}
+	if arg >= 0 {
+		name = &ddefaultArg{arg, name}
+	}
+	return &dlocal{fn, name}, info
+}
+
+/* <discriminator> ::= _ <digit> | __ <number> _, not printed */
+func (d *demangler) discriminator() {
+	if !d.consume("_") {
+		return
+	}
+	if d.consume("_") {
+		d.number()
+		d.expect('_')
+		return
+	}
+	for isDigit(d.peek()) {
+		d.pos++
+	}
+}
+
+/* <unqualified-name>: a source, operator, constructor or destructor name, lambda or unnamed type, with ABI tags */
+func (d *demangler) unqualifiedName(scope dnode, info *dnameInfo) dnode {
+	var name dnode
+	c := d.peek()
+	switch {
+	case isDigit(c):
+		name = d.sourceName()
+	case isLower(c):
+		name = d.operatorName(info)
+	case c == 'C' || c == 'D' && d.peekAt(1) != 'C':
+		name = d.ctorDtorName(scope)
+		info.ctor = true
+	case c == 'U':
+		name = d.unnamedTypeName()
+	case c == 'L':
+		d.pos++
+		name = d.sourceName()
+		d.discriminator()
+	case c == 'D' && d.peekAt(1) == 'C':
+		d.pos += 2
+		names := []dnode{}
+		for !d.consume("E") {
+			names = append(names, d.sourceName())
+		}
+		name = &dbinding{names}
+	default:
+		d.fail("bad unqualified name at %d", d.pos)
+	}
+	for d.peek() == 'B' {
+		d.pos++
+		name = &dabiTag{name, d.identifier()}
+	}
+	return name
+}
+
+/* <length> <identifier> */
+func (d *demangler) identifier() string {
+	n := d.number()
+	if n <= 0 || d.pos+n > len(d.s) {
+		d.fail("bad source name length")
+	}
+	d.pos += n
+	return d.s[d.pos-n : d.pos]
+}
+
+/* <source-name> ::= <length> <identifier>, the anonymous namespace is _GLOBAL__N */
+func (d *demangler) sourceName() dnode {
+	id := d.identifier()
+	d.lastName = id
+	if len(id) >= 10 && strings.HasPrefix(id, "_GLOBAL_") && strings.ContainsRune("._$", rune(id[8])) && id[9] == 'N' {
+		return &dname{s: "(anonymous namespace)"}
+	}
+	return &dname{s: id}
+}
+
+/* <ctor-dtor-name>: named after the last source name, as c++filt does */
+func (d *demangler) ctorDtorName(scope dnode) dnode {
+	dtor := d.next() == 'D'
+	c := d.next()
+	if !dtor && c == 'I' {
+		// inheriting constructor: CI1 <base class type>
+		d.next()
+		d.typ()
+	} else if c < '0' || c > '5' {
+		d.fail("bad constructor or destructor")
+	}
+	return &dctor{d.lastName, dtor}
+}
+
+/* Ut [<number>] _ is an unnamed type, Ul <lambda-sig> E [<number>] _ a closure type */
+func (d *demangler) unnamedTypeName() dnode {
+	d.expect('U')
+	switch d.next() {
+	case 't':
+		return &dunnamed{d.compactNumber()}
+	case 'l':
+		params := d.params()
+		d.expect('E')
+		return &dlambda{params, d.compactNumber()}
+	}
+	d.fail("bad unnamed type")
+	return nil
+}
+
+/* <operator-name>, with cv <type> for conversion operators and li <source-name> for literal operators */
+func (d *demangler) operatorName(info *dnameInfo) dnode {
+	if d.consume("cv") {
+		info.ctor = true
+		d.convert = true
+		return &dconversion{d.typ()}
+	}
+	if d.consume("li") {
+		return &dname{s: "operator\"\" " + d.sourceName().(*dname).s}
+	}
+	if d.consume("v") {
+		if !isDigit(d.peek()) {
+			d.fail("bad vendor operator")
+		}
+		d.pos++
+		return &dname{s: "operator " + d.sourceName().(*dname).s}
+	}
+	if d.pos+2 > len(d.s) {
+		d.fail("bad operator")
+	}
+	op, ok := demangle_operators[d.s[d.pos:d.pos+2]]
+	if !ok {
+		d.fail("unknown operator %s", d.s[d.pos:d.pos+2])
+	}
+	d.pos += 2
+	name := strings.TrimSuffix(op.name, " ")
+	if isLower(name[0]) {
+		return &dname{s: "operator " + name}
+	}
+	return &dname{s: "operator" + name}
+}
+
+/* an operator of expressions: how it is printed and the number of operands */
+type doperator struct {
+	name  string
+	arity int
+}
+
+var demangle_operators = map[string]doperator{
+	"aN": {"&=", 2}, "aS": {"=", 2}, "aa": {"&&", 2}, "ad": {"&", 1}, "an": {"&", 2},
+	"at": {"alignof ", 1}, "aw": {"co_await ", 1}, "az": {"alignof ", 1}, "cc": {"const_cast", 2},
+	"cl": {"()", 2}, "cm": {",", 2}, "co": {"~", 1}, "dV": {"/=", 2}, "da": {"delete[] ", 1},
+	"dc": {"dynamic_cast", 2}, "de": {"*", 1}, "dl": {"delete ", 1}, "ds": {".*", 2}, "dt": {".", 2},
+	"dv": {"/", 2}, "eO": {"^=", 2}, "eo": {"^", 2}, "eq": {"==", 2}, "ge": {">=", 2}, "gs": {"::", 1},
+	"gt": {">", 2}, "ix": {"[]", 2}, "lS": {"<<=", 2}, "le": {"<=", 2}, "ls": {"<<", 2}, "lt": {"<", 2},
+	"mI": {"-=", 2}, "mL": {"*=", 2}, "mi": {"-", 2}, "ml": {"*", 2}, "mm": {"--", 1}, "na": {"new[]", 3},
+	"ne": {"!=", 2}, "ng": {"-", 1}, "nt": {"!", 1}, "nw": {"new", 3}, "nx": {"noexcept", 1}, "oR": {"|=", 2},
+	"oo": {"||", 2}, "or": {"|", 2}, "pL": {"+=", 2}, "pl": {"+", 2}, "pm": {"->*", 2}, "pp": {"++", 1},
+	"ps": {"+", 1}, "pt": {"->", 2}, "qu": {"?", 3}, "rM": {"%=", 2}, "rS": {">>=", 2},
+	"rc": {"reinterpret_cast", 2}, "rm": {"%", 2}, "rs": {">>", 2}, "sP": {"sizeof...", 1},
+	"sZ": {"sizeof...", 1}, "sc": {"static_cast", 2}, "ss": {"<=>", 2}, "st": {"sizeof ", 1},
+	"sz": {"sizeof ", 1}, "tr": {"throw", 0}, "tw": {"throw ", 1},
+}
+
+/*
+<substitution>: S_, S<seq-id>_ or one of the std:: abbreviations, prefix tells whether it starts
+a nested name, where the constructor of an abbreviated class names it in full
+*/
+func (d *demangler) substitution(prefix bool) dnode {
+	d.expect('S')
+	c := d.peek()
+	if isDigit(c) || isUpper(c) || c == '_' {
+		id := d.seqID()
+		if id >= len(d.subs) {
+			d.fail("substitution %d out of range", id)
+		}
+		return d.subs[id]
+	}
+	d.pos++
+	sub, ok := demangle_std_subs[c]
+	if !ok {
+		d.fail("unknown substitution S%c", c)
+	}
+	if sub.last != "" {
+		d.lastName = sub.last
+	}
+	name := sub.name
+	if !d.verbose && (!prefix || d.peek() != 'C' && d.peek() != 'D') {
+		name = sub.short
+	}
+	var node dnode = &dname{s: name}
+	if d.peek() == 'B' {
+		for d.peek() == 'B' {
+			d.pos++
+			node = &dabiTag{node, d.identifier()}
+		}
+		d.addSub(node)
+	}
+	return node
+}
+
+/* the std:: abbreviations in full and in short, and the class name a constructor gets */
+var demangle_std_subs = map[byte]struct{ name, short, last string }{
+	't': {"std", "std", ""},
+	'a': {"std::allocator", "std::allocator", "allocator"},
+	'b': {"std::basic_string", "std::basic_string", "basic_string"},
+	's': {"std::basic_string<char, std::char_traits<char>, std::allocator<char> >", "std::string", "basic_string"},
+	'i': {"std::basic_istream<char, std::char_traits<char> >", "std::istream", "basic_istream"},
+	'o': {"std::basic_ostream<char, std::char_traits<char> >", "std::ostream", "basic_ostream"},
+	'd': {"std::basic_iostream<char, std::char_traits<char> >", "std::iostream", "basic_iostream"},
+}
+
+/* <template-args> ::= I <template-arg>+ E, they do not change the name a constructor is printed with */
+func (d *demangler) templateArgs() *dargs {
+	d.enter()
+	defer d.leave()
+
+	d.expect('I')
+	last := d.lastName
+	args := &dargs{}
+	for !d.consume("E") {
+		if d.peek() == 0 {
+			d.fail("unterminated template arguments")
+		}
+		args.list = append(args.list, d.templateArg())
+	}
+	d.lastName = last
+	return args
+}
+
+/* <template-arg> ::= <type> | X <expression> E | <expr-primary> | J <template-arg>* E */
+func (d *demangler) templateArg() dnode {
+	switch d.peek() {
+	case 'X':
+		d.pos++
+		expr := d.expression()
+		d.expect('E')
+		return expr
+	case 'L':
+		return d.exprPrimary()
+	case 'J':
+		d.pos++
+		pack := &dpack{}
+		for !d.consume("E") {
+			if d.peek() == 0 {
+				d.fail("unterminated argument pack")
+			}
+			pack.list = append(pack.list, d.templateArg())
+		}
+		return pack
+	}
+	return d.typ()
+}
+
+/* <template-param> ::= T_ | T <number> _, what it stands for depends on where it is printed */
+func (d *demangler) templateParam() dnode {
+	d.expect('T')
+	idx := d.compactNumber()
+	return &dtparam{idx}
+}
+
+/* <CV-qualifiers> ::= [r] [V] [K], printed in the order const, volatile, restrict */
+func (d *demangler) cvQualifiers() string {
+	var restrict, volatile, konst bool
+	restrict = d.consume("r")
+	volatile = d.consume("V")
+	konst = d.consume("K")
+	quals := ""
+	if konst {
+		quals += " const"
+	}
+	if volatile {
+		quals += " volatile"
+	}
+	if restrict {
+		quals += " restrict"
+	}
+	return quals
+}
+
+var demangle_builtins = map[byte]string{
+	'v': "void", 'w': "wchar_t", 'b': "bool", 'c': "char", 'a': "signed char", 'h': "unsigned char",
+	's': "short", 't': "unsigned short", 'i': "int", 'j': "unsigned int", 'l': "long", 'm': "unsigned long",
+	'x': "long long", 'y': "unsigned long long", 'n': "__int128", 'o': "unsigned __int128", 'f': "float",
+	'd': "double", 'e': "long double", 'g': "__float128", 'z': "...",
+}
+
+var demangle_d_builtins = map[byte]string{
+	'd': "decimal64", 'e': "decimal128", 'f': "decimal32", 'h': "half", 'u': "char8_t", 's': "char16_t",
+	'i': "char32_t", 'n': "decltype(nullptr)", 'a': "auto", 'c': "decltype(auto)",
+}
+
+/* <type>, every type but the builtin ones and plain substitutions becomes a substitution candidate */
+func (d *demangler) typ() dnode {
+	d.enter()
+	defer d.leave()
+
+	convert := d.convert
+	d.convert = false
+	c := d.peek()
+	if name, ok := demangle_builtins[c]; ok {
+		d.pos++
+		return &dname{s: name, builtin: true, code: c}
+	}
+
+	var node dnode
+	switch c {
+	case 'r', 'V', 'K':
+		quals := d.cvQualifiers()
+		except := d.exceptionSpec()
+		if d.peek() == 'F' {
+			fn := d.functionType()
+			fn.cv, fn.except = quals, except
+			node = fn
+		} else {
+			if except != "" {
+				d.fail("exception specification on a type")
+			}
+			node = &dqual{d.typ(), quals}
+		}
+	case 'D':
+		if except := d.exceptionSpec(); except != "" {
+			fn := d.functionType()
+			fn.except = except
+			node = fn
+			break
+		}
+		if name, ok := demangle_d_builtins[d.peekAt(1)]; ok {
+			d.pos += 2
+			return &dname{s: name, builtin: true}
+		}
+		d.pos++
+		switch c := d.next(); c {
+		case 't', 'T':
+			node = &ddecltype{d.expression()}
+			d.expect('E')
+		case 'p':
+			node = &dexpansion{d.typ()}
+		case 'v':
+			var dim dnode
+			if d.consume("_") {
+				dim = d.expression()
+			} else {
+				dim = &dname{s: strconv.Itoa(d.number())}
+			}
+			d.expect('_')
+			node = &dvector{d.typ(), dim}
+		case 'F':
+			n := d.number()
+			if d.consume("x") {
+				return &dname{s: fmt.Sprintf("_Float%dx", n), builtin: true}
+			}
+			if d.consume("b") {
+				return &dname{s: "std::bfloat16_t", builtin: true}
+			}
+			d.expect('_')
+			return &dname{s: fmt.Sprintf("_Float%d", n), builtin: true}
+		case 'B', 'U':
+			var bits string
+			if isDigit(d.peek()) {
+				bits = strconv.Itoa(d.number())
+			} else {
+				p := new(dprinter)
+				p.print(d.expression())
+				bits = p.buf.String()
+			}
+			d.expect('_')
+			if c == 'U' {
+				return &dname{s: "unsigned _BitInt(" + bits + ")", builtin: true}
+			}
+			return &dname{s: "_BitInt(" + bits + ")", builtin: true}
+		default:
+			d.fail("unknown type D%c", c)
+		}
+	case 'u':
+		d.pos++
+		node = d.sourceName()
+	case 'F':
+		node = d.functionType()
+	case 'A':
+		node = d.arrayType()
+	case 'M':
+		d.pos++
+		class := d.typ()
+		node = &dptrmem{class, d.typ()}
+	case 'T':
+		node = d.templateParam()
+		if d.peek() == 'I' && !convert {
+			d.addSub(node)
+			node = &dtemplate{node, d.templateArgs()}
+		}
+	case 'P':
+		d.pos++
+		node = &dpointer{d.typ()}
+	case 'R':
+		d.pos++
+		node = &dref{d.typ(), false}
+	case 'O':
+		d.pos++
+		node = &dref{d.typ(), true}
+	case 'C':
+		d.pos++
+		node = &dsuffix{d.typ(), " _Complex"}
+	case 'G':
+		d.pos++
+		node = &dsuffix{d.typ(), " _Imaginary"}
+	case 'U':
+		d.pos++
+		var qual dnode = d.sourceName()
+		if d.peek() == 'I' {
+			qual = &dtemplate{qual, d.templateArgs()}
+		}
+		p := new(dprinter)
+		p.print(qual)
+		node = &dsuffix{d.typ(), " " + p.buf.String()}
+	case 'S':
+		if c := d.peekAt(1); isDigit(c) || isUpper(c) || c == '_' {
+			node = d.substitution(false)
+			if d.peek() != 'I' {
+				return node
+			}
+			node = &dtemplate{node, d.templateArgs()}
+			break
+		}
+		var info dnameInfo
+		node, info = d.name()
+		if _, ok := node.(*dname); ok && !info.template {
+			// std::string and the others are not new candidates
+			return node
+		}
+	default:
+		node, _ = d.name()
+	}
+	d.addSub(node)
+	return node
+}
+
+/* Do, DO <expression> E, Dw <type>+ E and Dx before a function type */
+func (d *demangler) exceptionSpec() string {
+	switch {
+	case d.consume("Do"):
+		return " noexcept"
+	case d.consume("DO"):
+		p := new(dprinter)
+		p.print(d.expression())
+		d.expect('E')
+		return " noexcept(" + p.buf.String() + ")"
+	case d.consume("Dw"):
+		types := []string{}
+		for !d.consume("E") {
+			p := new(dprinter)
+			p.print(d.typ())
+			types = append(types, p.buf.String())
+		}
+		return " throw(" + strings.Join(types, ", ") + ")"
+	case d.consume("Dx"):
+		return " transaction_safe"
+	}
+	return ""
+}
+
+/* <function-type> ::= F [Y] <return type> <bare-function-type> [<ref-qualifier>] E */
+func (d *demangler) functionType() *dfuncType {
+	d.expect('F')
+	d.consume("Y")
+	fn := &dfuncType{ret: d.typ()}
+	fn.params = d.params()
+	if d.consume("R") {
+		fn.ref = " &"
+	} else if d.consume("O") {
+		fn.ref = " &&"
+	}
+	d.expect('E')
+	return fn
+}
+
+/* <array-type> ::= A <number> _ <type> | A [<expression>] _ <type> */
+func (d *demangler) arrayType() dnode {
+	d.expect('A')
+	var dim dnode
+	switch {
+	case d.peek() == '_':
+	case isDigit(d.peek()):
+		start := d.pos
+		for isDigit(d.peek()) {
+			d.pos++
+		}
+		dim = &dname{s: d.s[start:d.pos]}
+	default:
+		dim = d.expression()
+	}
+	d.expect('_')
+	return &darray{d.typ(), dim}
+}
+
+/* <expr-primary> ::= L <type> <value> E | L <mangled-name> E */
+func (d *demangler) exprPrimary() dnode {
+	d.expect('L')
+	if d.peek() == '_' || d.peek() == 'Z' {
+		d.consume("_")
+		d.expect('Z')
+		node := d.encoding(false)
+		d.expect('E')
+		return node
+	}
+	typ := d.typ()
+	if b, ok := typ.(*dname); ok && b.s == "decltype(nullptr)" && d.consume("E") {
+		return typ
+	}
+	neg := d.consume("n")
+	start := d.pos
+	for d.peek() != 'E' {
+		d.next()
+	}
+	value := d.s[start:d.pos]
+	d.pos++
+	return &dliteral{typ, value, neg}
+}
+
+/* <expression>, what template arguments, array bounds and decltype hold */
+func (d *demangler) expression() dnode {
+	d.enter()
+	defer d.leave()
+
+	c := d.peek()
+	switch {
+	case c == 'L':
+		return d.exprPrimary()
+	case c == 'T':
+		return d.templateParam()
+	case d.consume("sr"):
+		return d.unresolvedName()
+	case d.consume("sp"):
+		return &dexpansion{d.expression()}
+	case d.consume("fp"):
+		// like c++filt, the qualified and the fL forms of outer parameters are not taken
+		if d.consume("T") {
+			return &dname{s: "this"}
+		}
+		return &dfparam{d.compactNumber()}
+	case isDigit(c) || c == 'o' && d.peekAt(1) == 'n':
+		d.consume("on")
+		var info dnameInfo
+		name := d.unqualifiedName(nil, &info)
+		if d.peek() == 'I' {
+			return &dtemplate{name, d.templateArgs()}
+		}
+		return name
+	case c == 'i' && d.peekAt(1) == 'l', c == 't' && d.peekAt(1) == 'l':
+		var typ dnode
+		if d.next() == 't' {
+			d.pos++
+			typ = d.typ()
+		} else {
+			d.pos++
+		}
+		return &dinitList{typ, d.exprList('E')}
+	case d.consume("dn"):
+		return &dname{s: "~" + d.typeAsString(d.unresolvedType())}
+	}
+
+	if d.consume("cv") {
+		typ := d.typ()
+		if d.consume("_") {
+			return &dunary{op: "", cast: typ, operand: d.exprList('E')}
+		}
+		return &dunary{op: "", cast: typ, operand: d.expression()}
+	}
+
+	if d.pos+2 > len(d.s) {
+		d.fail("bad expression")
+	}
+	code := d.s[d.pos : d.pos+2]
+	op, ok := demangle_operators[code]
+	if !ok {
+		d.fail("unknown expression %s", code)
+	}
+	d.pos += 2
+	switch code {
+	case "st", "at":
+		return &dunary{op: op.name, code: code, operand: d.typ()}
+	case "sP":
+		pack := &dpack{}
+		for !d.consume("E") {
+			pack.list = append(pack.list, d.templateArg())
+		}
+		return &dunary{op: op.name, code: code, operand: pack}
+	case "dc", "sc", "cc", "rc":
+		typ := d.typ()
+		return &dbinary{op: op.name, code: code, left: typ, right: d.expression()}
+	case "cl":
+		fn := d.expression()
+		return &dbinary{op: op.name, code: code, left: fn, right: d.exprList('E')}
+	case "dt", "pt":
+		left := d.expression()
+		var right dnode
+		if d.consume("sr") {
+			right = d.unresolvedName()
+		} else {
+			var info dnameInfo
+			right = d.unqualifiedName(nil, &info)
+			if d.peek() == 'I' {
+				right = &dtemplate{right, d.templateArgs()}
+			}
+		}
+		return &dbinary{op: op.name, code: code, left: left, right: right}
+	case "nw", "na":
+		return d.newExpression(code)
+	}
+
+	switch op.arity {
+	case 0:
+		return &dname{s: op.name}
+	case 1:
+		suffix := false
+		if code == "pp" || code == "mm" {
+			suffix = !d.consume("_")
+		}
+		return &dunary{op: op.name, code: code, operand: d.expression(), suffix: suffix}
+	case 2:
+		left := d.expression()
+		return &dbinary{op: op.name, code: code, left: left, right: d.expression()}
+	default:
+		first := d.expression()
+		second := d.expression()
+		return &dtrinary{first, second, d.expression()}
+	}
+}
+
+/* [gs] nw <expression>* _ <type> [pi <expression>* E] E */
+func (d *demangler) newExpression(code string) dnode {
+	placement := d.exprList('_')
+	typ := d.typ()
+	var init *dexprList
+	if d.consume("pi") {
+		init = d.exprList('E')
+	} else {
+		d.expect('E')
+	}
+	return &dnew{code == "na", placement, typ, init}
+}
+
+/* <expression>* terminated by end */
+func (d *demangler) exprList(end byte) *dexprList {
+	list := &dexprList{}
+	for !d.consume(string(end)) {
+		if d.peek() == 0 {
+			d.fail("unterminated expression list")
+		}
+		list.list = append(list.list, d.expression())
+	}
+	return list
+}
+
+/* <unresolved-name> after sr: a type or nested qualifiers and the name in it */
+func (d *demangler) unresolvedName() dnode {
+	var scope dnode
+	if d.consume("N") {
+		scope = d.unresolvedType()
+		if d.peek() == 'I' {
+			scope = &dtemplate{scope, d.templateArgs()}
+		}
+		for !d.consume("E") {
+			scope = &dnested{scope, d.simpleID()}
+		}
+	} else if isDigit(d.peek()) {
+		scope = d.simpleID()
+		for !d.consume("E") {
+			scope = &dnested{scope, d.simpleID()}
+		}
+	} else {
+		scope = d.unresolvedType()
+		if d.peek() == 'I' {
+			scope = &dtemplate{scope, d.templateArgs()}
+		}
+	}
+	// template arguments apply to the qualified name, which makes it more than a name in an expression
+	name := d.baseUnresolvedName()
+	if t, ok := name.(*dtemplate); ok {
+		return &dtemplate{&dnested{scope, t.name}, t.args}
+	}
+	return &dnested{scope, name}
+}
+
+/* <unresolved-type> ::= <template-param> | <decltype> | <substitution> */
+func (d *demangler) unresolvedType() dnode {
+	switch d.peek() {
+	case 'T':
+		node := d.templateParam()
+		d.addSub(node)
+		return node
+	case 'D':
+		return d.typ()
+	case 'S':
+		return d.substitution(false)
+	}
+	return d.simpleID()
+}
+
+/* <simple-id> ::= <source-name> [<template-args>] */
+func (d *demangler) simpleID() dnode {
+	name := d.sourceName()
+	if d.peek() == 'I' {
+		return &dtemplate{name, d.templateArgs()}
+	}
+	return name
+}
+
+/* <base-unresolved-name>: a simple id, an operator or a destructor */
+func (d *demangler) baseUnresolvedName() dnode {
+	var info dnameInfo
+	switch {
+	case isDigit(d.peek()):
+		return d.simpleID()
+	case d.consume("dn"):
+		if isDigit(d.peek()) {
+			return &dname{s: "~" + d.typeAsString(d.simpleID())}
+		}
+		return &dname{s: "~" + d.typeAsString(d.unresolvedType())}
+	}
+	d.consume("on")
+	name := d.operatorName(&info)
+	if d.peek() == 'I' {
+		return &dtemplate{name, d.templateArgs()}
+	}
+	return name
+}
+
+func (d *demangler) typeAsString(n dnode) string {
+	p := new(dprinter)
+	p.print(n)
+	return p.buf.String()
+}
@@ -0,0 +1,870 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+/* a node of a demangled name, printed by dprinter */
+type dnode any
+
+type dname struct {
+	s       string
+	builtin bool
+	code    byte /* the mangled code of a builtin type, literals of it are printed after it */
+}
+
+type dnested struct {
+	scope dnode
+	name  dnode
+}
+
+type dtemplate struct {
+	name dnode
+	args *dargs
+}
+
+type dargs struct {
+	list []dnode
+}
+
+/* a function encoding, the return type is only mangled for templates */
+type dfunc struct {
+	name   dnode
+	ret    dnode
+	params []dnode
+	cv     string
+	ref    string
+}
+
+type dlocal struct {
+	fn   dnode
+	name dnode
+}
+
+type dclone struct {
+	node   dnode
+	suffix string
+}
+
+type dspecial struct {
+	prefix string
+	node   dnode
+}
+
+type dctorVtable struct {
+	base    dnode
+	derived dnode
+}
+
+type dlambda struct {
+	params []dnode
+	num    int
+}
+
+type dunnamed struct {
+	num int
+}
+
+type ddefaultArg struct {
+	num  int
+	name dnode
+}
+
+type dbinding struct {
+	names []dnode
+}
+
+type dabiTag struct {
+	name dnode
+	tag  string
+}
+
+type dctor struct {
+	name string
+	dtor bool
+}
+
+type dconversion struct {
+	typ dnode
+}
+
+type dpack struct {
+	list []dnode
+}
+
+/* T_, the argument it stands for is looked up in the innermost template being printed */
+type dtparam struct {
+	idx int
+}
+
+type dqual struct {
+	typ   dnode
+	quals string
+}
+
+type dfuncType struct {
+	ret    dnode
+	params []dnode
+	cv     string
+	ref    string
+	except string
+}
+
+type ddecltype struct {
+	expr dnode
+}
+
+/* Dp or sp, the pattern is printed once for each element of the pack it refers to */
+type dexpansion struct {
+	pattern dnode
+}
+
+type dvector struct {
+	typ dnode
+	dim dnode
+}
+
+type dptrmem struct {
+	class  dnode
+	member dnode
+}
+
+type dpointer struct {
+	typ dnode
+}
+
+type dref struct {
+	typ    dnode
+	rvalue bool
+}
+
+type dsuffix struct {
+	typ    dnode
+	suffix string
+}
+
+type darray struct {
+	typ dnode
+	dim dnode
+}
+
+type dliteral struct {
+	typ   dnode
+	value string
+	neg   bool
+}
+
+type dunary struct {
+	op      string
+	code    string
+	cast    dnode
+	operand dnode
+	suffix  bool
+}
+
+type dfparam struct {
+	num int
+}
+
+type dinitList struct {
+	typ  dnode
+	list *dexprList
+}
+
+type dbinary struct {
+	op    string
+	code  string
+	left  dnode
+	right dnode
+}
+
+type dtrinary struct {
+	cond   dnode
+	first  dnode
+	second dnode
+}
+
+type dnew struct {
+	array     bool
+	placement *dexprList
+	typ       dnode
+	init      *dexprList
+}
+
+type dexprList struct {
+	list []dnode
+}
+
+/*
+prints the nodes of a demangled name, types are printed in two halves around what they
+declare, the way int (*)[3] wraps a pointer in an array
+*/
+type dprinter struct {
+	buf    bytes.Buffer
+	depth  int
+	failed bool
+	lambda int  /* inside the signature of a lambda, where template parameters print as auto */
+	packed bool /* inside a pack expansion, printing element pack of it */
+	pack   int
+	stale  byte /* c++filt keeps the space of a separator it took back as the last character */
+
+	steps   int      /* nodes visited, shared substitutions can make a short name slow to print */
+	tmpls   []*dargs /* the templates around what is printed, T_ refers to the last */
+	current *dargs   /* the template whose name is printed, a conversion operator in it refers to it */
+}
+
+func (p *dprinter) write(s string) {
+	if p.buf.Len()+len(s) > MAX_DEMANGLED {
+		p.failed = true
+		return
+	}
+	if s != "" {
+		p.stale = 0
+	}
+	p.buf.WriteString(s)
+}
+
+func (p *dprinter) last() byte {
+	if p.stale != 0 {
+		return p.stale
+	}
+	if p.buf.Len() == 0 {
+		return 0
+	}
+	return p.buf.Bytes()[p.buf.Len()-1]
+}
+
+func (p *dprinter) enter() bool {
+	p.depth++
+	p.steps++
+	if p.depth > MAX_DEMANGLE_DEPTH || p.steps > MAX_DEMANGLED*16 {
+		p.failed = true
+	}
+	return !p.failed
+}
+
+func (p *dprinter) print(n dnode) {
+	p.left(n)
+	p.right(n)
+}
+
+func (p *dprinter) string(n dnode) string {
+	sub := &dprinter{depth: p.depth, lambda: p.lambda, packed: p.packed, pack: p.pack, steps: p.steps, tmpls: p.tmpls, current: p.current}
+	sub.print(n)
+	p.steps = sub.steps
+	if sub.failed {
+		p.failed = true
+	}
+	return sub.buf.String()
+}
+
+/* the node a template parameter stands for, at the current element of a pack expansion */
+func (p *dprinter) resolve(n dnode) dnode {
+	n, _ = p.lookup(n)
+	return n
+}
+
+/*
+returns the argument a template parameter stands for and the number of templates it is printed in,
+the argument can refer to the parameters of the templates outside its own
+*/
+func (p *dprinter) lookup(n dnode) (dnode, int) {
+	level := len(p.tmpls)
+	for i := 0; i < MAX_DEMANGLE_DEPTH; i++ {
+		param, ok := n.(*dtparam)
+		if !ok || p.lambda > 0 {
+			return n, level
+		}
+		if level == 0 || param.idx >= len(p.tmpls[level-1].list) {
+			p.failed = true
+			return n, level
+		}
+		n = p.tmpls[level-1].list[param.idx]
+		level--
+		if pack, ok := n.(*dpack); ok {
+			idx := 0
+			if p.packed {
+				idx = p.pack
+			}
+			if idx >= len(pack.list) {
+				p.failed = true
+				return n, level
+			}
+			n = pack.list[idx]
+		}
+	}
+	p.failed = true
+	return n, len(p.tmpls)
+}
+
+/* prints the argument of a template parameter, left or right of what it declares */
+func (p *dprinter) param(n *dtparam, print func(dnode)) {
+	arg, level := p.lookup(n)
+	if arg == dnode(n) {
+		p.failed = true
+		return
+	}
+	tmpls := p.tmpls
+	p.tmpls = p.tmpls[:level:level]
+	print(arg)
+	p.tmpls = tmpls
+}
+
+/* the template arguments of a function name, its parameters and return type can refer to them */
+func (p *dprinter) functionTemplate(n dnode) *dargs {
+	for i := 0; i < MAX_DEMANGLE_DEPTH; i++ {
+		switch name := n.(type) {
+		case *dlocal:
+			n = name.name
+		case *ddefaultArg:
+			n = name.name
+		case *dtemplate:
+			return name.args
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+/* the type under template parameters and qualifiers */
+func (p *dprinter) peel(n dnode) dnode {
+	n = p.resolve(n)
+	for i := 0; i < MAX_DEMANGLE_DEPTH; i++ {
+		q, ok := n.(*dqual)
+		if !ok {
+			break
+		}
+		n = p.resolve(q.typ)
+	}
+	return n
+}
+
+/* whether the type is printed around what it declares: a function or array */
+func (p *dprinter) wraps(n dnode) bool {
+	switch n := p.resolve(n).(type) {
+	case *dfuncType, *darray:
+		return true
+	case *dpointer:
+		return p.wraps(n.typ)
+	case *dref:
+		return p.wraps(n.typ)
+	case *dptrmem:
+		return p.wraps(n.member)
+	case *dqual:
+		return p.wraps(n.typ)
+	}
+	return false
+}
+
+/* the pointer, reference or member pointer declarator around a function or array */
+func (p *dprinter) declarator(inner dnode, s string) {
+	switch p.peel(inner).(type) {
+	case *dfuncType:
+		if c := p.last(); c != '(' && c != '*' && c != ' ' {
+			p.write(" ")
+		}
+		p.write("(")
+	case *darray:
+		p.write(" (")
+	default:
+		p.write(s)
+		return
+	}
+	p.write(strings.TrimPrefix(s, " "))
+}
+
+func (p *dprinter) closeDeclarator(inner dnode) {
+	switch p.peel(inner).(type) {
+	case *dfuncType, *darray:
+		p.write(")")
+	}
+	p.right(inner)
+}
+
+func (p *dprinter) left(n dnode) {
+	if !p.enter() {
+		return
+	}
+	defer func() { p.depth-- }()
+
+	switch n := n.(type) {
+	case *dname:
+		p.write(n.s)
+	case *dnested:
+		p.left(n.scope)
+		p.write("::")
+		p.left(n.name)
+	case *dtemplate:
+		current := p.current
+		p.current = n.args
+		p.left(n.name)
+		p.templateArgs(n.args.list)
+		p.current = current
+	case *dargs:
+		p.templateArgs(n.list)
+	case *dfunc:
+		if args := p.functionTemplate(n.name); args != nil {
+			p.tmpls = append(p.tmpls, args)
+			defer func() { p.tmpls = p.tmpls[:len(p.tmpls)-1] }()
+		}
+		if n.ret != nil {
+			p.left(n.ret)
+			if !p.wraps(n.ret) {
+				p.write(" ")
+			}
+		}
+		p.left(n.name)
+		p.write("(")
+		p.list(n.params)
+		p.write(")" + n.cv + n.ref)
+		if n.ret != nil {
+			p.right(n.ret)
+		}
+	case *dlocal:
+		p.print(n.fn)
+		p.write("::")
+		p.print(n.name)
+	case *dclone:
+		p.print(n.node)
+		p.write(" [clone " + n.suffix + "]")
+	case *dspecial:
+		p.write(n.prefix)
+		p.print(n.node)
+	case *dctorVtable:
+		p.write("construction vtable for ")
+		p.print(n.base)
+		p.write("-in-")
+		p.print(n.derived)
+	case *dlambda:
+		p.write("{lambda(")
+		p.lambda++
+		p.list(n.params)
+		p.lambda--
+		p.write(")#" + strconv.Itoa(n.num+1) + "}")
+	case *dunnamed:
+		p.write("{unnamed type#" + strconv.Itoa(n.num+1) + "}")
+	case *ddefaultArg:
+		p.write("{default arg#" + strconv.Itoa(n.num+1) + "}::")
+		p.print(n.name)
+	case *dbinding:
+		p.write("[")
+		p.list(n.names)
+		p.write("]")
+	case *dabiTag:
+		p.left(n.name)
+		p.write("[abi:" + n.tag + "]")
+	case *dctor:
+		if n.dtor {
+			p.write("~")
+		}
+		p.write(n.name)
+	case *dconversion:
+		p.write("operator ")
+		if p.current != nil {
+			p.tmpls = append(p.tmpls, p.current)
+			defer func() { p.tmpls = p.tmpls[:len(p.tmpls)-1] }()
+		}
+		p.print(n.typ)
+	case *dpack:
+		p.list(n.list)
+	case *dtparam:
+		if p.lambda > 0 {
+			p.write("auto:" + strconv.Itoa(n.idx+1))
+			return
+		}
+		p.param(n, p.left)
+	case *dqual:
+		p.left(n.typ)
+		// qualifiers the template argument already has are not repeated
+		quals := n.quals
+		if q, ok := p.resolve(n.typ).(*dqual); ok {
+			for _, qual := range strings.Fields(q.quals) {
+				quals = strings.Replace(quals, " "+qual, "", 1)
+			}
+		}
+		p.write(quals)
+	case *dfuncType:
+		p.left(n.ret)
+		if !p.wraps(n.ret) {
+			p.write(" ")
+		}
+	case *ddecltype:
+		p.write("decltype (")
+		p.print(n.expr)
+		p.write(")")
+	case *dexpansion:
+		p.expansion(n, "")
+	case *dvector:
+		p.left(n.typ)
+		p.write(" __vector(")
+		p.print(n.dim)
+		p.write(")")
+	case *dptrmem:
+		p.left(n.member)
+		p.declarator(n.member, " "+p.string(n.class)+"::*")
+	case *dpointer:
+		p.left(n.typ)
+		p.declarator(n.typ, "*")
+	case *dref:
+		// a reference to a reference collapses, && only survives on both sides
+		inner, rvalue := p.resolve(n.typ), n.rvalue
+		for {
+			r, ok := inner.(*dref)
+			if !ok {
+				break
+			}
+			rvalue = rvalue && r.rvalue
+			inner = p.resolve(r.typ)
+		}
+		p.left(inner)
+		if rvalue {
+			p.declarator(inner, "&&")
+		} else {
+			p.declarator(inner, "&")
+		}
+	case *dsuffix:
+		p.left(n.typ)
+		p.write(n.suffix)
+	case *darray:
+		p.left(n.typ)
+	case *dliteral:
+		p.literal(n)
+	case *dunary:
+		p.unary(n)
+	case *dfparam:
+		p.write("{parm#" + strconv.Itoa(n.num+1) + "}")
+	case *dinitList:
+		if n.typ != nil {
+			p.print(n.typ)
+		}
+		p.write("{")
+		p.list(n.list.list)
+		p.write("}")
+	case *dbinary:
+		p.binary(n)
+	case *dtrinary:
+		p.subexpr(n.cond)
+		p.write("?")
+		p.subexpr(n.first)
+		p.write(" : ")
+		p.subexpr(n.second)
+	case *dnew:
+		if n.array {
+			p.write("new[]")
+		} else {
+			p.write("new")
+		}
+		if len(n.placement.list) > 0 {
+			p.write(" (")
+			p.list(n.placement.list)
+			p.write(")")
+		}
+		p.write(" ")
+		p.print(n.typ)
+		if n.init != nil {
+			p.write("(")
+			p.list(n.init.list)
+			p.write(")")
+		}
+	case *dexprList:
+		p.list(n.list)
+	default:
+		p.failed = true
+	}
+}
+
+func (p *dprinter) right(n dnode) {
+	if !p.enter() {
+		return
+	}
+	defer func() { p.depth-- }()
+
+	switch n := n.(type) {
+	case *dtparam:
+		if p.lambda == 0 {
+			p.param(n, p.right)
+		}
+	case *dqual:
+		p.right(n.typ)
+	case *dfuncType:
+		p.write("(")
+		p.list(n.params)
+		p.write(")" + n.cv + n.ref + n.except)
+		p.right(n.ret)
+	case *dptrmem:
+		p.closeDeclarator(n.member)
+	case *dpointer:
+		p.closeDeclarator(n.typ)
+	case *dref:
+		inner := p.resolve(n.typ)
+		for {
+			r, ok := inner.(*dref)
+			if !ok {
+				break
+			}
+			inner = p.resolve(r.typ)
+		}
+		p.closeDeclarator(inner)
+	case *dsuffix:
+		p.right(n.typ)
+	case *darray:
+		if p.last() != ']' {
+			p.write(" ")
+		}
+		p.write("[")
+		if n.dim != nil {
+			p.print(n.dim)
+		}
+		p.write("]")
+		p.right(n.typ)
+	}
+}
+
+/* <...> after a template name, with a space to keep >> and operator<< apart */
+func (p *dprinter) templateArgs(args []dnode) {
+	if p.last() == '<' {
+		p.write(" ")
+	}
+	p.write("<")
+	p.list(args)
+	if p.last() == '>' {
+		p.write(" ")
+	}
+	p.write(">")
+}
+
+/* prints nodes separated by commas, expanding packs and leaving out empty ones */
+func (p *dprinter) list(nodes []dnode) {
+	printed := false
+	for _, n := range nodes {
+		mark := p.buf.Len()
+		if printed {
+			p.write(", ")
+		}
+		start := p.buf.Len()
+		if e, ok := n.(*dexpansion); ok {
+			p.expansion(e, ", ")
+		} else {
+			p.print(n)
+		}
+		if p.buf.Len() == start {
+			if mark != start {
+				p.buf.Truncate(mark)
+				p.stale = ' '
+			}
+		} else {
+			printed = true
+		}
+	}
+}
+
+/* prints the pattern once for each element of the pack in it, or with ... when there is none */
+func (p *dprinter) expansion(e *dexpansion, sep string) {
+	count := p.packSize(e.pattern, 0)
+	if count < 0 {
+		p.print(e.pattern)
+		p.write("...")
+		return
+	}
+	packed, pack := p.packed, p.pack
+	p.packed = true
+	for i := 0; i < count && !p.failed; i++ {
+		if i > 0 {
+			if sep == "" {
+				p.write(", ")
+			} else {
+				p.write(sep)
+			}
+		}
+		p.pack = i
+		p.print(e.pattern)
+	}
+	p.packed, p.pack = packed, pack
+}
+
+/* the number of elements of the first pack a template parameter in n refers to, -1 if none */
+func (p *dprinter) packSize(n dnode, depth int) int {
+	p.steps++
+	if depth > MAX_DEMANGLE_DEPTH || p.steps > MAX_DEMANGLED*16 {
+		p.failed = true
+		return -1
+	}
+	first := func(nodes ...dnode) int {
+		for _, c := range nodes {
+			if c == nil {
+				continue
+			}
+			if size := p.packSize(c, depth+1); size >= 0 {
+				return size
+			}
+		}
+		return -1
+	}
+	switch n := n.(type) {
+	case *dtparam:
+		level := len(p.tmpls)
+		if level == 0 || n.idx >= len(p.tmpls[level-1].list) {
+			return -1
+		}
+		if pack, ok := p.tmpls[level-1].list[n.idx].(*dpack); ok {
+			return len(pack.list)
+		}
+	case *dnested:
+		return first(n.scope, n.name)
+	case *dtemplate:
+		return first(append([]dnode{n.name}, n.args.list...)...)
+	case *dqual:
+		return first(n.typ)
+	case *dfuncType:
+		return first(append([]dnode{n.ret}, n.params...)...)
+	case *ddecltype:
+		return first(n.expr)
+	case *dvector:
+		return first(n.typ)
+	case *dptrmem:
+		return first(n.class, n.member)
+	case *dpointer:
+		return first(n.typ)
+	case *dref:
+		return first(n.typ)
+	case *dsuffix:
+		return first(n.typ)
+	case *darray:
+		return first(n.typ, n.dim)
+	case *dunary:
+		return first(n.cast, n.operand)
+	case *dbinary:
+		return first(n.left, n.right)
+	case *dtrinary:
+		return first(n.cond, n.first, n.second)
+	case *dexprList:
+		return first(n.list...)
+	case *dinitList:
+		return first(n.typ, n.list)
+	}
+	return -1
+}
+
+/* an operand, in parentheses unless it is a name */
+func (p *dprinter) subexpr(n dnode) {
+	switch n := n.(type) {
+	case *dname:
+		if !n.builtin {
+			p.print(n)
+			return
+		}
+	case *dnested, *dinitList, *dfparam:
+		p.print(n)
+		return
+	}
+	p.write("(")
+	p.print(n)
+	p.write(")")
+}
+
+func (p *dprinter) unary(n *dunary) {
+	if n.cast != nil {
+		if list, ok := n.operand.(*dexprList); ok {
+			p.print(n.cast)
+			p.write("(")
+			p.list(list.list)
+			p.write(")")
+			return
+		}
+		p.write("(")
+		p.print(n.cast)
+		p.write(")")
+		p.subexpr(n.operand)
+		return
+	}
+
+	operand := n.operand
+	if f, ok := operand.(*dfunc); ok && n.code == "ad" {
+		// the address of a member function is printed without its type
+		if _, ok := f.name.(*dnested); ok {
+			operand = f.name
+		}
+	}
+	switch {
+	case n.suffix:
+		p.subexpr(operand)
+		p.write(n.op)
+	case n.code == "sP" || n.code == "sZ":
+		p.write(n.op + "(")
+		p.print(operand)
+		p.write(")")
+	default:
+		p.write(n.op)
+		p.subexpr(operand)
+	}
+}
+
+func (p *dprinter) binary(n *dbinary) {
+	switch n.code {
+	case "dc", "sc", "cc", "rc":
+		p.write(n.op + "<")
+		p.print(n.left)
+		p.write(">(")
+		p.print(n.right)
+		p.write(")")
+		return
+	case "cl":
+		p.subexpr(n.left)
+		p.write("(")
+		p.print(n.right)
+		p.write(")")
+		return
+	case "ix":
+		p.subexpr(n.left)
+		p.write("[")
+		p.print(n.right)
+		p.write("]")
+		return
+	}
+	// a > would end the template argument list it is in
+	if n.code == "gt" {
+		p.write("(")
+	}
+	p.subexpr(n.left)
+	p.write(n.op)
+	if n.code == "dt" || n.code == "pt" {
+		p.print(n.right)
+	} else {
+		p.subexpr(n.right)
+	}
+	if n.code == "gt" {
+		p.write(")")
+	}
+}
+
+/* the suffixes of integer literals, other types are printed as a cast */
+var demangle_literal_suffixes = map[byte]string{
+	'i': "", 'j': "u", 'l': "l", 'm': "ul", 'x': "ll", 'y': "ull",
+}
+
+func (p *dprinter) literal(n *dliteral) {
+	sign := ""
+	if n.neg {
+		sign = "-"
+	}
+	if b, ok := n.typ.(*dname); ok && b.builtin {
+		if suffix, ok := demangle_literal_suffixes[b.code]; ok {
+			p.write(sign + n.value + suffix)
+			return
+		}
+		if b.code == 'b' && !n.neg && (n.value == "0" || n.value == "1") {
+			p.write(map[string]string{"0": "false", "1": "true"}[n.value])
+			return
+		}
+		if b.code == 'f' || b.code == 'd' || b.code == 'e' {
+			p.write("(" + b.s + ")[" + n.value + "]")
+			return
+		}
+	}
+	p.write("(")
+	p.print(n.typ)
+	p.write(")" + sign + n.value)
+}
@@ -0,0 +1,757 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+returns the demangled form of a legacy Rust symbol, an Itanium nested name whose last component
+is the hash h<16 hex digits>, with the $..$ escapes of the path decoded
+*/
+func demangleRustLegacy(name string, verbose bool) (string, bool) {
+	sym := strings.TrimPrefix(name, "_ZN")
+	for _, c := range []byte(sym) {
+		if c != '_' && c != '$' && c != '.' && c != ':' && c != '@' && !isDigit(c) && !isLower(c) && !isUpper(c) {
+			return "", false
+		}
+	}
+	// a .llvm.<hash> or .cold suffix follows the E
+	for i := strings.Index(sym, "E."); i >= 0; {
+		if i >= 19 && strings.HasPrefix(sym[i-19:], "17h") {
+			sym = sym[:i+1]
+			break
+		}
+		next := strings.Index(sym[i+1:], "E.")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	if !strings.HasSuffix(sym, "E") || len(sym) < 20 || !strings.HasPrefix(sym[len(sym)-20:], "17h") {
+		return "", false
+	}
+	sym = sym[:len(sym)-1]
+
+	idents := []string{}
+	for len(sym) > 0 {
+		n := 0
+		i := 0
+		for i < len(sym) && isDigit(sym[i]) && n < len(sym) {
+			n = n*10 + int(sym[i]-'0')
+			i++
+		}
+		if i == 0 || n == 0 || i+n > len(sym) {
+			return "", false
+		}
+		idents = append(idents, sym[i:i+n])
+		sym = sym[i+n:]
+	}
+	if !isRustHash(idents[len(idents)-1]) {
+		return "", false
+	}
+	if !verbose {
+		idents = idents[:len(idents)-1]
+	}
+
+	var out strings.Builder
+	for i, ident := range idents {
+		if i > 0 {
+			out.WriteString("::")
+		}
+		out.WriteString(rustLegacyIdent(ident))
+	}
+	return out.String(), true
+}
+
+/* h and 16 lower case hex digits, of which at least 5 differ so that a C++ name is not taken for one */
+func isRustHash(s string) bool {
+	if len(s) != 17 || s[0] != 'h' {
+		return false
+	}
+	seen := map[rune]bool{}
+	for _, c := range s[1:] {
+		if !isDigit(byte(c)) && (c < 'a' || c > 'f') {
+			return false
+		}
+		seen[c] = true
+	}
+	return len(seen) >= 5
+}
+
+var rust_legacy_escapes = map[string]byte{
+	"SP": '@', "BP": '*', "RF": '&', "LT": '<', "GT": '>', "LP": '(', "RP": ')', "C": ',',
+}
+
+/* decodes $LT$, $u20$ and .. in a legacy identifier, an escape c++filt does not know is left as it is with the rest */
+func rustLegacyIdent(ident string) string {
+	if strings.HasPrefix(ident, "_$") {
+		ident = ident[1:]
+	}
+	var out strings.Builder
+	for len(ident) > 0 {
+		switch {
+		case ident[0] == '$':
+			end := strings.IndexByte(ident[1:], '$')
+			if end < 0 {
+				out.WriteString(ident)
+				return out.String()
+			}
+			escape := ident[1 : end+1]
+			c, ok := rust_legacy_escapes[escape]
+			if !ok && len(escape) == 3 && escape[0] == 'u' {
+				// only printable ASCII
+				v, err := strconv.ParseUint(escape[1:], 16, 8)
+				ok = err == nil && v >= 0x20 && v < 0x80 && strings.ToLower(escape) == escape
+				c = byte(v)
+			}
+			if !ok {
+				out.WriteString(ident)
+				return out.String()
+			}
+			out.WriteByte(c)
+			ident = ident[end+2:]
+		case strings.HasPrefix(ident, ".."):
+			out.WriteString("::")
+			ident = ident[2:]
+		default:
+			end := strings.IndexAny(ident[1:], "$.") + 1
+			if end == 0 {
+				end = len(ident)
+			}
+			out.WriteString(ident[:end])
+			ident = ident[end:]
+		}
+	}
+	return out.String()
+}
+
+/* the state of demangling a Rust v0 (_R) symbol, paths and types can refer back to earlier ones */
+type rustDemangler struct {
+	s       string /* the symbol after _R */
+	pos     int
+	depth   int
+	steps   int
+	skip    bool /* parsing what is not printed, such as the path of an impl */
+	verbose bool /* print crate disambiguators and the types of constants */
+	bound   int  /* lifetimes bound by for<...> around what is printed */
+	out     strings.Builder
+}
+
+func demangleRust(name string, verbose bool) (s string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(demangleError)
+			if !ok {
+				panic(r)
+			}
+			s, err = "", fmt.Errorf("error: cannot demangle %s: %s", name, string(e))
+		}
+	}()
+
+	sym := strings.TrimPrefix(name, "_R")
+	// suffixes such as .llvm.<hash> are not part of the symbol
+	if i := strings.IndexByte(sym, '.'); i >= 0 {
+		sym = sym[:i]
+	}
+	if sym == "" || !isUpper(sym[0]) {
+		return "", fmt.Errorf("error: %s is not a Rust symbol", name)
+	}
+	for _, c := range []byte(sym) {
+		if c != '_' && !isDigit(c) && !isLower(c) && !isUpper(c) {
+			return "", fmt.Errorf("error: %s is not a Rust symbol", name)
+		}
+	}
+
+	d := &rustDemangler{s: sym, verbose: verbose}
+	d.path(true)
+	// the crate the symbol was instantiated in is not printed
+	if d.pos < len(d.s) {
+		d.skip = true
+		d.path(false)
+	}
+	if d.pos != len(d.s) {
+		d.fail("unexpected %q", d.s[d.pos:])
+	}
+	return d.out.String(), nil
+}
+
+func (d *rustDemangler) fail(format string, args ...any) {
+	panic(demangleError(fmt.Sprintf(format, args...)))
+}
+
+func (d *rustDemangler) print(s string) {
+	if d.skip {
+		return
+	}
+	if d.out.Len()+len(s) > MAX_DEMANGLED {
+		d.fail("too long")
+	}
+	d.out.WriteString(s)
+}
+
+func (d *rustDemangler) peek() byte {
+	if d.pos < len(d.s) {
+		return d.s[d.pos]
+	}
+	return 0
+}
+
+func (d *rustDemangler) next() byte {
+	c := d.peek()
+	if c == 0 {
+		d.fail("unexpected end")
+	}
+	d.pos++
+	return c
+}
+
+func (d *rustDemangler) eat(c byte) bool {
+	if d.peek() == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *rustDemangler) enter() {
+	d.depth++
+	d.steps++
+	if d.depth > MAX_DEMANGLE_DEPTH || d.steps > MAX_DEMANGLED {
+		d.fail("too deeply nested")
+	}
+}
+
+func (d *rustDemangler) leave() {
+	d.depth--
+}
+
+/* <base-62-number>: digits, lower and upper case letters terminated by _, where _ alone is 0 */
+func (d *rustDemangler) base62() uint64 {
+	if d.eat('_') {
+		return 0
+	}
+	var n uint64
+	for !d.eat('_') {
+		c := d.next()
+		var v uint64
+		switch {
+		case isDigit(c):
+			v = uint64(c - '0')
+		case isLower(c):
+			v = uint64(c-'a') + 10
+		case isUpper(c):
+			v = uint64(c-'A') + 36
+		default:
+			d.fail("bad base 62 number")
+		}
+		if n > (1<<64-1-v)/62 {
+			d.fail("base 62 number overflows")
+		}
+		n = n*62 + v
+	}
+	if n == 1<<64-1 {
+		d.fail("base 62 number overflows")
+	}
+	return n + 1
+}
+
+/* an optional tag and base 62 number, 0 when the tag is not there */
+func (d *rustDemangler) optBase62(tag byte) uint64 {
+	if !d.eat(tag) {
+		return 0
+	}
+	return d.base62() + 1
+}
+
+/* <identifier>: [u] <decimal length> [_] <bytes>, u marks the punycode of a non-ASCII name */
+func (d *rustDemangler) ident() string {
+	puny := d.eat('u')
+	c := d.next()
+	if !isDigit(c) {
+		d.fail("bad identifier")
+	}
+	n := int(c - '0')
+	if c != '0' {
+		for isDigit(d.peek()) {
+			n = n*10 + int(d.next()-'0')
+			if n > len(d.s) {
+				d.fail("bad identifier length")
+			}
+		}
+	}
+	d.eat('_')
+	if d.pos+n > len(d.s) {
+		d.fail("bad identifier length")
+	}
+	ident := d.s[d.pos : d.pos+n]
+	d.pos += n
+	if !puny {
+		return ident
+	}
+	// the ASCII characters come before the last _, the insertions of the others after it
+	ascii, code := "", ident
+	if i := strings.LastIndexByte(ident, '_'); i >= 0 {
+		ascii, code = ident[:i], ident[i+1:]
+	}
+	if code == "" {
+		d.fail("bad punycode identifier")
+	}
+	return d.punycode(ascii, code)
+}
+
+/* RFC 3492 punycode decoding */
+func (d *rustDemangler) punycode(ascii, code string) string {
+	const (
+		base  = 36
+		tmin  = 1
+		tmax  = 26
+		skew  = 38
+		damp  = 700
+		bias0 = 72
+	)
+	out := []rune(ascii)
+	n, i, bias := 0x80, 0, bias0
+	first := true
+	for pos := 0; pos < len(code); {
+		old, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(code) {
+				d.fail("bad punycode identifier")
+			}
+			c := code[pos]
+			pos++
+			var digit int
+			switch {
+			case isLower(c):
+				digit = int(c - 'a')
+			case isDigit(c):
+				digit = int(c-'0') + 26
+			default:
+				d.fail("bad punycode identifier")
+			}
+			i += digit * w
+			t := min(max(k-bias, tmin), tmax)
+			if digit < t {
+				break
+			}
+			w *= base - t
+			if i > utf8.MaxRune*len(code) || w > utf8.MaxRune {
+				d.fail("bad punycode identifier")
+			}
+		}
+		// bias adaptation
+		delta := i - old
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		first = false
+		delta += delta / (len(out) + 1)
+		k := 0
+		for delta > (base-tmin)*tmax/2 {
+			delta /= base - tmin
+			k += base
+		}
+		bias = k + (base-tmin+1)*delta/(delta+skew)
+
+		n += i / (len(out) + 1)
+		i %= len(out) + 1
+		if n > utf8.MaxRune || len(out) > MAX_DEMANGLED {
+			d.fail("bad punycode identifier")
+		}
+		out = append(out[:i], append([]rune{rune(n)}, out[i:]...)...)
+		i++
+	}
+	return string(out)
+}
+
+/* a position earlier in the symbol that a B<base-62-number> refers to */
+func (d *rustDemangler) backref(parse func()) {
+	start := d.pos - 1
+	at := d.base62()
+	if at >= uint64(start) {
+		d.fail("bad back reference")
+	}
+	if d.skip {
+		return
+	}
+	pos := d.pos
+	d.pos = int(at)
+	parse()
+	d.pos = pos
+}
+
+/* <path>, with generic arguments preceded by :: where the path is a value rather than a type */
+func (d *rustDemangler) path(value bool) {
+	d.enter()
+	defer d.leave()
+
+	switch c := d.next(); c {
+	case 'C':
+		dis := d.optBase62('s')
+		d.print(d.ident())
+		if d.verbose {
+			d.print("[" + strconv.FormatUint(dis, 16) + "]")
+		}
+	case 'M', 'X', 'Y':
+		if c != 'Y' {
+			// the path of the impl itself is not printed
+			d.optBase62('s')
+			skip := d.skip
+			d.skip = true
+			d.path(value)
+			d.skip = skip
+		}
+		d.print("<")
+		d.typ()
+		if c != 'M' {
+			d.print(" as ")
+			d.path(false)
+		}
+		d.print(">")
+	case 'N':
+		ns := d.next()
+		if !isLower(ns) && !isUpper(ns) {
+			d.fail("bad namespace")
+		}
+		d.path(value)
+		dis := d.optBase62('s')
+		name := d.ident()
+		if isUpper(ns) {
+			// closures, shims and the like
+			d.print("::{")
+			switch ns {
+			case 'C':
+				d.print("closure")
+			case 'S':
+				d.print("shim")
+			default:
+				d.print(string(ns))
+			}
+			if name != "" {
+				d.print(":" + name)
+			}
+			d.print("#" + strconv.FormatUint(dis, 10) + "}")
+		} else if name != "" {
+			d.print("::" + name)
+		}
+	case 'I':
+		d.path(value)
+		if value {
+			d.print("::")
+		}
+		d.print("<")
+		for i := 0; !d.eat('E'); i++ {
+			if i > 0 {
+				d.print(", ")
+			}
+			d.genericArg()
+		}
+		d.print(">")
+	case 'B':
+		d.backref(func() { d.path(value) })
+	default:
+		d.fail("bad path %c", c)
+	}
+}
+
+/* <generic-arg> ::= <lifetime> | <type> | K <const> */
+func (d *rustDemangler) genericArg() {
+	switch {
+	case d.eat('L'):
+		d.lifetime(d.base62())
+	case d.eat('K'):
+		d.constant()
+	default:
+		d.typ()
+	}
+}
+
+/* lifetimes are numbered from the innermost binder, 'a being the outermost */
+func (d *rustDemangler) lifetime(lt uint64) {
+	d.print("'")
+	if lt == 0 {
+		d.print("_")
+		return
+	}
+	if lt > uint64(d.bound) {
+		d.fail("bad lifetime")
+	}
+	depth := uint64(d.bound) - lt
+	if depth < 26 {
+		d.print(string(rune('a' + depth)))
+	} else {
+		d.print("_" + strconv.FormatUint(depth, 10))
+	}
+}
+
+/* G<base-62-number> binds that many lifetimes plus one, printed as for<'a, 'b> */
+func (d *rustDemangler) binder() {
+	n := d.optBase62('G')
+	if n == 0 {
+		return
+	}
+	if n > MAX_DEMANGLE_DEPTH {
+		d.fail("too many lifetimes")
+	}
+	d.print("for<")
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			d.print(", ")
+		}
+		d.bound++
+		d.lifetime(1)
+	}
+	d.print("> ")
+}
+
+var rust_basic_types = map[byte]string{
+	'a': "i8", 'b': "bool", 'c': "char", 'd': "f64", 'e': "str", 'f': "f32", 'h': "u8", 'i': "isize",
+	'j': "usize", 'l': "i32", 'm': "u32", 'n': "i128", 'o': "u128", 'p': "_", 's': "i16", 't': "u16",
+	'u': "()", 'v': "...", 'x': "i64", 'y': "u64", 'z': "!",
+}
+
+func (d *rustDemangler) typ() {
+	d.enter()
+	defer d.leave()
+
+	c := d.next()
+	if name, ok := rust_basic_types[c]; ok {
+		d.print(name)
+		return
+	}
+	switch c {
+	case 'R', 'Q':
+		d.print("&")
+		if d.eat('L') {
+			if lt := d.base62(); lt != 0 {
+				d.lifetime(lt)
+				d.print(" ")
+			}
+		}
+		if c == 'Q' {
+			d.print("mut ")
+		}
+		d.typ()
+	case 'P':
+		d.print("*const ")
+		d.typ()
+	case 'O':
+		d.print("*mut ")
+		d.typ()
+	case 'A', 'S':
+		d.print("[")
+		d.typ()
+		if c == 'A' {
+			d.print("; ")
+			d.constant()
+		}
+		d.print("]")
+	case 'T':
+		d.print("(")
+		i := 0
+		for ; !d.eat('E'); i++ {
+			if i > 0 {
+				d.print(", ")
+			}
+			d.typ()
+		}
+		if i == 1 {
+			d.print(",")
+		}
+		d.print(")")
+	case 'F':
+		bound := d.bound
+		d.binder()
+		if d.eat('U') {
+			d.print("unsafe ")
+		}
+		if d.eat('K') {
+			// the - of an ABI such as C-unwind is mangled as _
+			abi := "C"
+			if !d.eat('C') {
+				if d.peek() == 'u' {
+					d.fail("bad ABI")
+				}
+				abi = strings.ReplaceAll(d.ident(), "_", "-")
+			}
+			d.print("extern \"" + abi + "\" ")
+		}
+		d.print("fn(")
+		for i := 0; !d.eat('E'); i++ {
+			if i > 0 {
+				d.print(", ")
+			}
+			d.typ()
+		}
+		d.print(")")
+		if !d.eat('u') {
+			d.print(" -> ")
+			d.typ()
+		}
+		d.bound = bound
+	case 'D':
+		d.print("dyn ")
+		bound := d.bound
+		d.binder()
+		for i := 0; !d.eat('E'); i++ {
+			if i > 0 {
+				d.print(" + ")
+			}
+			d.dynTrait()
+		}
+		d.bound = bound
+		if !d.eat('L') {
+			d.fail("no lifetime of dyn")
+		}
+		if lt := d.base62(); lt != 0 {
+			d.print(" + ")
+			d.lifetime(lt)
+		}
+	case 'B':
+		d.backref(d.typ)
+	default:
+		d.pos--
+		d.path(false)
+	}
+}
+
+/* a trait of a dyn type, its associated type bindings join its generic arguments as in Iterator<Item = u8> */
+func (d *rustDemangler) dynTrait() {
+	open := d.openGenerics()
+	for d.eat('p') {
+		if open {
+			d.print(", ")
+		} else {
+			d.print("<")
+		}
+		open = true
+		d.print(d.ident() + " = ")
+		d.typ()
+	}
+	if open {
+		d.print(">")
+	}
+}
+
+/* prints a path leaving its generic arguments open, reports whether there were any */
+func (d *rustDemangler) openGenerics() bool {
+	d.enter()
+	defer d.leave()
+
+	open := false
+	switch {
+	case d.eat('B'):
+		d.backref(func() { open = d.openGenerics() })
+	case d.eat('I'):
+		d.path(false)
+		d.print("<")
+		open = true
+		for i := 0; !d.eat('E'); i++ {
+			if i > 0 {
+				d.print(", ")
+			}
+			d.genericArg()
+		}
+	default:
+		d.path(false)
+	}
+	return open
+}
+
+/* <const>: a type and hex digits, printed as a value with its type */
+func (d *rustDemangler) constant() {
+	d.enter()
+	defer d.leave()
+
+	if d.eat('B') {
+		d.backref(d.constant)
+		return
+	}
+	c := d.next()
+	switch c {
+	case 'p':
+		d.print("_")
+		return
+	case 'h', 't', 'm', 'y', 'o', 'j':
+		d.print(d.constUint())
+	case 'a', 's', 'l', 'x', 'n', 'i':
+		if d.eat('n') {
+			d.print("-")
+		}
+		d.print(d.constUint())
+	case 'b':
+		switch d.hex() {
+		case "0":
+			d.print("false")
+		case "1":
+			d.print("true")
+		default:
+			d.fail("bad bool constant")
+		}
+	case 'c':
+		hex := d.hex()
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if hex == "" || err != nil {
+			d.fail("bad char constant")
+		}
+		d.print(rustChar(rune(v)))
+	default:
+		d.fail("bad constant type %c", c)
+	}
+	if d.verbose {
+		d.print(": " + rust_basic_types[c])
+	}
+}
+
+/* hex digits terminated by _ */
+func (d *rustDemangler) hex() string {
+	start := d.pos
+	for !d.eat('_') {
+		c := d.next()
+		if !isDigit(c) && (c < 'a' || c > 'f') {
+			d.fail("bad constant")
+		}
+	}
+	return d.s[start : d.pos-1]
+}
+
+/*
+an unsigned constant in decimal, or as hex when it does not fit 64 bits, where c++filt
+leaves out the first digit and keeps the terminating _
+*/
+func (d *rustDemangler) constUint() string {
+	hex := d.hex()
+	if hex == "" {
+		return "0"
+	}
+	if len(hex) > 16 {
+		return "0x" + hex[1:] + "_"
+	}
+	v, _ := strconv.ParseUint(hex, 16, 64)
+	return strconv.FormatUint(v, 10)
+}
+
+/* a char literal, with printable ASCII as it is and the rest escaped */
+func rustChar(c rune) string {
+	switch c {
+	case '\t':
+		return `'\t'`
+	case '\r':
+		return `'\r'`
+	case '\n':
+		return `'\n'`
+	case '\\':
+		return `'\\'`
+	case '\'':
+		return `'\''`
+	}
+	if c >= 0x20 && c <= 0x7e {
+		return "'" + string(c) + "'"
+	}
+	return fmt.Sprintf(`'\u{%x}'`, c)
+}
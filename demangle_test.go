@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+)
+
+/* names and what GNU c++filt 2.40 prints for them */
+var demangle_tests = []struct{ name, want string }{
+	// Itanium C++ ABI
+	{"_Z1fPKc", "f(char const*)"},
+	{"_Z1fDv4_f", "f(float __vector(4))"},
+	{"_Z1fPA3_i", "f(int (*) [3])"},
+	{"_Z1fA3_Pi", "f(int* [3])"},
+	{"_Z1fM1AKFvvE", "f(void (A::*)() const)"},
+	{"_Z1fPFPFviEiE", "f(void (*(*)(int))(int))"},
+	{"_Z1fPVKri", "f(int restrict const volatile*)"},
+	{"_Z1fPDoFvvE", "f(void (*)() noexcept)"},
+	{"_Z1fCd", "f(double _Complex)"},
+	{"_Z1fDn", "f(decltype(nullptr))"},
+	{"_ZNK1A1fEv", "A::f() const"},
+	{"_ZNVKO1A1fEv", "A::f() const volatile &&"},
+	{"_ZN1A1fB5cxx11Ev", "A::f[abi:cxx11]()"},
+	{"_ZN1AD2Ev", "A::~A()"},
+	{"_ZN1AIiEC1Ev", "A<int>::A()"},
+	{"_ZN1AcviEv", "A::operator int()"},
+	{"_ZN1AcvT_IiEEv", "A::operator int<int>()"},
+	{"_ZN1AplERKS_", "A::operator+(A const&)"},
+	{"_ZN1AlsIiEEvT_", "void A::operator<< <int>(int)"},
+	{"_ZN12_GLOBAL__N_11fEv", "(anonymous namespace)::f()"},
+	{"_Z1fIXadL_ZN1A1gEvEEEvv", "void f<&A::g>()"},
+	{"_Z1fILb1ELi5ELj5ELc97ELs3ELin3EEvv", "void f<true, 5, 5u, (char)97, (short)3, -3>()"},
+	{"_Z1fIJidEEvDpT_", "void f<int, double>(int, double)"},
+	{"_Z1fIJEEvDpT_", "void f<>()"},
+	{"_Z1fIiEPFvvEv", "void (*f<int>())()"},
+	{"_Z1fIA3_iEvRKT_", "void f<int [3]>(int const (&) [3])"},
+	{"_Z1fIiEDTplfp_Li1EET_", "decltype ({parm#1}+(1)) f<int>(int)"},
+	{"_Z1fIiEvDtsrT_1xE", "void f<int>(decltype (int::x))"},
+	{"_ZN5Outer5InnerIiE1fIdEEvT_", "void Outer::Inner<int>::f<double>(double)"},
+	{"_ZZ1fvENKUlT_E_clIiEEDaS_", "auto f()::{lambda(auto:1)#1}::operator()<int>(int) const"},
+	{"_ZZ1fvEs", "f()::string literal"},
+	{"_ZNSt6vectorIiSaIiEE9push_backERKi", "std::vector<int, std::allocator<int> >::push_back(int const&)"},
+	{"_ZNSsC1Ev", "std::basic_string<char, std::char_traits<char>, std::allocator<char> >::basic_string()"},
+	{"_Z1fSt8functionIFviEE", "f(std::function<void (int)>)"},
+	{"_ZTv0_n24_N1A1fEv", "virtual thunk to A::f()"},
+	{"_ZThn8_N1A1fEv", "non-virtual thunk to A::f()"},
+	{"_ZTCN1C1DE0_N1A1BE", "construction vtable for A::B-in-C::D"},
+	{"_ZGVZ1fvE1x", "guard variable for f()::x"},
+	{"_ZTV1A", "vtable for A"},
+	{"_ZTI1A", "typeinfo for A"},
+	{"_ZTH1x", "TLS init function for x"},
+	{"_Z3foov.isra.0.cold", "foo() [clone .isra.0] [clone .cold]"},
+	{"_ZNKSs4sizeEv@@GLIBCXX_3.4", "std::basic_string<char, std::char_traits<char>, std::allocator<char> >::size() const@@GLIBCXX_3.4"},
+
+	// Rust v0
+	{"_RNvCsd31AUCFlsec_3lib4more", "lib[97fccac71d395f0a]::more"},
+	{"_RNvC3foo3bar.llvm.123", "foo[0]::bar"},
+	{"_RNCNvCsd31AUCFlsec_3lib3alls1_0B3_", "lib[97fccac71d395f0a]::all::{closure#3}"},
+	{"_RNvCsd31AUCFlsec_3libu9gre_6ka8i", "lib[97fccac71d395f0a]::größe"},
+	{"_RINvCsd31AUCFlsec_3lib7genericKj2_FhEzEB2_", "lib[97fccac71d395f0a]::generic::<2: usize, fn(u8) -> !>"},
+	{"_RNvMs0_Csd31AUCFlsec_3libINtB5_3CstKb0_Kcfc_Kl3_Ky0_E3getB5_", "<lib[97fccac71d395f0a]::Cst<false: bool, '\\u{fc}': char, 3: i32, 0: u64>>::get"},
+	{"_RNvMs0_Csd31AUCFlsec_3libINtB5_3CstKb1_Kc78_Kln5_Ky7_E3getB5_", "<lib[97fccac71d395f0a]::Cst<true: bool, 'x': char, -5: i32, 7: u64>>::get"},
+	{"_RINvMNtCsd31AUCFlsec_3libu13ncd_dma1a7bzbNtB3_u9Strae_oqa5gehenTtbEEB5_", "<lib[97fccac71d395f0a]::ünïcödé::Straße>::gehen::<(u16, bool)>"},
+	{"_RNvXCsd31AUCFlsec_3libINtB2_3FooReENtB2_2Tr1mB2_", "<lib[97fccac71d395f0a]::Foo<&str> as lib[97fccac71d395f0a]::Tr>::m"},
+	{"_RNvXsa_NtCs5GmCzIpY9Qj_4core5arrayAbj3_NtNtB7_3fmt5Debug3fmtCsd31AUCFlsec_3lib", "<[bool; 3: usize] as core[42326c15e70145c1]::fmt::Debug>::fmt"},
+	{"_RNSNvYNCNvCsd31AUCFlsec_3lib3all0INtNtNtCs5GmCzIpY9Qj_4core3ops8function6FnOnceTReEE9call_once6vtableB8_", "<lib[97fccac71d395f0a]::all::{closure#0} as core[42326c15e70145c1]::ops::function::FnOnce<(&str,)>>::call_once::{shim:vtable#0}"},
+	{"_RINvC3foo3barDNtC4core8Iteratorp4ItemmEL_E", "foo[0]::bar::<dyn core[0]::Iterator<Item = u32>>"},
+	{"_RINvC3foo3barFG_RL0_hEuE", "foo[0]::bar::<for<'a> fn(&'a u8)>"},
+	{"_RINvC3foo3barKj123456789abcdef01_E", "foo[0]::bar::<0x23456789abcdef01_: usize>"},
+
+	// Rust legacy
+	{"_ZN3std3sys2fs10remove_dir17ha195d384278a23aaE", "std::sys::fs::remove_dir::ha195d384278a23aa"},
+	{"_ZN60_$LT$std..time..Instant$u20$as$u20$core..ops..arith..Sub$GT$3sub17h307d2ff72e716d41E", "<std::time::Instant as core::ops::arith::Sub>::sub::h307d2ff72e716d41"},
+	{"_ZN3lib24Cst$LT$_$C$_$C$_$C$_$GT$3get17h7db8c39b11a82dd7E", "lib::Cst<_,_,_,_>::get::h7db8c39b11a82dd7"},
+	{"_ZN3lib13gr$uf6$$udf$e17ha64d3dd0af6ce0c1E", "lib::gr$uf6$$udf$e::ha64d3dd0af6ce0c1"},
+	{"_ZN3std2io5stdio19OUTPUT_CAPTURE_USED17haefae5e0118b70edE.0", "std::io::stdio::OUTPUT_CAPTURE_USED::haefae5e0118b70ed"},
+}
+
+func TestDemangle(t *testing.T) {
+	for _, test := range demangle_tests {
+		got, err := Demangle(test.name)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s:\n got %s\nwant %s", test.name, got, test.want)
+		}
+	}
+}
+
+/* readelf -C prints the short forms */
+func TestDemangleShort(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"_ZNKSs12find_last_ofERKSsm", "std::string::find_last_of(std::string const&, unsigned long) const"},
+		{"_ZNKSo6sentrycvbEv", "std::ostream::sentry::operator bool() const"},
+		{"_ZNSsC1ERKSaIcE", "std::basic_string<char, std::char_traits<char>, std::allocator<char> >::basic_string(std::allocator<char> const&)"},
+		{"_ZN3std3sys2fs10remove_dir17ha195d384278a23aaE", "std::sys::fs::remove_dir"},
+		{"_RNvMs0_Csd31AUCFlsec_3libINtB5_3CstKb1_Kc78_Kln5_Ky7_E3getB5_", "<lib::Cst<true, 'x', -5, 7>>::get"},
+		{"_RINvCsd31AUCFlsec_3lib7genericKj2_FhEzEB2_", "lib::generic::<2, fn(u8) -> !>"},
+	}
+	for _, test := range tests {
+		got, err := demangleName(test.name, false)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s:\n got %s\nwant %s", test.name, got, test.want)
+		}
+	}
+}
+
+/* names c++filt leaves as they are */
+func TestDemangleInvalid(t *testing.T) {
+	for _, name := range []string{"", "main", "_Z", "_Zx", "_Z1", "_ZGR1x_", "_Z1fIT_Ev", "_R", "_RNvC3foo", "_RNvC3foo3barKRe3abc_E"} {
+		if got, err := Demangle(name); err == nil {
+			t.Errorf("%q demangled to %q", name, got)
+		}
+		if got := demangled(name, true); got != name {
+			t.Errorf("%q shown as %q", name, got)
+		}
+	}
+}
+
+func FuzzDemangle(f *testing.F) {
+	for _, test := range demangle_tests {
+		f.Add(test.name)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		if s, err := Demangle(name); err == nil && len(s) > MAX_DEMANGLED+len(name) {
+			t.Fatalf("%d bytes demangled from %d", len(s), len(name))
+		}
+	})
+}
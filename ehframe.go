@@ -0,0 +1,581 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+/* a Common Information Entry of .eh_frame: what the FDEs that point to it share */
+type EhCie struct {
+	codeAlign uint64
+	dataAlign int64
+	raReg     uint64 /* the DWARF register holding the return address */
+	fdeEnc    byte   /* the pointer encoding of the FDE addresses */
+	aug       bool   /* the FDEs have augmentation data to skip */
+	signal    bool   /* the FDEs describe signal trampolines, whose return address is not after a call */
+	initial   []byte
+}
+
+/* a Frame Description Entry: the unwind rules of the code in [start, end) */
+type EhFde struct {
+	cie   *EhCie
+	start Elf64_Addr
+	end   Elf64_Addr
+	insns []byte
+}
+
+/* how to find the caller's value of a register */
+type cfaRule struct {
+	kind   int
+	offset int64
+	reg    uint64
+	expr   []byte
+}
+
+const (
+	ruleSame      = iota /* unchanged */
+	ruleUndefined        /* lost, as the return address of the outermost frame */
+	ruleOffset           /* saved at CFA+offset */
+	ruleValOffset        /* is CFA+offset */
+	ruleRegister         /* held in another register */
+	ruleExpr             /* saved at the address the expression computes */
+	ruleValExpr          /* is the value of the expression */
+)
+
+/* the rules at one address: how to compute the canonical frame address and the registers of the caller */
+type cfaRow struct {
+	cfaReg    uint64
+	cfaOffset int64
+	cfaExpr   []byte
+	rules     map[uint64]cfaRule
+}
+
+func (row *cfaRow) copy() *cfaRow {
+	c := *row
+	c.rules = map[uint64]cfaRule{}
+	for reg, rule := range row.rules {
+		c.rules[reg] = rule
+	}
+	return &c
+}
+
+/* reads the encoded values of call frame information, with the address data is loaded at for pc-relative pointers */
+type cfiReader struct {
+	data  []byte
+	pos   int
+	addr  Elf64_Addr
+	order binary.ByteOrder
+	bad   bool /* a read went past the end or met an encoding that cannot be decoded */
+}
+
+func (r *cfiReader) done() bool {
+	return r.bad || r.pos >= len(r.data)
+}
+
+func (r *cfiReader) take(n int) []byte {
+	if n < 0 || n > len(r.data)-r.pos {
+		r.bad = true
+		r.pos = len(r.data)
+		return make([]byte, max(n, 0))
+	}
+	r.pos += n
+	return r.data[r.pos-n : r.pos]
+}
+
+func (r *cfiReader) u8() byte      { return r.take(1)[0] }
+func (r *cfiReader) u16() uint16   { return r.order.Uint16(r.take(2)) }
+func (r *cfiReader) u32() uint32   { return r.order.Uint32(r.take(4)) }
+func (r *cfiReader) u64() uint64   { return r.order.Uint64(r.take(8)) }
+func (r *cfiReader) block() []byte { return r.take(int(min(r.uleb(), uint64(len(r.data))))) }
+
+func (r *cfiReader) uleb() uint64 {
+	var value uint64
+	for shift := uint(0); ; shift += 7 {
+		b := r.u8()
+		if shift < 64 {
+			value |= uint64(b&0x7f) << shift
+		}
+		if b&0x80 == 0 || r.bad {
+			return value
+		}
+	}
+}
+
+func (r *cfiReader) sleb() int64 {
+	var value int64
+	shift := uint(0)
+	for {
+		b := r.u8()
+		if shift < 64 {
+			value |= int64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 || r.bad {
+			if shift < 64 && b&0x40 != 0 {
+				value |= -1 << shift
+			}
+			return value
+		}
+	}
+}
+
+func (r *cfiReader) cString() string {
+	start := r.pos
+	for !r.done() && r.data[r.pos] != 0 {
+		r.pos++
+	}
+	s := string(r.data[start:r.pos])
+	r.u8()
+	return s
+}
+
+/* reads a pointer in one of the DW_EH_PE encodings, only absolute and pc-relative ones can be resolved */
+func (r *cfiReader) pointer(enc byte) Elf64_Addr {
+	if enc == DW_EH_PE_omit {
+		return 0
+	}
+	var base Elf64_Addr
+	switch enc & 0x70 {
+	case DW_EH_PE_absptr:
+	case DW_EH_PE_pcrel:
+		base = r.addr + Elf64_Addr(r.pos)
+	default:
+		r.bad = true
+	}
+
+	var value uint64
+	switch enc & 0x0f {
+	case DW_EH_PE_absptr, DW_EH_PE_udata8, DW_EH_PE_sdata8:
+		value = r.u64()
+	case DW_EH_PE_uleb128:
+		value = r.uleb()
+	case DW_EH_PE_udata2:
+		value = uint64(r.u16())
+	case DW_EH_PE_udata4:
+		value = uint64(r.u32())
+	case DW_EH_PE_sleb128:
+		value = uint64(r.sleb())
+	case DW_EH_PE_sdata2:
+		value = uint64(int16(r.u16()))
+	case DW_EH_PE_sdata4:
+		value = uint64(int32(r.u32()))
+	default:
+		r.bad = true
+	}
+	return base + Elf64_Addr(value)
+}
+
+/* reads the CIE at offset, nil when it cannot be decoded */
+func parseCie(data []byte, offset int, addr Elf64_Addr, order binary.ByteOrder) *EhCie {
+	r := &cfiReader{data: data, pos: offset, addr: addr, order: order}
+	length := uint64(r.u32())
+	if length == 0xffffffff {
+		length = r.u64()
+	}
+	if length > uint64(len(data)-r.pos) || r.u32() != 0 {
+		return nil
+	}
+	r.data = data[:r.pos-4+int(length)]
+
+	cie := &EhCie{}
+	version := r.u8()
+	augmentation := r.cString()
+	if version >= 4 {
+		r.take(2) // address and segment selector sizes
+	}
+	cie.codeAlign = r.uleb()
+	cie.dataAlign = r.sleb()
+	if version == 1 {
+		cie.raReg = uint64(r.u8())
+	} else {
+		cie.raReg = r.uleb()
+	}
+
+	if len(augmentation) != 0 {
+		// without the size of the augmentation data, unknown augmentations cannot be skipped
+		if augmentation[0] != 'z' {
+			return nil
+		}
+		cie.aug = true
+		data := r.block()
+		aug := &cfiReader{data: data, addr: r.addr + Elf64_Addr(r.pos-len(data)), order: order}
+		for _, c := range augmentation[1:] {
+			switch c {
+			case 'L':
+				aug.u8()
+			case 'P':
+				aug.pointer(aug.u8() &^ 0x80)
+			case 'R':
+				cie.fdeEnc = aug.u8()
+			case 'S':
+				cie.signal = true
+			}
+		}
+	}
+	if r.bad {
+		return nil
+	}
+	cie.initial = r.data[r.pos:]
+	return cie
+}
+
+/*
+parses the CIEs and FDEs of an .eh_frame section loaded at addr, sorted by address.
+The section ends at its end or at a zero length entry, as the one crtend.o adds.
+*/
+func parseEhFrame(data []byte, addr Elf64_Addr, order binary.ByteOrder) ([]*EhFde, error) {
+	cies := map[int]*EhCie{}
+	fdes := []*EhFde{}
+	r := &cfiReader{data: data, addr: addr, order: order}
+	for r.pos+4 <= len(data) {
+		start := r.pos
+		length := uint64(r.u32())
+		if length == 0 {
+			break
+		}
+		if length == 0xffffffff {
+			length = r.u64()
+		}
+		if r.bad || length > uint64(len(data)-r.pos) || length < 4 {
+			return fdes, fmt.Errorf("error: .eh_frame entry at 0x%x extends past the end of the section", start)
+		}
+		end := r.pos + int(length)
+
+		// the CIE pointer of an FDE is the distance back from the field to its CIE
+		id := int(r.u32())
+		if id != 0 {
+			offset := r.pos - 4 - id
+			cie, ok := cies[offset]
+			if !ok {
+				if offset >= 0 {
+					cie = parseCie(data, offset, addr, order)
+				}
+				cies[offset] = cie
+			}
+			if cie == nil {
+				return fdes, fmt.Errorf("error: .eh_frame FDE at 0x%x has a bad CIE pointer", start)
+			}
+
+			fde := &cfiReader{data: data[:end], pos: r.pos, addr: addr, order: order}
+			begin := fde.pointer(cie.fdeEnc)
+			size := fde.pointer(cie.fdeEnc & 0x0f)
+			if cie.aug {
+				fde.block()
+			}
+			// FDEs of discarded functions are left with a zero address
+			if !fde.bad && begin != 0 {
+				fdes = append(fdes, &EhFde{cie: cie, start: begin, end: begin + size, insns: data[fde.pos:end]})
+			}
+		}
+		r.pos = end
+	}
+
+	sort.SliceStable(fdes, func(i, j int) bool { return fdes[i].start < fdes[j].start })
+	return fdes, nil
+}
+
+/*
+returns the FDEs of the file's .eh_frame, found through PT_GNU_EH_FRAME when
+the section headers were stripped
+*/
+func (p *ElfParser) GetEhFrame() []*EhFde {
+	data, shdr := p.sectionData(".eh_frame")
+	addr := Elf64_Addr(0)
+	if shdr != nil {
+		addr = shdr.SH_addr
+	} else {
+		data, addr = p.ehFrameFromHdr()
+	}
+	if data == nil {
+		return nil
+	}
+	fdes, err := parseEhFrame(data, addr, p.order)
+	if err != nil {
+		p.fail("%v", err)
+	}
+	return fdes
+}
+
+/* follows eh_frame_ptr of .eh_frame_hdr, .eh_frame then runs at most to the end of its PT_LOAD */
+func (p *ElfParser) ehFrameFromHdr() ([]byte, Elf64_Addr) {
+	for _, phdr := range p.GetPhdrs() {
+		if phdr.P_type != PT_GNU_EH_FRAME || phdr.P_filesz < 8 {
+			continue
+		}
+		hdr := p.readBytes(int64(phdr.P_offset), 8+4)
+		if hdr == nil || hdr[0] != 1 {
+			return nil, 0
+		}
+		r := &cfiReader{data: hdr, pos: 4, addr: phdr.P_vaddr, order: p.order}
+		addr := r.pointer(hdr[1])
+		if r.bad {
+			return nil, 0
+		}
+		for _, load := range p.GetPhdrs() {
+			if load.P_type == PT_LOAD && addr >= load.P_vaddr && addr < load.P_vaddr+Elf64_Addr(load.P_filesz) {
+				size := int64(load.P_vaddr + Elf64_Addr(load.P_filesz) - addr)
+				return p.readBytes(int64(load.P_offset)+int64(addr-load.P_vaddr), size), addr
+			}
+		}
+	}
+	return nil, 0
+}
+
+/* the FDE covering addr in fdes sorted by address */
+func findFde(fdes []*EhFde, addr Elf64_Addr) *EhFde {
+	i := sort.Search(len(fdes), func(i int) bool { return fdes[i].start > addr }) - 1
+	if i < 0 || addr >= fdes[i].end {
+		return nil
+	}
+	return fdes[i]
+}
+
+/* runs the CIE's initial instructions and then the FDE's up to pc, returning the rules in force at pc */
+func (fde *EhFde) rowAt(pc Elf64_Addr, order binary.ByteOrder) (*cfaRow, bool) {
+	row := &cfaRow{rules: map[uint64]cfaRule{}}
+	if !fde.execute(fde.cie.initial, row, nil, pc, order) {
+		return nil, false
+	}
+	if !fde.execute(fde.insns, row, row.copy(), pc, order) {
+		return nil, false
+	}
+	return row, true
+}
+
+/* applies call frame instructions to row until the location passes pc, initial is what DW_CFA_restore returns to */
+func (fde *EhFde) execute(insns []byte, row *cfaRow, initial *cfaRow, pc Elf64_Addr, order binary.ByteOrder) bool {
+	cie := fde.cie
+	r := &cfiReader{data: insns, order: order}
+	loc := fde.start
+	stack := []*cfaRow{}
+	restore := func(reg uint64) {
+		delete(row.rules, reg)
+		if initial == nil {
+			return
+		}
+		if rule, ok := initial.rules[reg]; ok {
+			row.rules[reg] = rule
+		}
+	}
+	offset := func(reg uint64, factored int64, kind int) {
+		row.rules[reg] = cfaRule{kind: kind, offset: factored * cie.dataAlign}
+	}
+
+	for !r.done() {
+		op := r.u8()
+		advance := uint64(0)
+		switch op & 0xc0 {
+		case DW_CFA_advance_loc:
+			advance = uint64(op&0x3f) * cie.codeAlign
+		case DW_CFA_offset:
+			offset(uint64(op&0x3f), int64(r.uleb()), ruleOffset)
+		case DW_CFA_restore:
+			restore(uint64(op & 0x3f))
+		default:
+			switch op {
+			case DW_CFA_nop:
+			case DW_CFA_GNU_args_size:
+				r.uleb()
+			case DW_CFA_set_loc:
+				loc = r.pointer(cie.fdeEnc)
+				if loc > pc {
+					return !r.bad
+				}
+			case DW_CFA_advance_loc1:
+				advance = uint64(r.u8()) * cie.codeAlign
+			case DW_CFA_advance_loc2:
+				advance = uint64(r.u16()) * cie.codeAlign
+			case DW_CFA_advance_loc4:
+				advance = uint64(r.u32()) * cie.codeAlign
+			case DW_CFA_offset_extended:
+				reg := r.uleb()
+				offset(reg, int64(r.uleb()), ruleOffset)
+			case DW_CFA_offset_extended_sf:
+				reg := r.uleb()
+				offset(reg, r.sleb(), ruleOffset)
+			case DW_CFA_val_offset:
+				reg := r.uleb()
+				offset(reg, int64(r.uleb()), ruleValOffset)
+			case DW_CFA_val_offset_sf:
+				reg := r.uleb()
+				offset(reg, r.sleb(), ruleValOffset)
+			case DW_CFA_restore_extended:
+				restore(r.uleb())
+			case DW_CFA_undefined:
+				row.rules[r.uleb()] = cfaRule{kind: ruleUndefined}
+			case DW_CFA_same_value:
+				delete(row.rules, r.uleb())
+			case DW_CFA_register:
+				reg := r.uleb()
+				row.rules[reg] = cfaRule{kind: ruleRegister, reg: r.uleb()}
+			case DW_CFA_expression, DW_CFA_val_expression:
+				reg := r.uleb()
+				kind := ruleExpr
+				if op == DW_CFA_val_expression {
+					kind = ruleValExpr
+				}
+				row.rules[reg] = cfaRule{kind: kind, expr: r.block()}
+			case DW_CFA_remember_state:
+				stack = append(stack, row.copy())
+			case DW_CFA_restore_state:
+				if len(stack) == 0 {
+					return false
+				}
+				saved := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				row.rules = saved.rules
+				row.cfaReg, row.cfaOffset, row.cfaExpr = saved.cfaReg, saved.cfaOffset, saved.cfaExpr
+			case DW_CFA_def_cfa:
+				row.cfaReg = r.uleb()
+				row.cfaOffset = int64(r.uleb())
+				row.cfaExpr = nil
+			case DW_CFA_def_cfa_sf:
+				row.cfaReg = r.uleb()
+				row.cfaOffset = r.sleb() * cie.dataAlign
+				row.cfaExpr = nil
+			case DW_CFA_def_cfa_register:
+				row.cfaReg = r.uleb()
+				row.cfaExpr = nil
+			case DW_CFA_def_cfa_offset:
+				row.cfaOffset = int64(r.uleb())
+			case DW_CFA_def_cfa_offset_sf:
+				row.cfaOffset = r.sleb() * cie.dataAlign
+			case DW_CFA_def_cfa_expression:
+				row.cfaExpr = r.block()
+			default:
+				return false
+			}
+		}
+		if advance != 0 {
+			loc += Elf64_Addr(advance)
+			if loc > pc {
+				return true
+			}
+		}
+	}
+	return !r.bad
+}
+
+/*
+evaluates a DWARF expression of a CFA rule on a stack machine, starting with
+the given values on the stack. reg reads a register, deref reads memory.
+*/
+func evalExpr(expr []byte, stack []uint64, order binary.ByteOrder,
+	reg func(uint64) (uint64, bool), deref func(uint64) (uint64, bool)) (uint64, bool) {
+	r := &cfiReader{data: expr, order: order}
+	pop := func() uint64 {
+		if len(stack) == 0 {
+			r.bad = true
+			return 0
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	boolean := func(b bool) uint64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	for !r.done() {
+		op := r.u8()
+		switch {
+		case op >= DW_OP_lit0 && op < DW_OP_lit0+32:
+			stack = append(stack, uint64(op-DW_OP_lit0))
+		case op >= DW_OP_breg0 && op < DW_OP_breg0+32 || op == DW_OP_bregx:
+			n := uint64(op - DW_OP_breg0)
+			if op == DW_OP_bregx {
+				n = r.uleb()
+			}
+			value, ok := reg(n)
+			if !ok {
+				return 0, false
+			}
+			stack = append(stack, value+uint64(r.sleb()))
+		case op == DW_OP_const1u:
+			stack = append(stack, uint64(r.u8()))
+		case op == DW_OP_const1s:
+			stack = append(stack, uint64(int8(r.u8())))
+		case op == DW_OP_const2u:
+			stack = append(stack, uint64(r.u16()))
+		case op == DW_OP_const2s:
+			stack = append(stack, uint64(int16(r.u16())))
+		case op == DW_OP_const4u:
+			stack = append(stack, uint64(r.u32()))
+		case op == DW_OP_const4s:
+			stack = append(stack, uint64(int32(r.u32())))
+		case op == DW_OP_const8u, op == DW_OP_const8s:
+			stack = append(stack, r.u64())
+		case op == DW_OP_constu:
+			stack = append(stack, r.uleb())
+		case op == DW_OP_consts:
+			stack = append(stack, uint64(r.sleb()))
+		case op == DW_OP_dup:
+			v := pop()
+			stack = append(stack, v, v)
+		case op == DW_OP_drop:
+			pop()
+		case op == DW_OP_over:
+			b, a := pop(), pop()
+			stack = append(stack, a, b, a)
+		case op == DW_OP_swap:
+			b, a := pop(), pop()
+			stack = append(stack, b, a)
+		case op == DW_OP_deref:
+			value, ok := deref(pop())
+			if !ok {
+				return 0, false
+			}
+			stack = append(stack, value)
+		case op == DW_OP_neg:
+			stack = append(stack, -pop())
+		case op == DW_OP_not:
+			stack = append(stack, ^pop())
+		case op == DW_OP_plus_uconst:
+			stack = append(stack, pop()+r.uleb())
+		default:
+			b, a := pop(), pop()
+			var v uint64
+			switch op {
+			case DW_OP_and:
+				v = a & b
+			case DW_OP_or:
+				v = a | b
+			case DW_OP_xor:
+				v = a ^ b
+			case DW_OP_plus:
+				v = a + b
+			case DW_OP_minus:
+				v = a - b
+			case DW_OP_mul:
+				v = a * b
+			case DW_OP_shl:
+				v = a << b
+			case DW_OP_shr:
+				v = a >> b
+			case DW_OP_eq:
+				v = boolean(a == b)
+			case DW_OP_ne:
+				v = boolean(a != b)
+			case DW_OP_ge:
+				v = boolean(int64(a) >= int64(b))
+			case DW_OP_gt:
+				v = boolean(int64(a) > int64(b))
+			case DW_OP_le:
+				v = boolean(int64(a) <= int64(b))
+			case DW_OP_lt:
+				v = boolean(int64(a) < int64(b))
+			default:
+				return 0, false
+			}
+			stack = append(stack, v)
+		}
+	}
+	if r.bad || len(stack) == 0 {
+		return 0, false
+	}
+	return stack[len(stack)-1], true
+}
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+/*
+a small in-memory ELF file generator for the tests. Allocated sections are laid out
+in order after the headers, each PT_LOAD starting on a new page of the address space
+so that p_vaddr and p_offset stay congruent; the other sections and the section
+header table follow. Tables whose contents depend on the addresses (symbols and the
+dynamic section) are filled in once the layout is known.
+*/
+type fixtureSection struct {
+	name    string
+	typ     Elf64_Word
+	flags   Elf64_XWord
+	data    []byte
+	size    Elf64_XWord /* SHT_NOBITS only */
+	align   Elf64_XWord
+	entsize Elf64_XWord
+	link    string
+	info    Elf64_Word
+	load    int /* the PT_LOAD holding the section, -1 for none */
+
+	fill   func(f *fixture) []byte /* computes data after the layout, must not change its size */
+	offset Elf64_Off
+	addr   Elf64_Addr
+}
+
+type fixtureSymbol struct {
+	name    string
+	bind    Elf_UChar
+	typ     Elf_UChar
+	other   Elf_UChar
+	section string     /* "" for SHN_UNDEF, "*ABS*" for SHN_ABS */
+	value   Elf64_Addr /* relative to the section address */
+	size    Elf64_XWord
+}
+
+type fixture struct {
+	order    binary.ByteOrder
+	typ      Elf64_Half
+	machine  Elf64_Half
+	base     Elf64_Addr
+	entry    string /* symbol name, "" for no entry point */
+	sections []*fixtureSection
+	segments []Elf64_Word /* segment types besides PT_LOAD, which follow the load indices */
+	loads    []Elf64_Word /* flags of each PT_LOAD */
+	symbols  map[string][]fixtureSymbol
+}
+
+func newFixture(typ Elf64_Half, machine Elf64_Half, order binary.ByteOrder) *fixture {
+	f := &fixture{order: order, typ: typ, machine: machine, symbols: map[string][]fixtureSymbol{}}
+	f.sections = []*fixtureSection{{load: -1}}
+	if typ == ET_EXEC {
+		f.base = 0x400000
+	}
+	return f
+}
+
+func (f *fixture) add(s *fixtureSection) *fixtureSection {
+	if s.align == 0 {
+		s.align = 1
+	}
+	f.sections = append(f.sections, s)
+	return s
+}
+
+func (f *fixture) section(name string) *fixtureSection {
+	for _, s := range f.sections {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (f *fixture) index(name string) Elf64_Word {
+	for i, s := range f.sections {
+		if s.name == name {
+			return Elf64_Word(i)
+		}
+	}
+	panic("fixture: no section " + name)
+}
+
+/* adds a symbol table and its string table, locals must come first in syms */
+func (f *fixture) addSymbols(name string, strtab string, syms []fixtureSymbol, load int) {
+	typ, flags := Elf64_Word(SHT_SYMTAB), Elf64_XWord(0)
+	if name == ".dynsym" {
+		typ, flags = SHT_DYNSYM, SHF_ALLOC
+	}
+	names := NewElfStrtab()
+	locals := Elf64_Word(1)
+	for i, sym := range syms {
+		names.Add(sym.name)
+		if sym.bind == STB_LOCAL {
+			locals = Elf64_Word(i + 2)
+		}
+	}
+	f.symbols[name] = syms
+
+	f.add(&fixtureSection{name: name, typ: typ, flags: flags, align: 8, entsize: 24, link: strtab, info: locals, load: load,
+		data: make([]byte, 24*(len(syms)+1)),
+		fill: func(f *fixture) []byte {
+			buf := new(bytes.Buffer)
+			binary.Write(buf, f.order, Elf64SymbolHeader{})
+			for _, sym := range syms {
+				binary.Write(buf, f.order, f.symbol(names, sym))
+			}
+			return buf.Bytes()
+		}})
+	f.add(&fixtureSection{name: strtab, typ: SHT_STRTAB, flags: flags, data: names.data, load: load})
+}
+
+func (f *fixture) symbol(names *ElfStrtab, sym fixtureSymbol) Elf64SymbolHeader {
+	header := Elf64SymbolHeader{
+		ST_name:  names.Add(sym.name),
+		ST_info:  sym.bind<<4 | sym.typ,
+		ST_other: sym.other,
+		ST_value: sym.value,
+		ST_size:  sym.size,
+	}
+	switch sym.section {
+	case "":
+	case "*ABS*":
+		header.ST_shndx = SHN_ABS
+	default:
+		header.ST_shndx = Elf64_Half(f.index(sym.section))
+		// thread-local symbols hold offsets into the TLS template
+		if f.typ != ET_REL && sym.typ != STT_TLS {
+			header.ST_value += f.section(sym.section).addr
+		}
+	}
+	return header
+}
+
+/* adds .dynamic, values naming a section are replaced by its address */
+func (f *fixture) addDynamic(entries []Elf64Dyn, addrs map[Elf64_SXWord]string, load int) {
+	f.add(&fixtureSection{name: ".dynamic", typ: SHT_DYNAMIC, flags: SHF_ALLOC | SHF_WRITE, align: 8, entsize: 16,
+		link: ".dynstr", load: load, data: make([]byte, 16*len(entries)),
+		fill: func(f *fixture) []byte {
+			buf := new(bytes.Buffer)
+			for _, dyn := range entries {
+				if name, ok := addrs[dyn.D_tag]; ok {
+					dyn.D_val = Elf64_XWord(f.section(name).addr)
+				}
+				binary.Write(buf, f.order, dyn)
+			}
+			return buf.Bytes()
+		}})
+}
+
+func (f *fixture) Bytes() []byte {
+	const pagesize = 0x1000
+	ehsize := Elf64_Off(binary.Size(Elf64Header{}))
+	phentsize := Elf64_Off(binary.Size(Elf64ProgramHeader{}))
+	phnum := len(f.loads) + len(f.segments)
+	if f.typ != ET_REL && len(f.loads) != 0 {
+		phnum++ // PT_PHDR
+	}
+
+	names := NewElfStrtab()
+	shstrtab := f.add(&fixtureSection{name: ".shstrtab", typ: SHT_STRTAB, load: -1})
+	for _, s := range f.sections {
+		names.Add(s.name)
+	}
+	shstrtab.data = names.data
+
+	// allocated sections first, in the order of their segments
+	cursor := ehsize + phentsize*Elf64_Off(phnum)
+	for load := range f.loads {
+		for _, s := range f.sections {
+			if s.load != load {
+				continue
+			}
+			cursor = Elf64_Off(alignUp(int64(cursor), int64(s.align)))
+			s.offset = cursor
+			s.addr = f.base + Elf64_Addr(pagesize*load) + Elf64_Addr(cursor)
+			if s.typ != SHT_NOBITS {
+				cursor += Elf64_Off(len(s.data))
+			}
+		}
+	}
+	for _, s := range f.sections[1:] {
+		if s.load >= 0 {
+			continue
+		}
+		cursor = Elf64_Off(alignUp(int64(cursor), int64(s.align)))
+		s.offset = cursor
+		cursor += Elf64_Off(len(s.data))
+	}
+	shoff := Elf64_Off(alignUp(int64(cursor), 8))
+
+	for _, s := range f.sections {
+		if s.fill != nil {
+			if data := s.fill(f); len(data) != len(s.data) {
+				panic(fmt.Sprintf("fixture: %s changed size", s.name))
+			} else {
+				s.data = data
+			}
+		}
+	}
+
+	ehdr := Elf64Header{
+		E_type:      f.typ,
+		E_machine:   f.machine,
+		E_version:   EV_CURRENT,
+		E_shoff:     shoff,
+		E_ehsize:    Elf64_Half(ehsize),
+		E_shentsize: Elf64_Half(binary.Size(Elf64SectionHeader{})),
+		E_shnum:     Elf64_Half(len(f.sections)),
+		E_shstrndx:  Elf64_Half(len(f.sections) - 1),
+	}
+	for i := range SELFMAG {
+		ehdr.E_ident[i] = Elf_UChar(ELFMAG[i])
+	}
+	ehdr.E_ident[EI_CLASS] = ELFCLASS64
+	ehdr.E_ident[EI_DATA] = ELFDATA2LSB
+	if f.order == binary.BigEndian {
+		ehdr.E_ident[EI_DATA] = ELFDATA2MSB
+	}
+	ehdr.E_ident[EI_VERSION] = EV_CURRENT
+	if phnum != 0 {
+		ehdr.E_phoff = ehsize
+		ehdr.E_phentsize = Elf64_Half(phentsize)
+		ehdr.E_phnum = Elf64_Half(phnum)
+	}
+	if f.entry != "" {
+		for _, sym := range f.symbols[".symtab"] {
+			if sym.name == f.entry {
+				ehdr.E_entry = f.section(sym.section).addr + sym.value
+			}
+		}
+	}
+
+	phdrs := []Elf64ProgramHeader{}
+	if phnum != 0 {
+		size := Elf64_XWord(phentsize) * Elf64_XWord(phnum)
+		phdrs = append(phdrs, Elf64ProgramHeader{P_type: PT_PHDR, P_flags: PF_R, P_offset: ehsize,
+			P_vaddr: f.base + Elf64_Addr(ehsize), P_paddr: f.base + Elf64_Addr(ehsize), P_filesz: size, P_memsz: size, P_align: 8})
+	}
+	// a segment spans its sections, the first PT_LOAD the file headers as well
+	span := func(match func(s *fixtureSection) bool) (Elf64ProgramHeader, bool) {
+		phdr := Elf64ProgramHeader{}
+		found := false
+		for _, s := range f.sections {
+			if !match(s) {
+				continue
+			}
+			size := Elf64_XWord(len(s.data))
+			if s.typ == SHT_NOBITS {
+				size = s.size
+			}
+			if !found {
+				phdr.P_offset, phdr.P_vaddr = s.offset, s.addr
+				found = true
+			}
+			if s.typ != SHT_NOBITS {
+				phdr.P_filesz = Elf64_XWord(s.offset-phdr.P_offset) + size
+			}
+			phdr.P_memsz = Elf64_XWord(s.addr-phdr.P_vaddr) + size
+		}
+		phdr.P_paddr = phdr.P_vaddr
+		return phdr, found
+	}
+	for load, flags := range f.loads {
+		phdr, _ := span(func(s *fixtureSection) bool { return s.load == load })
+		if load == 0 {
+			phdr.P_filesz += Elf64_XWord(phdr.P_offset)
+			phdr.P_memsz += Elf64_XWord(phdr.P_offset)
+			phdr.P_vaddr -= Elf64_Addr(phdr.P_offset)
+			phdr.P_paddr, phdr.P_offset = phdr.P_vaddr, 0
+		}
+		phdr.P_type, phdr.P_flags, phdr.P_align = PT_LOAD, flags, pagesize
+		phdrs = append(phdrs, phdr)
+	}
+	for _, typ := range f.segments {
+		phdr := Elf64ProgramHeader{}
+		switch typ {
+		case PT_DYNAMIC:
+			phdr, _ = span(func(s *fixtureSection) bool { return s.typ == SHT_DYNAMIC })
+			phdr.P_flags, phdr.P_align = PF_R|PF_W, 8
+		case PT_INTERP:
+			phdr, _ = span(func(s *fixtureSection) bool { return s.name == ".interp" })
+			phdr.P_flags, phdr.P_align = PF_R, 1
+		case PT_NOTE:
+			phdr, _ = span(func(s *fixtureSection) bool { return s.typ == SHT_NOTE && s.load >= 0 })
+			phdr.P_flags, phdr.P_align = PF_R, 4
+		case PT_TLS:
+			phdr, _ = span(func(s *fixtureSection) bool { return s.flags&SHF_TLS != 0 })
+			phdr.P_flags, phdr.P_align = PF_R, 8
+		case PT_GNU_RELRO:
+			phdr, _ = span(func(s *fixtureSection) bool { return s.name == ".data.rel.ro" || s.typ == SHT_DYNAMIC })
+			phdr.P_flags, phdr.P_align = PF_R, 1
+		case PT_GNU_STACK:
+			phdr.P_flags, phdr.P_align = PF_R|PF_W, 16
+		}
+		phdr.P_type = typ
+		phdrs = append(phdrs, phdr)
+	}
+
+	out := make([]byte, int(shoff)+len(f.sections)*binary.Size(Elf64SectionHeader{}))
+	buf := new(bytes.Buffer)
+	binary.Write(buf, f.order, ehdr)
+	binary.Write(buf, f.order, phdrs)
+	copy(out, buf.Bytes())
+	for _, s := range f.sections {
+		if s.typ != SHT_NOBITS {
+			copy(out[s.offset:], s.data)
+		}
+	}
+
+	buf.Reset()
+	for i, s := range f.sections {
+		shdr := Elf64SectionHeader{}
+		if i != 0 {
+			size := Elf64_XWord(len(s.data))
+			if s.typ == SHT_NOBITS {
+				size = s.size
+			}
+			shdr = Elf64SectionHeader{SH_name: names.Add(s.name), SH_type: s.typ, SH_flags: s.flags, SH_addr: s.addr,
+				SH_offset: s.offset, SH_size: size, SH_info: s.info, SH_addralign: s.align, SH_entsize: s.entsize}
+			if s.link != "" {
+				shdr.SH_link = f.index(s.link)
+			}
+		}
+		binary.Write(buf, f.order, shdr)
+	}
+	copy(out[shoff:], buf.Bytes())
+	return out
+}
+
+/* x86-64 code for `_start: xor %edi,%edi; mov $60,%eax; syscall` padded to 16 bytes */
+var fixtureText = []byte{0x31, 0xff, 0xb8, 0x3c, 0x00, 0x00, 0x00, 0x0f, 0x05, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90}
+
+/* a statically linked executable with code, read-only data, data and bss */
+func fixtureExec(order binary.ByteOrder, machine Elf64_Half, stripped bool) *fixture {
+	f := newFixture(ET_EXEC, machine, order)
+	f.loads = []Elf64_Word{PF_R | PF_X, PF_R | PF_W}
+	f.segments = []Elf64_Word{PT_NOTE, PT_TLS, PT_GNU_STACK}
+
+	note := new(bytes.Buffer)
+	binary.Write(note, order, Elf64Nhdr{N_namesz: 4, N_descsz: 16, N_type: NT_GNU_ABI_TAG})
+	note.WriteString("GNU\x00")
+	binary.Write(note, order, [4]Elf64_Word{0, 3, 2, 0})
+
+	f.add(&fixtureSection{name: ".note.ABI-tag", typ: SHT_NOTE, flags: SHF_ALLOC, align: 4, data: note.Bytes()})
+	f.add(&fixtureSection{name: ".text", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 16, data: fixtureText})
+	f.add(&fixtureSection{name: ".rodata", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_MERGE | SHF_STRINGS, align: 8, entsize: 1,
+		data: []byte("hello, fixture\x00")})
+	f.add(&fixtureSection{name: ".tdata", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_WRITE | SHF_TLS, align: 8, load: 1,
+		data: []byte{1, 0, 0, 0, 0, 0, 0, 0}})
+	// .tbss takes no room in the load segment, .data starts at its address
+	f.add(&fixtureSection{name: ".tbss", typ: SHT_NOBITS, flags: SHF_ALLOC | SHF_WRITE | SHF_TLS, align: 8, size: 16, load: 1})
+	f.add(&fixtureSection{name: ".data", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_WRITE, align: 8, load: 1,
+		data: []byte{42, 0, 0, 0, 0, 0, 0, 0}})
+	f.add(&fixtureSection{name: ".bss", typ: SHT_NOBITS, flags: SHF_ALLOC | SHF_WRITE, align: 32, size: 0x100, load: 1})
+	f.add(&fixtureSection{name: ".comment", typ: SHT_PROGBITS, flags: SHF_MERGE | SHF_STRINGS, entsize: 1, load: -1,
+		data: []byte("fixture 1.0\x00")})
+	if stripped {
+		return f
+	}
+
+	f.entry = "_start"
+	f.addSymbols(".symtab", ".strtab", []fixtureSymbol{
+		{name: "start.c", bind: STB_LOCAL, typ: STT_FILE, section: "*ABS*"},
+		{name: "", bind: STB_LOCAL, typ: STT_SECTION, section: ".text"},
+		{name: "message", bind: STB_LOCAL, typ: STT_OBJECT, section: ".rodata", size: 15},
+		{name: "tls_counter", bind: STB_LOCAL, typ: STT_TLS, section: ".tdata", size: 8},
+		{name: "_start", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", size: 9},
+		{name: "answer", bind: STB_GLOBAL, typ: STT_OBJECT, section: ".data", size: 8},
+		{name: "buffer", bind: STB_GLOBAL, typ: STT_OBJECT, other: STV_HIDDEN, section: ".bss", size: 0x100},
+		{name: "__weak_hook", bind: STB_WEAK, typ: STT_NOTYPE},
+	}, -1)
+	return f
+}
+
+/* a shared object with a dynamic symbol table, a SysV hash table, a dynamic section and RELRO */
+func fixtureShared() *fixture {
+	f := newFixture(ET_DYN, EM_X86_64, binary.LittleEndian)
+	f.loads = []Elf64_Word{PF_R | PF_X, PF_R | PF_W}
+	f.segments = []Elf64_Word{PT_DYNAMIC, PT_GNU_STACK, PT_GNU_RELRO}
+
+	dynsyms := []fixtureSymbol{
+		{name: "puts", bind: STB_GLOBAL, typ: STT_FUNC},
+		{name: "fixture_version", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", size: 9},
+		{name: "fixture_table", bind: STB_GLOBAL, typ: STT_OBJECT, section: ".data", size: 8},
+	}
+	f.addSymbols(".dynsym", ".dynstr", dynsyms, 0)
+	dynstr := f.section(".dynstr")
+	needed := Elf64_XWord(len(dynstr.data))
+	dynstr.data = append(dynstr.data, "libc.so.6\x00"...)
+	soname := Elf64_XWord(len(dynstr.data))
+	dynstr.data = append(dynstr.data, "libfixture.so.1\x00"...)
+
+	// one bucket, every symbol on its chain
+	hash := make([]byte, 4*(2+1+4))
+	for i, word := range []uint32{1, 4, 3, 0, 0, 1, 2} {
+		binary.LittleEndian.PutUint32(hash[4*i:], word)
+	}
+	f.add(&fixtureSection{name: ".hash", typ: SHT_HASH, flags: SHF_ALLOC, align: 8, entsize: 4, link: ".dynsym", data: hash})
+	f.add(&fixtureSection{name: ".text", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 16, data: fixtureText})
+	f.add(&fixtureSection{name: ".data.rel.ro", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_WRITE, align: 8, load: 1, data: make([]byte, 16)})
+	f.addDynamic([]Elf64Dyn{
+		{D_tag: DT_NEEDED, D_val: needed},
+		{D_tag: DT_SONAME, D_val: soname},
+		{D_tag: DT_HASH},
+		{D_tag: DT_STRTAB},
+		{D_tag: DT_SYMTAB},
+		{D_tag: DT_STRSZ, D_val: Elf64_XWord(len(dynstr.data))},
+		{D_tag: DT_SYMENT, D_val: 24},
+		{D_tag: DT_NULL},
+	}, map[Elf64_SXWord]string{DT_HASH: ".hash", DT_STRTAB: ".dynstr", DT_SYMTAB: ".dynsym"}, 1)
+	f.add(&fixtureSection{name: ".data", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_WRITE, align: 8, load: 1, data: make([]byte, 8)})
+
+	f.addSymbols(".symtab", ".strtab", []fixtureSymbol{
+		{name: "lib.c", bind: STB_LOCAL, typ: STT_FILE, section: "*ABS*"},
+		{name: "_DYNAMIC", bind: STB_LOCAL, typ: STT_OBJECT, section: ".dynamic"},
+		{name: "fixture_version", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", size: 9},
+		{name: "fixture_table", bind: STB_GLOBAL, typ: STT_OBJECT, section: ".data", size: 8},
+		{name: "puts", bind: STB_GLOBAL, typ: STT_FUNC},
+	}, -1)
+	return f
+}
+
+/* the dynamic linking of a fixtureDynamic program or library */
+type fixtureLink struct {
+	interp  string
+	needed  []string
+	soname  string
+	rpath   string
+	runpath string
+	dyns    []Elf64Dyn      /* entries added before DT_NULL */
+	imports []fixtureSymbol /* undefined dynamic symbols */
+	exports []fixtureSymbol /* functions go to .text, objects to .data */
+	copies  []fixtureSymbol /* objects defined in .bss by R_X86_64_COPY relocations */
+}
+
+/* a dynamically linked program or library with a .dynsym, a .dynamic and RELRO, but no section symbols */
+func fixtureDynamic(typ Elf64_Half, link fixtureLink) *fixture {
+	f := newFixture(typ, EM_X86_64, binary.LittleEndian)
+	f.loads = []Elf64_Word{PF_R | PF_X, PF_R | PF_W}
+	f.segments = []Elf64_Word{PT_DYNAMIC, PT_GNU_STACK, PT_GNU_RELRO}
+	if link.interp != "" {
+		f.segments = append([]Elf64_Word{PT_INTERP}, f.segments...)
+		f.add(&fixtureSection{name: ".interp", typ: SHT_PROGBITS, flags: SHF_ALLOC, data: []byte(link.interp + "\x00")})
+	}
+
+	dynsyms := append([]fixtureSymbol{}, link.imports...)
+	data := 0
+	for _, sym := range link.exports {
+		if sym.typ == STT_OBJECT {
+			sym.section, sym.value = ".data", Elf64_Addr(8*data)
+			data++
+		} else {
+			sym.section = ".text"
+		}
+		dynsyms = append(dynsyms, sym)
+	}
+	for i, sym := range link.copies {
+		sym.section, sym.value = ".bss", Elf64_Addr(8*i)
+		dynsyms = append(dynsyms, sym)
+	}
+	f.addSymbols(".dynsym", ".dynstr", dynsyms, 0)
+	if len(link.copies) != 0 {
+		first := len(dynsyms) - len(link.copies) + 1
+		f.add(&fixtureSection{name: ".rela.dyn", typ: SHT_RELA, flags: SHF_ALLOC, align: 8, entsize: 24, link: ".dynsym",
+			data: make([]byte, 24*len(link.copies)), fill: func(f *fixture) []byte {
+				rela := new(bytes.Buffer)
+				for i := range link.copies {
+					addr := uint64(f.section(".bss").addr) + uint64(8*i)
+					binary.Write(rela, binary.LittleEndian, []uint64{addr, uint64(first+i)<<32 | R_X86_64_COPY, 0})
+				}
+				return rela.Bytes()
+			}})
+	}
+	dynstr := f.section(".dynstr")
+	dynamic := []Elf64Dyn{}
+	str := func(tag Elf64_SXWord, s string) {
+		dynamic = append(dynamic, Elf64Dyn{D_tag: tag, D_val: Elf64_XWord(len(dynstr.data))})
+		dynstr.data = append(dynstr.data, s+"\x00"...)
+	}
+	for _, needed := range link.needed {
+		str(DT_NEEDED, needed)
+	}
+	if link.soname != "" {
+		str(DT_SONAME, link.soname)
+	}
+	if link.rpath != "" {
+		str(DT_RPATH, link.rpath)
+	}
+	if link.runpath != "" {
+		str(DT_RUNPATH, link.runpath)
+	}
+	dynamic = append(dynamic, Elf64Dyn{D_tag: DT_STRTAB}, Elf64Dyn{D_tag: DT_SYMTAB},
+		Elf64Dyn{D_tag: DT_STRSZ, D_val: Elf64_XWord(len(dynstr.data))}, Elf64Dyn{D_tag: DT_SYMENT, D_val: 24})
+	dynamic = append(append(dynamic, link.dyns...), Elf64Dyn{D_tag: DT_NULL})
+
+	f.add(&fixtureSection{name: ".text", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 16, data: fixtureText})
+	f.addDynamic(dynamic, map[Elf64_SXWord]string{DT_STRTAB: ".dynstr", DT_SYMTAB: ".dynsym", DT_HASH: ".hash", DT_GNU_HASH: ".gnu.hash"}, 1)
+	f.add(&fixtureSection{name: ".data", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_WRITE, align: 8, load: 1,
+		data: make([]byte, 8*max(data, 1))})
+	if len(link.copies) != 0 {
+		f.add(&fixtureSection{name: ".bss", typ: SHT_NOBITS, flags: SHF_ALLOC | SHF_WRITE, align: 8, load: 1,
+			size: Elf64_XWord(8 * len(link.copies))})
+	}
+	return f
+}
+
+/* a relocatable object with a relocation section, a common symbol and a section group */
+func fixtureRelocatable() *fixture {
+	f := newFixture(ET_REL, EM_X86_64, binary.LittleEndian)
+
+	group := make([]byte, 8)
+	binary.LittleEndian.PutUint32(group, GRP_COMDAT)
+	f.add(&fixtureSection{name: ".group", typ: SHT_GROUP, align: 4, entsize: 4, link: ".symtab", info: 4, load: -1, data: group,
+		fill: func(f *fixture) []byte {
+			binary.LittleEndian.PutUint32(group[4:], uint32(f.index(".text.inline")))
+			return group
+		}})
+	f.add(&fixtureSection{name: ".text", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 16, load: -1, data: fixtureText})
+	f.add(&fixtureSection{name: ".text.inline", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR | SHF_GROUP, align: 16, load: -1,
+		data: fixtureText[:9]})
+
+	// R_X86_64_PC32 against counter and R_X86_64_PLT32 against helper
+	rela := new(bytes.Buffer)
+	addend := int64(-4)
+	binary.Write(rela, binary.LittleEndian, []uint64{3, 5<<32 | 2, uint64(addend), 8, 6<<32 | 4, uint64(addend)})
+	f.add(&fixtureSection{name: ".rela.text", typ: SHT_RELA, flags: SHF_INFO_LINK, align: 8, entsize: 24, link: ".symtab",
+		load: -1, data: rela.Bytes(), fill: func(f *fixture) []byte {
+			f.section(".rela.text").info = f.index(".text")
+			return rela.Bytes()
+		}})
+	f.add(&fixtureSection{name: ".data", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_WRITE, align: 4, load: -1, data: []byte{7, 0, 0, 0}})
+	f.add(&fixtureSection{name: ".bss", typ: SHT_NOBITS, flags: SHF_ALLOC | SHF_WRITE, align: 4, size: 4, load: -1})
+	f.add(&fixtureSection{name: ".note.GNU-stack", typ: SHT_PROGBITS, load: -1})
+
+	f.addSymbols(".symtab", ".strtab", []fixtureSymbol{
+		{name: "object.c", bind: STB_LOCAL, typ: STT_FILE, section: "*ABS*"},
+		{name: "", bind: STB_LOCAL, typ: STT_SECTION, section: ".text"},
+		{name: "", bind: STB_LOCAL, typ: STT_SECTION, section: ".data"},
+		{name: "inline_helper", bind: STB_WEAK, typ: STT_FUNC, section: ".text.inline", size: 9},
+		{name: "counter", bind: STB_GLOBAL, typ: STT_OBJECT, section: ".data", size: 4},
+		{name: "helper", bind: STB_GLOBAL, typ: STT_NOTYPE},
+		{name: "shared_buffer", bind: STB_GLOBAL, typ: STT_OBJECT, value: 16, size: 64},
+		{name: "object_main", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", size: 16},
+	}, -1)
+	// the common symbol lives in no section
+	syms := f.symbols[".symtab"]
+	fill := f.section(".symtab").fill
+	f.section(".symtab").fill = func(f *fixture) []byte {
+		data := fill(f)
+		binary.LittleEndian.PutUint16(data[24*(len(syms)-1)+6:], SHN_COMMON)
+		return data
+	}
+	return f
+}
+
+/* a relocatable object with one section per function, as -ffunction-sections produces */
+func fixtureManySections(count int) *fixture {
+	f := newFixture(ET_REL, EM_AARCH64, binary.LittleEndian)
+	syms := []fixtureSymbol{{name: "many.c", bind: STB_LOCAL, typ: STT_FILE, section: "*ABS*"}}
+	for i := range count {
+		name := fmt.Sprintf(".text.function_%03d", i)
+		// aarch64 `ret`
+		f.add(&fixtureSection{name: name, typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 4, load: -1,
+			data: []byte{0xc0, 0x03, 0x5f, 0xd6}})
+	}
+	for i := range count {
+		syms = append(syms, fixtureSymbol{name: fmt.Sprintf("function_%03d", i), bind: STB_GLOBAL, typ: STT_FUNC,
+			section: fmt.Sprintf(".text.function_%03d", i), size: 4})
+	}
+	f.addSymbols(".symtab", ".strtab", syms, -1)
+	return f
+}
+
+/* the fixtures by name, the golden files are named after them */
+var fixtures = map[string]func() []byte{
+	"exec":        func() []byte { return fixtureExec(binary.LittleEndian, EM_X86_64, false).Bytes() },
+	"shared":      func() []byte { return fixtureShared().Bytes() },
+	"relocatable": func() []byte { return fixtureRelocatable().Bytes() },
+	"bigendian":   func() []byte { return fixtureExec(binary.BigEndian, EM_PPC64, false).Bytes() },
+	"stripped":    func() []byte { return fixtureExec(binary.LittleEndian, EM_X86_64, true).Bytes() },
+	"many":        func() []byte { return fixtureManySections(300).Bytes() },
+}
+
+/* compares got with testdata/golden/<name>.golden, which -update rewrites */
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file\n--- got\n%s\n--- want\n%s", name, got, want)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/* a run of bytes loaded at a physical address */
+type ImageChunk struct {
+	addr Elf64_Addr
+	data []byte
+}
+
+/* machine names accepted by `objcopy -B`, for raw input */
+var binary_machine = map[string]Elf64_Half{
+	"i386:x86-64": EM_X86_64,
+	"x86-64":      EM_X86_64,
+	"aarch64":     EM_AARCH64,
+	"riscv":       EM_RISCV,
+	"riscv64":     EM_RISCV,
+	"powerpc64":   EM_PPC64,
+	"s390x":       EM_S390,
+	"bpf":         EM_BPF,
+}
+
+/*
+returns the allocated sections at their physical (load) addresses, as a flash programmer
+sees them and as GNU objcopy writes them: the headers and the padding between sections are
+left out. A section is loaded at p_paddr plus its file offset in its segment, PT_TLS for
+thread-local data and PT_LOAD for the rest, and a section outside of them at its address.
+*/
+func (e *ElfFile) LoadImage() ([]*ImageChunk, error) {
+	if err := e.layout(); err != nil {
+		return nil, err
+	}
+
+	chunks := []*ImageChunk{}
+	for _, s := range e.sections {
+		if s.shdr.SH_flags&SHF_ALLOC == 0 || s.shdr.SH_type == SHT_NOBITS || len(s.data) == 0 {
+			continue
+		}
+		lma := s.shdr.SH_addr
+		tls := s.shdr.SH_flags&SHF_TLS != 0
+		for _, phdr := range e.phdrs {
+			if (phdr.P_type == PT_LOAD && !tls || phdr.P_type == PT_TLS) && s.shdr.SH_offset >= phdr.P_offset &&
+				uint64(s.shdr.SH_offset-phdr.P_offset)+uint64(s.shdr.SH_size) <= uint64(phdr.P_filesz) {
+				lma = phdr.P_paddr + Elf64_Addr(s.shdr.SH_offset-phdr.P_offset)
+				break
+			}
+		}
+		chunks = append(chunks, &ImageChunk{lma, s.data})
+	}
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].addr < chunks[j].addr })
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("error: nothing to load")
+	}
+	return chunks, nil
+}
+
+/* writes a raw memory image from the lowest load address, filling the gaps with gap */
+func WriteBinary(w io.Writer, chunks []*ImageChunk, gap byte) error {
+	base := chunks[0].addr
+	var end Elf64_Addr
+	for _, c := range chunks {
+		end = max(end, c.addr+Elf64_Addr(len(c.data)))
+	}
+	if end-base > 1<<32 {
+		return fmt.Errorf("error: the image spans 0x%x bytes, check the load addresses", end-base)
+	}
+
+	image := bytes.Repeat([]byte{gap}, int(end-base))
+	for _, c := range chunks {
+		copy(image[c.addr-base:], c.data)
+	}
+	_, err := w.Write(image)
+	return err
+}
+
+/* writes Intel HEX: 16 byte data records with extended linear address records for the upper 16 bits */
+func WriteIhex(w io.Writer, chunks []*ImageChunk, entry Elf64_Addr) error {
+	record := func(typ byte, addr uint16, data []byte) {
+		line := []byte{byte(len(data)), byte(addr >> 8), byte(addr), typ}
+		line = append(line, data...)
+		var sum byte
+		for _, b := range line {
+			sum += b
+		}
+		fmt.Fprintf(w, ":%X%02X\r\n", line, -sum)
+	}
+
+	// like GNU objcopy, addresses below 64K need no extended address record
+	upper := 0
+	for _, c := range chunks {
+		if c.addr+Elf64_Addr(len(c.data)) > 1<<32 {
+			return fmt.Errorf("error: address 0x%x does not fit in 32 bits", c.addr)
+		}
+		for off := 0; off < len(c.data); {
+			addr := uint32(c.addr) + uint32(off)
+			if int(addr>>16) != upper {
+				upper = int(addr >> 16)
+				record(0x04, 0, []byte{byte(upper >> 8), byte(upper)})
+			}
+			// a record may not cross a 64K boundary
+			n := min(16, len(c.data)-off, 0x10000-int(addr&0xffff))
+			record(0x00, uint16(addr), c.data[off:off+n])
+			off += n
+		}
+	}
+	if entry != 0 && entry < 1<<32 {
+		record(0x05, 0, binary.BigEndian.AppendUint32(nil, uint32(entry)))
+	}
+	record(0x01, 0, nil)
+	return nil
+}
+
+/* writes Motorola S-records, using the shortest address width that holds every address */
+func WriteSrec(w io.Writer, name string, chunks []*ImageChunk, entry Elf64_Addr) error {
+	var end Elf64_Addr
+	for _, c := range chunks {
+		end = max(end, c.addr+Elf64_Addr(len(c.data)))
+	}
+	end = max(end, entry)
+	if end > 1<<32 {
+		return fmt.Errorf("error: address 0x%x does not fit in 32 bits", end)
+	}
+
+	// S1/S9 use 16 bit addresses, S2/S8 24 bit and S3/S7 32 bit
+	data, term, width := byte('1'), byte('9'), 2
+	if end > 1<<16 {
+		data, term, width = '2', '8', 3
+	}
+	if end > 1<<24 {
+		data, term, width = '3', '7', 4
+	}
+
+	record := func(typ byte, width int, addr uint32, payload []byte) {
+		line := []byte{byte(width + len(payload) + 1)}
+		for i := width - 1; i >= 0; i-- {
+			line = append(line, byte(addr>>(8*i)))
+		}
+		line = append(line, payload...)
+		var sum byte
+		for _, b := range line {
+			sum += b
+		}
+		fmt.Fprintf(w, "S%c%X%02X\r\n", typ, line, ^sum)
+	}
+
+	record('0', 2, 0, []byte(name))
+	for _, c := range chunks {
+		for off := 0; off < len(c.data); off += 16 {
+			n := min(16, len(c.data)-off)
+			record(data, width, uint32(c.addr)+uint32(off), c.data[off:off+n])
+		}
+	}
+	record(term, width, uint32(entry), nil)
+	return nil
+}
+
+/*
+wraps raw data into a relocatable object like `objcopy -I binary`: a .data section
+holding the bytes and the symbols _binary_<name>_start, _end and _size, where name
+is the input file name with every character that is not a letter or digit replaced by _
+*/
+func NewBinaryObject(path string, data []byte, machine Elf64_Half, order binary.ByteOrder) *ElfFile {
+	e := new(ElfFile)
+	e.order = order
+	for i := range SELFMAG {
+		e.ehdr.E_ident[i] = Elf_UChar(ELFMAG[i])
+	}
+	e.ehdr.E_ident[EI_CLASS] = ELFCLASS64
+	e.ehdr.E_ident[EI_DATA] = ELFDATA2LSB
+	if order == binary.BigEndian {
+		e.ehdr.E_ident[EI_DATA] = ELFDATA2MSB
+	}
+	e.ehdr.E_ident[EI_VERSION] = EV_CURRENT
+	e.ehdr.E_type = ET_REL
+	e.ehdr.E_machine = machine
+	e.ehdr.E_version = EV_CURRENT
+	e.ehdr.E_ehsize = Elf64_Half(binary.Size(Elf64Header{}))
+	e.ehdr.E_shentsize = Elf64_Half(binary.Size(Elf64SectionHeader{}))
+
+	mangled := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, path)
+
+	section := NewElfSection(".data", SHT_PROGBITS, SHF_ALLOC|SHF_WRITE, data)
+	strtab := NewElfSection(".strtab", SHT_STRTAB, 0, nil)
+	symtab := NewElfSection(".symtab", SHT_SYMTAB, 0, nil)
+	symtab.link = strtab
+	symtab.shdr.SH_entsize = Elf64_XWord(binary.Size(Elf64SymbolHeader{}))
+	symtab.shdr.SH_addralign = 8
+
+	// the null section comes first, .data is section 1
+	e.sections = []*ElfSection{new(ElfSection)}
+	e.AddSection(section)
+	e.AddSection(symtab)
+	e.AddSection(strtab)
+
+	names := NewElfStrtab()
+	syms := []Elf64SymbolHeader{
+		{},
+		{ST_name: names.Add("_binary_" + mangled + "_start"), ST_info: STB_GLOBAL<<4 | STT_NOTYPE, ST_shndx: 1},
+		{ST_name: names.Add("_binary_" + mangled + "_end"), ST_info: STB_GLOBAL<<4 | STT_NOTYPE, ST_shndx: 1, ST_value: Elf64_Addr(len(data))},
+		{ST_name: names.Add("_binary_" + mangled + "_size"), ST_info: STB_GLOBAL<<4 | STT_NOTYPE, ST_shndx: SHN_ABS, ST_value: Elf64_Addr(len(data))},
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, order, syms)
+	e.SetData(symtab, buf.Bytes())
+	symtab.shdr.SH_info = 1
+	e.SetData(strtab, names.data)
+
+	e.origs = append([]*ElfSection{}, e.sections...)
+	return e
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"bytes"
+	"debug/gosym"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+/* the Go linker's note holding the build ID, in .note.go.buildid */
+const NT_GO_BUILDID = 4
+
+/* .go.buildinfo starts with this magic, followed by the pointer size and flags bytes */
+var go_buildinfo_magic = []byte("\xff Go buildinf:")
+
+/* the module information is wrapped in these 16 byte markers */
+var (
+	go_modinfo_start = []byte("\x30\x77\xaf\x0c\x92\x74\x08\x02\x41\xe1\xc1\x07\xe6\xd6\x18\xe6")
+	go_modinfo_end   = []byte("\xf9\x32\x43\x31\x86\x18\x20\x72\x00\x82\x42\x10\x41\x16\xd8\xf2")
+)
+
+/* the first word of .gopclntab, by the Go release that introduced the layout */
+var go_pclntab_magic = map[uint32]string{
+	0xfffffffb: "go1.2",
+	0xfffffffa: "go1.16",
+	0xfffffff0: "go1.18",
+	0xfffffff1: "go1.20",
+}
+
+/* a module the binary was built from, Replace is set when a replace directive applied */
+type GoModule struct {
+	Path    string    `json:"path"`
+	Version string    `json:"version"`
+	Sum     string    `json:"sum,omitempty"`
+	Replace *GoModule `json:"replace,omitempty"`
+}
+
+type GoSetting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+/* what `go version -m` reports of a Go binary, and the build ID and function table */
+type GoInfo struct {
+	File      string      `json:"file"`
+	GoVersion string      `json:"go_version"`
+	BuildID   string      `json:"build_id,omitempty"`
+	Path      string      `json:"path,omitempty"`
+	Main      *GoModule   `json:"main,omitempty"`
+	Deps      []*GoModule `json:"deps"`
+	Settings  []GoSetting `json:"settings"`
+	Pclntab   string      `json:"pclntab,omitempty"` /* the layout of the function table */
+	Functions int         `json:"functions"`
+	Files     int         `json:"files"`
+	build     *debug.BuildInfo
+}
+
+func goModule(m *debug.Module) *GoModule {
+	if m == nil || m.Path == "" {
+		return nil
+	}
+	return &GoModule{Path: m.Path, Version: m.Version, Sum: m.Sum, Replace: goModule(m.Replace)}
+}
+
+/* the contents of a section by name, nil when it is missing or has no file data */
+func (p *ElfParser) sectionData(name string) ([]byte, *Elf64SectionHeader) {
+	for _, desp := range p.GetShdrs() {
+		if strings.TrimRight(desp.name, "\x00") == name && desp.shdr.SH_type != SHT_NOBITS {
+			return p.readBytes(int64(desp.shdr.SH_offset), int64(desp.shdr.SH_size)), desp.shdr
+		}
+	}
+	return nil, nil
+}
+
+/* the file contents of a PT_LOAD segment and the address they are loaded at */
+type loadedData struct {
+	vaddr uint64
+	data  []byte
+}
+
+/* the file contents of the PT_LOAD segments, where stripped files keep what the sections held */
+func (p *ElfParser) loadData(exec bool) []loadedData {
+	loaded := []loadedData{}
+	for _, phdr := range p.GetPhdrs() {
+		if phdr.P_type == PT_LOAD && (phdr.P_flags&PF_X != 0) == exec {
+			if buf := p.readBytes(int64(phdr.P_offset), int64(phdr.P_filesz)); buf != nil {
+				loaded = append(loaded, loadedData{uint64(phdr.P_vaddr), buf})
+			}
+		}
+	}
+	return loaded
+}
+
+/* reports whether the file was built by the Go linker, or links Go code */
+func (p *ElfParser) IsGo() bool {
+	for _, desp := range p.GetShdrs() {
+		switch strings.TrimRight(desp.name, "\x00") {
+		case ".go.buildinfo", ".gopclntab", ".data.rel.ro.gopclntab", ".note.go.buildid":
+			return true
+		}
+	}
+	return p.GoBuildID() != "" || p.goBuildInfo() != nil
+}
+
+/* returns the build ID from the .note.go.buildid note, "" when there is none */
+func (p *ElfParser) GoBuildID() string {
+	notes := p.GetNotes()
+	for _, desp := range p.GetShdrs() {
+		if strings.TrimRight(desp.name, "\x00") == ".note.go.buildid" {
+			shdr := desp.shdr
+			notes = append(notes, p.readNotes(int64(shdr.SH_offset), int64(shdr.SH_size), int64(shdr.SH_addralign))...)
+		}
+	}
+	for _, note := range notes {
+		if note.name == "Go" && note.typ == NT_GO_BUILDID {
+			return cString(note.desc)
+		}
+	}
+	return ""
+}
+
+/* the .go.buildinfo header, from the section or found by its magic in the data segments */
+func (p *ElfParser) goBuildInfo() []byte {
+	data, _ := p.sectionData(".go.buildinfo")
+	if bytes.HasPrefix(data, go_buildinfo_magic) {
+		return data
+	}
+	// the header is 16 byte aligned
+	for _, loaded := range p.loadData(false) {
+		for i := 0; i+32 <= len(loaded.data); i += 16 {
+			if bytes.HasPrefix(loaded.data[i:], go_buildinfo_magic) {
+				return loaded.data[i:]
+			}
+		}
+	}
+	return nil
+}
+
+/* reads a string header {pointer, length} at addr, as Go before 1.18 refers to its strings */
+func (p *ElfParser) goString(addr uint64, ptrsize int, order binary.ByteOrder) string {
+	word := func(addr uint64) (uint64, bool) {
+		offset, ok := p.vaddrToOffset(Elf64_Addr(addr))
+		if !ok {
+			return 0, false
+		}
+		buf := p.readBytes(offset, int64(ptrsize))
+		if buf == nil {
+			return 0, false
+		}
+		if ptrsize == 4 {
+			return uint64(order.Uint32(buf)), true
+		}
+		return order.Uint64(buf), true
+	}
+	ptr, ok := word(addr)
+	if !ok {
+		return ""
+	}
+	size, ok := word(addr + uint64(ptrsize))
+	if !ok || size > MAX_STRING_SIZE {
+		return ""
+	}
+	offset, ok := p.vaddrToOffset(Elf64_Addr(ptr))
+	if !ok {
+		return ""
+	}
+	return string(p.readBytes(offset, int64(size)))
+}
+
+/*
+decodes .go.buildinfo: the Go version and the module information that `go version -m`
+prints. Since Go 1.18 both strings follow the header, prefixed by their varint length,
+older releases point to string headers in the data segment.
+*/
+func (p *ElfParser) GetGoBuildInfo() (string, *debug.BuildInfo, error) {
+	data := p.goBuildInfo()
+	if len(data) < 32 {
+		return "", nil, fmt.Errorf("error: no .go.buildinfo in this file")
+	}
+
+	var version, modinfo string
+	ptrsize, flags := int(data[14]), data[15]
+	if flags&2 != 0 {
+		data = data[32:]
+		for _, s := range []*string{&version, &modinfo} {
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return "", nil, fmt.Errorf("error: truncated .go.buildinfo")
+			}
+			*s = string(data[n : n+int(size)])
+			data = data[n+int(size):]
+		}
+	} else {
+		if ptrsize != 4 && ptrsize != 8 {
+			return "", nil, fmt.Errorf("error: bad pointer size %d in .go.buildinfo", ptrsize)
+		}
+		var order binary.ByteOrder = binary.LittleEndian
+		if flags&1 != 0 {
+			order = binary.BigEndian
+		}
+		word := func(b []byte) uint64 {
+			if ptrsize == 4 {
+				return uint64(order.Uint32(b))
+			}
+			return order.Uint64(b)
+		}
+		version = p.goString(word(data[16:]), ptrsize, order)
+		modinfo = p.goString(word(data[16+ptrsize:]), ptrsize, order)
+	}
+	if version == "" {
+		return "", nil, fmt.Errorf("error: no Go version in .go.buildinfo")
+	}
+
+	// binaries built outside of a module have no module information
+	if len(modinfo) < 33 || !strings.HasPrefix(modinfo, string(go_modinfo_start)) || !strings.HasSuffix(modinfo, string(go_modinfo_end)) {
+		return version, nil, nil
+	}
+	info, err := debug.ParseBuildInfo(modinfo[16 : len(modinfo)-16])
+	if err != nil {
+		return version, nil, fmt.Errorf("error: bad module information in .go.buildinfo: %v", err)
+	}
+	info.GoVersion = version
+	return version, info, nil
+}
+
+/* checks a .gopclntab header: magic, two zero bytes, the instruction size quantum and the pointer size */
+func goPclntabHeader(data []byte) (string, bool) {
+	if len(data) < 16 || data[4] != 0 || data[5] != 0 {
+		return "", false
+	}
+	if q := data[6]; q != 1 && q != 2 && q != 4 {
+		return "", false
+	}
+	if ps := data[7]; ps != 4 && ps != 8 {
+		return "", false
+	}
+	release, ok := go_pclntab_magic[binary.LittleEndian.Uint32(data)]
+	if !ok {
+		release, ok = go_pclntab_magic[binary.BigEndian.Uint32(data)]
+	}
+	return release, ok
+}
+
+/* the .gopclntab contents and address, from the section or found by its header in the read-only segments */
+func (p *ElfParser) goPclntab() ([]byte, uint64, string) {
+	for _, name := range []string{".gopclntab", ".data.rel.ro.gopclntab"} {
+		if data, shdr := p.sectionData(name); data != nil {
+			if release, ok := goPclntabHeader(data); ok {
+				return data, uint64(shdr.SH_addr), release
+			}
+		}
+	}
+	for _, loaded := range p.loadData(false) {
+		for i := 0; i+16 <= len(loaded.data); i += 4 {
+			if release, ok := goPclntabHeader(loaded.data[i:]); ok {
+				return loaded.data[i:], loaded.vaddr + uint64(i), release
+			}
+		}
+	}
+	return nil, 0, ""
+}
+
+/* reads a pointer sized word */
+func (p *ElfParser) goWord(b []byte, ptrsize int) uint64 {
+	if ptrsize == 4 {
+		return uint64(p.order.Uint32(b))
+	}
+	return p.order.Uint64(b)
+}
+
+/*
+the address the function table is relative to: runtime.text, else the text field of
+the runtime's moduledata, which since Go 1.16 starts with a pointer to the table header
+and the funcnametab slice into the table, and holds text 22 words in. Then the text start in the header, zero in recent releases,
+and last the start of .text or of the code segment.
+*/
+func (p *ElfParser) goTextStart(pclntab []byte, addr uint64) uint64 {
+	for _, desp := range p.GetSyms() {
+		if strings.TrimRight(desp.name, "\x00") == "runtime.text" {
+			return uint64(desp.sym.ST_value)
+		}
+	}
+	release, _ := goPclntabHeader(pclntab)
+	if release == "go1.2" {
+		return 0 // the function table holds absolute addresses
+	}
+	ptrsize := int(pclntab[7])
+	for _, loaded := range p.loadData(false) {
+		data := loaded.data
+		for i := 0; i+23*ptrsize <= len(data); i += ptrsize {
+			if p.goWord(data[i:], ptrsize) != addr {
+				continue
+			}
+			names := p.goWord(data[i+ptrsize:], ptrsize)
+			if names < addr || names >= addr+uint64(len(pclntab)) || p.goWord(data[i+2*ptrsize:], ptrsize) != p.goWord(data[i+3*ptrsize:], ptrsize) {
+				continue
+			}
+			text := p.goWord(data[i+22*ptrsize:], ptrsize)
+			if _, ok := p.vaddrToOffset(Elf64_Addr(text)); ok && text != 0 {
+				return text
+			}
+		}
+	}
+	if release != "go1.16" && len(pclntab) >= 8+3*ptrsize {
+		if text := p.goWord(pclntab[8+2*ptrsize:], ptrsize); text != 0 {
+			return text
+		}
+	}
+	if _, shdr := p.sectionData(".text"); shdr != nil {
+		return uint64(shdr.SH_addr)
+	}
+	for _, phdr := range p.GetPhdrs() {
+		if phdr.P_type == PT_LOAD && phdr.P_flags&PF_X != 0 {
+			return uint64(phdr.P_vaddr)
+		}
+	}
+	return 0
+}
+
+/*
+checks the counts and offsets of a .gopclntab header against the size of the table.
+debug/gosym allocates by the function count before it reads the table and computes
+the go1.2 table size in 32 bits, so a bad count exhausts memory, which recover cannot catch.
+*/
+func (p *ElfParser) goCheckPclntab(pclntab []byte, release string) error {
+	ptrsize := uint64(pclntab[7])
+	size := uint64(len(pclntab))
+	word := func(n uint64) (uint64, bool) {
+		off := 8 + n*ptrsize
+		if off+ptrsize > size {
+			return 0, false
+		}
+		return p.goWord(pclntab[off:], int(ptrsize)), true
+	}
+
+	nfunc, ok := word(0)
+	// every function takes at least two words in the function table
+	if !ok || nfunc > size/8 {
+		return fmt.Errorf("error: bad .gopclntab: %d functions in %d bytes", nfunc, size)
+	}
+	if release == "go1.2" {
+		// the function table follows the count, the offset of the file table follows it
+		end := 8 + ptrsize + (2*nfunc+1)*ptrsize
+		if end+4 > size {
+			return fmt.Errorf("error: bad .gopclntab: the function table ends past the end at 0x%x", end)
+		}
+		fileoff := uint64(p.order.Uint32(pclntab[end:]))
+		if fileoff+4 > size {
+			return fmt.Errorf("error: bad .gopclntab: the file table at 0x%x is past the end", fileoff)
+		}
+		if nfiles := uint64(p.order.Uint32(pclntab[fileoff:])); fileoff+4*nfiles > size {
+			return fmt.Errorf("error: bad .gopclntab: %d files in %d bytes", nfiles, size)
+		}
+		return nil
+	}
+
+	// since Go 1.16 the header holds the file count and the offsets of the tables, the function table last
+	first, last, entsize := uint64(2), uint64(6), ptrsize
+	if release != "go1.16" {
+		first, last, entsize = 3, 7, 4 // the text start comes before the offsets, entries are 32 bit offsets
+	}
+	if nfiles, ok := word(1); !ok || nfiles > size {
+		return fmt.Errorf("error: bad .gopclntab: %d files in %d bytes", nfiles, size)
+	}
+	for n := first; n <= last; n++ {
+		off, ok := word(n)
+		if !ok || off > size {
+			return fmt.Errorf("error: bad .gopclntab: table %d at 0x%x is past the end", n, off)
+		}
+	}
+	functab, _ := word(last)
+	if functab+(2*nfunc+1)*entsize > size {
+		return fmt.Errorf("error: bad .gopclntab: the function table ends past the end at 0x%x", functab+(2*nfunc+1)*entsize)
+	}
+	return nil
+}
+
+/* decodes .gopclntab into the function table with file and line lookup, which works on stripped binaries */
+func (p *ElfParser) GetGoTable() (table *gosym.Table, release string, err error) {
+	pclntab, addr, release := p.goPclntab()
+	if pclntab == nil {
+		return nil, "", fmt.Errorf("error: no .gopclntab in this file")
+	}
+	if err := p.goCheckPclntab(pclntab, release); err != nil {
+		return nil, release, err
+	}
+	// debug/gosym trusts the offsets in the table
+	defer func() {
+		if r := recover(); r != nil {
+			table, err = nil, fmt.Errorf("error: bad .gopclntab: %v", r)
+		}
+	}()
+	table, err = gosym.NewTable(nil, gosym.NewLineTable(pclntab, p.goTextStart(pclntab, addr)))
+	if err != nil {
+		return nil, release, fmt.Errorf("error: bad .gopclntab: %v", err)
+	}
+	return table, release, nil
+}
+
+/* collects what the file tells about its Go build, nil when it is not a Go binary */
+func (p *ElfParser) GetGoInfo() (*GoInfo, error) {
+	if !p.IsGo() {
+		return nil, fmt.Errorf("error: not a Go binary")
+	}
+	info := new(GoInfo)
+	info.BuildID = p.GoBuildID()
+
+	version, build, err := p.GetGoBuildInfo()
+	if err != nil {
+		p.fail("%v", err)
+	}
+	info.GoVersion, info.build = version, build
+	info.Deps, info.Settings = []*GoModule{}, []GoSetting{}
+	if build != nil {
+		info.Path, info.Main = build.Path, goModule(&build.Main)
+		for _, dep := range build.Deps {
+			info.Deps = append(info.Deps, goModule(dep))
+		}
+		for _, setting := range build.Settings {
+			info.Settings = append(info.Settings, GoSetting{setting.Key, setting.Value})
+		}
+	}
+
+	table, release, err := p.GetGoTable()
+	if err != nil {
+		p.fail("%v", err)
+	} else {
+		info.Pclntab = release
+		info.Functions = len(table.Funcs)
+		info.Files = len(table.Files)
+	}
+	return info, nil
+}
+
+/* the text `go version -m` prints: the version, then the module information indented by a tab */
+func (info *GoInfo) String() string {
+	builder := new(strings.Builder)
+	version := info.GoVersion
+	if version == "" {
+		version = "unknown Go version"
+	}
+	fmt.Fprintf(builder, "%s: %s\n", info.File, version)
+	if info.build != nil {
+		for _, line := range strings.Split(strings.TrimRight(info.build.String(), "\n"), "\n") {
+			if !strings.HasPrefix(line, "go\t") {
+				fmt.Fprintf(builder, "\t%s\n", line)
+			}
+		}
+	}
+	if info.BuildID != "" {
+		fmt.Fprintf(builder, "\tbuildid\t%s\n", info.BuildID)
+	}
+	if info.Pclntab != "" {
+		fmt.Fprintf(builder, "\tpclntab\t%s layout, %d functions, %d files\n", info.Pclntab, info.Functions, info.Files)
+	}
+	return builder.String()
+}
+
+/* describes pc as function+offset file:line */
+func goSymbolize(table *gosym.Table, pc uint64) string {
+	file, line, fn := table.PCToLine(pc)
+	if fn == nil {
+		return "??"
+	}
+	return fmt.Sprintf("%s+0x%x %s:%d", fn.Name, pc-fn.Entry, file, line)
+}
+
+func runGo(args []string) error {
+	asJson, funcs := false, false
+	addrs := []uint64{}
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--json":
+			asJson = true
+		case "--funcs":
+			funcs = true
+		case "--addr":
+			if i+1 >= len(args) {
+				return usageError("elfparser: option requires an argument: %s", arg)
+			}
+			i++
+			addr, err := strconv.ParseUint(args[i], 0, 64)
+			if err != nil {
+				return usageError("elfparser: bad address: %s", args[i])
+			}
+			addrs = append(addrs, addr)
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+
+	results := []*GoInfo{}
+	for _, path := range paths {
+		info, table, err := goFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			continue
+		}
+		if asJson {
+			results = append(results, info)
+			continue
+		}
+
+		fmt.Print(info)
+		if table == nil {
+			continue
+		}
+		if funcs {
+			for _, fn := range table.Funcs {
+				file, line, _ := table.PCToLine(fn.Entry)
+				fmt.Printf("0x%016x 0x%016x %s %s:%d\n", fn.Entry, fn.End, fn.Name, file, line)
+			}
+		}
+		for _, addr := range addrs {
+			fmt.Printf("0x%016x %s\n", addr, goSymbolize(table, addr))
+		}
+	}
+
+	if asJson {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	}
+	return nil
+}
+
+/* reads the Go build of a file, the function table is nil when .gopclntab cannot be decoded */
+func goFile(path string) (*GoInfo, *gosym.Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	parser, err := LoadData(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := parser.GetGoInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	info.File = path
+	for _, err := range parser.Errors() {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+	table, _, _ := parser.GetGoTable()
+	return info, table, nil
+}
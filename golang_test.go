@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+/* the test binary is a Go binary, its build information and function table describe this package */
+func TestGoBinary(t *testing.T) {
+	path, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer file.Close()
+
+	p, err := LoadData(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := p.GetGoInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("Go version %q, want %q", info.GoVersion, runtime.Version())
+	}
+	if info.BuildID == "" {
+		t.Errorf("no build ID")
+	}
+	if info.Main == nil || info.Main.Path != "github.com/wasuppu/elf" {
+		t.Errorf("main module %+v, want github.com/wasuppu/elf", info.Main)
+	}
+
+	table, _, err := p.GetGoTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := uint64(reflect.ValueOf(goSymbolize).Pointer())
+	source, _, fn := table.PCToLine(pc)
+	if fn == nil || fn.Name != "github.com/wasuppu/elf.goSymbolize" || !strings.HasSuffix(source, "golang.go") {
+		t.Errorf("0x%x is %v in %s, want goSymbolize in golang.go", pc, fn, source)
+	}
+}
+
+/*
+the go1.20 .gopclntab of one function, main.main at the start of .text, on line 3 of main.go
+for the 16 bytes of the function: the header, the function names, the compilation unit and
+file tables, the pc-value tables and the function table with the _func entry of main.main
+*/
+func fixtureGoPclntab() []byte {
+	buf := new(bytes.Buffer)
+	word := func(v ...uint64) { binary.Write(buf, binary.LittleEndian, v) }
+	binary.Write(buf, binary.LittleEndian, uint32(0xfffffff1))
+	buf.Write([]byte{0, 0, 1, 8})
+	// functions, files, text start, then the offsets of the tables
+	word(1, 1, 0, 72, 82, 86, 94, 104)
+	buf.WriteString("main.main\x00")
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	buf.WriteString("main.go\x00")
+	// pcfile at 1 and pcln at 4: zigzag value deltas from -1, each for 16 bytes
+	buf.Write([]byte{0, 0x02, 0x10, 0, 0x08, 0x10, 0, 0, 0, 0})
+	// entry and _func offset of main.main, then the end of the last function
+	binary.Write(buf, binary.LittleEndian, []uint32{0, 12, 16})
+	// entryOff, nameOff, args, deferreturn, pcsp, pcfile, pcln, npcdata, cuOffset, startLine, funcID and flags
+	binary.Write(buf, binary.LittleEndian, []uint32{0, 0, 0, 0, 0, 1, 4, 0, 0, 3, 0})
+	return buf.Bytes()
+}
+
+/* a stripped Go executable, all that is left is the function table */
+func fixtureGo() *fixture {
+	f := fixtureExec(binary.LittleEndian, EM_X86_64, true)
+	f.add(&fixtureSection{name: ".gopclntab", typ: SHT_PROGBITS, flags: SHF_ALLOC, align: 32, data: fixtureGoPclntab()})
+	return f
+}
+
+/* the function table resolves addresses, damaged counts and offsets are refused before debug/gosym reads them */
+func TestGoTable(t *testing.T) {
+	data := fixtureGo().Bytes()
+	p, err := LoadData(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, release, err := p.GetGoTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, text := p.sectionData(".text")
+	file, line, fn := table.PCToLine(uint64(text.SH_addr) + 4)
+	if release != "go1.20" || fn == nil || fn.Name != "main.main" || file != "main.go" || line != 3 {
+		t.Errorf("%s table: .text+4 is %v at %s:%d, want main.main at main.go:3", release, fn, file, line)
+	}
+
+	_, shdr := p.sectionData(".gopclntab")
+	for name, damage := range map[string]func(pclntab []byte){
+		"functions":      func(pclntab []byte) { binary.LittleEndian.PutUint64(pclntab[8:], 0xffffffff) },
+		"files":          func(pclntab []byte) { binary.LittleEndian.PutUint64(pclntab[16:], 1<<40) },
+		"function table": func(pclntab []byte) { binary.LittleEndian.PutUint64(pclntab[64:], 150) },
+		"file table":     func(pclntab []byte) { binary.LittleEndian.PutUint64(pclntab[48:], 1<<32) },
+		// the go1.2 layout, its table size wraps in 32 bits in debug/gosym
+		"go1.2 functions": func(pclntab []byte) {
+			binary.LittleEndian.PutUint32(pclntab, 0xfffffffb)
+			binary.LittleEndian.PutUint64(pclntab[8:], 1<<31)
+		},
+	} {
+		damaged := append([]byte{}, data...)
+		damage(damaged[shdr.SH_offset:])
+		p, err := LoadData(bytes.NewReader(damaged))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p.GetGoTable(); err == nil {
+			t.Errorf("the table with bad %s was decoded", name)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* the hash function of the SysV hash table */
+func elfHash(name string) Elf64_Word {
+	var h Elf64_Word
+	for i := 0; i < len(name); i++ {
+		h = (h << 4) + Elf64_Word(name[i])
+		g := h & 0xf0000000
+		if g != 0 {
+			h ^= g >> 24
+		}
+		h &^= g
+	}
+	return h
+}
+
+/* the hash function of the GNU hash table (Bernstein's djb2) */
+func gnuHash(name string) Elf64_Word {
+	h := Elf64_Word(5381)
+	for i := 0; i < len(name); i++ {
+		h = h*33 + Elf64_Word(name[i])
+	}
+	return h
+}
+
+/* reads the SysV hash table, nil when the file has no .hash section */
+func (p *ElfParser) GetHashTable() *Elf64HashTable {
+	if p.hashTab != nil {
+		return p.hashTab
+	}
+
+	for _, shdrDesp := range p.GetShdrs() {
+		shdr := shdrDesp.shdr
+		if shdr.SH_type != SHT_HASH || shdr.SH_size < 8 {
+			continue
+		}
+		if !p.inFile(uint64(shdr.SH_offset), uint64(shdr.SH_size)) {
+			p.fail("error: the hash table at 0x%x extends past the end of the file", shdr.SH_offset)
+			return nil
+		}
+
+		pos := int64(shdr.SH_offset)
+		header := make([]Elf64_Word, 2)
+		if err := read(p.order, p.file, pos, &header); err != nil {
+			return nil
+		}
+		nbucket, nchain := int64(header[0]), int64(header[1])
+		if 8+4*(nbucket+nchain) > int64(shdr.SH_size) {
+			return nil
+		}
+
+		table := new(Elf64HashTable)
+		table.buckets = make([]Elf64_Word, nbucket)
+		table.chains = make([]Elf64_Word, nchain)
+		if read(p.order, p.file, pos+8, &table.buckets) != nil || read(p.order, p.file, pos+8+4*nbucket, &table.chains) != nil {
+			return nil
+		}
+		p.hashTab = table
+		return table
+	}
+	return nil
+}
+
+/* reads the GNU hash table, nil when the file has no .gnu.hash section */
+func (p *ElfParser) GetGnuHashTable() *Elf64GnuHashTable {
+	if p.gnuHashTab != nil {
+		return p.gnuHashTab
+	}
+
+	for _, shdrDesp := range p.GetShdrs() {
+		shdr := shdrDesp.shdr
+		if shdr.SH_type != SHT_GNU_HASH || shdr.SH_size < 16 {
+			continue
+		}
+
+		if !p.inFile(uint64(shdr.SH_offset), uint64(shdr.SH_size)) {
+			p.fail("error: the GNU hash table at 0x%x extends past the end of the file", shdr.SH_offset)
+			return nil
+		}
+
+		table := new(Elf64GnuHashTable)
+		pos := int64(shdr.SH_offset)
+		end := pos + int64(shdr.SH_size)
+		if err := read(p.order, p.file, pos, &table.hdr); err != nil {
+			return nil
+		}
+		pos += 16
+
+		bloomsize := int64(table.hdr.GH_bloomsize)
+		nbuckets := int64(table.hdr.GH_nbuckets)
+		if pos+8*bloomsize+4*nbuckets > end {
+			return nil
+		}
+		table.bloom = make([]Elf64_XWord, bloomsize)
+		table.buckets = make([]Elf64_Word, nbuckets)
+		// the chain array has no explicit length, it covers the remaining dynamic symbols
+		table.chains = make([]Elf64_Word, (end-pos-8*bloomsize-4*nbuckets)/4)
+		if read(p.order, p.file, pos, &table.bloom) != nil ||
+			read(p.order, p.file, pos+8*bloomsize, &table.buckets) != nil ||
+			read(p.order, p.file, pos+8*bloomsize+4*nbuckets, &table.chains) != nil {
+			return nil
+		}
+		p.gnuHashTab = table
+		return table
+	}
+	return nil
+}
+
+/*
+looks up a dynamic symbol by name the way ld.so does: through the GNU hash table
+(bloom filter, bucket, then chain) or the SysV hash table, and by a linear scan of
+the symbol tables only when the file has neither
+*/
+func (p *ElfParser) LookupSymbol(name string) (*Elf64SymbolHeaderDesp, bool) {
+	dynsyms := p.GetDynSyms()
+
+	if table := p.GetGnuHashTable(); table != nil {
+		idx, ok := table.lookup(name, dynsyms)
+		if !ok {
+			return nil, false
+		}
+		return dynsyms[idx], true
+	}
+
+	if table := p.GetHashTable(); table != nil {
+		idx, ok := table.lookup(name, dynsyms)
+		if !ok {
+			return nil, false
+		}
+		return dynsyms[idx], true
+	}
+
+	for _, desp := range p.GetSyms() {
+		if desp.sym.ST_shndx != SHN_UNDEF && strings.Trim(desp.name, "\x00") == name {
+			return desp, true
+		}
+	}
+	return nil, false
+}
+
+func (table *Elf64GnuHashTable) lookup(name string, dynsyms []*Elf64SymbolHeaderDesp) (int, bool) {
+	if table.hdr.GH_nbuckets == 0 || table.hdr.GH_bloomsize == 0 {
+		return 0, false
+	}
+	h := gnuHash(name)
+
+	word := table.bloom[(h/64)%table.hdr.GH_bloomsize]
+	mask := Elf64_XWord(1)<<(h%64) | Elf64_XWord(1)<<((h>>table.hdr.GH_bloomshift)%64)
+	if word&mask != mask {
+		return 0, false
+	}
+
+	idx := table.buckets[h%table.hdr.GH_nbuckets]
+	if idx < table.hdr.GH_symoffset {
+		return 0, false
+	}
+	for {
+		c := int(idx - table.hdr.GH_symoffset)
+		if c >= len(table.chains) || int(idx) >= len(dynsyms) {
+			return 0, false
+		}
+		if table.chains[c]|1 == h|1 && defines(dynsyms[idx], name) {
+			return int(idx), true
+		}
+		if table.chains[c]&1 != 0 {
+			return 0, false
+		}
+		idx++
+	}
+}
+
+func (table *Elf64HashTable) lookup(name string, dynsyms []*Elf64SymbolHeaderDesp) (int, bool) {
+	if len(table.buckets) == 0 {
+		return 0, false
+	}
+	h := elfHash(name)
+
+	// a corrupt chain may loop, a well-formed one never visits more than nchain entries
+	idx := table.buckets[h%Elf64_Word(len(table.buckets))]
+	for n := 0; idx != 0 && n < len(table.chains); n++ {
+		if int(idx) >= len(dynsyms) || int(idx) >= len(table.chains) {
+			return 0, false
+		}
+		if defines(dynsyms[idx], name) {
+			return int(idx), true
+		}
+		idx = table.chains[idx]
+	}
+	return 0, false
+}
+
+/* like ld.so, a lookup passes over undefined entries with the same name */
+func defines(desp *Elf64SymbolHeaderDesp, name string) bool {
+	return desp.sym.ST_shndx != SHN_UNDEF && strings.Trim(desp.name, "\x00") == name
+}
+
+/* returns the length of every bucket chain of the SysV hash table */
+func (table *Elf64HashTable) chainLengths() []int {
+	lengths := make([]int, len(table.buckets))
+	for i, idx := range table.buckets {
+		for n := 0; idx != 0 && int(idx) < len(table.chains) && n < len(table.chains); n++ {
+			lengths[i]++
+			idx = table.chains[idx]
+		}
+	}
+	return lengths
+}
+
+/* returns the length of every bucket chain of the GNU hash table */
+func (table *Elf64GnuHashTable) chainLengths() []int {
+	lengths := make([]int, len(table.buckets))
+	for i, idx := range table.buckets {
+		if idx < table.hdr.GH_symoffset {
+			continue
+		}
+		for c := int(idx - table.hdr.GH_symoffset); c < len(table.chains); c++ {
+			lengths[i]++
+			if table.chains[c]&1 != 0 {
+				break
+			}
+		}
+	}
+	return lengths
+}
+
+/* reports the defined dynamic symbols that cannot be found through the hash tables */
+func (p *ElfParser) CheckHashTables() []string {
+	errs := []string{}
+	dynsyms := p.GetDynSyms()
+	gnu := p.GetGnuHashTable()
+	sysv := p.GetHashTable()
+
+	if sysv != nil && len(sysv.chains) != len(dynsyms) {
+		errs = append(errs, fmt.Sprintf("`.hash' has %d chain entries but `.dynsym' has %d symbols", len(sysv.chains), len(dynsyms)))
+	}
+	if gnu != nil && int(gnu.hdr.GH_symoffset)+len(gnu.chains) < len(dynsyms) {
+		errs = append(errs, fmt.Sprintf("`.gnu.hash' covers %d symbols but `.dynsym' has %d", int(gnu.hdr.GH_symoffset)+len(gnu.chains), len(dynsyms)))
+	}
+
+	for i, desp := range dynsyms {
+		name := strings.Trim(desp.name, "\x00")
+		if desp.sym.ST_shndx == SHN_UNDEF || name == "" {
+			continue
+		}
+
+		if gnu != nil {
+			if i < int(gnu.hdr.GH_symoffset) {
+				errs = append(errs, fmt.Sprintf("`.gnu.hash': defined symbol %d (%s) is below symoffset %d", i, name, gnu.hdr.GH_symoffset))
+			} else if c := i - int(gnu.hdr.GH_symoffset); c < len(gnu.chains) && gnu.chains[c]|1 != gnuHash(name)|1 {
+				errs = append(errs, fmt.Sprintf("`.gnu.hash': symbol %d (%s) has a wrong hash value", i, name))
+			} else if _, ok := gnu.lookup(name, dynsyms); !ok {
+				errs = append(errs, fmt.Sprintf("`.gnu.hash': symbol %d (%s) is not reachable", i, name))
+			}
+		}
+
+		if sysv != nil {
+			if _, ok := sysv.lookup(name, dynsyms); !ok {
+				errs = append(errs, fmt.Sprintf("`.hash': symbol %d (%s) is not reachable", i, name))
+			}
+		}
+	}
+	return errs
+}
+
+func (p *ElfParser) PrintHistogram() {
+	if table := p.GetHashTable(); table != nil {
+		fmt.Printf("\nHistogram for bucket list length (total of %d buckets):\n", len(table.buckets))
+		printHistogram(table.chainLengths())
+	}
+	if table := p.GetGnuHashTable(); table != nil {
+		fmt.Printf("\nHistogram for `.gnu.hash' bucket list length (total of %d buckets):\n", len(table.buckets))
+		printHistogram(table.chainLengths())
+	}
+	for _, err := range p.CheckHashTables() {
+		fmt.Printf("error: %s\n", err)
+	}
+}
+
+func printHistogram(lengths []int) {
+	maxLength := 0
+	total := 0
+	for _, length := range lengths {
+		maxLength = max(maxLength, length)
+		total += length
+	}
+	counts := make([]int, maxLength+1)
+	for _, length := range lengths {
+		counts[length]++
+	}
+
+	fmt.Println(" Length  Number     % of total  Coverage")
+	covered := 0
+	for length, count := range counts {
+		fmt.Printf("%7d  %-10d (%5.1f%%)", length, count, percent(count, len(lengths)))
+		if length != 0 {
+			covered += length * count
+			fmt.Printf("    %5.1f%%", percent(covered, total))
+		}
+		fmt.Println()
+	}
+}
+
+func percent(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
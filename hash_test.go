@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+/* the symbols the hash fixtures export, and the one they import */
+var fixtureHashNames = []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta", "theta", "iota", "kappa"}
+
+/*
+a shared object whose exports can be found through a SysV .hash, a GNU .gnu.hash or both.
+As ld does, the symbols the GNU table covers are sorted by bucket and the import stays below symoffset.
+*/
+func fixtureHashed(sysv bool, gnu bool) *fixture {
+	const nbuckets, bloomsize, bloomshift = 3, 1, 6
+	names := append([]string{}, fixtureHashNames...)
+	sort.SliceStable(names, func(i, j int) bool { return gnuHash(names[i])%nbuckets < gnuHash(names[j])%nbuckets })
+	exports := []fixtureSymbol{}
+	for _, name := range names {
+		exports = append(exports, fixtureSymbol{name: name, bind: STB_GLOBAL, typ: STT_FUNC, size: 9})
+	}
+	link := fixtureLink{soname: "libhash.so.1", imports: []fixtureSymbol{{name: "puts", bind: STB_GLOBAL, typ: STT_FUNC}}, exports: exports}
+	if sysv {
+		link.dyns = append(link.dyns, Elf64Dyn{D_tag: DT_HASH})
+	}
+	if gnu {
+		link.dyns = append(link.dyns, Elf64Dyn{D_tag: DT_GNU_HASH})
+	}
+	f := fixtureDynamic(ET_DYN, link)
+	symoffset := 2
+	count := symoffset + len(names)
+
+	if sysv {
+		words := make([]uint32, 2+nbuckets+count)
+		words[0], words[1] = nbuckets, uint32(count)
+		all := append([]string{"", "puts"}, names...)
+		// each symbol is put at the head of its bucket, the chain links to the previous head
+		for i := 1; i < count; i++ {
+			b := elfHash(all[i]) % nbuckets
+			words[2+nbuckets+i] = words[2+b]
+			words[2+b] = uint32(i)
+		}
+		data := new(bytes.Buffer)
+		binary.Write(data, binary.LittleEndian, words)
+		f.add(&fixtureSection{name: ".hash", typ: SHT_HASH, flags: SHF_ALLOC, align: 8, entsize: 4, link: ".dynsym", data: data.Bytes()})
+	}
+	if gnu {
+		header := []uint32{nbuckets, uint32(symoffset), bloomsize, bloomshift}
+		bloom := make([]uint64, bloomsize)
+		buckets := make([]uint32, nbuckets)
+		chains := make([]uint32, len(names))
+		for i, name := range names {
+			h := uint32(gnuHash(name))
+			bloom[(h/64)%bloomsize] |= 1<<(h%64) | 1<<((h>>bloomshift)%64)
+			if buckets[h%nbuckets] == 0 {
+				buckets[h%nbuckets] = uint32(symoffset + i)
+			}
+			chains[i] = h &^ 1
+			// the last symbol of a bucket ends its chain
+			if i == len(names)-1 || gnuHash(names[i+1])%nbuckets != Elf64_Word(h%nbuckets) {
+				chains[i] |= 1
+			}
+		}
+		data := new(bytes.Buffer)
+		binary.Write(data, binary.LittleEndian, header)
+		binary.Write(data, binary.LittleEndian, bloom)
+		binary.Write(data, binary.LittleEndian, buckets)
+		binary.Write(data, binary.LittleEndian, chains)
+		f.add(&fixtureSection{name: ".gnu.hash", typ: SHT_GNU_HASH, flags: SHF_ALLOC, align: 8, link: ".dynsym", data: data.Bytes()})
+	}
+	return f
+}
+
+/* parses data after change edits the named section in place */
+func loadPatched(t *testing.T, data []byte, section string, change func(data []byte)) *ElfParser {
+	t.Helper()
+	p, err := LoadData(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if section != "" {
+		_, shdr := sectionBytes(p, section)
+		data = append([]byte{}, data...)
+		change(data[shdr.SH_offset : shdr.SH_offset+Elf64_Off(shdr.SH_size)])
+		if p, err = LoadData(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func TestLookupSymbol(t *testing.T) {
+	tests := []struct {
+		name      string
+		sysv, gnu bool
+	}{
+		{"GNU", false, true},
+		{"SysV", true, false},
+		{"both", true, true},
+		{"neither", false, false},
+	}
+	for _, test := range tests {
+		p := loadPatched(t, fixtureHashed(test.sysv, test.gnu).Bytes(), "", nil)
+		if (p.GetGnuHashTable() != nil) != test.gnu || (p.GetHashTable() != nil) != test.sysv {
+			t.Fatalf("%s: the hash tables were not read", test.name)
+		}
+		if errs := p.CheckHashTables(); len(errs) != 0 {
+			t.Errorf("%s: %q", test.name, errs)
+		}
+		for _, name := range fixtureHashNames {
+			if desp, ok := p.LookupSymbol(name); !ok || strings.TrimRight(desp.name, "\x00") != name {
+				t.Errorf("%s: %s was not found", test.name, name)
+			}
+		}
+		// undefined symbols and unknown names are not found
+		for _, name := range []string{"puts", "", "alph", "alphaa", "lambda", "mu", "omega"} {
+			if desp, ok := p.LookupSymbol(name); ok {
+				t.Errorf("%s: looking up %q found %s", test.name, name, desp.name)
+			}
+		}
+	}
+}
+
+/* a name the bloom filter rejects is never looked for in the buckets, a defined name included */
+func TestLookupSymbolBloom(t *testing.T) {
+	data := fixtureHashed(false, true).Bytes()
+	p := loadPatched(t, data, ".gnu.hash", func(data []byte) { clear(data[16:24]) })
+	for _, name := range fixtureHashNames {
+		if _, ok := p.LookupSymbol(name); ok {
+			t.Errorf("%s was found past an empty bloom filter", name)
+		}
+	}
+	// a full bloom filter lets every name through to the chains, which still tell the names apart
+	p = loadPatched(t, data, ".gnu.hash", func(data []byte) { copy(data[16:24], bytes.Repeat([]byte{0xff}, 8)) })
+	for _, name := range fixtureHashNames {
+		if _, ok := p.LookupSymbol(name); !ok {
+			t.Errorf("%s was not found past a full bloom filter", name)
+		}
+	}
+	if _, ok := p.LookupSymbol("lambda"); ok {
+		t.Errorf("lambda was found past a full bloom filter")
+	}
+}
+
+func TestCheckHashTables(t *testing.T) {
+	data := fixtureHashed(true, true).Bytes()
+	p := loadPatched(t, data, "", nil)
+	dynsyms := p.GetDynSyms()
+	name := func(idx int) string {
+		return strings.TrimRight(dynsyms[idx].name, "\x00")
+	}
+	unreachable := func(table string, from int, to int) []string {
+		errs := []string{}
+		for i := from; i < to; i++ {
+			errs = append(errs, fmt.Sprintf("`%s': symbol %d (%s) is not reachable", table, i, name(i)))
+		}
+		return errs
+	}
+	// the GNU bucket of alpha holds the symbols from alpha to the end of its chain
+	gnu := p.GetGnuHashTable()
+	first := int(gnu.buckets[gnuHash("alpha")%gnu.hdr.GH_nbuckets])
+	end := first
+	for gnu.chains[end-int(gnu.hdr.GH_symoffset)]&1 == 0 {
+		end++
+	}
+	// the SysV chain of alpha past its head, in symbol order
+	sysv := p.GetHashTable()
+	head := sysv.buckets[elfHash("alpha")%Elf64_Word(len(sysv.buckets))]
+	lost := []int{}
+	for idx := sysv.chains[head]; idx != 0; idx = sysv.chains[idx] {
+		lost = append(lost, int(idx))
+	}
+	sort.Ints(lost)
+	cut := []string{}
+	for _, idx := range lost {
+		cut = append(cut, unreachable(".hash", idx, idx+1)...)
+	}
+	nbuckets := len(sysv.buckets)
+	chain := 24 + 4*int(gnu.hdr.GH_nbuckets) + 4*(first-int(gnu.hdr.GH_symoffset))
+	if end-first < 2 || len(lost) == 0 {
+		t.Fatalf("the chains of alpha are too short to break")
+	}
+
+	tests := []struct {
+		section string
+		change  func(data []byte)
+		want    []string
+	}{
+		// cutting a SysV chain after its head loses the rest of the chain
+		{".hash", func(data []byte) { binary.LittleEndian.PutUint32(data[4*(2+nbuckets+int(head)):], 0) }, cut},
+		// a bucket that starts one symbol late skips the first of its chain
+		{".gnu.hash", func(data []byte) { binary.LittleEndian.PutUint32(data[24+4*(gnuHash("alpha")%3):], uint32(first+1)) },
+			unreachable(".gnu.hash", first, first+1)},
+		{".gnu.hash", func(data []byte) {
+			binary.LittleEndian.PutUint32(data[chain:], binary.LittleEndian.Uint32(data[chain:])^0x100)
+		},
+			[]string{fmt.Sprintf("`.gnu.hash': symbol %d (%s) has a wrong hash value", first, name(first))}},
+		// a chain that ends early hides the symbols after it
+		{".gnu.hash", func(data []byte) {
+			binary.LittleEndian.PutUint32(data[chain:], binary.LittleEndian.Uint32(data[chain:])|1)
+		},
+			unreachable(".gnu.hash", first+1, end+1)},
+	}
+	for _, test := range tests {
+		p := loadPatched(t, data, test.section, test.change)
+		if got := p.CheckHashTables(); strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%q\nwant %q", got, test.want)
+		}
+	}
+
+	// tables that do not cover .dynsym are reported before the symbols they lose
+	p = loadPatched(t, data, ".hash", func(data []byte) { binary.LittleEndian.PutUint32(data[4:], 5) })
+	if got := p.CheckHashTables(); len(got) == 0 || got[0] != "`.hash' has 5 chain entries but `.dynsym' has 12 symbols" {
+		t.Errorf("%q", got)
+	}
+	p = loadPatched(t, data, ".gnu.hash", func(data []byte) { binary.LittleEndian.PutUint32(data[4:], 3) })
+	want := fmt.Sprintf("`.gnu.hash': defined symbol 2 (%s) is below symoffset 3", name(2))
+	if got := p.CheckHashTables(); len(got) == 0 || got[0] != want {
+		t.Errorf("%q\nwant %q first", got, want)
+	}
+}
+
+/* the -I output, checked against readelf -I on the same file */
+func TestPrintHistogram(t *testing.T) {
+	p := loadPatched(t, fixtureHashed(true, true).Bytes(), "", nil)
+	checkGolden(t, "hash.histogram", captureStdout(t, p.PrintHistogram))
+}
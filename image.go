@@ -0,0 +1,528 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/* limits on what an image can make the scanner read into memory */
+const (
+	MAX_IMAGE_FILE = 1 << 30 /* largest ELF file read from a layer */
+	MAX_IMAGE_JSON = 1 << 22 /* largest manifest, index or config read from an image */
+)
+
+/* OCI image layout descriptors, indexes and manifests, docker's distribution formats share the fields */
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant"`
+	} `json:"platform"`
+}
+
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+/* an entry of the manifest.json of docker save */
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+/* an image of an image layout or tarball: a name and its layers from the bottom up */
+type imageRef struct {
+	name   string
+	layers []string
+}
+
+/*
+the files of one layer by path, nil for what is not an ELF file, and what it deletes in
+the layers below: whiteouts remove a path, opaque directories everything in them. Hard
+links are kept by path and target, which may be in a layer below.
+*/
+type imageLayer struct {
+	files     map[string]*ScanResult
+	links     map[string]string
+	whiteouts []string
+	opaque    []string
+}
+
+/* reads layers and parses the ELF files in them on a pool of workers */
+type imageScanner struct {
+	jobs chan imageFile
+	wg   sync.WaitGroup
+}
+
+type imageFile struct {
+	path   string
+	data   []byte
+	result *ScanResult
+}
+
+func newImageScanner(workers int) *imageScanner {
+	s := &imageScanner{jobs: make(chan imageFile)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for f := range s.jobs {
+				*f.result = *scanData(f.path, f.data)
+				s.wg.Done()
+			}
+		}()
+	}
+	return s
+}
+
+/* waits for the files handed to the workers and stops them */
+func (s *imageScanner) close() {
+	s.wg.Wait()
+	close(s.jobs)
+}
+
+/* reports whether path is an OCI image layout or a tar or gzip file that scan reads as an image */
+func IsImage(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		_, err := os.Stat(filepath.Join(path, "oci-layout"))
+		return err == nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(file, header)
+	return isGzip(header[:n]) || isTar(header[:n])
+}
+
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+func isTar(data []byte) bool {
+	return len(data) >= 263 && string(data[257:262]) == "ustar"
+}
+
+/* manifests, indexes and configs are JSON objects, the manifest.json of docker save an array */
+func isJson(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) != 0 && (data[0] == '{' || data[0] == '[')
+}
+
+func isZstd(data []byte) bool {
+	return len(data) >= 4 && string(data[:4]) == "\x28\xb5\x2f\xfd"
+}
+
+/*
+returns the ELF files of an OCI image layout, a docker save tarball or a tar of a root
+filesystem, with the layers of each image applied in order. Paths are image:/path, the
+image named by its tag when the layout or tarball holds several.
+*/
+func ScanImage(path string, workers int) ([]*ScanResult, error) {
+	s := newImageScanner(workers)
+	defer s.close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var images []imageRef
+	layers := map[string]*imageLayer{}
+	if info.IsDir() {
+		blob := func(name string) ([]byte, error) {
+			return readJson(filepath.Join(path, filepath.FromSlash(name)))
+		}
+		index, err := blob("index.json")
+		if err != nil {
+			return nil, err
+		}
+		if images, err = ociImages(index, blob); err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			for _, name := range image.layers {
+				if layers[name] != nil {
+					continue
+				}
+				layer, err := s.readLayerFile(filepath.Join(path, filepath.FromSlash(name)))
+				if err != nil {
+					return nil, fmt.Errorf("error: layer %s: %v", name, err)
+				}
+				layers[name] = layer
+			}
+		}
+	} else {
+		root, jsons, err := s.readImageTar(path, layers)
+		if err != nil {
+			return nil, err
+		}
+		blob := func(name string) ([]byte, error) {
+			if data, ok := jsons[name]; ok {
+				return data, nil
+			}
+			return nil, fmt.Errorf("error: %s not found", name)
+		}
+		// a root filesystem may have a manifest.json or an index.json of its own
+		switch {
+		case isDockerManifest(jsons["manifest.json"]):
+			images, err = dockerImages(jsons["manifest.json"])
+		case jsons["oci-layout"] != nil && jsons["index.json"] != nil:
+			images, err = ociImages(jsons["index.json"], blob)
+		default:
+			// not an image, the tar is the filesystem
+			layers[""] = root
+			images = []imageRef{{layers: []string{""}}}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.wg.Wait()
+
+	results := []*ScanResult{}
+	for _, image := range images {
+		prefix := path
+		if len(images) > 1 {
+			prefix = fmt.Sprintf("%s[%s]", path, image.name)
+		}
+		files := map[string]*ScanResult{}
+		for _, name := range image.layers {
+			layer, ok := layers[name]
+			if !ok {
+				return nil, fmt.Errorf("error: layer %s not found", name)
+			}
+			layer.applyTo(files)
+		}
+		names := []string{}
+		for name, r := range files {
+			if r != nil {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r := *files[name]
+			r.Path = prefix + ":/" + name
+			results = append(results, &r)
+		}
+	}
+	return results, nil
+}
+
+/* puts the files of the layer over those of the layers below it */
+func (l *imageLayer) applyTo(files map[string]*ScanResult) {
+	removed := append(append([]string{}, l.whiteouts...), l.opaque...)
+	for _, dir := range removed {
+		for name := range files {
+			if dir == "" || strings.HasPrefix(name, dir+"/") {
+				delete(files, name)
+			}
+		}
+	}
+	for _, name := range l.whiteouts {
+		delete(files, name)
+	}
+	for name, r := range l.files {
+		files[name] = r
+	}
+	for name, target := range l.links {
+		files[name] = files[target]
+	}
+}
+
+/* reports whether data is the manifest.json of docker save: an array of images with a config and layers */
+func isDockerManifest(data []byte) bool {
+	var manifests []dockerManifest
+	if json.Unmarshal(data, &manifests) != nil || len(manifests) == 0 {
+		return false
+	}
+	for _, m := range manifests {
+		if m.Config == "" || len(m.Layers) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+/* the images of a docker save manifest.json */
+func dockerImages(data []byte) ([]imageRef, error) {
+	var manifests []dockerManifest
+	if err := json.Unmarshal(data, &manifests); err != nil {
+		return nil, fmt.Errorf("error: manifest.json: %v", err)
+	}
+	images := []imageRef{}
+	for _, m := range manifests {
+		name := strings.TrimSuffix(path.Base(m.Config), ".json")
+		if len(m.RepoTags) != 0 {
+			name = m.RepoTags[0]
+		}
+		images = append(images, imageRef{name, m.Layers})
+	}
+	return images, nil
+}
+
+/*
+the images an OCI index.json refers to, nested indexes of multi-platform images are
+followed. Manifests whose blob is not in the layout, as for the platforms docker save
+leaves out, and attestation manifests are skipped.
+*/
+func ociImages(data []byte, blob func(name string) ([]byte, error)) ([]imageRef, error) {
+	images := []imageRef{}
+	var walk func(data []byte, name string, depth int) error
+	walk = func(data []byte, name string, depth int) error {
+		var index ociIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("error: %s: %v", name, err)
+		}
+		if index.Manifests == nil {
+			layers := []string{}
+			for _, layer := range index.Layers {
+				layers = append(layers, ociBlob(layer.Digest))
+			}
+			images = append(images, imageRef{name, layers})
+			return nil
+		}
+		if depth > 4 {
+			return fmt.Errorf("error: %s: indexes nested too deep", name)
+		}
+		for _, m := range index.Manifests {
+			if m.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+				continue
+			}
+			data, err := blob(ociBlob(m.Digest))
+			if err != nil {
+				continue
+			}
+			if err := walk(data, ociImageName(m), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(data, "index.json", 0); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+/* the path of a blob in an image layout, blobs/sha256/<hex> for sha256:<hex> */
+func ociBlob(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+/* names an image by its reference, then its platform, then its digest */
+func ociImageName(m ociDescriptor) string {
+	for _, key := range []string{"io.containerd.image.name", "org.opencontainers.image.ref.name"} {
+		if name := m.Annotations[key]; name != "" {
+			return name
+		}
+	}
+	if p := m.Platform; p != nil && p.OS != "" {
+		name := p.OS + "/" + p.Architecture
+		if p.Variant != "" {
+			name += "/" + p.Variant
+		}
+		return name
+	}
+	if len(m.Digest) > 19 {
+		return m.Digest[:19]
+	}
+	return m.Digest
+}
+
+func readJson(name string) ([]byte, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, MAX_IMAGE_JSON+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MAX_IMAGE_JSON {
+		return nil, fmt.Errorf("error: %s is too large", name)
+	}
+	return data, nil
+}
+
+/*
+reads a tar, compressed or not, in one pass: layers of docker save and OCI archives go
+to layers by their name in the tar, manifests and configs are kept, and the other files
+make up the filesystem returned for a tar that is not an image
+*/
+func (s *imageScanner) readImageTar(name string, layers map[string]*imageLayer) (*imageLayer, map[string][]byte, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	r, err := decompress(bufio.NewReader(file))
+	if err != nil {
+		return nil, nil, err
+	}
+	root := &imageLayer{files: map[string]*ScanResult{}, links: map[string]string{}}
+	jsons := map[string][]byte{}
+	links := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		entry := cleanTarPath(hdr.Name)
+		isBlob := strings.HasPrefix(entry, "blobs/") || path.Base(entry) == "layer.tar"
+		if isBlob && hdr.Typeflag == tar.TypeSymlink {
+			// docker save links a layer shared by several images to its first copy
+			links[entry] = cleanTarPath(path.Join(path.Dir(entry), hdr.Linkname))
+		}
+		if (isBlob || !strings.Contains(entry, "/")) && hdr.Typeflag == tar.TypeReg {
+			data := bufio.NewReader(tr)
+			head, _ := data.Peek(512)
+			switch {
+			case isJson(head) && hdr.Size <= MAX_IMAGE_JSON:
+				blob, err := io.ReadAll(data)
+				if err != nil {
+					return nil, nil, err
+				}
+				jsons[entry] = blob
+				if !isBlob {
+					root.add(s, hdr, entry, bytes.NewReader(blob))
+				}
+				continue
+			case isBlob && (isGzip(head) || isTar(head) || isZstd(head)):
+				layer, err := s.readLayer(data)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error: layer %s: %v", entry, err)
+				}
+				layers[entry] = layer
+				continue
+			}
+			root.add(s, hdr, entry, data)
+			continue
+		}
+		root.add(s, hdr, entry, tr)
+	}
+	for entry, target := range links {
+		if layer, ok := layers[target]; ok {
+			layers[entry] = layer
+		}
+	}
+	return root, jsons, nil
+}
+
+/* a reader of the data of a gzip stream, or of the data itself */
+func decompress(r *bufio.Reader) (io.Reader, error) {
+	head, _ := r.Peek(4)
+	switch {
+	case isGzip(head):
+		return gzip.NewReader(r)
+	case isZstd(head):
+		return nil, fmt.Errorf("error: zstd compressed layers are not supported")
+	}
+	return r, nil
+}
+
+func (s *imageScanner) readLayerFile(name string) (*imageLayer, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return s.readLayer(file)
+}
+
+/* reads the tar of a layer, the ELF files in it are parsed while the rest is read */
+func (s *imageScanner) readLayer(r io.Reader) (*imageLayer, error) {
+	data, err := decompress(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	layer := &imageLayer{files: map[string]*ScanResult{}, links: map[string]string{}}
+	tr := tar.NewReader(data)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return layer, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		layer.add(s, hdr, cleanTarPath(hdr.Name), tr)
+	}
+}
+
+/* records a tar entry in the layer, an ELF file is read into memory and handed to the workers */
+func (l *imageLayer) add(s *imageScanner, hdr *tar.Header, name string, data io.Reader) {
+	dir, base := path.Split(name)
+	switch {
+	case name == "":
+		return
+	case base == ".wh..wh..opq":
+		l.opaque = append(l.opaque, strings.TrimSuffix(dir, "/"))
+		return
+	case strings.HasPrefix(base, ".wh."):
+		l.whiteouts = append(l.whiteouts, dir+strings.TrimPrefix(base, ".wh."))
+		return
+	case hdr.Typeflag == tar.TypeLink:
+		// a hard link shares the file it links to, resolved once the layers below are applied
+		delete(l.files, name)
+		l.links[name] = cleanTarPath(hdr.Linkname)
+		return
+	case hdr.Typeflag != tar.TypeReg:
+		delete(l.links, name)
+		l.files[name] = nil
+		return
+	}
+
+	delete(l.links, name)
+	l.files[name] = nil
+	magic := make([]byte, SELFMAG)
+	if _, err := io.ReadFull(data, magic); err != nil || string(magic) != ELFMAG {
+		return
+	}
+	r := new(ScanResult)
+	l.files[name] = r
+	if hdr.Size > MAX_IMAGE_FILE {
+		*r = *failedScan(name, fmt.Errorf("error: %d bytes, larger than %d", hdr.Size, MAX_IMAGE_FILE))
+		return
+	}
+	rest, err := io.ReadAll(data)
+	if err != nil {
+		*r = *failedScan(name, err)
+		return
+	}
+	s.wg.Add(1)
+	s.jobs <- imageFile{name, append(magic, rest...), r}
+}
+
+/* a path in a tar without the leading ./ or / */
+func cleanTarPath(name string) string {
+	name = path.Clean("/" + name)
+	return strings.TrimPrefix(name, "/")
+}
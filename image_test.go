@@ -0,0 +1,206 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+/* a tar of the entries, a name ending in / is a directory and a value starting with > a hard link */
+func testTar(t *testing.T, entries [][2]string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e[0], Mode: 0755, Typeflag: tar.TypeReg, Size: int64(len(e[1]))}
+		switch {
+		case e[0][len(e[0])-1] == '/':
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		case len(e[1]) > 0 && e[1][0] == '>':
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, e[1][1:], 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte(e[1]))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testGzip(data []byte) []byte {
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+/*
+two layers: the second replaces an executable by a script, whites out a library, makes
+a directory opaque and hard links a file into it, and a file of the first layer elsewhere
+*/
+func testLayers(t *testing.T) (lower, upper []byte) {
+	exec := string(fixtures["exec"]())
+	shared := string(fixtures["shared"]())
+	lower = testTar(t, [][2]string{
+		{"bin/", ""},
+		{"bin/tool", exec},
+		{"bin/sh", exec},
+		{"lib/", ""},
+		{"lib/libfixture.so.1", shared},
+		{"lib/libgone.so", shared},
+		{"opt/app/", ""},
+		{"opt/app/old", exec},
+		{"etc/hostname", "lower\n"},
+	})
+	upper = testGzip(testTar(t, [][2]string{
+		{"./bin/tool", "#!/bin/sh\n"},
+		{"./lib/.wh.libgone.so", ""},
+		{"./opt/app/.wh..wh..opq", ""},
+		{"./opt/app/new", string(fixtures["stripped"]())},
+		{"./opt/app/link", ">opt/app/new"},
+		{"./bin/busybox", ">bin/sh"},
+	}))
+	return lower, upper
+}
+
+var image_want = []string{
+	":/bin/busybox EXEC",
+	":/bin/sh EXEC",
+	":/lib/libfixture.so.1 DYN",
+	":/opt/app/link EXEC stripped",
+	":/opt/app/new EXEC stripped",
+}
+
+func imagePaths(t *testing.T, results []*ScanResult, prefix string) []string {
+	t.Helper()
+	got := []string{}
+	for _, r := range results {
+		if len(r.Errors) != 0 {
+			t.Errorf("%s: %v", r.Path, r.Errors)
+		}
+		line := r.Path[len(prefix):] + " " + r.Type
+		if r.Stripped {
+			line += " stripped"
+		}
+		got = append(got, line)
+	}
+	return got
+}
+
+func TestScanDockerSave(t *testing.T) {
+	lower, upper := testLayers(t)
+	manifest, _ := json.Marshal([]dockerManifest{{
+		Config:   "cfg.json",
+		RepoTags: []string{"test:latest"},
+		Layers:   []string{"aaa/layer.tar", "bbb/layer.tar"},
+	}})
+	// the manifest comes last as in docker save
+	path := filepath.Join(t.TempDir(), "image.tar")
+	os.WriteFile(path, testTar(t, [][2]string{
+		{"bbb/", ""},
+		{"bbb/layer.tar", string(upper)},
+		{"aaa/", ""},
+		{"aaa/layer.tar", string(lower)},
+		{"cfg.json", `{"architecture":"amd64"}`},
+		{"manifest.json", string(manifest)},
+	}), 0644)
+
+	if !IsImage(path) {
+		t.Fatalf("%s is not an image", path)
+	}
+	results, err := ScanImage(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := imagePaths(t, results, path); !reflect.DeepEqual(got, image_want) {
+		t.Errorf("got %q\nwant %q", got, image_want)
+	}
+}
+
+func TestScanOciLayout(t *testing.T) {
+	dir := t.TempDir()
+	blob := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		path := filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(sum[:]))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, data, 0644)
+		return digest
+	}
+	lower, upper := testLayers(t)
+	manifest, _ := json.Marshal(map[string]any{
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"layers":    []map[string]string{{"digest": blob(lower)}, {"digest": blob(upper)}},
+	})
+	index, _ := json.Marshal(map[string]any{
+		"manifests": []map[string]any{{
+			"digest":      blob(manifest),
+			"annotations": map[string]string{"org.opencontainers.image.ref.name": "latest"},
+		}},
+	})
+	os.WriteFile(filepath.Join(dir, "index.json"), index, 0644)
+	os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+
+	if !IsImage(dir) {
+		t.Fatalf("%s is not an image", dir)
+	}
+	results, err := ScanImage(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := imagePaths(t, results, dir); !reflect.DeepEqual(got, image_want) {
+		t.Errorf("got %q\nwant %q", got, image_want)
+	}
+
+	// the same layout in an OCI archive, as docker save writes it since 25.0
+	entries := [][2]string{}
+	filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, name)
+			data, _ := os.ReadFile(name)
+			entries = append(entries, [2]string{filepath.ToSlash(rel), string(data)})
+		}
+		return err
+	})
+	path := filepath.Join(t.TempDir(), "image.tar")
+	os.WriteFile(path, testTar(t, entries), 0644)
+	if results, err = ScanImage(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := imagePaths(t, results, path); !reflect.DeepEqual(got, image_want) {
+		t.Errorf("the archive: got %q\nwant %q", got, image_want)
+	}
+}
+
+/* a root filesystem with a manifest.json and an index.json of its own is not an image */
+func TestScanRootfs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rootfs.tar")
+	os.WriteFile(path, testGzip(testTar(t, [][2]string{
+		{"manifest.json", `[{"name":"app","version":"1.0"}]`},
+		{"index.json", `{"manifests":[]}`},
+		{"bin/", ""},
+		{"bin/sh", string(fixtures["exec"]())},
+		{"bin/ash", ">bin/sh"},
+	})), 0644)
+
+	results, err := ScanImage(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := imagePaths(t, results, path), []string{":/bin/ash EXEC", ":/bin/sh EXEC"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/* the trailer of a signed module, after the signature and its struct module_signature */
+const MODULE_SIG_MAGIC = "~Module signature appended~\n"
+
+/* the size of struct module_signature: algo, hash, id_type, signer_len, key_id_len, 3 bytes of padding and the big endian sig_len */
+const MODULE_SIG_INFO_SIZE = 12
+
+/* struct modversion_info in __versions: an unsigned long CRC and the name padded to MODULE_NAME_LEN */
+const (
+	MODULE_NAME_LEN     = 56
+	MODVERSION_INFO_LEN = 8 + MODULE_NAME_LEN
+)
+
+/* struct module starts with enum module_state and a struct list_head, then char name[MODULE_NAME_LEN] */
+const THIS_MODULE_NAME_OFFSET = 24
+
+/* id_type of struct module_signature */
+var module_sig_id = map[byte]string{
+	0: "PGP",
+	1: "X509",
+	2: "PKCS#7",
+}
+
+/* enum hash_algo of the kernel, hash of struct module_signature in the signatures before PKCS#7 */
+var module_hash_algo = map[byte]string{
+	0: "md4",
+	1: "md5",
+	2: "sha1",
+	3: "rmd160",
+	4: "sha256",
+	5: "sha384",
+	6: "sha512",
+	7: "sha224",
+}
+
+/* the digest algorithms of a PKCS#7 signer */
+var pkcs7_digest_algo = map[string]string{
+	"1.3.14.3.2.26":           "sha1",
+	"2.16.840.1.101.3.4.2.1":  "sha256",
+	"2.16.840.1.101.3.4.2.2":  "sha384",
+	"2.16.840.1.101.3.4.2.3":  "sha512",
+	"2.16.840.1.101.3.4.2.4":  "sha224",
+	"2.16.840.1.101.3.4.2.8":  "sha3-256",
+	"2.16.840.1.101.3.4.2.9":  "sha3-384",
+	"2.16.840.1.101.3.4.2.10": "sha3-512",
+	"1.2.156.10197.1.401":     "sm3",
+}
+
+var oid_common_name = asn1.ObjectIdentifier{2, 5, 4, 3}
+
+/* what ContentInfo, SignedData and SignerInfo of RFC 2315 hold that a module signature uses */
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	Crls             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	Sid                       asn1.RawValue /* IssuerAndSerialNumber, or [0] SubjectKeyIdentifier */
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type ModinfoField struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+/* an entry of __versions, the CRC of an exported symbol the module was built against */
+type ModVersion struct {
+	CRC  uint64 `json:"crc"`
+	Name string `json:"name"`
+}
+
+/* the appended signature as modinfo prints it, it is not verified */
+type ModuleSignature struct {
+	IdType    string `json:"id_type"`
+	Signer    string `json:"signer"`
+	KeyID     string `json:"key_id"`
+	HashAlgo  string `json:"hash_algo"`
+	Signature string `json:"signature"`
+	Size      int    `json:"size"` /* the bytes appended to the ELF file, with the trailer */
+}
+
+/* what a kernel module tells about itself: .modinfo, __versions, .gnu.linkonce.this_module and its signature */
+type KernelModule struct {
+	File      string           `json:"file"`
+	Modinfo   []ModinfoField   `json:"modinfo"`
+	Name      string           `json:"name,omitempty"` /* from .gnu.linkonce.this_module */
+	Size      uint64           `json:"this_module_size,omitempty"`
+	Init      string           `json:"init,omitempty"`
+	Exit      string           `json:"exit,omitempty"`
+	Versions  []ModVersion     `json:"versions"`
+	Signature *ModuleSignature `json:"signature,omitempty"`
+}
+
+/* reports whether the file is a kernel module: a relocatable object with .modinfo or .gnu.linkonce.this_module */
+func (p *ElfParser) IsKernelModule() bool {
+	if p.GetEhdr().E_type != ET_REL {
+		return false
+	}
+	for _, desp := range p.GetShdrs() {
+		switch strings.TrimRight(desp.name, "\x00") {
+		case ".modinfo", ".gnu.linkonce.this_module":
+			return true
+		}
+	}
+	return false
+}
+
+/* the key=value strings of .modinfo in order, keys like alias and parm repeat */
+func (p *ElfParser) GetModinfo() []ModinfoField {
+	fields := []ModinfoField{}
+	data, _ := p.sectionData(".modinfo")
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if len(entry) == 0 {
+			continue // the strings are padded to their alignment
+		}
+		key, value, ok := strings.Cut(string(entry), "=")
+		if !ok {
+			p.fail("error: .modinfo entry without a value: %q", entry)
+			continue
+		}
+		fields = append(fields, ModinfoField{key, value})
+	}
+	return fields
+}
+
+/*
+the symbol CRCs of __versions, and of __version_ext_crcs with the names in
+__version_ext_names that kernels with CONFIG_EXTENDED_MODVERSIONS add for names too
+long for MODULE_NAME_LEN
+*/
+func (p *ElfParser) GetModVersions() []ModVersion {
+	versions := []ModVersion{}
+	data, _ := p.sectionData("__versions")
+	if len(data)%MODVERSION_INFO_LEN != 0 {
+		p.fail("error: __versions size %d is not a multiple of %d", len(data), MODVERSION_INFO_LEN)
+	}
+	for i := 0; i+MODVERSION_INFO_LEN <= len(data); i += MODVERSION_INFO_LEN {
+		versions = append(versions, ModVersion{p.order.Uint64(data[i:]), cString(data[i+8 : i+MODVERSION_INFO_LEN])})
+	}
+
+	crcs, _ := p.sectionData("__version_ext_crcs")
+	names, _ := p.sectionData("__version_ext_names")
+	for i := 0; i+4 <= len(crcs); i += 4 {
+		end := bytes.IndexByte(names, 0)
+		if end < 0 {
+			p.fail("error: __version_ext_names has fewer names than __version_ext_crcs")
+			break
+		}
+		versions = append(versions, ModVersion{uint64(p.order.Uint32(crcs[i:])), string(names[:end])})
+		names = names[end+1:]
+	}
+	return versions
+}
+
+/*
+the functions that relocations in .rela.gnu.linkonce.this_module store in struct module,
+by the init_module and cleanup_module aliases module_init() and module_exit() define
+*/
+func (p *ElfParser) thisModuleFunctions() (init, exit string) {
+	var rela *Elf64SectionHeaderDesp
+	for _, desp := range p.GetShdrs() {
+		if strings.TrimRight(desp.name, "\x00") == ".rela.gnu.linkonce.this_module" && desp.shdr.SH_type == SHT_RELA {
+			rela = desp
+		}
+	}
+	if rela == nil {
+		return "", ""
+	}
+	symtab := []*Elf64SymbolHeaderDesp{}
+	for _, desp := range p.GetSyms() {
+		if desp.tab.idx == int(rela.shdr.SH_link) {
+			symtab = append(symtab, desp)
+		}
+	}
+	name := func(desp *Elf64SymbolHeaderDesp) string {
+		return strings.TrimRight(desp.name, "\x00")
+	}
+	// the alias is reported by the name of the function it stands for
+	function := func(alias *Elf64SymbolHeaderDesp) string {
+		for _, desp := range symtab {
+			sym := desp.sym
+			if desp != alias && sym.ST_shndx == alias.sym.ST_shndx && sym.ST_value == alias.sym.ST_value &&
+				sym.ST_info&0xf == STT_FUNC && name(desp) != "init_module" && name(desp) != "cleanup_module" {
+				return name(desp)
+			}
+		}
+		return name(alias)
+	}
+
+	data := p.readBytes(int64(rela.shdr.SH_offset), int64(rela.shdr.SH_size))
+	for i := 0; i+24 <= len(data); i += 24 {
+		idx := int(p.order.Uint64(data[i+8:]) >> 32)
+		if idx >= len(symtab) {
+			p.fail("error: relocation %d of .rela.gnu.linkonce.this_module has a bad symbol index %d", i/24, idx)
+			continue
+		}
+		switch sym := symtab[idx]; name(sym) {
+		case "init_module":
+			init = function(sym)
+		case "cleanup_module":
+			exit = function(sym)
+		}
+	}
+	return init, exit
+}
+
+/* the bytes of a big number as modinfo prints them, 01:AB:... */
+func modinfoHex(data []byte) string {
+	octets := make([]string, len(data))
+	for i, b := range data {
+		octets[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(octets, ":")
+}
+
+/* splits the signature after the ELF file: the struct module_signature before the trailer tells the size */
+func (p *ElfParser) GetModuleSignature() (*ModuleSignature, error) {
+	trailer := p.size - int64(len(MODULE_SIG_MAGIC))
+	if trailer < MODULE_SIG_INFO_SIZE || string(p.readBytes(trailer, int64(len(MODULE_SIG_MAGIC)))) != MODULE_SIG_MAGIC {
+		return nil, nil
+	}
+	info := p.readBytes(trailer-MODULE_SIG_INFO_SIZE, MODULE_SIG_INFO_SIZE)
+	hash, idType, signerLen, keyIdLen := info[1], info[2], int64(info[3]), int64(info[4])
+	sigLen := int64(binary.BigEndian.Uint32(info[8:]))
+	start := trailer - MODULE_SIG_INFO_SIZE - sigLen - signerLen - keyIdLen
+	if start < 0 {
+		return nil, fmt.Errorf("error: the module signature of %d bytes is larger than the file", sigLen)
+	}
+	data := p.readBytes(start, trailer-MODULE_SIG_INFO_SIZE-start)
+	sig := &ModuleSignature{IdType: module_sig_id[idType], Size: int(p.size - start)}
+	if sig.IdType == "" {
+		sig.IdType = fmt.Sprintf("id type %d", idType)
+	}
+
+	if idType != 2 {
+		// the signer and the key ID precede the signature
+		sig.Signer = string(data[:signerLen])
+		sig.KeyID = modinfoHex(data[signerLen : signerLen+keyIdLen])
+		sig.HashAlgo = module_hash_algo[hash]
+		sig.Signature = modinfoHex(data[signerLen+keyIdLen:])
+		return sig, nil
+	}
+	if err := parsePkcs7Signer(data, sig); err != nil {
+		return sig, fmt.Errorf("error: bad PKCS#7 module signature: %v", err)
+	}
+	return sig, nil
+}
+
+/* fills in the signer, key ID, digest and signature of the first SignerInfo */
+func parsePkcs7Signer(data []byte, sig *ModuleSignature) error {
+	var content pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(data, &content); err != nil {
+		return err
+	}
+	var signed pkcs7SignedData
+	if _, err := asn1.Unmarshal(content.Content.Bytes, &signed); err != nil {
+		return err
+	}
+	if len(signed.SignerInfos) == 0 {
+		return fmt.Errorf("no signer")
+	}
+	signer := signed.SignerInfos[0]
+
+	oid := signer.DigestAlgorithm.Algorithm.String()
+	if sig.HashAlgo = pkcs7_digest_algo[oid]; sig.HashAlgo == "" {
+		sig.HashAlgo = oid
+	}
+	sig.Signature = modinfoHex(signer.EncryptedDigest)
+
+	if signer.Sid.Class == asn1.ClassContextSpecific {
+		sig.KeyID = modinfoHex(signer.Sid.Bytes)
+		return nil
+	}
+	var sid pkcs7IssuerAndSerial
+	if _, err := asn1.Unmarshal(signer.Sid.FullBytes, &sid); err != nil {
+		return err
+	}
+	sig.KeyID = modinfoHex(sid.Serial.Bytes())
+	var issuer pkix.RDNSequence
+	if _, err := asn1.Unmarshal(sid.Issuer.FullBytes, &issuer); err != nil {
+		return err
+	}
+	for _, rdn := range issuer {
+		for _, attr := range rdn {
+			if attr.Type.Equal(oid_common_name) {
+				sig.Signer = fmt.Sprint(attr.Value)
+			}
+		}
+	}
+	if sig.Signer == "" {
+		sig.Signer = issuer.String()
+	}
+	return nil
+}
+
+/* collects the metadata of a kernel module */
+func (p *ElfParser) GetKernelModule() (*KernelModule, error) {
+	if !p.IsKernelModule() {
+		return nil, fmt.Errorf("error: not a kernel module")
+	}
+	m := new(KernelModule)
+	m.Modinfo = p.GetModinfo()
+	m.Versions = p.GetModVersions()
+
+	if data, shdr := p.sectionData(".gnu.linkonce.this_module"); shdr != nil {
+		m.Size = uint64(shdr.SH_size)
+		if len(data) >= THIS_MODULE_NAME_OFFSET+MODULE_NAME_LEN {
+			m.Name = cString(data[THIS_MODULE_NAME_OFFSET : THIS_MODULE_NAME_OFFSET+MODULE_NAME_LEN])
+		}
+		m.Init, m.Exit = p.thisModuleFunctions()
+	}
+	for _, field := range m.Modinfo {
+		if field.Key == "name" && m.Name != "" && field.Value != m.Name {
+			p.fail("error: .modinfo names the module %s but .gnu.linkonce.this_module %s", field.Value, m.Name)
+		}
+	}
+
+	sig, err := p.GetModuleSignature()
+	if err != nil {
+		p.fail("%v", err)
+	}
+	m.Signature = sig
+	return m, nil
+}
+
+/* the signature bytes in lines of 20, continued with two tabs as modinfo does */
+func modinfoSignature(signature string) string {
+	lines := []string{}
+	for len(signature) > 60 {
+		lines = append(lines, signature[:60])
+		signature = signature[60:]
+	}
+	return strings.Join(append(lines, signature), "\n\t\t")
+}
+
+/* the text of modinfo: a key: value line per field, the parm descriptions with their types */
+func (m *KernelModule) String() string {
+	builder := new(strings.Builder)
+	line := func(key, value string) {
+		fmt.Fprintf(builder, "%-16s%s\n", key+":", value)
+	}
+	line("filename", m.File)
+
+	types := map[string]string{}
+	for _, field := range m.Modinfo {
+		if field.Key == "parmtype" {
+			name, typ, _ := strings.Cut(field.Value, ":")
+			types[name] = typ
+		}
+	}
+	for _, field := range m.Modinfo {
+		switch field.Key {
+		case "parmtype":
+		case "parm":
+			name, _, _ := strings.Cut(field.Value, ":")
+			if typ, ok := types[name]; ok {
+				line("parm", fmt.Sprintf("%s (%s)", field.Value, typ))
+			} else {
+				line("parm", field.Value)
+			}
+		default:
+			line(field.Key, field.Value)
+		}
+	}
+
+	if m.Size != 0 {
+		this := fmt.Sprintf("%s, %d bytes", m.Name, m.Size)
+		if m.Init != "" {
+			this += ", init " + m.Init
+		}
+		if m.Exit != "" {
+			this += ", exit " + m.Exit
+		}
+		line("this_module", this)
+	}
+	if len(m.Versions) != 0 {
+		line("modversions", fmt.Sprintf("%d symbols", len(m.Versions)))
+	}
+	if sig := m.Signature; sig != nil {
+		line("sig_id", sig.IdType)
+		if sig.Signer != "" {
+			line("signer", sig.Signer)
+		}
+		line("sig_key", sig.KeyID)
+		line("sig_hashalgo", sig.HashAlgo)
+		line("signature", modinfoSignature(sig.Signature))
+	}
+	return builder.String()
+}
+
+/* the exported symbols of a kernel build by name, from the 0xcrc, symbol, module, export type lines of Module.symvers */
+func readSymvers(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	crcs := map[string]uint64{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		crc, err := strconv.ParseUint(fields[0], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("elfparser: %s:%d: bad CRC %q", path, n, fields[0])
+		}
+		crcs[fields[1]] = crc
+	}
+	return crcs, scanner.Err()
+}
+
+/* the symbols whose CRC differs from the kernel build, or that it does not export */
+func (m *KernelModule) CheckVersions(symvers map[string]uint64) []string {
+	problems := []string{}
+	for _, v := range m.Versions {
+		crc, ok := symvers[v.Name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: not exported by the kernel", v.Name))
+		case crc != v.CRC:
+			problems = append(problems, fmt.Sprintf("%s: CRC 0x%08x, the kernel has 0x%08x", v.Name, v.CRC, crc))
+		}
+	}
+	return problems
+}
+
+func runKmod(args []string) error {
+	asJson, versions := false, false
+	symversPath := ""
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--json":
+			asJson = true
+		case "--versions":
+			versions = true
+		case "--symvers":
+			if i+1 >= len(args) {
+				return usageError("elfparser: option requires an argument: %s", arg)
+			}
+			i++
+			symversPath = args[i]
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+	var symvers map[string]uint64
+	if symversPath != "" {
+		var err error
+		if symvers, err = readSymvers(symversPath); err != nil {
+			return err
+		}
+	}
+
+	failed := false
+	results := []*KernelModule{}
+	for _, path := range paths {
+		m, err := kmodFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		problems := []string{}
+		if symvers != nil {
+			problems = m.CheckVersions(symvers)
+			failed = failed || len(problems) != 0
+		}
+		if asJson {
+			results = append(results, m)
+			continue
+		}
+
+		fmt.Print(m)
+		if versions {
+			// as modprobe --dump-modversions
+			for _, v := range m.Versions {
+				fmt.Printf("0x%08x\t%s\n", v.CRC, v.Name)
+			}
+		}
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", path, problem)
+		}
+	}
+
+	if asJson {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	}
+	// like modprobe, exit with a failure status when a module would not load against the kernel
+	if failed {
+		return errExitStatus
+	}
+	return nil
+}
+
+/* reads a module, compressed with gzip as .ko.gz or not */
+func kmodFile(path string) (*KernelModule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader ElfReader = file
+	head := make([]byte, 6)
+	io.ReadFull(file, head)
+	switch {
+	case isGzip(head):
+		file.Seek(0, io.SeekStart)
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(zr, MAX_IMAGE_FILE+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > MAX_IMAGE_FILE {
+			return nil, fmt.Errorf("error: the module is larger than %d bytes", MAX_IMAGE_FILE)
+		}
+		reader = bytes.NewReader(data)
+	case isZstd(head):
+		return nil, fmt.Errorf("error: zstd compressed modules are not supported")
+	case string(head) == "\xfd7zXZ\x00":
+		return nil, fmt.Errorf("error: xz compressed modules are not supported")
+	}
+
+	parser, err := LoadData(reader)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parser.GetKernelModule()
+	if err != nil {
+		return nil, err
+	}
+	m.File = path
+	for _, err := range parser.Errors() {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+	return m, nil
+}
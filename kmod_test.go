@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+/* a kernel module as modpost leaves it: .modinfo, __versions and struct module with its init and exit relocations */
+func fixtureModule() *fixture {
+	f := newFixture(ET_REL, EM_X86_64, binary.LittleEndian)
+	f.add(&fixtureSection{name: ".text", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_EXECINSTR, align: 16, load: -1, data: fixtureText})
+	f.add(&fixtureSection{name: ".modinfo", typ: SHT_PROGBITS, flags: SHF_ALLOC, align: 8, load: -1, data: []byte(
+		"license=GPL\x00description=fixture module\x00parm=debug:enable debug output\x00parmtype=debug:int\x00" +
+			"srcversion=3F2A5C1D6E7B8A9C0D1E2F3\x00alias=platform:fixture\x00depends=\x00retpoline=Y\x00" +
+			"name=fixture\x00vermagic=6.1.0 SMP preempt mod_unload modversions \x00\x00\x00")})
+
+	versions := make([]byte, 2*MODVERSION_INFO_LEN)
+	binary.LittleEndian.PutUint64(versions, 0x2f1f6a0c)
+	copy(versions[8:], "module_layout")
+	binary.LittleEndian.PutUint64(versions[MODVERSION_INFO_LEN:], 0x92997ed8)
+	copy(versions[MODVERSION_INFO_LEN+8:], "_printk")
+	f.add(&fixtureSection{name: "__versions", typ: SHT_PROGBITS, flags: SHF_ALLOC, align: 32, load: -1, data: versions})
+
+	this := make([]byte, 0x500)
+	copy(this[THIS_MODULE_NAME_OFFSET:], "fixture")
+	f.add(&fixtureSection{name: ".gnu.linkonce.this_module", typ: SHT_PROGBITS, flags: SHF_ALLOC | SHF_WRITE, align: 64,
+		load: -1, data: this})
+	// R_X86_64_64 against init_module and cleanup_module at the init and exit fields
+	rela := new(bytes.Buffer)
+	binary.Write(rela, binary.LittleEndian, []uint64{0x138, 3<<32 | 1, 0, 0x4c8, 4<<32 | 1, 0})
+	f.add(&fixtureSection{name: ".rela.gnu.linkonce.this_module", typ: SHT_RELA, flags: SHF_INFO_LINK, align: 8, entsize: 24,
+		link: ".symtab", load: -1, data: rela.Bytes(), fill: func(f *fixture) []byte {
+			f.section(".rela.gnu.linkonce.this_module").info = f.index(".gnu.linkonce.this_module")
+			return rela.Bytes()
+		}})
+
+	f.addSymbols(".symtab", ".strtab", []fixtureSymbol{
+		{name: "fixture_init", bind: STB_LOCAL, typ: STT_FUNC, section: ".text", size: 9},
+		{name: "fixture_exit", bind: STB_LOCAL, typ: STT_FUNC, section: ".text", value: 9, size: 1},
+		{name: "init_module", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", size: 9},
+		{name: "cleanup_module", bind: STB_GLOBAL, typ: STT_FUNC, section: ".text", value: 9, size: 1},
+	}, -1)
+	return f
+}
+
+/* appends a PKCS#7 signature as sign-file does, without certificates or authenticated attributes */
+func signModule(t *testing.T, module []byte) []byte {
+	t.Helper()
+	type issuerAndSerial struct {
+		Issuer pkix.RDNSequence
+		Serial *big.Int
+	}
+	type signerInfo struct {
+		Version         int
+		Sid             issuerAndSerial
+		DigestAlgorithm pkix.AlgorithmIdentifier
+		SignatureAlgo   pkix.AlgorithmIdentifier
+		Signature       []byte
+	}
+	issuer := pkix.Name{Organization: []string{"fixture"}, CommonName: "Build time autogenerated kernel key"}
+	signed, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+		ContentInfo      struct{ Type asn1.ObjectIdentifier }
+		SignerInfos      []signerInfo `asn1:"set"`
+	}{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}}},
+		ContentInfo:      struct{ Type asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		SignerInfos: []signerInfo{{
+			Version:         1,
+			Sid:             issuerAndSerial{issuer.ToRDNSequence(), big.NewInt(0x1a2b3c4d5e)},
+			DigestAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}},
+			SignatureAlgo:   pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}},
+			Signature:       bytes.Repeat([]byte{0xa5, 0x5a}, 24),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct {
+		Type    asn1.ObjectIdentifier
+		Content asn1.RawValue
+	}{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}, asn1.RawValue{Class: asn1.ClassContextSpecific, IsCompound: true, Bytes: signed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := make([]byte, MODULE_SIG_INFO_SIZE)
+	info[2] = 2 // PKEY_ID_PKCS7
+	binary.BigEndian.PutUint32(info[8:], uint32(len(sig)))
+	return append(append(append(module, sig...), info...), MODULE_SIG_MAGIC...)
+}
+
+func TestKernelModule(t *testing.T) {
+	dir := t.TempDir()
+	module := signModule(t, fixtureModule().Bytes())
+	path := filepath.Join(dir, "fixture.ko")
+	os.WriteFile(path, module, 0644)
+	os.WriteFile(path+".gz", testGzip(module), 0644)
+
+	out := captureStdout(t, func() {
+		if err := runKmod([]string{"--versions", path}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	checkGolden(t, "kmod", bytes.ReplaceAll(out, []byte(dir), []byte("DIR")))
+
+	m, err := kmodFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := kmodFile(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed.File = m.File
+	if !reflect.DeepEqual(m, compressed) {
+		t.Errorf("the compressed module reads as %+v, want %+v", compressed, m)
+	}
+
+	// a kernel built with another _printk and without module_layout
+	problems := m.CheckVersions(map[string]uint64{"_printk": 0x12345678})
+	want := []string{"module_layout: not exported by the kernel", "_printk: CRC 0x92997ed8, the kernel has 0x12345678"}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("got %q\nwant %q", problems, want)
+	}
+
+	// the problems are printed and only the exit status is left to main
+	symvers := filepath.Join(dir, "Module.symvers")
+	os.WriteFile(symvers, []byte("0x12345678\t_printk\tvmlinux\tEXPORT_SYMBOL\n"), 0644)
+	captureStdout(t, func() {
+		if err := runKmod([]string{"--symvers", symvers, path}); err != errExitStatus {
+			t.Errorf("a module that would not load returned %v", err)
+		}
+	})
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"sort"
+	"strings"
+)
+
+/* what a block of the layout stands for */
+const (
+	LAYOUT_SEGMENT = iota /* a PT_LOAD, the blocks inside it are its children */
+	LAYOUT_SECTION
+	LAYOUT_HEADER  /* the ELF header or one of the header tables */
+	LAYOUT_PADDING /* bytes that belong to nothing between two blocks */
+	LAYOUT_GAP     /* address space between two segments that is not mapped */
+)
+
+/* a range of the address space or of the file, a segment holds the blocks inside it */
+type LayoutBlock struct {
+	kind     int
+	name     string
+	start    uint64
+	size     uint64
+	flags    Elf64_Word /* the permissions of a segment */
+	nobits   bool       /* a section without file contents, zero filled in memory */
+	children []*LayoutBlock
+}
+
+func (b *LayoutBlock) end() uint64 {
+	return b.start + b.size
+}
+
+/* the text drawn for a block */
+func (b *LayoutBlock) label() string {
+	switch b.kind {
+	case LAYOUT_SEGMENT:
+		perms := []byte("---")
+		if b.flags&PF_R != 0 {
+			perms[0] = 'R'
+		}
+		if b.flags&PF_W != 0 {
+			perms[1] = 'W'
+		}
+		if b.flags&PF_X != 0 {
+			perms[2] = 'X'
+		}
+		return fmt.Sprintf("%s %s", b.name, perms)
+	case LAYOUT_SECTION:
+		if b.nobits {
+			return b.name + " [zero]"
+		}
+		return b.name
+	case LAYOUT_PADDING:
+		return "(padding)"
+	case LAYOUT_GAP:
+		return "unmapped"
+	}
+	return b.name
+}
+
+/* sorts blocks by start and fills the holes between them, and up to end, with kind */
+func layoutFill(blocks []*LayoutBlock, start uint64, end uint64, kind int) []*LayoutBlock {
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].start < blocks[j].start })
+
+	filled := []*LayoutBlock{}
+	cursor := start
+	for _, b := range blocks {
+		if b.start > cursor {
+			filled = append(filled, &LayoutBlock{kind: kind, start: cursor, size: b.start - cursor})
+		}
+		filled = append(filled, b)
+		cursor = max(cursor, b.end())
+	}
+	if end > cursor {
+		filled = append(filled, &LayoutBlock{kind: kind, start: cursor, size: end - cursor})
+	}
+	return filled
+}
+
+/* the ELF header and the header tables, by file offset */
+func (p *ElfParser) layoutHeaders() []*LayoutBlock {
+	ehdr := p.GetEhdr()
+	headers := []*LayoutBlock{{kind: LAYOUT_HEADER, name: "ELF header", size: uint64(ehdr.E_ehsize)}}
+	if size := uint64(ehdr.E_phnum) * uint64(ehdr.E_phentsize); size != 0 {
+		headers = append(headers, &LayoutBlock{kind: LAYOUT_HEADER, name: "program headers", start: uint64(ehdr.E_phoff), size: size})
+	}
+	if size := uint64(ehdr.E_shnum) * uint64(ehdr.E_shentsize); size != 0 {
+		headers = append(headers, &LayoutBlock{kind: LAYOUT_HEADER, name: "section headers", start: uint64(ehdr.E_shoff), size: size})
+	}
+	return headers
+}
+
+/*
+returns the virtual address space: the PT_LOAD segments by address with the sections
+in them, the headers the first segment maps, and the unmapped gaps between them
+*/
+func (p *ElfParser) MemoryLayout() []*LayoutBlock {
+	mapping := p.GetSegmentMapping()
+	headers := p.layoutHeaders()
+
+	blocks := []*LayoutBlock{}
+	for _, m := range mapping {
+		phdr := m.phdr
+		if phdr.P_type != PT_LOAD {
+			continue
+		}
+		segment := &LayoutBlock{kind: LAYOUT_SEGMENT, name: fmt.Sprintf("LOAD[%d]", m.idx), start: uint64(phdr.P_vaddr),
+			size: uint64(phdr.P_memsz), flags: phdr.P_flags}
+
+		children := []*LayoutBlock{}
+		for _, h := range headers {
+			if h.start >= uint64(phdr.P_offset) && h.end() <= uint64(phdr.P_offset)+uint64(phdr.P_filesz) {
+				children = append(children, &LayoutBlock{kind: LAYOUT_HEADER, name: h.name,
+					start: uint64(phdr.P_vaddr) + h.start - uint64(phdr.P_offset), size: h.size})
+			}
+		}
+		for _, desp := range m.sections {
+			shdr := desp.shdr
+			children = append(children, &LayoutBlock{kind: LAYOUT_SECTION, name: strings.TrimRight(desp.name, "\x00"),
+				start: uint64(shdr.SH_addr), size: uint64(shdr.SH_size), nobits: shdr.SH_type == SHT_NOBITS})
+		}
+		segment.children = layoutFill(children, segment.start, segment.end(), LAYOUT_PADDING)
+		blocks = append(blocks, segment)
+	}
+	if len(blocks) == 0 {
+		return blocks
+	}
+
+	// fill only between the segments, not from address 0
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].start < blocks[j].start })
+	return layoutFill(blocks, blocks[0].start, blocks[len(blocks)-1].end(), LAYOUT_GAP)
+}
+
+/*
+returns the file from offset 0 to its end: the file ranges of the PT_LOAD segments
+with the headers and sections they load, then what is not loaded, padding in between
+*/
+func (p *ElfParser) FileLayout() []*LayoutBlock {
+	pieces := p.layoutHeaders()
+	for _, desp := range p.GetShdrs() {
+		shdr := desp.shdr
+		if desp.idx == 0 || shdr.SH_type == SHT_NOBITS || shdr.SH_size == 0 {
+			continue
+		}
+		pieces = append(pieces, &LayoutBlock{kind: LAYOUT_SECTION, name: strings.TrimRight(desp.name, "\x00"),
+			start: uint64(shdr.SH_offset), size: uint64(shdr.SH_size)})
+	}
+
+	blocks := []*LayoutBlock{}
+	for i, phdr := range p.GetPhdrs() {
+		if phdr.P_type == PT_LOAD && phdr.P_filesz != 0 {
+			blocks = append(blocks, &LayoutBlock{kind: LAYOUT_SEGMENT, name: fmt.Sprintf("LOAD[%d]", i),
+				start: uint64(phdr.P_offset), size: uint64(phdr.P_filesz), flags: phdr.P_flags})
+		}
+	}
+	for _, piece := range pieces {
+		var parent *LayoutBlock
+		for _, b := range blocks {
+			if b.kind == LAYOUT_SEGMENT && piece.start >= b.start && piece.start < b.end() {
+				parent = b
+				break
+			}
+		}
+		if parent != nil {
+			parent.children = append(parent.children, piece)
+		} else {
+			blocks = append(blocks, piece)
+		}
+	}
+	for _, b := range blocks {
+		if b.kind == LAYOUT_SEGMENT {
+			b.children = layoutFill(b.children, b.start, b.end(), LAYOUT_PADDING)
+		}
+	}
+	return layoutFill(blocks, 0, uint64(p.size), LAYOUT_PADDING)
+}
+
+/* inner width of the boxes drawn in the terminal */
+const LAYOUT_WIDTH = 56
+
+/*
+draws blocks as boxes: segments are framed with +---+ and |, the blocks outside any
+segment use : for the frame. digits is the width of the addresses.
+*/
+func PrintLayout(blocks []*LayoutBlock, digits int) {
+	addr := func(v uint64) string { return fmt.Sprintf("0x%0*x", digits, v) }
+	blank := strings.Repeat(" ", digits+2)
+	border := "+" + strings.Repeat("-", LAYOUT_WIDTH) + "+"
+	row := func(edge string, text string, size uint64) string {
+		s := fmt.Sprintf("%#x", size)
+		n := LAYOUT_WIDTH - 3 - len(s)
+		if len(text) > n {
+			text = text[:n]
+		}
+		return fmt.Sprintf("%s %-*s %s %s", edge, n, text, s, edge)
+	}
+
+	for _, b := range blocks {
+		switch b.kind {
+		case LAYOUT_SEGMENT:
+			fmt.Println(addr(b.start), border)
+			fmt.Println(blank, row("|", b.label(), b.size))
+			for _, c := range b.children {
+				fmt.Println(addr(c.start), row("|", "  "+c.label(), c.size))
+			}
+			fmt.Println(addr(b.end()), border)
+		case LAYOUT_GAP:
+			text := fmt.Sprintf(" %s %#x ", b.label(), b.size)
+			left := (LAYOUT_WIDTH + 2 - len(text)) / 2
+			fmt.Println(blank, strings.Repeat("~", left)+text+strings.Repeat("~", max(LAYOUT_WIDTH+2-left-len(text), 0)))
+		default:
+			fmt.Println(addr(b.start), row(":", b.label(), b.size))
+		}
+	}
+}
+
+/* fill colors of the SVG drawing, by segment permissions */
+var layout_colors = map[Elf64_Word]string{
+	PF_R:               "#cfe2f3",
+	PF_R | PF_X:        "#f4cccc",
+	PF_R | PF_W:        "#d9ead3",
+	PF_R | PF_W | PF_X: "#ffe599",
+}
+
+const (
+	LAYOUT_ROW    = 18  /* height of a row in the SVG drawing */
+	LAYOUT_ADDR   = 150 /* width of the address column */
+	LAYOUT_BOX    = 380 /* width of the boxes */
+	LAYOUT_COLUMN = LAYOUT_ADDR + LAYOUT_BOX + 40
+)
+
+/* draws one view into the SVG at column x, returns the height used */
+func svgLayout(buf *bytes.Buffer, title string, blocks []*LayoutBlock, digits int, x int) int {
+	y := 30
+	fmt.Fprintf(buf, "<text x=\"%d\" y=\"%d\" class=\"title\">%s</text>\n", x, y-10, html.EscapeString(title))
+	text := func(x int, y int, anchor string, s string) {
+		fmt.Fprintf(buf, "<text x=\"%d\" y=\"%d\" text-anchor=\"%s\">%s</text>\n", x, y+13, anchor, html.EscapeString(s))
+	}
+	addr := func(y int, v uint64) {
+		text(x+LAYOUT_ADDR-8, y, "end", fmt.Sprintf("0x%0*x", digits, v))
+	}
+	box := x + LAYOUT_ADDR
+
+	for _, b := range blocks {
+		switch b.kind {
+		case LAYOUT_SEGMENT:
+			height := LAYOUT_ROW * (len(b.children) + 1)
+			color, ok := layout_colors[b.flags&(PF_R|PF_W|PF_X)]
+			if !ok {
+				color = "#eeeeee"
+			}
+			fmt.Fprintf(buf, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"#333\"/>\n", box, y, LAYOUT_BOX, height, color)
+			addr(y, b.start)
+			text(box+6, y, "start", b.label())
+			text(box+LAYOUT_BOX-6, y, "end", fmt.Sprintf("%#x", b.size))
+			for i, c := range b.children {
+				cy := y + LAYOUT_ROW*(i+1)
+				fill, dash := "#ffffff", ""
+				if c.kind == LAYOUT_PADDING {
+					fill, dash = "none", " stroke-dasharray=\"3,3\""
+				}
+				fmt.Fprintf(buf, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"#999\"%s/>\n", box+16, cy, LAYOUT_BOX-22, LAYOUT_ROW, fill, dash)
+				addr(cy, c.start)
+				text(box+22, cy, "start", c.label())
+				text(box+LAYOUT_BOX-12, cy, "end", fmt.Sprintf("%#x", c.size))
+			}
+			y += height
+			addr(y, b.end())
+			y += LAYOUT_ROW
+		case LAYOUT_GAP:
+			fmt.Fprintf(buf, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#999\" stroke-dasharray=\"6,4\"/>\n", box, y+LAYOUT_ROW/2, box+LAYOUT_BOX, y+LAYOUT_ROW/2)
+			text(box+LAYOUT_BOX/2, y-4, "middle", fmt.Sprintf("%s %#x", b.label(), b.size))
+			y += LAYOUT_ROW
+		default:
+			fmt.Fprintf(buf, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"#f3f3f3\" stroke=\"#999\" stroke-dasharray=\"3,3\"/>\n", box, y, LAYOUT_BOX, LAYOUT_ROW)
+			addr(y, b.start)
+			text(box+6, y, "start", b.label())
+			text(box+LAYOUT_BOX-6, y, "end", fmt.Sprintf("%#x", b.size))
+			y += LAYOUT_ROW
+		}
+	}
+	return y
+}
+
+/* draws the memory and the file layout side by side as a standalone SVG image */
+func (p *ElfParser) LayoutSVG() []byte {
+	body := new(bytes.Buffer)
+	height := max(svgLayout(body, "Virtual address space", p.MemoryLayout(), 16, 10),
+		svgLayout(body, "File layout", p.FileLayout(), 8, 10+LAYOUT_COLUMN))
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"12\">\n",
+		2*LAYOUT_COLUMN, height+10)
+	buf.WriteString("<style>.title { font-size: 14px; font-weight: bold; }</style>\n")
+	buf.Write(body.Bytes())
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+/* wraps the SVG drawing into a self-contained HTML page with a legend */
+func (p *ElfParser) LayoutHTML(name string) []byte {
+	buf := new(bytes.Buffer)
+	title := html.EscapeString("Layout of " + name)
+	fmt.Fprintf(buf, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", title)
+	buf.WriteString("<style>\nbody { font-family: sans-serif; margin: 20px; }\n" +
+		".legend span { display: inline-block; padding: 2px 8px; margin-right: 8px; border: 1px solid #333; font-family: monospace; }\n</style>\n")
+	fmt.Fprintf(buf, "</head>\n<body>\n<h1>%s</h1>\n<p class=\"legend\">", title)
+	for _, flags := range []Elf64_Word{PF_R, PF_R | PF_X, PF_R | PF_W, PF_R | PF_W | PF_X} {
+		segment := &LayoutBlock{kind: LAYOUT_SEGMENT, flags: flags}
+		fmt.Fprintf(buf, "<span style=\"background: %s\">%s</span>", layout_colors[flags], strings.TrimSpace(segment.label()))
+	}
+	buf.WriteString("<span>(padding) bytes in no section</span><span>[zero] no file contents</span></p>\n")
+	buf.Write(p.LayoutSVG())
+	buf.WriteString("</body>\n</html>\n")
+	return buf.Bytes()
+}
+
+func runLayout(args []string) error {
+	memory, file := true, true
+	svg, page := "", ""
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--memory":
+			memory, file = true, false
+		case "--file":
+			memory, file = false, true
+		case "--svg", "--html":
+			if i+1 >= len(args) {
+				return usageError("elfparser: option requires an argument: %s", arg)
+			}
+			i++
+			if arg == "--svg" {
+				svg = args[i]
+			} else {
+				page = args[i]
+			}
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) != 1 {
+		return usageError("elfparser: layout takes one file")
+	}
+
+	path := paths[0]
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	parser, err := LoadData(f)
+	if err != nil {
+		return err
+	}
+
+	if svg != "" {
+		if err := os.WriteFile(svg, parser.LayoutSVG(), 0644); err != nil {
+			return err
+		}
+	}
+	if page != "" {
+		if err := os.WriteFile(page, parser.LayoutHTML(path), 0644); err != nil {
+			return err
+		}
+	}
+	if svg != "" || page != "" {
+		return nil
+	}
+
+	if memory {
+		fmt.Printf("Virtual address space of %s:\n\n", path)
+		if blocks := parser.MemoryLayout(); len(blocks) != 0 {
+			PrintLayout(blocks, 16)
+		} else {
+			fmt.Println("There are no PT_LOAD segments in this file.")
+		}
+	}
+	if memory && file {
+		fmt.Println()
+	}
+	if file {
+		fmt.Printf("File layout of %s:\n\n", path)
+		PrintLayout(parser.FileLayout(), 8)
+	}
+	return nil
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/* a shared object in the dependency tree, as the dynamic loader would map it */
+type LddObject struct {
+	name     string /* the DT_NEEDED entry, or the path given on the command line */
+	path     string /* resolved path, "" when the library was not found */
+	soname   string
+	machine  Elf64_Half
+	needed   []string
+	rpath    []string
+	runpath  []string
+	verdefs  []*Elf64VerdefDesp
+	verneeds []*Elf64VerneedDesp
+	deps     []*LddObject
+	parent   *LddObject
+}
+
+/* a version required by one object that the providing library does not define */
+type LddMissingVersion struct {
+	version  string
+	library  string
+	required string
+}
+
+/*
+resolves shared library dependencies without executing anything, following the
+search order of ld.so: DT_RPATH (when there is no DT_RUNPATH), LD_LIBRARY_PATH,
+DT_RUNPATH, the directories of /etc/ld.so.conf and finally the default directories
+*/
+type LddResolver struct {
+	sysroot     string
+	libraryPath []string
+	confDirs    []string
+	loaded      map[string]*LddObject
+	order       []*LddObject /* breadth-first load order, the executable first */
+	missing     []*LddObject
+	interp      *LddObject
+}
+
+func NewLddResolver(sysroot string) *LddResolver {
+	r := new(LddResolver)
+	r.sysroot = sysroot
+	r.loaded = map[string]*LddObject{}
+	if env := os.Getenv("LD_LIBRARY_PATH"); env != "" {
+		r.libraryPath = splitPath(env)
+	}
+	r.confDirs = r.readLdSoConf("/etc/ld.so.conf", map[string]bool{})
+	return r
+}
+
+/* resolves the dependency tree of the executable or shared object at path */
+func (r *LddResolver) Resolve(path string) (*LddObject, error) {
+	root, err := loadLddObject(path)
+	if err != nil {
+		return nil, err
+	}
+	root.name = path
+	r.order = append(r.order, root)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	parser, err := LoadData(file)
+	if err == nil {
+		if interp := parser.GetInterp(); interp != "" {
+			r.interp = &LddObject{name: interp}
+			if obj, err := loadLddObject(r.withSysroot(interp)); err == nil {
+				obj.name = interp
+				r.interp = obj
+				// the interpreter is mapped before anything else, a DT_NEEDED naming it gets the same object
+				r.loaded[interp] = obj
+				r.loaded[filepath.Base(interp)] = obj
+				if obj.soname != "" {
+					r.loaded[obj.soname] = obj
+				}
+			}
+		}
+	}
+	file.Close()
+
+	// ld.so loads the whole DT_NEEDED list of an object before descending, so walk breadth-first
+	queue := []*LddObject{root}
+	for len(queue) != 0 {
+		obj := queue[0]
+		queue = queue[1:]
+
+		for _, name := range obj.needed {
+			if dep, ok := r.loaded[name]; ok {
+				obj.deps = append(obj.deps, dep)
+				// the interpreter joins the load order where the first object needs it
+				if dep == r.interp && dep.parent == nil {
+					dep.parent = obj
+					r.order = append(r.order, dep)
+					queue = append(queue, dep)
+				}
+				continue
+			}
+
+			dep := r.find(name, obj)
+			dep.parent = obj
+			obj.deps = append(obj.deps, dep)
+			r.loaded[name] = dep
+			if dep.soname != "" {
+				r.loaded[dep.soname] = dep
+			}
+
+			if dep.path == "" {
+				r.missing = append(r.missing, dep)
+				continue
+			}
+			r.order = append(r.order, dep)
+			queue = append(queue, dep)
+		}
+	}
+
+	return root, nil
+}
+
+func (r *LddResolver) find(name string, requester *LddObject) *LddObject {
+	if strings.Contains(name, "/") {
+		path := name
+		if filepath.IsAbs(path) {
+			path = r.withSysroot(path)
+		}
+		return r.tryLoad(name, path, requester.machine)
+	}
+
+	dirs := []string{}
+	if len(requester.runpath) == 0 {
+		for obj := requester; obj != nil; obj = obj.parent {
+			if len(obj.runpath) == 0 {
+				dirs = append(dirs, r.expand(obj.rpath, obj)...)
+			}
+		}
+	}
+	dirs = append(dirs, r.sysrooted(r.libraryPath)...)
+	dirs = append(dirs, r.expand(requester.runpath, requester)...)
+	dirs = append(dirs, r.sysrooted(r.confDirs)...)
+	dirs = append(dirs, r.sysrooted(defaultLibDirs(requester.machine))...)
+
+	for _, dir := range dirs {
+		if obj := r.tryLoad(name, filepath.Join(dir, name), requester.machine); obj.path != "" {
+			return obj
+		}
+	}
+	return &LddObject{name: name}
+}
+
+/* loads path if it is an ELF file for the same machine, otherwise returns an unresolved object */
+func (r *LddResolver) tryLoad(name string, path string, machine Elf64_Half) *LddObject {
+	obj, err := loadLddObject(path)
+	if err != nil || obj.machine != machine {
+		return &LddObject{name: name}
+	}
+	obj.name = name
+	return obj
+}
+
+/* expands $ORIGIN, $LIB and $PLATFORM in the DT_RPATH or DT_RUNPATH directories of obj */
+func (r *LddResolver) expand(dirs []string, obj *LddObject) []string {
+	origin, err := filepath.Abs(filepath.Dir(obj.path))
+	if err != nil {
+		origin = filepath.Dir(obj.path)
+	}
+	lib, platform := "lib", ""
+	switch obj.machine {
+	case EM_X86_64:
+		lib, platform = "lib64", "x86_64"
+	case EM_AARCH64:
+		lib, platform = "lib64", "aarch64"
+	}
+
+	expanded := []string{}
+	for _, dir := range dirs {
+		hasOrigin := strings.Contains(dir, "$ORIGIN") || strings.Contains(dir, "${ORIGIN}")
+		replacer := strings.NewReplacer(
+			"${ORIGIN}", origin, "$ORIGIN", origin,
+			"${LIB}", lib, "$LIB", lib,
+			"${PLATFORM}", platform, "$PLATFORM", platform,
+		)
+		dir = replacer.Replace(dir)
+		// $ORIGIN is already a path inside the sysroot
+		if !hasOrigin && filepath.IsAbs(dir) {
+			dir = r.withSysroot(dir)
+		}
+		expanded = append(expanded, dir)
+	}
+	return expanded
+}
+
+func (r *LddResolver) withSysroot(path string) string {
+	if r.sysroot == "" {
+		return path
+	}
+	return filepath.Join(r.sysroot, path)
+}
+
+func (r *LddResolver) sysrooted(dirs []string) []string {
+	rooted := []string{}
+	for _, dir := range dirs {
+		rooted = append(rooted, r.withSysroot(dir))
+	}
+	return rooted
+}
+
+/* reads the directories listed in ld.so.conf, following `include` globs relative to the sysroot */
+func (r *LddResolver) readLdSoConf(path string, seen map[string]bool) []string {
+	dirs := []string{}
+	if seen[path] {
+		return dirs
+	}
+	seen[path] = true
+
+	file, err := os.Open(r.withSysroot(path))
+	if err != nil {
+		return dirs
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if fields[0] == "include" {
+			for _, pattern := range fields[1:] {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(filepath.Dir(path), pattern)
+				}
+				matches, _ := filepath.Glob(r.withSysroot(pattern))
+				sort.Strings(matches)
+				for _, match := range matches {
+					rel := match
+					if r.sysroot != "" {
+						rel = filepath.Clean("/" + strings.TrimPrefix(match, filepath.Clean(r.sysroot)))
+					}
+					dirs = append(dirs, r.readLdSoConf(rel, seen)...)
+				}
+			}
+			continue
+		}
+		if fields[0] == "hwcap" {
+			continue
+		}
+		dirs = append(dirs, splitPath(line)...)
+	}
+	return dirs
+}
+
+/* reports every version needed by an object that its providing library does not define */
+func (r *LddResolver) MissingVersions() []*LddMissingVersion {
+	missing := []*LddMissingVersion{}
+	for _, obj := range r.order {
+		for _, need := range obj.verneeds {
+			lib, ok := r.loaded[need.file]
+			if !ok || lib.path == "" {
+				continue
+			}
+			if !lib.definesVersion(need.name) {
+				missing = append(missing, &LddMissingVersion{need.name, lib.path, obj.path})
+			}
+		}
+	}
+	return missing
+}
+
+func (obj *LddObject) definesVersion(version string) bool {
+	for _, verdef := range obj.verdefs {
+		if len(verdef.names) != 0 && verdef.names[0] == version {
+			return true
+		}
+	}
+	return false
+}
+
+func loadLddObject(path string) (*LddObject, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	parser, err := LoadData(file)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := new(LddObject)
+	obj.path = path
+	obj.machine = parser.ehdr.E_machine
+	obj.needed = parser.GetDynStrings(DT_NEEDED)
+	for _, rpath := range parser.GetDynStrings(DT_RPATH) {
+		obj.rpath = append(obj.rpath, splitPath(rpath)...)
+	}
+	for _, runpath := range parser.GetDynStrings(DT_RUNPATH) {
+		obj.runpath = append(obj.runpath, splitPath(runpath)...)
+	}
+	if sonames := parser.GetDynStrings(DT_SONAME); len(sonames) != 0 {
+		obj.soname = sonames[0]
+	}
+	obj.verdefs = parser.GetVerdefs()
+	obj.verneeds = parser.GetVerneeds()
+	return obj, nil
+}
+
+func defaultLibDirs(machine Elf64_Half) []string {
+	switch machine {
+	case EM_X86_64, EM_AARCH64, EM_PPC64, EM_SPARCV9, EM_S390, EM_RISCV:
+		return []string{"/lib64", "/usr/lib64", "/lib", "/usr/lib"}
+	}
+	return []string{"/lib", "/usr/lib"}
+}
+
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(c rune) bool { return c == ':' || c == ';' })
+}
+
+func (obj *LddObject) String() string {
+	if obj.path == "" {
+		return fmt.Sprintf("%s => not found", obj.name)
+	}
+	if obj.name == obj.path {
+		return obj.path
+	}
+	return fmt.Sprintf("%s => %s", obj.name, obj.path)
+}
+
+func (r *LddResolver) PrintTree(root *LddObject) {
+	fmt.Println(root.path)
+	printed := map[*LddObject]bool{root: true}
+	r.printTree(root, "", printed)
+}
+
+func (r *LddResolver) printTree(obj *LddObject, indent string, printed map[*LddObject]bool) {
+	for i, dep := range obj.deps {
+		branch, next := "├── ", "│   "
+		if i == len(obj.deps)-1 {
+			branch, next = "└── ", "    "
+		}
+		if printed[dep] {
+			fmt.Printf("%s%s%s [already loaded]\n", indent, branch, dep.name)
+			continue
+		}
+		printed[dep] = true
+		fmt.Printf("%s%s%s\n", indent, branch, dep)
+		r.printTree(dep, indent+next, printed)
+	}
+}
+
+func (r *LddResolver) PrintList() {
+	for _, obj := range r.order[1:] {
+		if obj != r.interp {
+			fmt.Printf("\t%s\n", obj)
+		}
+	}
+	for _, obj := range r.missing {
+		fmt.Printf("\t%s\n", obj)
+	}
+	if r.interp != nil {
+		if r.interp.path == "" {
+			fmt.Printf("\t%s (not found)\n", r.interp.name)
+		} else {
+			fmt.Printf("\t%s\n", r.interp.path)
+		}
+	}
+}
+
+func (r *LddResolver) PrintDot(root *LddObject) {
+	fmt.Println("digraph dependencies {")
+	fmt.Println("\tnode [shape=box];")
+	objs := append(append([]*LddObject{}, r.order...), r.missing...)
+	for _, obj := range objs {
+		label := obj.name
+		if obj == root {
+			label = filepath.Base(obj.path)
+		}
+		attrs := ""
+		if obj.path == "" {
+			attrs = ", color=red, style=dashed"
+		}
+		fmt.Printf("\t%q [label=%q%s];\n", obj.name, label, attrs)
+	}
+	for _, obj := range r.order {
+		for _, dep := range obj.deps {
+			fmt.Printf("\t%q -> %q;\n", obj.name, dep.name)
+		}
+	}
+	fmt.Println("}")
+}
+
+func runLdd(args []string) error {
+	format := "tree"
+	sysroot := ""
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--tree":
+			format = "tree"
+		case "--list":
+			format = "list"
+		case "--dot":
+			format = "dot"
+		case "--sysroot":
+			if i+1 >= len(args) {
+				return usageError("elfparser: option requires an argument: %s", arg)
+			}
+			i++
+			sysroot = args[i]
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+
+	for _, path := range paths {
+		r := NewLddResolver(sysroot)
+		root, err := r.Resolve(path)
+		if err != nil {
+			return err
+		}
+
+		if len(paths) > 1 && format != "dot" {
+			fmt.Printf("%s:\n", path)
+		}
+		switch format {
+		case "tree":
+			r.PrintTree(root)
+		case "list":
+			r.PrintList()
+		case "dot":
+			r.PrintDot(root)
+		}
+
+		for _, obj := range r.missing {
+			fmt.Fprintf(os.Stderr, "%s: error: %s not found (required by %s)\n", path, obj.name, obj.parent.path)
+		}
+		for _, m := range r.MissingVersions() {
+			fmt.Fprintf(os.Stderr, "%s: error: version `%s' not found in %s (required by %s)\n", path, m.version, m.library, m.required)
+		}
+	}
+	return nil
+}
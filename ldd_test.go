@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/* writes a fixture library or program to root/path, creating the directories */
+func writeFixture(t *testing.T, root string, path string, f *fixture) string {
+	t.Helper()
+	path = filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, f.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func fixtureLibrary(soname string, needed ...string) *fixture {
+	return fixtureDynamic(ET_DYN, fixtureLink{soname: soname, needed: needed})
+}
+
+/* resolves the program at path below a sysroot, without the LD_LIBRARY_PATH of the test */
+func resolveFixture(t *testing.T, sysroot string, path string) (*LddResolver, *LddObject) {
+	t.Helper()
+	r := NewLddResolver(sysroot)
+	root, err := r.Resolve(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, root
+}
+
+/* the path each library of the load order was found at, relative to the sysroot */
+func loadOrder(r *LddResolver, sysroot string) []string {
+	paths := []string{}
+	for _, obj := range r.order[1:] {
+		paths = append(paths, obj.name+" => "+strings.TrimPrefix(obj.path, sysroot))
+	}
+	for _, obj := range r.missing {
+		paths = append(paths, obj.name+" => not found")
+	}
+	return paths
+}
+
+/* libc needs the interpreter, which must resolve to the object already mapped for PT_INTERP */
+func TestLddInterpreter(t *testing.T) {
+	t.Setenv("LD_LIBRARY_PATH", "")
+	sysroot := t.TempDir()
+	const interp = "/lib64/ld-linux-x86-64.so.2"
+	writeFixture(t, sysroot, interp, fixtureLibrary("ld-linux-x86-64.so.2"))
+	writeFixture(t, sysroot, "/lib64/libc.so.6", fixtureLibrary("libc.so.6", "ld-linux-x86-64.so.2"))
+	program := writeFixture(t, sysroot, "/usr/bin/program",
+		fixtureDynamic(ET_DYN, fixtureLink{interp: interp, needed: []string{"libc.so.6"}}))
+
+	r, root := resolveFixture(t, sysroot, program)
+	want := []string{"libc.so.6 => /lib64/libc.so.6", interp + " => " + interp}
+	if got := loadOrder(r, sysroot); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("load order %q\nwant %q", got, want)
+	}
+	libc := root.deps[0]
+	if len(libc.deps) != 1 || libc.deps[0] != r.interp {
+		t.Errorf("the DT_NEEDED of libc on the interpreter loaded another copy")
+	}
+
+	out := captureStdout(t, r.PrintList)
+	list := "\t" + "libc.so.6 => " + filepath.Join(sysroot, "/lib64/libc.so.6") + "\n\t" + filepath.Join(sysroot, interp) + "\n"
+	if string(out) != list {
+		t.Errorf("the list is\n%s\nwant\n%s", out, list)
+	}
+}
+
+func TestLddSearchOrder(t *testing.T) {
+	sysroot := t.TempDir()
+	// every directory has its own copy of the library, the one found tells where the search stopped
+	for _, dir := range []string{"/app/rpath", "/app/runpath", "/env", "/conf", "/lib64", "/opt/lib"} {
+		writeFixture(t, sysroot, dir+"/libfoo.so.1", fixtureLibrary("libfoo.so.1"))
+	}
+	os.MkdirAll(filepath.Join(sysroot, "/etc/ld.so.conf.d"), 0755)
+	os.WriteFile(filepath.Join(sysroot, "/etc/ld.so.conf.d/test.conf"), []byte("/conf\n"), 0644)
+	conf := filepath.Join(sysroot, "/etc/ld.so.conf")
+
+	tests := []struct {
+		name    string
+		link    fixtureLink
+		conf    bool
+		env     string
+		foundIn string
+	}{
+		{"default directories", fixtureLink{}, false, "", "/lib64"},
+		{"ld.so.conf", fixtureLink{}, true, "", "/conf"},
+		{"LD_LIBRARY_PATH", fixtureLink{}, true, "/env", "/env"},
+		{"RPATH before LD_LIBRARY_PATH", fixtureLink{rpath: "$ORIGIN/rpath"}, true, "/env", "/app/rpath"},
+		{"RUNPATH after LD_LIBRARY_PATH", fixtureLink{runpath: "$ORIGIN/runpath"}, true, "/env", "/env"},
+		{"RUNPATH before ld.so.conf", fixtureLink{runpath: "${ORIGIN}/runpath"}, true, "", "/app/runpath"},
+		{"RUNPATH hides RPATH", fixtureLink{rpath: "$ORIGIN/rpath", runpath: "$ORIGIN/runpath"}, false, "", "/app/runpath"},
+		{"absolute RPATH in the sysroot", fixtureLink{rpath: "/missing:/opt/lib"}, false, "", "/opt/lib"},
+	}
+	for _, test := range tests {
+		os.Remove(conf)
+		if test.conf {
+			os.WriteFile(conf, []byte("# comment\ninclude ld.so.conf.d/*.conf\n"), 0644)
+		}
+		t.Setenv("LD_LIBRARY_PATH", test.env)
+		test.link.needed = []string{"libfoo.so.1"}
+		program := writeFixture(t, sysroot, "/app/program", fixtureDynamic(ET_DYN, test.link))
+		r, _ := resolveFixture(t, sysroot, program)
+		want := "libfoo.so.1 => " + test.foundIn + "/libfoo.so.1"
+		if got := loadOrder(r, sysroot); len(got) != 1 || got[0] != want {
+			t.Errorf("%s: %q, want %s", test.name, got, want)
+		}
+	}
+}
+
+/* the RPATH of an object applies to the libraries its dependencies load, RUNPATH only to its own */
+func TestLddInheritedPath(t *testing.T) {
+	t.Setenv("LD_LIBRARY_PATH", "")
+	sysroot := t.TempDir()
+	writeFixture(t, sysroot, "/app/lib/libfoo.so.1", fixtureLibrary("libfoo.so.1", "libbar.so.1"))
+	writeFixture(t, sysroot, "/app/lib/libbar.so.1", fixtureLibrary("libbar.so.1"))
+
+	program := writeFixture(t, sysroot, "/app/program",
+		fixtureDynamic(ET_DYN, fixtureLink{needed: []string{"libfoo.so.1"}, rpath: "$ORIGIN/lib"}))
+	r, _ := resolveFixture(t, sysroot, program)
+	want := []string{"libfoo.so.1 => /app/lib/libfoo.so.1", "libbar.so.1 => /app/lib/libbar.so.1"}
+	if got := loadOrder(r, sysroot); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("with RPATH %q\nwant %q", got, want)
+	}
+
+	program = writeFixture(t, sysroot, "/app/program",
+		fixtureDynamic(ET_DYN, fixtureLink{needed: []string{"libfoo.so.1"}, runpath: "$ORIGIN/lib"}))
+	r, _ = resolveFixture(t, sysroot, program)
+	want = []string{"libfoo.so.1 => /app/lib/libfoo.so.1", "libbar.so.1 => not found"}
+	if got := loadOrder(r, sysroot); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("with RUNPATH %q\nwant %q", got, want)
+	}
+	if r.missing[0].parent.name != "libfoo.so.1" {
+		t.Errorf("libbar.so.1 is required by %s", r.missing[0].parent.name)
+	}
+}
+
+/* a library that is not found, and one for another machine, are reported missing */
+func TestLddNotFound(t *testing.T) {
+	t.Setenv("LD_LIBRARY_PATH", "")
+	sysroot := t.TempDir()
+	other := fixtureLibrary("libother.so.1")
+	other.machine = EM_AARCH64
+	writeFixture(t, sysroot, "/lib64/libother.so.1", other)
+	program := writeFixture(t, sysroot, "/app/program", fixtureDynamic(ET_DYN,
+		fixtureLink{interp: "/lib64/ld-missing.so.2", needed: []string{"libmissing.so.1", "libother.so.1"}}))
+
+	r, _ := resolveFixture(t, sysroot, program)
+	want := []string{"libmissing.so.1 => not found", "libother.so.1 => not found"}
+	if got := loadOrder(r, sysroot); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("%q\nwant %q", got, want)
+	}
+	out := captureStdout(t, r.PrintList)
+	list := "\tlibmissing.so.1 => not found\n\tlibother.so.1 => not found\n\t/lib64/ld-missing.so.2 (not found)\n"
+	if string(out) != list {
+		t.Errorf("the list is\n%s\nwant\n%s", out, list)
+	}
+}
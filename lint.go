@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	LINT_ERROR   = iota /* the file breaks the ELF specification, tools may misread it */
+	LINT_WARNING        /* legal but suspicious, usually a sign of a hand-edited file */
+)
+
+var lint_severity = map[int]string{
+	LINT_ERROR:   "error",
+	LINT_WARNING: "warning",
+}
+
+/* one violated invariant, where names the header, segment or section at fault */
+type LintIssue struct {
+	severity int
+	where    string
+	msg      string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", lint_severity[i.severity], i.where, i.msg)
+}
+
+/* the sh_entsize every table of a given type must have in an ELF64 file */
+var lint_entsize = map[Elf64_Word]Elf64_XWord{
+	SHT_SYMTAB:        24,
+	SHT_DYNSYM:        24,
+	SHT_RELA:          24,
+	SHT_REL:           16,
+	SHT_RELR:          8,
+	SHT_DYNAMIC:       16,
+	SHT_INIT_ARRAY:    8,
+	SHT_FINI_ARRAY:    8,
+	SHT_PREINIT_ARRAY: 8,
+	SHT_GROUP:         4,
+	SHT_SYMTAB_SHNDX:  4,
+	SHT_GNU_versym:    2,
+}
+
+func isPowerOf2(v uint64) bool {
+	return v&(v-1) == 0
+}
+
+/*
+checks the structural invariants of the file. The header tables are bounds checked before
+they are read, so that malformed files are reported rather than read as garbage.
+*/
+func (p *ElfParser) Lint() []*LintIssue {
+	issues := []*LintIssue{}
+	report := func(severity int, where string, format string, args ...any) {
+		issues = append(issues, &LintIssue{severity, where, fmt.Sprintf(format, args...)})
+	}
+
+	inFile := p.inFile
+
+	ehdr := p.ehdr
+	if int(ehdr.E_ehsize) != binary.Size(Elf64Header{}) {
+		report(LINT_ERROR, "ELF header", "e_ehsize is %d, expected %d", ehdr.E_ehsize, binary.Size(Elf64Header{}))
+	}
+	if ehdr.E_version != EV_CURRENT || ehdr.E_ident[EI_VERSION] != EV_CURRENT {
+		report(LINT_WARNING, "ELF header", "unknown ELF version %d", ehdr.E_version)
+	}
+
+	phdrsOk := ehdr.E_phnum == 0
+	if ehdr.E_phnum != 0 {
+		phentsize := binary.Size(Elf64ProgramHeader{})
+		switch {
+		case int(ehdr.E_phentsize) != phentsize:
+			report(LINT_ERROR, "ELF header", "e_phentsize is %d, expected %d", ehdr.E_phentsize, phentsize)
+		case !inFile(uint64(ehdr.E_phoff), uint64(ehdr.E_phnum)*uint64(phentsize)):
+			report(LINT_ERROR, "ELF header", "the program header table at 0x%x extends past the end of the file", ehdr.E_phoff)
+		default:
+			phdrsOk = true
+		}
+	}
+
+	shdrsOk := ehdr.E_shnum == 0
+	if ehdr.E_shnum != 0 {
+		shentsize := binary.Size(Elf64SectionHeader{})
+		switch {
+		case int(ehdr.E_shentsize) != shentsize:
+			report(LINT_ERROR, "ELF header", "e_shentsize is %d, expected %d", ehdr.E_shentsize, shentsize)
+		case !inFile(uint64(ehdr.E_shoff), uint64(ehdr.E_shnum)*uint64(shentsize)):
+			report(LINT_ERROR, "ELF header", "the section header table at 0x%x extends past the end of the file", ehdr.E_shoff)
+		default:
+			shdrsOk = true
+		}
+		if ehdr.E_shstrndx >= ehdr.E_shnum {
+			report(LINT_ERROR, "ELF header", "e_shstrndx %d is out of range (%d sections)", ehdr.E_shstrndx, ehdr.E_shnum)
+			shdrsOk = false
+		}
+	}
+
+	phdrs := []*Elf64ProgramHeader{}
+	if phdrsOk {
+		phdrs = p.GetPhdrs()
+	}
+	var lastLoad *Elf64ProgramHeader
+	for i, phdr := range phdrs {
+		where := fmt.Sprintf("segment %d (%s)", i, p_type[phdr.P_type])
+		if phdr.P_filesz != 0 && !inFile(uint64(phdr.P_offset), uint64(phdr.P_filesz)) {
+			report(LINT_ERROR, where, "offset 0x%x + size 0x%x is outside the file", phdr.P_offset, phdr.P_filesz)
+		}
+		if phdr.P_filesz > phdr.P_memsz && phdr.P_type == PT_LOAD {
+			report(LINT_ERROR, where, "p_filesz 0x%x is larger than p_memsz 0x%x", phdr.P_filesz, phdr.P_memsz)
+		}
+		if !isPowerOf2(uint64(phdr.P_align)) {
+			report(LINT_ERROR, where, "p_align 0x%x is not a power of two", phdr.P_align)
+		} else if phdr.P_type == PT_LOAD && phdr.P_align > 1 &&
+			uint64(phdr.P_vaddr)%uint64(phdr.P_align) != uint64(phdr.P_offset)%uint64(phdr.P_align) {
+			report(LINT_ERROR, where, "p_vaddr 0x%x and p_offset 0x%x differ modulo p_align 0x%x", phdr.P_vaddr, phdr.P_offset, phdr.P_align)
+		}
+		if phdr.P_type != PT_LOAD {
+			continue
+		}
+		if lastLoad != nil && phdr.P_vaddr < lastLoad.P_vaddr {
+			report(LINT_ERROR, where, "PT_LOAD at 0x%x is not sorted by p_vaddr, it follows 0x%x", phdr.P_vaddr, lastLoad.P_vaddr)
+		}
+		lastLoad = phdr
+	}
+
+	if !shdrsOk || ehdr.E_shnum == 0 {
+		return issues
+	}
+	shdrs := p.GetShdrs()
+	shstrtab := shdrs[ehdr.E_shstrndx].shdr
+	if shstrtab.SH_type != SHT_STRTAB {
+		report(LINT_ERROR, "ELF header", "e_shstrndx %d is not a string table", ehdr.E_shstrndx)
+	}
+
+	names := make([]string, len(shdrs))
+	for i, desp := range shdrs {
+		shdr := desp.shdr
+		names[i] = fmt.Sprintf("section %d", i)
+		if uint64(shdr.SH_name) >= uint64(shstrtab.SH_size) {
+			report(LINT_ERROR, names[i], "sh_name 0x%x is past the end of the section name table", shdr.SH_name)
+		} else if name := strings.Trim(desp.name, "\x00"); name != "" {
+			names[i] += " (" + name + ")"
+		}
+	}
+
+	for i, desp := range shdrs {
+		shdr := desp.shdr
+		where := names[i]
+		if shdr.SH_type == SHT_NULL {
+			continue
+		}
+		if shdr.SH_type != SHT_NOBITS && !inFile(uint64(shdr.SH_offset), uint64(shdr.SH_size)) {
+			report(LINT_ERROR, where, "offset 0x%x + size 0x%x is outside the file", shdr.SH_offset, shdr.SH_size)
+		}
+		if !isPowerOf2(uint64(shdr.SH_addralign)) {
+			report(LINT_ERROR, where, "sh_addralign 0x%x is not a power of two", shdr.SH_addralign)
+		} else if shdr.SH_addralign > 1 && uint64(shdr.SH_addr)%uint64(shdr.SH_addralign) != 0 {
+			report(LINT_WARNING, where, "sh_addr 0x%x is not aligned to sh_addralign 0x%x", shdr.SH_addr, shdr.SH_addralign)
+		}
+
+		if uint64(shdr.SH_link) >= uint64(len(shdrs)) {
+			report(LINT_ERROR, where, "sh_link %d is out of range (%d sections)", shdr.SH_link, len(shdrs))
+		} else if typ := shdr.SH_type; typ == SHT_SYMTAB || typ == SHT_DYNSYM || typ == SHT_DYNAMIC {
+			if shdrs[shdr.SH_link].shdr.SH_type != SHT_STRTAB {
+				report(LINT_ERROR, where, "sh_link %d is not a string table", shdr.SH_link)
+			}
+		}
+		if shdr.SH_flags&SHF_INFO_LINK != 0 || (shdr.SH_type == SHT_REL || shdr.SH_type == SHT_RELA) && shdr.SH_info != 0 {
+			if uint64(shdr.SH_info) >= uint64(len(shdrs)) {
+				report(LINT_ERROR, where, "sh_info %d is out of range (%d sections)", shdr.SH_info, len(shdrs))
+			}
+		}
+
+		if want, ok := lint_entsize[shdr.SH_type]; ok {
+			if shdr.SH_entsize != want {
+				report(LINT_ERROR, where, "sh_entsize is %d, expected %d for %s", shdr.SH_entsize, want, sh_type[shdr.SH_type])
+			} else if shdr.SH_size%shdr.SH_entsize != 0 {
+				report(LINT_ERROR, where, "size 0x%x is not a multiple of sh_entsize %d", shdr.SH_size, shdr.SH_entsize)
+			}
+		}
+	}
+
+	// sections with contents must not share file bytes
+	sorted := []*Elf64SectionHeaderDesp{}
+	for _, desp := range shdrs {
+		if desp.shdr.SH_type != SHT_NULL && desp.shdr.SH_type != SHT_NOBITS && desp.shdr.SH_size != 0 {
+			sorted = append(sorted, desp)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].shdr.SH_offset < sorted[j].shdr.SH_offset })
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1].shdr, sorted[i].shdr
+		if uint64(prev.SH_offset)+uint64(prev.SH_size) > uint64(cur.SH_offset) {
+			report(LINT_ERROR, names[sorted[i].idx], "overlaps %s in the file at 0x%x", names[sorted[i-1].idx], cur.SH_offset)
+		}
+	}
+
+	// nor the bytes of the headers
+	headers := []struct {
+		name   string
+		offset uint64
+		size   uint64
+	}{
+		{"the ELF header", 0, uint64(ehdr.E_ehsize)},
+		{"the program header table", uint64(ehdr.E_phoff), uint64(ehdr.E_phnum) * uint64(ehdr.E_phentsize)},
+		{"the section header table", uint64(ehdr.E_shoff), uint64(ehdr.E_shnum) * uint64(ehdr.E_shentsize)},
+	}
+	for _, desp := range sorted {
+		shdr := desp.shdr
+		for _, header := range headers {
+			if header.size != 0 && uint64(shdr.SH_offset) < header.offset+header.size &&
+				header.offset < uint64(shdr.SH_offset)+uint64(shdr.SH_size) {
+				report(LINT_ERROR, names[desp.idx], "overlaps %s in the file at 0x%x", header.name, shdr.SH_offset)
+			}
+		}
+	}
+
+	// every allocated section of a loadable file must be mapped by some segment
+	if ehdr.E_type == ET_EXEC || ehdr.E_type == ET_DYN {
+		for i, desp := range shdrs {
+			shdr := desp.shdr
+			if shdr.SH_flags&SHF_ALLOC == 0 || shdr.SH_size == 0 {
+				continue
+			}
+			covered := false
+			for _, phdr := range phdrs {
+				// .tbss only takes room in the TLS template, not in the address space
+				if phdr.P_type != PT_LOAD && !(phdr.P_type == PT_TLS && shdr.SH_flags&SHF_TLS != 0) {
+					continue
+				}
+				if shdr.SH_addr >= phdr.P_vaddr && uint64(shdr.SH_addr)+uint64(shdr.SH_size) <= uint64(phdr.P_vaddr)+uint64(phdr.P_memsz) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				report(LINT_WARNING, names[i], "allocated section at 0x%x is not covered by any segment", shdr.SH_addr)
+			}
+		}
+	}
+
+	issues = append(issues, p.lintSymbols(shdrs, names, inFile)...)
+	return issues
+}
+
+/*
+checks that symbol names lie within their string table, that the locals come before sh_info
+and that sized symbols lie within their section
+*/
+func (p *ElfParser) lintSymbols(shdrs []*Elf64SectionHeaderDesp, names []string, inFile func(uint64, uint64) bool) []*LintIssue {
+	issues := []*LintIssue{}
+	for i, desp := range shdrs {
+		shdr := desp.shdr
+		if shdr.SH_type != SHT_SYMTAB && shdr.SH_type != SHT_DYNSYM {
+			continue
+		}
+		if shdr.SH_entsize != 24 || !inFile(uint64(shdr.SH_offset), uint64(shdr.SH_size)) ||
+			uint64(shdr.SH_link) >= uint64(len(shdrs)) {
+			// already reported, the entries cannot be read
+			continue
+		}
+
+		strtab := shdrs[shdr.SH_link].shdr
+		count := uint64(shdr.SH_size) / 24
+		if uint64(shdr.SH_info) > count {
+			issues = append(issues, &LintIssue{LINT_ERROR, names[i], fmt.Sprintf("sh_info %d is larger than the %d symbols", shdr.SH_info, count)})
+		}
+		// a corrupt table would give one report per symbol, keep the first few
+		bad := 0
+		add := func(format string, args ...any) {
+			if bad++; bad <= 5 {
+				issues = append(issues, &LintIssue{LINT_ERROR, names[i], fmt.Sprintf(format, args...)})
+			}
+		}
+		data := p.readBytes(int64(shdr.SH_offset), int64(shdr.SH_size))
+		for j := uint64(0); j < count; j++ {
+			name := p.order.Uint32(data[24*j:])
+			info := data[24*j+4]
+			shndx := p.order.Uint16(data[24*j+6:])
+			value := p.order.Uint64(data[24*j+8:])
+			size := p.order.Uint64(data[24*j+16:])
+			if strtab.SH_type == SHT_STRTAB && uint64(name) >= uint64(strtab.SH_size) {
+				add("symbol %d: st_name 0x%x is past the end of the string table", j, name)
+			}
+			// the locals come first, sh_info is the index of the first global
+			if j != 0 && j < uint64(shdr.SH_info) && info>>4 != STB_LOCAL {
+				add("symbol %d: non-local symbol before sh_info %d", j, shdr.SH_info)
+			} else if j >= uint64(shdr.SH_info) && info>>4 == STB_LOCAL {
+				add("symbol %d: local symbol after sh_info %d", j, shdr.SH_info)
+			}
+			if shndx < SHN_LORESERVE && uint64(shndx) >= uint64(len(shdrs)) {
+				add("symbol %d: st_shndx %d is out of range", j, shndx)
+				continue
+			}
+			if shndx == SHN_UNDEF || shndx >= SHN_LORESERVE {
+				continue
+			}
+			// the linker places markers such as _end past their section, they have no size; the value
+			// of a TLS symbol is an offset in the TLS template
+			if typ := info & 0xf; size == 0 || typ == STT_TLS || typ == STT_SECTION {
+				continue
+			}
+			section := shdrs[shndx].shdr
+			start := uint64(section.SH_addr)
+			if p.ehdr.E_type == ET_REL {
+				start = 0
+			}
+			if value < start || value-start > uint64(section.SH_size) || size > uint64(section.SH_size)-(value-start) {
+				add("symbol %d: value 0x%x + size 0x%x is outside %s", j, value, size, names[shndx])
+			}
+		}
+		if bad > 5 {
+			issues = append(issues, &LintIssue{LINT_ERROR, names[i], fmt.Sprintf("%d more bad symbols", bad-5)})
+		}
+	}
+	return issues
+}
+
+func runLint(args []string) error {
+	paths := []string{}
+	warnings := true
+	for _, arg := range args {
+		switch arg {
+		case "--errors-only":
+			warnings = false
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+
+	failed := false
+	for _, path := range paths {
+		issues, err := lintFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		for _, issue := range issues {
+			if issue.severity == LINT_ERROR {
+				failed = true
+			} else if !warnings {
+				continue
+			}
+			fmt.Printf("%s: %s\n", path, issue)
+		}
+	}
+
+	// like a compiler, exit with a failure status when any error was found
+	if failed {
+		return errExitStatus
+	}
+	return nil
+}
+
+func lintFile(path string) ([]*LintIssue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	parser, err := LoadData(file)
+	if err != nil {
+		return nil, err
+	}
+	return parser.Lint(), nil
+}
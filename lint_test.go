@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+/* each corruption of the executable fixture is reported as exactly these issues */
+func TestLint(t *testing.T) {
+	clean := fixtureExec(binary.LittleEndian, EM_X86_64, false).Bytes()
+	p, err := LoadData(bytes.NewReader(clean))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ehdr := p.GetEhdr()
+	index := map[string]int{}
+	for i, name := range sectionNames(p) {
+		index[name] = i
+	}
+	loads := []int{}
+	for i, phdr := range p.GetPhdrs() {
+		if phdr.P_type == PT_LOAD {
+			loads = append(loads, i)
+		}
+	}
+	shdr := func(name string) int { return int(ehdr.E_shoff) + 64*index[name] }
+	phdr := func(i int) int { return int(ehdr.E_phoff) + 56*i }
+	_, symtab := sectionBytes(p, ".symtab")
+	sym := func(i int) int { return int(symtab.SH_offset) + 24*i }
+	_, rodata := sectionBytes(p, ".rodata")
+	text := p.GetPhdrs()[loads[0]]
+	data := p.GetPhdrs()[loads[1]]
+
+	tests := []struct {
+		name    string
+		corrupt func(b []byte)
+		want    []string
+	}{
+		{"e_ehsize", func(b []byte) { binary.LittleEndian.PutUint16(b[52:], 60) },
+			[]string{"error: ELF header: e_ehsize is 60, expected 64"}},
+		{"section overlapping the headers", func(b []byte) { binary.LittleEndian.PutUint64(b[shdr(".comment")+24:], 0) },
+			[]string{"error: section 8 (.comment): overlaps the ELF header in the file at 0x0"}},
+		{"overlapping sections", func(b []byte) {
+			binary.LittleEndian.PutUint64(b[shdr(".strtab")+24:], uint64(symtab.SH_offset)+8)
+		}, []string{fmt.Sprintf("error: section 10 (.strtab): overlaps section 9 (.symtab) in the file at 0x%x", symtab.SH_offset+8)}},
+		{"segment outside the file", func(b []byte) { binary.LittleEndian.PutUint64(b[phdr(0)+8:], 1<<32) },
+			[]string{fmt.Sprintf("error: segment 0 (%s): offset 0x100000000 + size 0x%x is outside the file",
+				p_type[p.GetPhdrs()[0].P_type], p.GetPhdrs()[0].P_filesz)}},
+		{"unsorted PT_LOAD", func(b []byte) {
+			first := append([]byte{}, b[phdr(loads[0]):phdr(loads[0])+56]...)
+			copy(b[phdr(loads[0]):], b[phdr(loads[1]):phdr(loads[1])+56])
+			copy(b[phdr(loads[1]):], first)
+		}, []string{fmt.Sprintf("error: segment %d (LOAD): PT_LOAD at 0x%x is not sorted by p_vaddr, it follows 0x%x",
+			loads[1], text.P_vaddr, data.P_vaddr)}},
+		{"bad sh_link", func(b []byte) { binary.LittleEndian.PutUint32(b[shdr(".symtab")+40:], 99) },
+			[]string{"error: section 9 (.symtab): sh_link 99 is out of range (12 sections)"}},
+		{"sh_link not a string table", func(b []byte) {
+			binary.LittleEndian.PutUint32(b[shdr(".symtab")+40:], uint32(index[".comment"]))
+		}, []string{"error: section 9 (.symtab): sh_link 8 is not a string table"}},
+		{"sh_addralign", func(b []byte) { binary.LittleEndian.PutUint64(b[shdr(".text")+48:], 3) },
+			[]string{"error: section 2 (.text): sh_addralign 0x3 is not a power of two"}},
+		{"sh_entsize", func(b []byte) { binary.LittleEndian.PutUint64(b[shdr(".symtab")+56:], 16) },
+			[]string{"error: section 9 (.symtab): sh_entsize is 16, expected 24 for SYMTAB"}},
+		{"section outside the segments", func(b []byte) {
+			binary.LittleEndian.PutUint64(b[shdr(".comment")+8:], uint64(SHF_ALLOC|SHF_MERGE|SHF_STRINGS))
+		}, []string{"warning: section 8 (.comment): allocated section at 0x0 is not covered by any segment"}},
+		{"st_name", func(b []byte) { binary.LittleEndian.PutUint32(b[sym(3):], 0xffff) },
+			[]string{"error: section 9 (.symtab): symbol 3: st_name 0xffff is past the end of the string table"}},
+		{"symbol outside its section", func(b []byte) { binary.LittleEndian.PutUint64(b[sym(3)+16:], 16) },
+			[]string{fmt.Sprintf("error: section 9 (.symtab): symbol 3: value 0x%x + size 0x10 is outside section 3 (.rodata)", rodata.SH_addr)}},
+		{"non-local symbol before sh_info", func(b []byte) { binary.LittleEndian.PutUint32(b[shdr(".symtab")+44:], 6) },
+			[]string{"error: section 9 (.symtab): symbol 5: non-local symbol before sh_info 6"}},
+		{"local symbol after sh_info", func(b []byte) { binary.LittleEndian.PutUint32(b[shdr(".symtab")+44:], 4) },
+			[]string{"error: section 9 (.symtab): symbol 4: local symbol after sh_info 4"}},
+		{"sh_info past the symbols", func(b []byte) { binary.LittleEndian.PutUint32(b[shdr(".symtab")+44:], 10) },
+			[]string{"error: section 9 (.symtab): sh_info 10 is larger than the 9 symbols",
+				"error: section 9 (.symtab): symbol 5: non-local symbol before sh_info 10",
+				"error: section 9 (.symtab): symbol 6: non-local symbol before sh_info 10",
+				"error: section 9 (.symtab): symbol 7: non-local symbol before sh_info 10",
+				"error: section 9 (.symtab): symbol 8: non-local symbol before sh_info 10"}},
+	}
+	for _, test := range tests {
+		b := append([]byte{}, clean...)
+		test.corrupt(b)
+		p, err := LoadData(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		got := []string{}
+		for _, issue := range p.Lint() {
+			got = append(got, issue.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
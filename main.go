@@ -1,18 +1,87 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 )
 
 var options = map[string]bool{
-	"header":   false,
-	"sections": false,
-	"segments": false,
-	"symbols":  false,
-	"all":      false,
-	"help":     true,
+	"header":    false,
+	"sections":  false,
+	"segments":  false,
+	"symbols":   false,
+	"histogram": false,
+	"armap":     false,
+	"all":       false,
+	"compat":    false,
+	"wide":      false,
+	"demangle":  false,
+	"help":      true,
+}
+
+/* single letter options, several can be given in one argument as in -lSW */
+var short_options = map[byte]string{
+	'a': "all",
+	'h': "header",
+	'l': "segments",
+	'S': "sections",
+	's': "symbols",
+	'I': "histogram",
+	'c': "armap",
+	'W': "wide",
+	'C': "demangle",
+	'H': "help",
+}
+
+/* subcommands, selected by the first argument: `parser <command> [args]` */
+var commands = map[string]func(args []string) error{
+	"bpf":      runBpf,
+	"checksec": runChecksec,
+	"core":     runCore,
+	"go":       runGo,
+	"kmod":     runKmod,
+	"layout":   runLayout,
+	"ldd":      runLdd,
+	"lint":     runLint,
+	"objcopy":  runObjcopy,
+	"patchelf": runPatchelf,
+	"scan":     runScan,
+	"shell":    runShell,
+	"strip":    runStrip,
+	"symcheck": runSymcheck,
+}
+
+/*
+returned by a command that has already reported its problems and only
+has to exit with a failure status, like ld.so when a symbol is missing
+*/
+var errExitStatus = errors.New("elfparser: exit status 1")
+
+/* a mistake in the command line, reported together with the usage */
+type UsageError struct {
+	msg string
+}
+
+func (e *UsageError) Error() string {
+	return e.msg
+}
+
+func usageError(format string, args ...any) error {
+	return &UsageError{fmt.Sprintf(format, args...)}
+}
+
+/* reports the error of a command, the usage only when the command line was wrong */
+func exitWith(err error) {
+	if !errors.Is(err, errExitStatus) {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+	var usage *UsageError
+	if errors.As(err, &usage) {
+		printUsage()
+	}
+	os.Exit(1)
 }
 
 func main() {
@@ -21,68 +90,168 @@ func main() {
 		return
 	}
 
+	if command, ok := commands[os.Args[1]]; ok {
+		if err := command(os.Args[2:]); err != nil {
+			exitWith(err)
+		}
+		return
+	}
+
 	paths, err := handleArgs(os.Args[1:])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		printUsage()
-		return
+		exitWith(err)
 	}
 
 	if err = parseFiles(paths); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		printUsage()
-		return
+		exitWith(err)
 	}
 }
 
 func parseFiles(paths []string) error {
 	if len(paths) == 0 {
-		return fmt.Errorf("elfparser: Warning: Nothing to do")
+		return usageError("elfparser: Warning: Nothing to do")
 	}
 
 	for _, path := range paths {
-		file, err := os.Open(path)
-		if err != nil {
+		if err := parseFile(path, len(paths) > 1); err != nil {
 			return err
 		}
-		defer file.Close()
+	}
+	return nil
+}
 
-		parser, err := LoadData(file)
-		if err != nil {
-			return err
+/* prints the selected modes for one file, which is closed before the next one is opened */
+func parseFile(path string, several bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if options["compat"] && several {
+		fmt.Printf("\nFile: %s\n", path)
+	}
+	if IsArchive(file) {
+		return parseArchive(path, file)
+	}
+
+	parser, err := LoadData(file)
+	if err != nil {
+		return err
+	}
+	printParser(parser)
+	for _, err := range parser.Errors() {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+	return nil
+}
+
+/* runs the selected modes on every member of a static archive */
+func parseArchive(path string, file *os.File) error {
+	archive, err := LoadArchive(file, path)
+	if err != nil {
+		return err
+	}
+
+	if options["armap"] {
+		archive.demangle = options["demangle"]
+		archive.PrintArmap()
+		options["help"] = false
+		if !options["all"] && !options["header"] && !options["sections"] && !options["segments"] && !options["symbols"] && !options["histogram"] {
+			return nil
 		}
-		if options["all"] {
-			parser.PrintEhdr()
-			parser.PrintShdrs()
-			parser.PrintPhdrs()
-			parser.PrintSyms()
-			options["help"] = false
+	}
+
+	for _, member := range archive.members {
+		fmt.Printf("\nFile: %s(%s)\n", path, member.name)
+
+		reader, closer, err := archive.Open(member)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s(%s): %v\n", path, member.name, err)
 			continue
 		}
-		if options["header"] {
-			parser.PrintEhdr()
-			options["help"] = false
-		}
-		if options["sections"] {
-			parser.PrintShdrs()
-			options["help"] = false
-		}
-		if options["segments"] {
-			parser.PrintPhdrs()
-			options["help"] = false
-		}
-
-		if options["symbols"] {
-			parser.PrintSyms()
-			options["help"] = false
+		parser, err := LoadData(reader)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s(%s): %v\n", path, member.name, err)
+			closer.Close()
+			continue
 		}
-		if options["help"] {
-			printUsage()
+		printParser(parser)
+		for _, err := range parser.Errors() {
+			fmt.Fprintf(os.Stderr, "%s(%s): %v\n", path, member.name, err)
 		}
+		closer.Close()
 	}
 	return nil
 }
 
+func printParser(parser *ElfParser) {
+	parser.demangle = options["demangle"]
+	if options["compat"] {
+		printGnu(parser)
+		return
+	}
+	if options["all"] {
+		parser.PrintEhdr()
+		parser.PrintShdrs()
+		parser.PrintPhdrs()
+		parser.PrintSyms()
+		options["help"] = false
+		return
+	}
+	if options["header"] {
+		parser.PrintEhdr()
+		options["help"] = false
+	}
+	if options["sections"] {
+		parser.PrintShdrs()
+		options["help"] = false
+	}
+	if options["segments"] {
+		parser.PrintPhdrs()
+		options["help"] = false
+	}
+
+	if options["symbols"] {
+		parser.PrintSyms()
+		options["help"] = false
+	}
+	if options["histogram"] {
+		parser.PrintHistogram()
+		options["help"] = false
+	}
+	if options["help"] {
+		printUsage()
+	}
+}
+
+/* prints the selected modes in the order and the exact format of GNU readelf */
+func printGnu(parser *ElfParser) {
+	all := options["all"]
+	f := GnuFormat{wide: options["wide"], header: all || options["header"], demangle: options["demangle"]}
+	if f.header {
+		parser.PrintGnuEhdr()
+	}
+	if all || options["sections"] {
+		parser.PrintGnuShdrs(f)
+	}
+	if all || options["segments"] {
+		parser.PrintGnuPhdrs(f)
+	}
+	if all || options["symbols"] {
+		parser.PrintGnuSyms(f)
+	}
+	if options["histogram"] {
+		parser.PrintHistogram()
+	}
+	if f.header || options["sections"] || options["segments"] || options["symbols"] || options["histogram"] {
+		options["help"] = false
+	}
+	if options["help"] {
+		printUsage()
+	}
+}
+
 func handleArgs(args []string) ([]string, error) {
 	paths := []string{}
 	for _, arg := range args {
@@ -98,27 +267,33 @@ func handleArgs(args []string) ([]string, error) {
 				options["sections"] = true
 			case "--symbols":
 				options["symbols"] = true
+			case "--histogram":
+				options["histogram"] = true
+			case "--archive-index", "--print-armap":
+				options["armap"] = true
+			case "--compat":
+				options["compat"] = true
+			case "--wide":
+				options["wide"] = true
+				options["compat"] = true
+			case "--demangle":
+				options["demangle"] = true
 			case "--help":
 				options["help"] = true
 			default:
-				return paths, fmt.Errorf("elfparser: unrecognized option: %s", arg)
+				return paths, usageError("elfparser: unrecognized option: %s", arg)
 			}
-		} else if strings.HasPrefix(arg, "-") {
-			switch arg {
-			case "-a":
-				options["all"] = true
-			case "-h":
-				options["header"] = true
-			case "-l":
-				options["segments"] = true
-			case "-S":
-				options["sections"] = true
-			case "-s":
-				options["symbols"] = true
-			case "-H":
-				options["help"] = true
-			default:
-				return paths, fmt.Errorf("elfparser: unrecognized option: %s", arg)
+		} else if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			for i := 1; i < len(arg); i++ {
+				option, ok := short_options[arg[i]]
+				if !ok {
+					return paths, usageError("elfparser: unrecognized option: %s", arg)
+				}
+				options[option] = true
+			}
+			// -W only has a meaning in the readelf layout
+			if options["wide"] {
+				options["compat"] = true
 			}
 		} else {
 			paths = append(paths, arg)
@@ -130,13 +305,79 @@ func handleArgs(args []string) ([]string, error) {
 
 func printUsage() {
 	var usage = `Usage: parser <option(s)> [executable]
-  Display information about the contents of ELF format files
+       parser <command> [args]
+  Display information about the contents of ELF format files and static archives
   Options are:
   -a --all          equivalent to: -h -l -S -s
   -h --file-header  Display the Elf file header
   -l --segments     Display the program headers
   -S --sections     Display the sections' header
   -s --symbols      Display the symbol table
-  -H --help         Display this information`
+  -I --histogram    Display histogram of bucket list lengths
+  -c --archive-index
+     --print-armap  Display the symbol/file index of an archive
+  -W --wide         Like --compat, one line per header and no names cut
+     --compat       Print -h, -l, -S and -s exactly like GNU readelf,
+                    including the section to segment mapping
+  -C --demangle     Decode C++ and Rust symbol names in -s and -c
+  -H --help         Display this information
+  Commands are:
+  checksec [--json] <file(s)>
+                    Report RELRO, stack canary, NX, PIE, RPATH/RUNPATH,
+                    FORTIFY_SOURCE, CET and symbol stripping
+  ldd [--tree|--list|--dot] [--sysroot dir] <file(s)>
+                    Resolve shared library dependencies like ld.so,
+                    without executing the file
+  symcheck [-v] [--sysroot dir] <file(s)>
+                    Check that every undefined dynamic symbol is provided
+                    by a dependency, and report interposed symbols
+  core [--exe file]... [--sysroot dir] <core(s)>
+                    Decode the notes of a core dump and print a symbolized
+                    backtrace per thread
+  go [--funcs] [--addr address]... [--json] <file(s)>
+                    Print the Go version, modules and build settings of Go
+                    binaries, list their functions or symbolize addresses
+  kmod [--versions] [--symvers Module.symvers] [--json] <module(s)>
+                    Print the .modinfo fields, struct module and signature of
+                    kernel modules as modinfo, check their symbol CRCs
+  bpf [--btf] [--ext] [-d|--disassemble] [-C|--demangle] [--json] <object(s)>
+                    List the programs and maps of eBPF objects, dump their BTF
+                    and .BTF.ext, disassemble them like llvm-objdump
+  layout [--memory|--file] [--svg file] [--html file] <file>
+                    Draw the PT_LOAD segments with the sections in them,
+                    padding and gaps, by address and by file offset
+  lint [--errors-only] <elf-file(s)>
+                    Check the structural invariants of the headers, segments,
+                    sections and symbol tables
+  objcopy [--add-section name=file] [-R|--remove-section name]
+          [--rename-section old=new[,flags]] [--update-section name=file]
+          [--set-section-flags name=flags] [--strip-all|--strip-debug]
+          [--strip-unneeded] [--only-keep-debug] [--add-gnu-debuglink file]
+          [--redefine-sym old=new] [-L|--localize-symbol name]
+          [-W|--weaken-symbol name] [-N|--strip-symbol name]
+          [--set-symbol-visibility name=default|hidden|protected|internal]
+          [-I|--input-target binary] [-B|--binary-architecture arch]
+          [-O|--output-target binary|ihex|srec] [--gap-fill byte]
+          <in> [out]
+                    Copy a file, editing its sections and symbols,
+                    converting raw data to and from ELF
+  patchelf [--set-interpreter path] [--set-rpath path] [--force-rpath]
+           [--remove-rpath] [--set-soname name] [--add-needed lib]
+           [--remove-needed lib] [--replace-needed old new]
+           [--print-interpreter|--print-rpath|--print-soname|--print-needed]
+           [--output file] <file>
+                    Edit the program interpreter and the dynamic section
+  scan [-j|--jobs n] [--json] <file(s)|dir(s)|image(s)>
+                    Find the ELF files in directory trees by their magic and
+                    print a line per file in walk order, parsing on n workers.
+                    OCI image layouts, docker save tarballs and .tar/.tar.gz
+                    files are read without extracting, whiteouts applied
+  shell <file>      Open a prompt to explore a file: sections, segments, syms,
+                    sym, hexdump, addr and find-bytes, completing section and
+                    symbol names with tab
+  strip [-s|--strip-all] [-g|--strip-debug] [--strip-unneeded]
+        [--only-keep-debug] [--add-gnu-debuglink file] [-o file] <file(s)>
+                    Remove the symbol table and debugging sections, or keep
+                    only them in a separate debug file`
 	fmt.Println(usage)
 }
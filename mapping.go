@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+/* the sections lying in one segment, a row of the section to segment mapping */
+type Elf64SegmentMapping struct {
+	idx      int
+	phdr     *Elf64ProgramHeader
+	sections []*Elf64SectionHeaderDesp
+}
+
+func (m Elf64SegmentMapping) String() string {
+	builder := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(builder, "   %02d     ", m.idx)
+	for _, desp := range m.sections {
+		fmt.Fprintf(builder, "%s ", strings.TrimRight(desp.name, "\x00"))
+	}
+	return builder.String()
+}
+
+/* computes the sections of every program header, by file offset and address */
+func (p *ElfParser) GetSegmentMapping() []*Elf64SegmentMapping {
+	if len(p.mapping) != 0 {
+		return p.mapping
+	}
+
+	shdrDesps := p.GetShdrs()
+	for i, phdr := range p.GetPhdrs() {
+		mapping := &Elf64SegmentMapping{idx: i, phdr: phdr}
+		for _, desp := range shdrDesps {
+			if desp.idx != 0 && sectionInSegment(desp.shdr, phdr) {
+				mapping.sections = append(mapping.sections, desp)
+			}
+		}
+		p.mapping = append(p.mapping, mapping)
+	}
+	return p.mapping
+}
+
+/* returns the sections of program header i */
+func (p *ElfParser) GetSegmentSections(i int) []*Elf64SectionHeaderDesp {
+	mapping := p.GetSegmentMapping()
+	if i < 0 || i >= len(mapping) {
+		return nil
+	}
+	return mapping[i].sections
+}
+
+/* returns the program headers containing section idx, usually a PT_LOAD and the more specific segments */
+func (p *ElfParser) GetSectionSegments(idx int) []*Elf64ProgramHeader {
+	phdrs := []*Elf64ProgramHeader{}
+	for _, mapping := range p.GetSegmentMapping() {
+		for _, desp := range mapping.sections {
+			if desp.idx == idx {
+				phdrs = append(phdrs, mapping.phdr)
+				break
+			}
+		}
+	}
+	return phdrs
+}
+
+/* reports whether the named section lies in a segment of type typ, as .data.rel.ro in PT_GNU_RELRO */
+func (p *ElfParser) InSegment(name string, typ Elf64_Word) bool {
+	for _, mapping := range p.GetSegmentMapping() {
+		if mapping.phdr.P_type != typ {
+			continue
+		}
+		for _, desp := range mapping.sections {
+			if strings.TrimRight(desp.name, "\x00") == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+reports whether a section lies in a segment by the rules of readelf's mapping
+(ELF_SECTION_IN_SEGMENT_STRICT): TLS sections only go into PT_TLS, PT_LOAD and
+PT_GNU_RELRO, non-alloc sections not into loaded segments, and the file offsets and
+addresses must both fall within the segment. A .tbss takes no room outside PT_TLS.
+*/
+func sectionInSegment(shdr *Elf64SectionHeader, phdr *Elf64ProgramHeader) bool {
+	tls := shdr.SH_flags&SHF_TLS != 0
+	alloc := shdr.SH_flags&SHF_ALLOC != 0
+	nobits := shdr.SH_type == SHT_NOBITS
+	typ := phdr.P_type
+
+	// .tbss outside the TLS segment is left out entirely
+	if tls && nobits && typ != PT_TLS {
+		return false
+	}
+	size := uint64(shdr.SH_size)
+	offset, filesz := uint64(shdr.SH_offset), uint64(phdr.P_filesz)
+	addr, memsz := uint64(shdr.SH_addr), uint64(phdr.P_memsz)
+	poffset, vaddr := uint64(phdr.P_offset), uint64(phdr.P_vaddr)
+
+	if tls && typ != PT_TLS && typ != PT_GNU_RELRO && typ != PT_LOAD {
+		return false
+	}
+	if !tls && (typ == PT_TLS || typ == PT_PHDR) {
+		return false
+	}
+	if !alloc {
+		switch {
+		case typ == PT_LOAD, typ == PT_DYNAMIC, typ == PT_GNU_EH_FRAME, typ == PT_GNU_STACK,
+			typ == PT_GNU_RELRO, typ == PT_GNU_SFRAME, typ >= PT_GNU_MBIND_LO && typ <= PT_GNU_MBIND_HI:
+			return false
+		}
+	}
+	// the subtractions wrap like the unsigned arithmetic of the macro
+	if !nobits && (offset < poffset || offset-poffset > filesz-1 || offset-poffset+size > filesz) {
+		return false
+	}
+	if alloc && (addr < vaddr || addr-vaddr > memsz-1 || addr-vaddr+size > memsz) {
+		return false
+	}
+	// empty sections at the very start or end of PT_DYNAMIC and PT_NOTE do not count
+	if (typ == PT_DYNAMIC || typ == PT_NOTE) && size == 0 && memsz != 0 {
+		inside := nobits || (offset > poffset && offset-poffset < filesz)
+		if !inside || (alloc && !(addr > vaddr && addr-vaddr < memsz)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSectionSegments(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		section  string
+		segments []Elf64_Word
+	}{
+		{"exec", ".note.ABI-tag", []Elf64_Word{PT_LOAD, PT_NOTE}},
+		{"exec", ".text", []Elf64_Word{PT_LOAD}},
+		{"exec", ".tdata", []Elf64_Word{PT_LOAD, PT_TLS}},
+		// .tbss shares its address with .data, only the TLS template holds it
+		{"exec", ".tbss", []Elf64_Word{PT_TLS}},
+		{"exec", ".data", []Elf64_Word{PT_LOAD}},
+		{"exec", ".bss", []Elf64_Word{PT_LOAD}},
+		{"exec", ".comment", []Elf64_Word{}},
+		{"shared", ".data.rel.ro", []Elf64_Word{PT_LOAD, PT_GNU_RELRO}},
+		{"shared", ".dynamic", []Elf64_Word{PT_LOAD, PT_DYNAMIC, PT_GNU_RELRO}},
+		{"shared", ".data", []Elf64_Word{PT_LOAD}},
+		{"relocatable", ".text", []Elf64_Word{}},
+	}
+
+	for _, test := range tests {
+		p, err := LoadData(bytes.NewReader(fixtures[test.fixture]()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx := -1
+		for _, desp := range p.GetShdrs() {
+			if strings.TrimRight(desp.name, "\x00") == test.section {
+				idx = desp.idx
+			}
+		}
+		if idx < 0 {
+			t.Fatalf("%s: no section %s", test.fixture, test.section)
+		}
+
+		got := []Elf64_Word{}
+		for _, phdr := range p.GetSectionSegments(idx) {
+			got = append(got, phdr.P_type)
+		}
+		if !reflect.DeepEqual(got, test.segments) {
+			t.Errorf("%s: %s is in segments %v, want %v", test.fixture, test.section, got, test.segments)
+		}
+
+		// the reverse lookup agrees
+		for i, phdr := range p.GetPhdrs() {
+			found := false
+			for _, desp := range p.GetSegmentSections(i) {
+				found = found || desp.idx == idx
+			}
+			if found && !p.InSegment(test.section, phdr.P_type) {
+				t.Errorf("%s: %s is in segment %d but not found by type", test.fixture, test.section, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/* the section operations of an objcopy run, applied in the order of the fields */
+type ObjcopyOptions struct {
+	remove    []string          /* section names, may be glob patterns */
+	rename    [][2]string       /* old, new[,flags] */
+	add       [][2]string       /* name, file */
+	update    [][2]string       /* name, file */
+	flags     map[string]string /* name => comma separated flags */
+	symbols   *SymbolEditOptions
+	strip     string /* --strip-all, --strip-debug, --strip-unneeded or --only-keep-debug */
+	debuglink string
+}
+
+/*
+computes sh_flags from objcopy flag names. Like GNU objcopy the flags are set, not added:
+a section is writable unless "readonly" is given, and only the structural flags are kept.
+"noload" turns the section into SHT_NOBITS and "contents" or "load" back into SHT_PROGBITS.
+*/
+func sectionFlags(s *ElfSection, spec string) (Elf64_XWord, Elf64_Word, error) {
+	flags := s.shdr.SH_flags & (SHF_INFO_LINK | SHF_LINK_ORDER | SHF_GROUP | SHF_TLS | SHF_COMPRESSED)
+	typ := s.shdr.SH_type
+	readonly := false
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "alloc":
+			flags |= SHF_ALLOC
+		case "code":
+			flags |= SHF_EXECINSTR
+		case "readonly", "rom":
+			readonly = true
+		case "merge":
+			flags |= SHF_MERGE
+		case "strings":
+			flags |= SHF_STRINGS
+		case "exclude":
+			flags |= SHF_EXCLUDE
+		case "noload":
+			typ = SHT_NOBITS
+		case "contents", "load":
+			if typ == SHT_NOBITS {
+				typ = SHT_PROGBITS
+			}
+		case "data", "debug", "share", "":
+		default:
+			return 0, 0, fmt.Errorf("error: unrecognized section flag `%s'", name)
+		}
+	}
+	if !readonly {
+		flags |= SHF_WRITE
+	}
+	return flags, typ, nil
+}
+
+func (e *ElfFile) setSectionFlags(s *ElfSection, spec string) error {
+	flags, typ, err := sectionFlags(s, spec)
+	if err != nil {
+		return err
+	}
+	if typ != s.shdr.SH_type {
+		if typ == SHT_NOBITS {
+			s.data = nil
+		} else {
+			s.data = make([]byte, s.shdr.SH_size)
+		}
+		e.repack = true
+	}
+	s.shdr.SH_flags = flags
+	s.shdr.SH_type = typ
+	return nil
+}
+
+func (e *ElfFile) Objcopy(opts *ObjcopyOptions) error {
+	for _, pattern := range opts.remove {
+		found := false
+		for _, s := range append([]*ElfSection{}, e.sections...) {
+			if ok, _ := filepath.Match(pattern, s.name); ok && s.shdr.SH_type != SHT_NULL {
+				if s == e.names {
+					return fmt.Errorf("error: cannot remove the section name string table %s", s.name)
+				}
+				e.RemoveSection(s)
+				found = true
+			}
+		}
+		if !found && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("error: section '%s' not found", pattern)
+		}
+	}
+	if err := e.stripSectionSymbols(e.removedSections()); err != nil {
+		return err
+	}
+
+	for _, rename := range opts.rename {
+		name, flags, hasFlags := strings.Cut(rename[1], ",")
+		s := e.Section(rename[0])
+		if s == nil {
+			return fmt.Errorf("error: section '%s' not found", rename[0])
+		}
+		e.RenameSection(s, name)
+		// the relocation sections are named after the section they apply to
+		for _, rel := range e.sections {
+			if rel.info == s && rel.shdr.SH_flags&SHF_INFO_LINK != 0 && strings.HasSuffix(rel.name, rename[0]) {
+				e.RenameSection(rel, strings.TrimSuffix(rel.name, rename[0])+name)
+			}
+		}
+		if hasFlags {
+			if err := e.setSectionFlags(s, flags); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, add := range opts.add {
+		if e.Section(add[0]) != nil {
+			return fmt.Errorf("error: section '%s' already exists", add[0])
+		}
+		data, err := os.ReadFile(add[1])
+		if err != nil {
+			return err
+		}
+		e.AddSection(NewElfSection(add[0], SHT_PROGBITS, 0, data))
+	}
+
+	for _, update := range opts.update {
+		s := e.Section(update[0])
+		if s == nil {
+			return fmt.Errorf("error: section '%s' not found", update[0])
+		}
+		if s.shdr.SH_type == SHT_NOBITS {
+			return fmt.Errorf("error: section '%s' has no contents to update", update[0])
+		}
+		data, err := os.ReadFile(update[1])
+		if err != nil {
+			return err
+		}
+		// allocated sections are tied to addresses, they can shrink but not grow
+		if s.shdr.SH_flags&SHF_ALLOC != 0 && len(data) > int(s.shdr.SH_size) {
+			return fmt.Errorf("error: allocated section '%s' cannot grow from %d to %d bytes", update[0], s.shdr.SH_size, len(data))
+		}
+		e.SetData(s, data)
+	}
+
+	for name, spec := range opts.flags {
+		s := e.Section(name)
+		if s == nil {
+			return fmt.Errorf("error: section '%s' not found", name)
+		}
+		if err := e.setSectionFlags(s, spec); err != nil {
+			return err
+		}
+	}
+
+	if opts.symbols != nil && !opts.symbols.empty() {
+		if err := e.EditSymbolsByName(opts.symbols); err != nil {
+			return err
+		}
+	}
+
+	switch opts.strip {
+	case "--strip-all":
+		if err := e.StripAll(); err != nil {
+			return err
+		}
+	case "--strip-debug":
+		if err := e.StripDebug(); err != nil {
+			return err
+		}
+	case "--strip-unneeded":
+		if err := e.StripUnneeded(); err != nil {
+			return err
+		}
+	case "--only-keep-debug":
+		e.OnlyKeepDebug()
+	}
+	if opts.debuglink != "" {
+		return e.AddDebuglink(opts.debuglink)
+	}
+	return nil
+}
+
+func runObjcopy(args []string) error {
+	opts := new(ObjcopyOptions)
+	opts.flags = map[string]string{}
+	opts.symbols = NewSymbolEditOptions()
+	paths := []string{}
+	input, output, machine := "elf", "elf", "i386:x86-64"
+	gap := byte(0)
+
+	pair := func(arg string, value string) ([2]string, error) {
+		k, v, ok := strings.Cut(value, "=")
+		if !ok || k == "" || v == "" {
+			return [2]string{}, usageError("elfparser: bad format for %s: %s", arg, value)
+		}
+		return [2]string{k, v}, nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg, value, inline := strings.Cut(args[i], "=")
+		if !strings.HasPrefix(arg, "--") {
+			arg, inline = args[i], false
+		}
+
+		switch arg {
+		case "--strip-all", "-S":
+			opts.strip = "--strip-all"
+			continue
+		case "--strip-debug", "-g":
+			opts.strip = "--strip-debug"
+			continue
+		case "--strip-unneeded", "--only-keep-debug":
+			opts.strip = arg
+			continue
+		case "-R", "--remove-section", "--add-section", "--rename-section", "--update-section",
+			"--set-section-flags", "--add-gnu-debuglink", "--redefine-sym", "-L", "--localize-symbol",
+			"-W", "--weaken-symbol", "-N", "--strip-symbol", "--set-symbol-visibility",
+			"-I", "--input-target", "-O", "--output-target", "-B", "--binary-architecture", "--gap-fill":
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+			continue
+		}
+
+		if !inline {
+			if i+1 >= len(args) {
+				return usageError("elfparser: option requires an argument: %s", arg)
+			}
+			i++
+			value = args[i]
+		}
+		switch arg {
+		case "-R", "--remove-section":
+			opts.remove = append(opts.remove, value)
+		case "--add-gnu-debuglink":
+			opts.debuglink = value
+		case "-L", "--localize-symbol":
+			opts.symbols.localize[value] = true
+		case "-W", "--weaken-symbol":
+			opts.symbols.weaken[value] = true
+		case "-N", "--strip-symbol":
+			opts.symbols.strip[value] = true
+		case "-I", "--input-target":
+			input = value
+		case "-O", "--output-target":
+			output = value
+		case "-B", "--binary-architecture":
+			machine = value
+		case "--gap-fill":
+			fill, err := strconv.ParseUint(value, 0, 8)
+			if err != nil {
+				return usageError("elfparser: bad --gap-fill value: %s", value)
+			}
+			gap = byte(fill)
+		default:
+			kv, err := pair(arg, value)
+			if err != nil {
+				return err
+			}
+			switch arg {
+			case "--add-section":
+				opts.add = append(opts.add, kv)
+			case "--rename-section":
+				opts.rename = append(opts.rename, kv)
+			case "--update-section":
+				opts.update = append(opts.update, kv)
+			case "--set-section-flags":
+				opts.flags[kv[0]] = kv[1]
+			case "--redefine-sym":
+				opts.symbols.redefine[kv[0]] = kv[1]
+			case "--set-symbol-visibility":
+				vis, ok := symbol_visibility[kv[1]]
+				if !ok {
+					return usageError("elfparser: unknown symbol visibility: %s", kv[1])
+				}
+				opts.symbols.visibility[kv[0]] = vis
+			}
+		}
+	}
+	if len(paths) == 0 || len(paths) > 2 {
+		return usageError("elfparser: objcopy takes an input and an optional output file")
+	}
+	// elf64-x86-64, elf64-big and the like all mean this file's own ELF flavour
+	if strings.HasPrefix(input, "elf") {
+		input = "elf"
+	}
+	if strings.HasPrefix(output, "elf") {
+		output = "elf"
+	}
+	if input != "elf" && input != "binary" {
+		return usageError("elfparser: unsupported input target: %s", input)
+	}
+	if output != "elf" && output != "binary" && output != "ihex" && output != "srec" {
+		return usageError("elfparser: unsupported output target: %s", output)
+	}
+	src, dst := paths[0], paths[len(paths)-1]
+
+	var e *ElfFile
+	perm := os.FileMode(0644)
+	if input == "binary" {
+		em, ok := binary_machine[machine]
+		if !ok {
+			return usageError("elfparser: unknown binary architecture: %s", machine)
+		}
+		order := binary.ByteOrder(binary.LittleEndian)
+		if em == EM_PPC64 || em == EM_S390 {
+			order = binary.BigEndian
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		e = NewBinaryObject(src, data, em, order)
+	} else {
+		file, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		perm = info.Mode().Perm()
+		parser, err := LoadData(file)
+		if err != nil {
+			return err
+		}
+		if e, err = NewElfFile(parser); err != nil {
+			return err
+		}
+	}
+	if err := e.Objcopy(opts); err != nil {
+		return fmt.Errorf("%s: %v", src, err)
+	}
+	if output == "elf" {
+		return e.WriteFile(dst, perm)
+	}
+
+	chunks, err := e.LoadImage()
+	if err != nil {
+		return fmt.Errorf("%s: %v", src, err)
+	}
+	buf := new(bytes.Buffer)
+	switch output {
+	case "binary":
+		err = WriteBinary(buf, chunks, gap)
+	case "ihex":
+		err = WriteIhex(buf, chunks, e.ehdr.E_entry)
+	case "srec":
+		err = WriteSrec(buf, dst, chunks, e.ehdr.E_entry)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", src, err)
+	}
+	return os.WriteFile(dst, buf.Bytes(), perm)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/* the symbols defined in a removed section go with it, the others keep their sections */
+func TestObjcopyRemoveSection(t *testing.T) {
+	e := loadElfFile(t, fixtureManySections(3).Bytes())
+	if err := e.Objcopy(&ObjcopyOptions{remove: []string{".text.function_001"}}); err != nil {
+		t.Fatal(err)
+	}
+	p := writeAndLoad(t, e)
+
+	names := []string{}
+	for _, desp := range p.GetSyms() {
+		names = append(names, strings.TrimRight(desp.name, "\x00"))
+	}
+	if want := []string{"", "many.c", "function_000", "function_002"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("symbols %q, want %q", names, want)
+	}
+	if got := symbolSection(t, p, "function_002"); got != ".text.function_002" {
+		t.Errorf("function_002 is in %q", got)
+	}
+	// sh_info is the index of the first global symbol
+	for _, desp := range p.GetShdrs() {
+		if desp.shdr.SH_type == SHT_SYMTAB && desp.shdr.SH_info != 2 {
+			t.Errorf(".symtab has sh_info %d, want 2", desp.shdr.SH_info)
+		}
+	}
+
+	// counter is defined in .data and used by a relocation in .rela.text
+	e = loadElfFile(t, fixtureRelocatable().Bytes())
+	err := e.Objcopy(&ObjcopyOptions{remove: []string{".data"}})
+	if err == nil || !strings.Contains(err.Error(), "counter") {
+		t.Errorf("removing a section whose symbol is relocated against returned %v", err)
+	}
+	// a section symbol is named after its section
+	f := fixtureRelocatable()
+	rela := f.section(".rela.text")
+	entry := binary.LittleEndian.AppendUint64(nil, 3)
+	entry = binary.LittleEndian.AppendUint64(entry, 3<<32|2)
+	entry = binary.LittleEndian.AppendUint64(entry, 0)
+	fill := rela.fill
+	rela.data = entry
+	rela.fill = func(f *fixture) []byte { fill(f); return entry }
+	e = loadElfFile(t, f.Bytes())
+	err = e.Objcopy(&ObjcopyOptions{remove: []string{".data"}})
+	if want := "error: not stripping symbol `.data' because it is named in a relocation"; err == nil || err.Error() != want {
+		t.Errorf("removing a section relocated against returned %v, want %q", err, want)
+	}
+}
+
+/* the relocations that are kept follow their symbols to the new indices */
+func TestObjcopyRemoveRelocatedSection(t *testing.T) {
+	e := loadElfFile(t, fixtureStrippable().Bytes())
+	if err := e.Objcopy(&ObjcopyOptions{remove: []string{".text"}}); err != nil {
+		t.Fatal(err)
+	}
+	p := writeAndLoad(t, e)
+
+	// .rela.text goes with .text, object_main and the section symbol of .text with their section
+	if got, want := sectionNames(p), []string{"", ".group", ".text.inline", ".data", ".bss", ".note.GNU-stack", ".symtab", ".strtab",
+		".debug_info", ".rela.debug_info", ".debug_str", ".debug_line", ".shstrtab"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sections %q, want %q", got, want)
+	}
+	want := []string{"", "object.c", "", "inline_helper", "counter", "helper", "shared_buffer"}
+	if got := symbolNames(p, SHT_SYMTAB); !reflect.DeepEqual(got, want) {
+		t.Errorf("symbols %q, want %q", got, want)
+	}
+	if got := relocationSymbols(t, p, ".rela.debug_info"); !reflect.DeepEqual(got, []string{"counter"}) {
+		t.Errorf(".rela.debug_info relocates against %q", got)
+	}
+	for _, desp := range p.GetShdrs() {
+		if desp.shdr.SH_type == SHT_GROUP && strings.TrimRight(p.GetSyms()[desp.shdr.SH_info].name, "\x00") != "inline_helper" {
+			t.Errorf(".group is named by symbol %d", desp.shdr.SH_info)
+		}
+	}
+}
+
+/*
+the load image holds the allocated sections at their load addresses, without the headers.
+The golden files are the output of GNU objcopy -O ihex and -O srec for the same files.
+*/
+func TestObjcopyLoadImage(t *testing.T) {
+	e := loadElfFile(t, fixtureExec(binary.LittleEndian, EM_X86_64, false).Bytes())
+	chunks, err := e.LoadImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := WriteSrec(out, "exec", chunks, e.ehdr.E_entry); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "exec.srec", out.Bytes())
+
+	// the data is stored in flash and copied to RAM at startup
+	for _, phdr := range e.phdrs {
+		if phdr.P_type == PT_LOAD && phdr.P_flags&PF_W != 0 {
+			phdr.P_paddr = 0x10000000
+		}
+	}
+	if chunks, err = e.LoadImage(); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := WriteIhex(out, chunks, e.ehdr.E_entry); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "exec.ihex", out.Bytes())
+}
+
+/* localizing a global moves it before the globals, the relocations and the group follow it */
+func TestObjcopyEditSymbols(t *testing.T) {
+	e := loadElfFile(t, fixtureRelocatable().Bytes())
+	opts := NewSymbolEditOptions()
+	opts.localize["counter"] = true
+	opts.strip["object_main"] = true
+	if err := e.Objcopy(&ObjcopyOptions{symbols: opts}); err != nil {
+		t.Fatal(err)
+	}
+	p := writeAndLoad(t, e)
+
+	want := []string{"", "object.c", "", "", "counter", "inline_helper", "helper", "shared_buffer"}
+	if got := symbolNames(p, SHT_SYMTAB); !reflect.DeepEqual(got, want) {
+		t.Errorf("symbols %q, want %q", got, want)
+	}
+	if got := relocationSymbols(t, p, ".rela.text"); !reflect.DeepEqual(got, []string{"counter", "helper"}) {
+		t.Errorf(".rela.text relocates against %q", got)
+	}
+	for _, desp := range p.GetShdrs() {
+		switch desp.shdr.SH_type {
+		case SHT_SYMTAB:
+			if desp.shdr.SH_info != 5 {
+				t.Errorf(".symtab has sh_info %d, want 5", desp.shdr.SH_info)
+			}
+		case SHT_GROUP:
+			if name := strings.TrimRight(p.GetSyms()[desp.shdr.SH_info].name, "\x00"); name != "inline_helper" {
+				t.Errorf(".group is named by %q", name)
+			}
+		}
+	}
+
+	e = loadElfFile(t, fixtureRelocatable().Bytes())
+	opts = NewSymbolEditOptions()
+	opts.strip["helper"] = true
+	err := e.Objcopy(&ObjcopyOptions{symbols: opts})
+	if want := "error: not stripping symbol `helper' because it is named in a relocation"; err == nil || err.Error() != want {
+		t.Errorf("stripping a relocated symbol returned %v, want %q", err, want)
+	}
+}
@@ -1,24 +1,45 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 )
 
+/* the parser reads from files on disk and from archive members alike */
+type ElfReader interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+/* limits on what a file can make the parser allocate, hostile files must not exhaust memory */
+const (
+	MAX_STRING_SIZE = 1 << 16 /* longest string read from a string table */
+	MAX_SYMBOLS     = 1 << 24 /* entries read from one symbol table */
+	MAX_NOTES       = 1 << 16 /* notes read from one segment or section */
+)
+
 type ElfParser struct {
-	file        *os.File
+	file        ElfReader
+	size        int64   /* the file size, every offset is checked against it */
+	errs        []error /* what could not be read, the getters skip it */
 	ehdr        *Elf64Header
 	phdrs       []*Elf64ProgramHeader
 	shdrDesps   []*Elf64SectionHeaderDesp
 	symbolDesps []*Elf64SymbolHeaderDesp
+	dynsymDesps []*Elf64SymbolHeaderDesp
+	dyns        []*Elf64Dyn
+	notes       []*Elf64NoteDesp
+	hashTab     *Elf64HashTable
+	gnuHashTab  *Elf64GnuHashTable
+	mapping     []*Elf64SegmentMapping
 	order       binary.ByteOrder
+	demangle    bool /* PrintSyms shows C++ and Rust names demangled */
 }
 
-func (p ElfParser) PrintEhdr() {
+func (p *ElfParser) PrintEhdr() {
 	fmt.Println(p.GetEhdr())
 }
 
@@ -27,12 +48,14 @@ func (p *ElfParser) GetEhdr() *Elf64Header {
 		return p.ehdr
 	}
 	header := new(Elf64Header)
-	read(p.order, p.file, 0, header)
+	if err := read(p.order, p.file, 0, header); err != nil {
+		p.fail("error: truncated ELF header")
+	}
 	p.ehdr = header
 	return header
 }
 
-func (p ElfParser) PrintPhdrs() {
+func (p *ElfParser) PrintPhdrs() {
 	fmt.Printf("\nElf file type is %s\n", e_type[p.ehdr.E_type])
 	fmt.Printf("Entry point 0x%x\n", p.ehdr.E_entry)
 	phdrs := p.GetPhdrs()
@@ -44,6 +67,15 @@ func (p ElfParser) PrintPhdrs() {
 	for _, phdr := range phdrs {
 		fmt.Println(phdr)
 	}
+
+	if len(phdrs) == 0 || len(p.GetShdrs()) == 0 {
+		return
+	}
+	fmt.Println("\n Section to Segment mapping:")
+	fmt.Println("  Segment Sections...")
+	for _, mapping := range p.GetSegmentMapping() {
+		fmt.Println(mapping)
+	}
 }
 
 func (p *ElfParser) GetPhdrs() []*Elf64ProgramHeader {
@@ -51,17 +83,34 @@ func (p *ElfParser) GetPhdrs() []*Elf64ProgramHeader {
 		return p.phdrs
 	}
 
-	for i := int64(0); i < int64(p.ehdr.E_phnum); i++ {
+	phnum := uint64(p.ehdr.E_phnum)
+	phentsize := uint64(p.ehdr.E_phentsize)
+	if phnum == 0 {
+		return p.phdrs
+	}
+	if phentsize < uint64(binary.Size(Elf64ProgramHeader{})) {
+		p.fail("error: e_phentsize %d is too small for a program header", phentsize)
+		return p.phdrs
+	}
+	if !p.inFile(uint64(p.ehdr.E_phoff), phnum*phentsize) {
+		p.fail("error: the program header table at 0x%x extends past the end of the file", p.ehdr.E_phoff)
+		return p.phdrs
+	}
+
+	for i := range phnum {
 		phdr := new(Elf64ProgramHeader)
-		pos := int64(p.ehdr.E_phoff) + int64(Elf64_Off(p.ehdr.E_phentsize))*i
-		read(p.order, p.file, pos, phdr)
+		pos := int64(uint64(p.ehdr.E_phoff) + phentsize*i)
+		if err := read(p.order, p.file, pos, phdr); err != nil {
+			p.fail("error: cannot read program header %d: %v", i, err)
+			break
+		}
 		p.phdrs = append(p.phdrs, phdr)
 	}
 
 	return p.phdrs
 }
 
-func (p ElfParser) PrintShdrs() {
+func (p *ElfParser) PrintShdrs() {
 	fmt.Printf("\nThere are %d section headers, starting at offset 0x%x:\n\n", p.ehdr.E_shnum, p.ehdr.E_shoff)
 
 	fmt.Println("Section Headers:")
@@ -70,7 +119,10 @@ func (p ElfParser) PrintShdrs() {
 
 	desps := p.GetShdrs()
 	for _, desp := range desps {
-		fmt.Println(desp)
+		// the names keep the NUL that ends them in the string table
+		shown := *desp
+		shown.name = strings.TrimRight(desp.name, "\x00")
+		fmt.Println(shown)
 	}
 }
 
@@ -79,35 +131,45 @@ func (p *ElfParser) GetShdrs() []*Elf64SectionHeaderDesp {
 		return p.shdrDesps
 	}
 
-	shnum := int64(p.ehdr.E_shnum)
-	shoff := int64(p.ehdr.E_shoff)
-	shentsize := int64(p.ehdr.E_shentsize)
-	shstrndx := int64(p.ehdr.E_shstrndx)
-
-	var shstrtaboffset int64
-	offset := shoff + shentsize*shstrndx
+	shnum := uint64(p.ehdr.E_shnum)
+	shoff := uint64(p.ehdr.E_shoff)
+	shentsize := uint64(p.ehdr.E_shentsize)
+	shstrndx := uint64(p.ehdr.E_shstrndx)
+	if shnum == 0 {
+		return p.shdrDesps
+	}
+	if shentsize < uint64(binary.Size(Elf64SectionHeader{})) {
+		p.fail("error: e_shentsize %d is too small for a section header", shentsize)
+		return p.shdrDesps
+	}
+	if !p.inFile(shoff, shnum*shentsize) {
+		p.fail("error: the section header table at 0x%x extends past the end of the file", shoff)
+		return p.shdrDesps
+	}
 
-	if shnum != 0 && shstrndx < shnum {
+	var shstrtab []byte
+	if shstrndx < shnum {
 		shdr := new(Elf64SectionHeader)
-		read(p.order, p.file, offset, shdr)
-		shstrtaboffset = int64(shdr.SH_offset)
+		if err := read(p.order, p.file, int64(shoff+shentsize*shstrndx), shdr); err == nil {
+			shstrtab = p.readTable(shdr)
+		}
 	}
 
 	for i := range shnum {
 		shdr := new(Elf64SectionHeader)
 		desp := new(Elf64SectionHeaderDesp)
 
-		pos := shoff + shentsize*i
-		read(p.order, p.file, pos, shdr)
+		pos := int64(shoff + shentsize*i)
+		if err := read(p.order, p.file, pos, shdr); err != nil {
+			p.fail("error: cannot read section header %d: %v", i, err)
+			break
+		}
 
 		desp.shdr = shdr
 		desp.idx = int(i)
 
 		// get string of sh_name
-		_, err := p.file.Seek(int64(shdr.SH_name)+shstrtaboffset, io.SeekStart)
-		check(err)
-		reader := bufio.NewReader(p.file)
-		desp.name, _ = reader.ReadString(0)
+		desp.name = tableString(shstrtab, uint64(shdr.SH_name))
 
 		p.shdrDesps = append(p.shdrDesps, desp)
 	}
@@ -115,12 +177,17 @@ func (p *ElfParser) GetShdrs() []*Elf64SectionHeaderDesp {
 	return p.shdrDesps
 }
 
-func (p ElfParser) PrintSyms() {
+func (p *ElfParser) PrintSyms() {
 	desps := p.GetSyms()
 	fmt.Printf("\nSymbol table '.symtab' contains %d entries:\n", len(desps))
 	fmt.Println("   Num:    Value          Size Type    Bind   Vis      Ndx Name")
 	for _, desp := range desps {
-		fmt.Println(desp)
+		shown := *desp
+		shown.name = strings.TrimRight(desp.name, "\x00")
+		if p.demangle {
+			shown.name = demangled(shown.name, true)
+		}
+		fmt.Println(shown)
 	}
 }
 
@@ -133,12 +200,11 @@ func (p *ElfParser) GetSyms() []*Elf64SymbolHeaderDesp {
 		p.GetShdrs()
 	}
 
-	var strtaboffset int64
-	var dynstroffset int64
+	var strtab, dynstr []byte
 	for _, shdrDesp := range p.shdrDesps {
 		shdr := shdrDesp.shdr
 		if shdr.SH_type == SHT_STRTAB && strings.Trim(shdrDesp.name, "\x00") == ".strtab" {
-			strtaboffset = int64(shdr.SH_offset)
+			strtab = p.readTable(shdr)
 			break
 		}
 	}
@@ -146,52 +212,47 @@ func (p *ElfParser) GetSyms() []*Elf64SymbolHeaderDesp {
 	for _, shdrDesp := range p.shdrDesps {
 		shdr := shdrDesp.shdr
 		if shdr.SH_type == SHT_STRTAB && strings.Trim(shdrDesp.name, "\x00") == ".dynstr" {
-			dynstroffset = int64(shdr.SH_offset)
+			dynstr = p.readTable(shdr)
 			break
 		}
 	}
 
+	symsize := uint64(binary.Size(Elf64SymbolHeader{}))
 	for _, shdrDesp := range p.shdrDesps {
 		shdr := shdrDesp.shdr
 		if shdr.SH_type != SHT_SYMTAB && shdr.SH_type != SHT_DYNSYM {
 			continue
 		}
+		if uint64(shdr.SH_entsize) < symsize {
+			p.fail("error: section %d has a bad sh_entsize of %d for a symbol table", shdrDesp.idx, shdr.SH_entsize)
+			continue
+		}
 
-		/*
-			// The code in the comments gets the same result of strtaboffset as the code in the loop at the beginning of this function, just calculated it again
-			strtabidx := int64(shdr.SH_link)
-			strtabshdroffset := int64(p.ehdr.E_shoff) + int64(p.ehdr.E_shentsize)*strtabidx
-			_, err := p.file.Seek(strtabshdroffset, io.SeekStart)
-			check(err)
-			tabshdr := new(Elf64SectionHeader)
-			read[Elf64SectionHeader](p.file, strtabshdroffset, tabshdr)
-			strtaboffset = int64(tabshdr.SH_offset)
-			fmt.Println(strtaboffset)
-		*/
-
-		symNum := int(shdr.SH_size) / int(shdr.SH_entsize)
-		for i := range symNum {
+		symNum := uint64(shdr.SH_size) / uint64(shdr.SH_entsize)
+		if symNum > MAX_SYMBOLS {
+			p.fail("error: section %d has too many symbols (%d)", shdrDesp.idx, symNum)
+			symNum = MAX_SYMBOLS
+		}
+		data := p.readBytes(int64(shdr.SH_offset), int64(symNum*uint64(shdr.SH_entsize)))
+		if data == nil {
+			continue
+		}
+
+		names := strtab
+		if shdr.SH_type == SHT_DYNSYM {
+			names = dynstr
+		}
+		for i := range int(symNum) {
 			symbol := new(Elf64SymbolHeader)
 			desp := new(Elf64SymbolHeaderDesp)
 
-			symoffset := int64(shdr.SH_offset) + int64(i)*int64(shdr.SH_entsize)
-			read(p.order, p.file, symoffset, symbol)
-
-			symnameoffset := int64(symbol.ST_name)
-			if shdr.SH_type == SHT_SYMTAB {
-				_, err := p.file.Seek(strtaboffset+symnameoffset, io.SeekStart)
-				check(err)
-			}
-
-			if shdr.SH_type == SHT_DYNSYM {
-				_, err := p.file.Seek(dynstroffset+symnameoffset, io.SeekStart)
-				check(err)
-			}
-			reader := bufio.NewReader(p.file)
-			desp.name, _ = reader.ReadString(0)
+			entry := data[uint64(i)*uint64(shdr.SH_entsize):]
+			binary.Read(bytes.NewReader(entry), p.order, symbol)
+			desp.name = tableString(names, uint64(symbol.ST_name))
 
 			desp.idx = i
 			desp.sym = symbol
+			desp.tab = shdrDesp
 
 			p.symbolDesps = append(p.symbolDesps, desp)
 		}
@@ -201,19 +262,285 @@ func (p *ElfParser) GetSyms() []*Elf64SymbolHeaderDesp {
 	return p.symbolDesps
 }
 
-func LoadData(file *os.File) (*ElfParser, error) {
+/* returns the symbols of the .dynsym section, indexed like .gnu.version */
+func (p *ElfParser) GetDynSyms() []*Elf64SymbolHeaderDesp {
+	if len(p.dynsymDesps) != 0 {
+		return p.dynsymDesps
+	}
+
+	for _, desp := range p.GetSyms() {
+		if desp.tab.shdr.SH_type == SHT_DYNSYM {
+			p.dynsymDesps = append(p.dynsymDesps, desp)
+		}
+	}
+	return p.dynsymDesps
+}
+
+func (p *ElfParser) GetDyns() []*Elf64Dyn {
+	if len(p.dyns) != 0 {
+		return p.dyns
+	}
+
+	var offset, size int64
+	for _, shdrDesp := range p.GetShdrs() {
+		shdr := shdrDesp.shdr
+		if shdr.SH_type == SHT_DYNAMIC {
+			offset = int64(shdr.SH_offset)
+			size = int64(shdr.SH_size)
+			break
+		}
+	}
+
+	// stripped section headers, fall back to the PT_DYNAMIC segment
+	if size == 0 {
+		for _, phdr := range p.GetPhdrs() {
+			if phdr.P_type == PT_DYNAMIC {
+				offset = int64(phdr.P_offset)
+				size = int64(phdr.P_filesz)
+				break
+			}
+		}
+	}
+
+	if !p.inFile(uint64(offset), uint64(size)) {
+		p.fail("error: the dynamic section at 0x%x extends past the end of the file", offset)
+		return p.dyns
+	}
+
+	entsize := int64(binary.Size(Elf64Dyn{}))
+	for i := int64(0); (i+1)*entsize <= size; i++ {
+		dyn := new(Elf64Dyn)
+		if err := read(p.order, p.file, offset+i*entsize, dyn); err != nil {
+			break
+		}
+		p.dyns = append(p.dyns, dyn)
+		if dyn.D_tag == DT_NULL {
+			break
+		}
+	}
+
+	return p.dyns
+}
+
+/* returns the value of the first dynamic entry with the given tag */
+func (p *ElfParser) GetDynVal(tag Elf64_SXWord) (Elf64_XWord, bool) {
+	for _, dyn := range p.GetDyns() {
+		if dyn.D_tag == tag {
+			return dyn.D_val, true
+		}
+	}
+	return 0, false
+}
+
+/* returns the strings of every dynamic entry with the given tag, e.g. DT_NEEDED */
+func (p *ElfParser) GetDynStrings(tag Elf64_SXWord) []string {
+	strs := []string{}
+	for _, dyn := range p.GetDyns() {
+		if dyn.D_tag == tag {
+			strs = append(strs, p.GetDynString(dyn.D_val))
+		}
+	}
+	return strs
+}
+
+/* reads a string from the dynamic string table (DT_STRTAB) */
+func (p *ElfParser) GetDynString(offset Elf64_XWord) string {
+	var tab int64 = -1
+	for _, shdrDesp := range p.GetShdrs() {
+		shdr := shdrDesp.shdr
+		if shdr.SH_type == SHT_STRTAB && strings.Trim(shdrDesp.name, "\x00") == ".dynstr" {
+			tab = int64(shdr.SH_offset)
+			break
+		}
+	}
+	if tab < 0 {
+		addr, ok := p.GetDynVal(DT_STRTAB)
+		if !ok {
+			return ""
+		}
+		if tab, ok = p.vaddrToOffset(Elf64_Addr(addr)); !ok {
+			return ""
+		}
+	}
+	return p.readString(tab + int64(offset))
+}
+
+/* returns the program interpreter named by PT_INTERP, or "" for static files */
+func (p *ElfParser) GetInterp() string {
+	for _, phdr := range p.GetPhdrs() {
+		if phdr.P_type == PT_INTERP {
+			return p.readString(int64(phdr.P_offset))
+		}
+	}
+	return ""
+}
+
+/* reads the notes from PT_NOTE segments, or from SHT_NOTE sections when there are no segments */
+func (p *ElfParser) GetNotes() []*Elf64NoteDesp {
+	if len(p.notes) != 0 {
+		return p.notes
+	}
+
+	for _, phdr := range p.GetPhdrs() {
+		if phdr.P_type == PT_NOTE {
+			p.notes = append(p.notes, p.readNotes(int64(phdr.P_offset), int64(phdr.P_filesz), int64(phdr.P_align))...)
+		}
+	}
+	if len(p.GetPhdrs()) == 0 {
+		for _, shdrDesp := range p.GetShdrs() {
+			shdr := shdrDesp.shdr
+			if shdr.SH_type == SHT_NOTE {
+				p.notes = append(p.notes, p.readNotes(int64(shdr.SH_offset), int64(shdr.SH_size), int64(shdr.SH_addralign))...)
+			}
+		}
+	}
+
+	return p.notes
+}
+
+func (p *ElfParser) readNotes(offset int64, size int64, align int64) []*Elf64NoteDesp {
+	// name and desc are padded to 4 bytes, except in 8-byte aligned notes such as .note.gnu.property
+	if align != 8 {
+		align = 4
+	}
+	notes := []*Elf64NoteDesp{}
+	if !p.inFile(uint64(offset), uint64(size)) {
+		p.fail("error: the notes at 0x%x extend past the end of the file", offset)
+		return notes
+	}
+	nhdrsize := int64(binary.Size(Elf64Nhdr{}))
+	pos := int64(0)
+	for pos+nhdrsize <= size && len(notes) < MAX_NOTES {
+		nhdr := new(Elf64Nhdr)
+		if err := read(p.order, p.file, offset+pos, nhdr); err != nil {
+			break
+		}
+
+		namepos := pos + nhdrsize
+		descpos := alignUp(namepos+int64(nhdr.N_namesz), align)
+		if descpos+int64(nhdr.N_descsz) > size {
+			break
+		}
+
+		desp := new(Elf64NoteDesp)
+		desp.typ = nhdr.N_type
+		desp.name = strings.Trim(string(p.readBytes(offset+namepos, int64(nhdr.N_namesz))), "\x00")
+		desp.desc = p.readBytes(offset+descpos, int64(nhdr.N_descsz))
+		pos = alignUp(descpos+int64(nhdr.N_descsz), align)
+
+		notes = append(notes, desp)
+	}
+	return notes
+}
+
+/* converts a virtual address to a file offset using the PT_LOAD segments */
+func (p *ElfParser) vaddrToOffset(addr Elf64_Addr) (int64, bool) {
+	for _, phdr := range p.GetPhdrs() {
+		if phdr.P_type != PT_LOAD {
+			continue
+		}
+		if addr >= phdr.P_vaddr && addr < phdr.P_vaddr+Elf64_Addr(phdr.P_filesz) {
+			return int64(phdr.P_offset) + int64(addr-phdr.P_vaddr), true
+		}
+	}
+	return 0, false
+}
+
+/* reports whether size bytes at offset lie within the file, without overflowing */
+func (p *ElfParser) inFile(offset uint64, size uint64) bool {
+	return offset <= uint64(p.size) && size <= uint64(p.size)-offset
+}
+
+/* records a problem found while reading, each message once */
+func (p *ElfParser) fail(format string, args ...any) {
+	err := fmt.Errorf(format, args...)
+	for _, e := range p.errs {
+		if e.Error() == err.Error() {
+			return
+		}
+	}
+	p.errs = append(p.errs, err)
+}
+
+/* returns the problems found so far, the getters skip what they cannot read instead of failing */
+func (p *ElfParser) Errors() []error {
+	return p.errs
+}
+
+/* reads a NUL terminated string of at most MAX_STRING_SIZE bytes, "" when offset is outside the file */
+func (p *ElfParser) readString(offset int64) string {
+	if offset < 0 || offset >= p.size {
+		return ""
+	}
+	buf := make([]byte, min(MAX_STRING_SIZE, p.size-offset))
+	n, _ := p.file.ReadAt(buf, offset)
+	return cString(buf[:n])
+}
+
+/* reads size bytes at offset, nil when they are not all in the file */
+func (p *ElfParser) readBytes(offset int64, size int64) []byte {
+	if offset < 0 || size < 0 || !p.inFile(uint64(offset), uint64(size)) {
+		p.fail("error: %d bytes at 0x%x extend past the end of the file", size, offset)
+		return nil
+	}
+	buf := make([]byte, size)
+	if _, err := p.file.ReadAt(buf, offset); err != nil {
+		p.fail("error: cannot read %d bytes at 0x%x: %v", size, offset, err)
+		return nil
+	}
+	return buf
+}
+
+/* reads the contents of a string table section */
+func (p *ElfParser) readTable(shdr *Elf64SectionHeader) []byte {
+	if shdr.SH_type == SHT_NOBITS {
+		return nil
+	}
+	return p.readBytes(int64(shdr.SH_offset), int64(shdr.SH_size))
+}
+
+/* returns the string at offset in a string table including its NUL, as the names are kept */
+func tableString(table []byte, offset uint64) string {
+	if offset >= uint64(len(table)) {
+		return ""
+	}
+	s := table[offset:]
+	if end := bytes.IndexByte(s, 0); end >= 0 {
+		s = s[:end+1]
+	}
+	return string(s)
+}
+
+func LoadData(file ElfReader) (*ElfParser, error) {
 	p := new(ElfParser)
 	p.file = file
 
 	if err := p.testElf(); err != nil {
 		return nil, err
 	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	p.size = size
 
 	p.GetEhdr()
+	if len(p.errs) != 0 {
+		return nil, p.errs[0]
+	}
 
 	return p, nil
 }
 
+/* reports whether the file starts with the ELF magic, of any class */
+func IsElf(file ElfReader) bool {
+	magic := make([]byte, SELFMAG)
+	if _, err := file.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return string(magic) == ELFMAG
+}
+
 func (p *ElfParser) testElf() error {
 	_, err := p.file.Seek(0, io.SeekStart)
 	if err != nil {
@@ -225,6 +552,10 @@ func (p *ElfParser) testElf() error {
 		return err
 	}
 
+	if string(ident[0:SARMAG]) == ARMAG || string(ident[0:SARMAG]) == THINMAG {
+		return fmt.Errorf("error: this is an archive, use LoadArchive")
+	}
+
 	if string(ident[0:SELFMAG]) != ELFMAG {
 		return fmt.Errorf("error: not an elf file - it has the wrong magic bytes at the start")
 	}
@@ -244,18 +575,18 @@ func (p *ElfParser) testElf() error {
 	return nil
 }
 
-func check(e error) {
-	if e != nil {
-		panic(e)
+func alignUp(v int64, align int64) int64 {
+	if align <= 1 {
+		return v
 	}
+	return (v + align - 1) / align * align
 }
 
-func read[T any](order binary.ByteOrder, file *os.File, pos int64, obj *T) *T {
-	_, err := file.Seek(pos, io.SeekStart)
-	check(err)
-	err = binary.Read(file, order, obj)
-	check(err)
-	return obj
+func read[T any](order binary.ByteOrder, file ElfReader, pos int64, obj *T) error {
+	if _, err := file.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Read(file, order, obj)
 }
 
 /* only work for .strtab, .shstrtab */
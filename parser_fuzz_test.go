@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+/* small valid files and damaged variants of them, hostile inputs start from these */
+func fuzzSeeds(f *testing.F) {
+	e := NewBinaryObject("seed.bin", []byte("fuzz seed data"), EM_X86_64, binary.LittleEndian)
+	obj, err := e.Bytes()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(obj)
+
+	big := NewBinaryObject("seed.bin", []byte("fuzz seed data"), EM_S390, binary.BigEndian)
+	if data, err := big.Bytes(); err == nil {
+		f.Add(data)
+	}
+
+	damage := func(edit func(data []byte)) {
+		data := append([]byte{}, obj...)
+		edit(data)
+		f.Add(data)
+	}
+	shoff := binary.LittleEndian.Uint64(obj[0x28:])
+	// symbol table entry size of 0
+	damage(func(data []byte) {
+		for i := uint64(1); shoff+64*i+64 <= uint64(len(data)); i++ {
+			if binary.LittleEndian.Uint32(data[shoff+64*i+4:]) == SHT_SYMTAB {
+				binary.LittleEndian.PutUint64(data[shoff+64*i+56:], 0)
+			}
+		}
+	})
+	// 65535 program headers far past the end of the file
+	damage(func(data []byte) {
+		binary.LittleEndian.PutUint64(data[0x20:], 0xfffffffffffff000)
+		binary.LittleEndian.PutUint16(data[0x36:], 56)
+		binary.LittleEndian.PutUint16(data[0x38:], 0xffff)
+	})
+	// section table offset that overflows when added to
+	damage(func(data []byte) {
+		binary.LittleEndian.PutUint64(data[0x28:], 0xffffffffffffffc0)
+	})
+	// huge section sizes
+	damage(func(data []byte) {
+		for i := uint64(1); shoff+64*i+64 <= uint64(len(data)); i++ {
+			binary.LittleEndian.PutUint64(data[shoff+64*i+32:], 1<<62)
+		}
+	})
+	f.Add(obj[:EI_NIDENT])
+	f.Add(obj[:len(obj)/2])
+	// a stripped Go binary, debug/gosym trusts the counts in its function table
+	f.Add(fixtureGo().Bytes())
+	// a kernel module, its signature trailer points back into the file
+	f.Add(append(fixtureModule().Bytes(), MODULE_SIG_MAGIC...))
+	// a BPF object with BTF and .BTF.ext
+	f.Add(fixtureBpf(binary.LittleEndian).Bytes())
+}
+
+func fuzzParser(t *testing.T, data []byte) *ElfParser {
+	p, err := LoadData(bytes.NewReader(data))
+	if err != nil {
+		t.Skip()
+	}
+	return p
+}
+
+func FuzzLoadData(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := fuzzParser(t, data)
+		p.GetDyns()
+		p.GetNotes()
+		p.GetVerdefs()
+		p.GetVerneeds()
+		p.GetVersyms()
+		p.GetHashTable()
+		p.GetGnuHashTable()
+		p.Lint()
+		p.GetGoInfo()
+		p.GetGoTable()
+		p.GetKernelModule()
+		p.GetBpfObject()
+	})
+}
+
+func FuzzGetShdrs(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := fuzzParser(t, data)
+		if shdrs := p.GetShdrs(); len(shdrs) > int(p.ehdr.E_shnum) {
+			t.Fatalf("%d section headers read, e_shnum is %d", len(shdrs), p.ehdr.E_shnum)
+		}
+	})
+}
+
+func FuzzGetPhdrs(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := fuzzParser(t, data)
+		if phdrs := p.GetPhdrs(); len(phdrs) > int(p.ehdr.E_phnum) {
+			t.Fatalf("%d program headers read, e_phnum is %d", len(phdrs), p.ehdr.E_phnum)
+		}
+	})
+}
+
+func FuzzGetSyms(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := fuzzParser(t, data)
+		// every symbol takes 24 bytes of the file
+		if syms := p.GetSyms(); len(syms)*24 > len(data) {
+			t.Fatalf("%d symbols read from %d bytes", len(syms), len(data))
+		}
+		p.GetDynSyms()
+	})
+}
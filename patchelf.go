@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+edits the program interpreter and the string entries of the dynamic section.
+Changes are collected in memory and written to the ElfFile by Apply, which moves
+.interp, .dynstr and .dynamic into a new segment when they no longer fit.
+*/
+type ElfPatcher struct {
+	file    *ElfFile
+	dynamic *ElfSection
+	dynstr  *ElfSection
+	dyns    []*Elf64Dyn /* without the terminating DT_NULL */
+	strtab  []byte
+	interp  *ElfSection
+	path    string /* the new interpreter, "" when unchanged */
+}
+
+func NewElfPatcher(e *ElfFile) (*ElfPatcher, error) {
+	p := new(ElfPatcher)
+	p.file = e
+
+	for _, phdr := range e.phdrs {
+		if phdr.P_type != PT_INTERP {
+			continue
+		}
+		for _, s := range e.sections {
+			if s.shdr.SH_type != SHT_NOBITS && s.shdr.SH_offset == phdr.P_offset && s.shdr.SH_size != 0 {
+				p.interp = s
+			}
+		}
+	}
+
+	for _, s := range e.sections {
+		if s.shdr.SH_type == SHT_DYNAMIC {
+			p.dynamic = s
+			p.dynstr = s.link
+			break
+		}
+	}
+	if p.dynamic == nil || p.dynstr == nil {
+		return p, nil
+	}
+
+	p.strtab = append([]byte{}, p.dynstr.data...)
+	for i := 0; i+16 <= len(p.dynamic.data); i += 16 {
+		dyn := new(Elf64Dyn)
+		dyn.D_tag = Elf64_SXWord(e.order.Uint64(p.dynamic.data[i:]))
+		dyn.D_val = Elf64_XWord(e.order.Uint64(p.dynamic.data[i+8:]))
+		if dyn.D_tag == DT_NULL {
+			break
+		}
+		p.dyns = append(p.dyns, dyn)
+	}
+	return p, nil
+}
+
+func (p *ElfPatcher) checkDynamic() error {
+	if p.dynamic == nil || p.dynstr == nil {
+		return fmt.Errorf("error: no .dynamic section, the file is statically linked")
+	}
+	return nil
+}
+
+func (p *ElfPatcher) Interp() string {
+	if p.path != "" {
+		return p.path
+	}
+	if p.interp == nil {
+		return ""
+	}
+	return cString(p.interp.data)
+}
+
+func (p *ElfPatcher) SetInterp(path string) error {
+	if p.interp == nil {
+		return fmt.Errorf("error: no .interp section, the file has no program interpreter")
+	}
+	p.path = path
+	return nil
+}
+
+/* returns the strings of the dynamic entries with the given tag, in order */
+func (p *ElfPatcher) Strings(tag Elf64_SXWord) []string {
+	strs := []string{}
+	for _, dyn := range p.dyns {
+		if dyn.D_tag == tag {
+			strs = append(strs, p.str(dyn.D_val))
+		}
+	}
+	return strs
+}
+
+func (p *ElfPatcher) str(offset Elf64_XWord) string {
+	if offset >= Elf64_XWord(len(p.strtab)) {
+		return ""
+	}
+	return cString(p.strtab[offset:])
+}
+
+/*
+returns the offset of s in .dynstr: an existing copy is reused, the string being replaced
+is overwritten when s fits and nothing else points into it, otherwise s is appended
+*/
+func (p *ElfPatcher) putString(s string, replace *Elf64Dyn) Elf64_XWord {
+	// the tail of a longer string is as good as a copy of its own
+	needle := append([]byte(s), 0)
+	if i := bytes.Index(p.strtab, needle); i >= 0 {
+		return Elf64_XWord(i)
+	}
+
+	if replace != nil && replace.D_val < Elf64_XWord(len(p.strtab)) {
+		old := p.str(replace.D_val)
+		if len(s) <= len(old) && !p.shared(replace, int(replace.D_val), len(old)) {
+			copy(p.strtab[replace.D_val:], needle)
+			clear(p.strtab[int(replace.D_val)+len(needle) : int(replace.D_val)+len(old)+1])
+			return replace.D_val
+		}
+	}
+
+	offset := Elf64_XWord(len(p.strtab))
+	p.strtab = append(p.strtab, needle...)
+	return offset
+}
+
+/* reports whether a dynamic symbol or another dynamic entry uses the string at [offset, offset+size] */
+func (p *ElfPatcher) shared(owner *Elf64Dyn, offset int, size int) bool {
+	refs := []int{}
+	for _, dyn := range p.dyns {
+		switch dyn.D_tag {
+		case DT_NEEDED, DT_SONAME, DT_RPATH, DT_RUNPATH, DT_AUXILIARY, DT_FILTER:
+			if dyn != owner {
+				refs = append(refs, int(dyn.D_val))
+			}
+		}
+	}
+	for _, s := range p.file.sections {
+		if s.shdr.SH_type == SHT_DYNSYM && s.link == p.dynstr {
+			for i := 0; i+24 <= len(s.data); i += 24 {
+				refs = append(refs, int(p.file.order.Uint32(s.data[i:])))
+			}
+		}
+	}
+
+	for _, ref := range refs {
+		if ref >= len(p.strtab) {
+			continue
+		}
+		end := ref + len(p.str(Elf64_XWord(ref)))
+		if ref <= offset+size && offset <= end {
+			return true
+		}
+	}
+	return false
+}
+
+/* sets the first entry with the given tag, adding it before DT_NULL when missing */
+func (p *ElfPatcher) setString(tag Elf64_SXWord, s string) {
+	for _, dyn := range p.dyns {
+		if dyn.D_tag == tag {
+			dyn.D_val = p.putString(s, dyn)
+			return
+		}
+	}
+	p.dyns = append(p.dyns, &Elf64Dyn{D_tag: tag, D_val: p.putString(s, nil)})
+}
+
+func (p *ElfPatcher) remove(match func(dyn *Elf64Dyn) bool) int {
+	dyns := []*Elf64Dyn{}
+	for _, dyn := range p.dyns {
+		if !match(dyn) {
+			dyns = append(dyns, dyn)
+		}
+	}
+	removed := len(p.dyns) - len(dyns)
+	p.dyns = dyns
+	return removed
+}
+
+/* sets DT_RUNPATH, or DT_RPATH when forced, and drops the other one */
+func (p *ElfPatcher) SetRunpath(path string, force bool) error {
+	if err := p.checkDynamic(); err != nil {
+		return err
+	}
+	tag, other := Elf64_SXWord(DT_RUNPATH), Elf64_SXWord(DT_RPATH)
+	if force {
+		tag, other = other, tag
+	}
+
+	// reuse the entry and string of the other tag so the old path can be overwritten in place
+	for _, dyn := range p.dyns {
+		if dyn.D_tag == other {
+			dyn.D_tag = tag
+		}
+	}
+	p.setString(tag, path)
+	p.remove(func(dyn *Elf64Dyn) bool { return dyn.D_tag == other })
+
+	seen := false
+	p.remove(func(dyn *Elf64Dyn) bool {
+		if dyn.D_tag != tag {
+			return false
+		}
+		dup := seen
+		seen = true
+		return dup
+	})
+	return nil
+}
+
+func (p *ElfPatcher) RemoveRunpath() error {
+	if err := p.checkDynamic(); err != nil {
+		return err
+	}
+	p.remove(func(dyn *Elf64Dyn) bool { return dyn.D_tag == DT_RPATH || dyn.D_tag == DT_RUNPATH })
+	return nil
+}
+
+func (p *ElfPatcher) SetSoname(soname string) error {
+	if err := p.checkDynamic(); err != nil {
+		return err
+	}
+	p.setString(DT_SONAME, soname)
+	return nil
+}
+
+/* adds DT_NEEDED entries after the existing ones, keeping the search order of the old dependencies */
+func (p *ElfPatcher) AddNeeded(lib string) error {
+	if err := p.checkDynamic(); err != nil {
+		return err
+	}
+	for _, name := range p.Strings(DT_NEEDED) {
+		if name == lib {
+			return nil
+		}
+	}
+
+	at := 0
+	for i, dyn := range p.dyns {
+		if dyn.D_tag == DT_NEEDED {
+			at = i + 1
+		}
+	}
+	dyn := &Elf64Dyn{D_tag: DT_NEEDED, D_val: p.putString(lib, nil)}
+	p.dyns = append(p.dyns[:at], append([]*Elf64Dyn{dyn}, p.dyns[at:]...)...)
+	return nil
+}
+
+func (p *ElfPatcher) RemoveNeeded(lib string) error {
+	if err := p.checkDynamic(); err != nil {
+		return err
+	}
+	if p.remove(func(dyn *Elf64Dyn) bool { return dyn.D_tag == DT_NEEDED && p.str(dyn.D_val) == lib }) == 0 {
+		return fmt.Errorf("error: %s is not a needed library", lib)
+	}
+	return nil
+}
+
+/* replaces a DT_NEEDED entry, the .gnu.version_r entry of the library is renamed along with it */
+func (p *ElfPatcher) ReplaceNeeded(old string, lib string) error {
+	if err := p.checkDynamic(); err != nil {
+		return err
+	}
+	for _, dyn := range p.dyns {
+		if dyn.D_tag != DT_NEEDED || p.str(dyn.D_val) != old {
+			continue
+		}
+		prev := dyn.D_val
+		dyn.D_val = p.putString(lib, dyn)
+		if dyn.D_val != prev {
+			p.renameVerneed(Elf64_Word(prev), Elf64_Word(dyn.D_val))
+		}
+		return nil
+	}
+	return fmt.Errorf("error: %s is not a needed library", old)
+}
+
+func (p *ElfPatcher) renameVerneed(prev Elf64_Word, offset Elf64_Word) {
+	order := p.file.order
+	for _, s := range p.file.sections {
+		if s.shdr.SH_type != SHT_GNU_verneed {
+			continue
+		}
+		data := append([]byte{}, s.data...)
+		for pos := 0; pos+16 <= len(data); {
+			if order.Uint32(data[pos+4:]) == uint32(prev) {
+				order.PutUint32(data[pos+4:], uint32(offset))
+			}
+			next := int(order.Uint32(data[pos+12:]))
+			if next == 0 {
+				break
+			}
+			pos += next
+		}
+		p.file.SetData(s, data)
+	}
+}
+
+/* writes the edits to the ElfFile, moving sections that grew into a new PT_LOAD segment */
+func (p *ElfPatcher) Apply() error {
+	moved := []*ElfSection{}
+
+	if p.path != "" {
+		data := make([]byte, max(int(p.interp.shdr.SH_size), len(p.path)+1))
+		copy(data, p.path)
+		if len(data) > int(p.interp.shdr.SH_size) {
+			moved = append(moved, p.interp)
+		}
+		p.interp.data = data
+		p.interp.shdr.SH_size = Elf64_XWord(len(data))
+		for _, phdr := range p.file.phdrs {
+			if phdr.P_type == PT_INTERP {
+				phdr.P_filesz = Elf64_XWord(len(data))
+				phdr.P_memsz = Elf64_XWord(len(data))
+			}
+		}
+	}
+
+	if p.dynamic != nil && p.dynstr != nil {
+		dynsize := (len(p.dyns) + 1) * 16
+		if len(p.strtab) > int(p.dynstr.shdr.SH_size) {
+			moved = append(moved, p.dynstr)
+		}
+		if dynsize > int(p.dynamic.shdr.SH_size) {
+			moved = append(moved, p.dynamic)
+		} else {
+			// shrinking leaves the unused entries as DT_NULL
+			dynsize = int(p.dynamic.shdr.SH_size)
+		}
+		p.dynstr.data = p.strtab
+		p.dynstr.shdr.SH_size = Elf64_XWord(len(p.strtab))
+		p.dynamic.data = make([]byte, dynsize)
+		p.dynamic.shdr.SH_size = Elf64_XWord(dynsize)
+	}
+
+	if len(moved) != 0 {
+		if err := p.file.MoveSections(moved...); err != nil {
+			return err
+		}
+	}
+
+	if p.dynamic != nil && p.dynstr != nil {
+		for _, dyn := range p.dyns {
+			switch dyn.D_tag {
+			case DT_STRTAB:
+				dyn.D_val = Elf64_XWord(p.dynstr.shdr.SH_addr)
+			case DT_STRSZ:
+				dyn.D_val = Elf64_XWord(len(p.strtab))
+			}
+		}
+		for i, dyn := range p.dyns {
+			p.file.order.PutUint64(p.dynamic.data[i*16:], uint64(dyn.D_tag))
+			p.file.order.PutUint64(p.dynamic.data[i*16+8:], uint64(dyn.D_val))
+		}
+	}
+	return nil
+}
+
+func runPatchelf(args []string) error {
+	type edit struct {
+		option string
+		values []string
+	}
+	edits := []edit{}
+	output := ""
+	force := false
+	paths := []string{}
+
+	nargs := map[string]int{
+		"--set-interpreter": 1, "--set-rpath": 1, "--set-soname": 1, "--add-needed": 1,
+		"--remove-needed": 1, "--replace-needed": 2, "--output": 1,
+		"--print-interpreter": 0, "--print-rpath": 0, "--print-soname": 0, "--print-needed": 0,
+		"--remove-rpath": 0,
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--force-rpath" {
+			force = true
+			continue
+		}
+		n, ok := nargs[arg]
+		if !ok {
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+			continue
+		}
+		if i+n >= len(args) {
+			return usageError("elfparser: option requires an argument: %s", arg)
+		}
+		if arg == "--output" {
+			output = args[i+1]
+		} else {
+			edits = append(edits, edit{arg, args[i+1 : i+1+n]})
+		}
+		i += n
+	}
+	if len(paths) != 1 {
+		return usageError("elfparser: patchelf takes exactly one file")
+	}
+	path := paths[0]
+	if output == "" {
+		output = path
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	parser, err := LoadData(file)
+	if err != nil {
+		return err
+	}
+	e, err := NewElfFile(parser)
+	if err != nil {
+		return err
+	}
+	p, err := NewElfPatcher(e)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, edit := range edits {
+		var err error
+		switch edit.option {
+		case "--print-interpreter":
+			if p.Interp() == "" {
+				return fmt.Errorf("error: no .interp section, the file has no program interpreter")
+			}
+			fmt.Println(p.Interp())
+		case "--print-rpath":
+			fmt.Println(strings.Join(append(p.Strings(DT_RPATH), p.Strings(DT_RUNPATH)...), ":"))
+		case "--print-soname":
+			fmt.Println(strings.Join(p.Strings(DT_SONAME), ""))
+		case "--print-needed":
+			for _, lib := range p.Strings(DT_NEEDED) {
+				fmt.Println(lib)
+			}
+		case "--set-interpreter":
+			err = p.SetInterp(edit.values[0])
+		case "--set-rpath":
+			err = p.SetRunpath(edit.values[0], force)
+		case "--remove-rpath":
+			err = p.RemoveRunpath()
+		case "--set-soname":
+			err = p.SetSoname(edit.values[0])
+		case "--add-needed":
+			err = p.AddNeeded(edit.values[0])
+		case "--remove-needed":
+			err = p.RemoveNeeded(edit.values[0])
+		case "--replace-needed":
+			err = p.ReplaceNeeded(edit.values[0], edit.values[1])
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		changed = changed || !strings.HasPrefix(edit.option, "--print-")
+	}
+
+	if !changed && output == path {
+		return nil
+	}
+	if err := p.Apply(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return e.WriteFile(output, info.Mode().Perm())
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/* an executable whose .bss reaches far past its file contents, as a new segment has to go after it */
+func fixturePatchable(typ Elf64_Half) *fixture {
+	f := fixtureDynamic(typ, fixtureLink{interp: "/lib64/ld-linux-x86-64.so.2", needed: []string{"libc.so.6"}, runpath: "/opt/lib"})
+	f.add(&fixtureSection{name: ".bss", typ: SHT_NOBITS, flags: SHF_ALLOC | SHF_WRITE, align: 32, size: 0x10000, load: 1})
+	return f
+}
+
+/* checks that a patched file can still be loaded: what the loader reads through the segments is where the sections are */
+func checkLoadable(t *testing.T, name string, p *ElfParser) {
+	t.Helper()
+	var loads []*Elf64ProgramHeader
+	var phdr *Elf64ProgramHeader
+	for _, ph := range p.GetPhdrs() {
+		switch ph.P_type {
+		case PT_LOAD:
+			if len(loads) != 0 && ph.P_vaddr < loads[len(loads)-1].P_vaddr {
+				t.Errorf("%s: PT_LOAD at 0x%x follows one at 0x%x", name, ph.P_vaddr, loads[len(loads)-1].P_vaddr)
+			}
+			loads = append(loads, ph)
+		case PT_PHDR:
+			phdr = ph
+		}
+	}
+	last, first := loads[len(loads)-1], loads[0]
+	if last.P_vaddr-Elf64_Addr(last.P_offset) != first.P_vaddr-Elf64_Addr(first.P_offset) {
+		t.Errorf("%s: the last PT_LOAD maps 0x%x at 0x%x, the first 0x%x at 0x%x", name,
+			last.P_offset, last.P_vaddr, first.P_offset, first.P_vaddr)
+	}
+
+	// the kernel finds the program headers through e_phoff and the first PT_LOAD, ld.so through PT_PHDR
+	if phdr == nil || phdr.P_offset != p.GetEhdr().E_phoff || phdr.P_vaddr != first.P_vaddr+Elf64_Addr(phdr.P_offset-first.P_offset) {
+		t.Fatalf("%s: PT_PHDR %+v does not match e_phoff 0x%x", name, phdr, p.GetEhdr().E_phoff)
+	}
+	covered := false
+	for _, load := range loads {
+		if phdr.P_vaddr >= load.P_vaddr && phdr.P_vaddr+Elf64_Addr(phdr.P_memsz) <= load.P_vaddr+Elf64_Addr(load.P_filesz) &&
+			phdr.P_vaddr-load.P_vaddr == Elf64_Addr(phdr.P_offset-load.P_offset) {
+			covered = true
+		}
+	}
+	if !covered {
+		t.Errorf("%s: no PT_LOAD maps the program headers at 0x%x", name, phdr.P_vaddr)
+	}
+
+	// PT_INTERP and PT_DYNAMIC name their sections, DT_STRTAB the loaded .dynstr
+	for _, ph := range p.GetPhdrs() {
+		section := map[Elf64_Word]string{PT_INTERP: ".interp", PT_DYNAMIC: ".dynamic"}[ph.P_type]
+		if section == "" {
+			continue
+		}
+		if _, shdr := sectionBytes(p, section); shdr.SH_offset != ph.P_offset || shdr.SH_addr != ph.P_vaddr || shdr.SH_size != ph.P_filesz {
+			t.Errorf("%s: segment %s at 0x%x, the section at 0x%x", name, p_type[ph.P_type], ph.P_vaddr, shdr.SH_addr)
+		}
+	}
+	_, dynstr := sectionBytes(p, ".dynstr")
+	if addr, _ := p.GetDynVal(DT_STRTAB); Elf64_Addr(addr) != dynstr.SH_addr {
+		t.Errorf("%s: DT_STRTAB 0x%x, .dynstr at 0x%x", name, addr, dynstr.SH_addr)
+	}
+	if offset, ok := p.vaddrToOffset(dynstr.SH_addr); !ok || offset != int64(dynstr.SH_offset) {
+		t.Errorf("%s: .dynstr at 0x%x is not loaded from its offset 0x%x", name, dynstr.SH_addr, dynstr.SH_offset)
+	}
+}
+
+func TestPatchelf(t *testing.T) {
+	interp := "/opt/toolchain/x86_64-linux-gnu/lib64/ld-linux-x86-64.so.2"
+	runpath := "/opt/toolchain/x86_64-linux-gnu/lib:$ORIGIN/../lib"
+	tests := []struct {
+		name    string
+		edit    func(p *ElfPatcher) error
+		interp  string
+		runpath []string
+		needed  []string
+	}{
+		{"set-interpreter", func(p *ElfPatcher) error { return p.SetInterp(interp) },
+			interp, []string{"/opt/lib"}, []string{"libc.so.6"}},
+		{"set-rpath", func(p *ElfPatcher) error { return p.SetRunpath(runpath, false) },
+			"/lib64/ld-linux-x86-64.so.2", []string{runpath}, []string{"libc.so.6"}},
+		{"add-needed", func(p *ElfPatcher) error { return p.AddNeeded("libfixture.so.1") },
+			"/lib64/ld-linux-x86-64.so.2", []string{"/opt/lib"}, []string{"libc.so.6", "libfixture.so.1"}},
+		{"replace-needed", func(p *ElfPatcher) error { return p.ReplaceNeeded("libc.so.6", "libc.musl-x86_64.so.1") },
+			"/lib64/ld-linux-x86-64.so.2", []string{"/opt/lib"}, []string{"libc.musl-x86_64.so.1"}},
+		{"all", func(p *ElfPatcher) error {
+			for _, err := range []error{p.SetInterp(interp), p.SetRunpath(runpath, false), p.AddNeeded("libfixture.so.1")} {
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}, interp, []string{runpath}, []string{"libc.so.6", "libfixture.so.1"}},
+	}
+	for _, typ := range []Elf64_Half{ET_EXEC, ET_DYN} {
+		for _, test := range tests {
+			name := test.name + " " + e_type[typ]
+			e := loadElfFile(t, fixturePatchable(typ).Bytes())
+			p, err := NewElfPatcher(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := test.edit(p); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if err := p.Apply(); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			out := writeAndLoad(t, e)
+			if got := out.GetInterp(); got != test.interp {
+				t.Errorf("%s: PT_INTERP %q, want %q", name, got, test.interp)
+			}
+			if got := out.GetDynStrings(DT_RUNPATH); !reflect.DeepEqual(got, test.runpath) {
+				t.Errorf("%s: DT_RUNPATH %q, want %q", name, got, test.runpath)
+			}
+			if got := out.GetDynStrings(DT_NEEDED); !reflect.DeepEqual(got, test.needed) {
+				t.Errorf("%s: DT_NEEDED %q, want %q", name, got, test.needed)
+			}
+			// every edit outgrows its section, which moves to a new segment
+			loads := 0
+			for _, ph := range out.GetPhdrs() {
+				if ph.P_type == PT_LOAD {
+					loads++
+				}
+			}
+			if loads != 3 {
+				t.Errorf("%s: %d PT_LOAD segments, want the new one", name, loads)
+			}
+			checkLoadable(t, name, out)
+		}
+	}
+}
+
+/* edits that fit where the strings were keep the layout, the command prints what it reads */
+func TestPatchelfCommand(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "exec")
+	if err := os.WriteFile(path, fixturePatchable(ET_EXEC).Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+	if err := runPatchelf([]string{"--set-interpreter", "/lib/ld.so", "--remove-rpath", path}); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.ReadFile(path)
+	if len(after) != len(before) {
+		t.Errorf("a shorter interpreter resized the file from %d to %d bytes", len(before), len(after))
+	}
+
+	out := captureStdout(t, func() {
+		if err := runPatchelf([]string{"--print-interpreter", "--print-rpath", "--print-needed", path}); err != nil {
+			t.Error(err)
+		}
+	})
+	if want := "/lib/ld.so\n\nlibc.so.6\n"; string(out) != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+	if err := runPatchelf([]string{"--replace-needed", "libm.so.6", "libmvec.so.1", path}); err == nil ||
+		!strings.Contains(err.Error(), "libm.so.6") {
+		t.Errorf("replacing a missing library returned %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+/* runs print with os.Stdout redirected to a pipe and returns what it wrote */
+func captureStdout(t *testing.T, print func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	// drain the pipe while printing, large outputs would fill its buffer
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- data
+	}()
+	print()
+	w.Close()
+	return <-out
+}
+
+func TestPrintGolden(t *testing.T) {
+	names := []string{}
+	for name := range fixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			data := fixtures[name]()
+			load := func() *ElfParser {
+				p, err := LoadData(bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p
+			}
+
+			checkGolden(t, name+".ehdr", captureStdout(t, load().PrintEhdr))
+			checkGolden(t, name+".shdrs", captureStdout(t, load().PrintShdrs))
+			checkGolden(t, name+".phdrs", captureStdout(t, load().PrintPhdrs))
+			checkGolden(t, name+".syms", captureStdout(t, load().PrintSyms))
+
+			// readelf -hSlsW, the files hold real readelf output for the fixtures
+			checkGolden(t, name+".readelf", captureStdout(t, func() {
+				p := load()
+				f := GnuFormat{wide: true, header: true}
+				p.PrintGnuEhdr()
+				p.PrintGnuShdrs(f)
+				p.PrintGnuPhdrs(f)
+				p.PrintGnuSyms(f)
+			}))
+
+			checkGolden(t, name+".layout", captureStdout(t, func() {
+				p := load()
+				PrintLayout(p.MemoryLayout(), 16)
+				PrintLayout(p.FileLayout(), 8)
+			}))
+		})
+	}
+}
+
+/* the fixtures must be well formed, or the golden files would pin down garbage */
+func TestFixturesLint(t *testing.T) {
+	for name, build := range fixtures {
+		p, err := LoadData(bytes.NewReader(build()))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, issue := range p.Lint() {
+			t.Errorf("%s: %s", name, issue)
+		}
+		for _, err := range p.Errors() {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+/* only a wrong command line is answered with the usage, not a file that cannot be read */
+func TestUsageErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	for name, command := range commands {
+		var usage *UsageError
+		if err := command([]string{"--no-such-option", missing}); !errors.As(err, &usage) {
+			t.Errorf("%s --no-such-option returned %v, want a usage error", name, err)
+		}
+		if err := command(nil); !errors.As(err, &usage) {
+			t.Errorf("%s without arguments returned %v, want a usage error", name, err)
+		}
+		captureStdout(t, func() {
+			if err := command([]string{missing}); errors.As(err, &usage) {
+				t.Errorf("%s on a missing file returned the usage error %v", name, err)
+			}
+		})
+	}
+	if _, err := handleArgs([]string{"-Z"}); err == nil || !errors.As(err, new(*UsageError)) {
+		t.Errorf("-Z returned %v, want a usage error", err)
+	}
+	if err := parseFiles([]string{missing}); err == nil || errors.As(err, new(*UsageError)) {
+		t.Errorf("a missing file returned %v, want the error alone", err)
+	}
+}
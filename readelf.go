@@ -0,0 +1,691 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+/*
+the layout of the GNU readelf compatible output (--compat). wide is -W, one line per
+header without cutting names. header is set when the file header is printed as well,
+readelf then leaves out the "There are N ..." lines in front of the tables.
+*/
+type GnuFormat struct {
+	wide     bool
+	header   bool
+	demangle bool /* readelf -C */
+}
+
+/* machine names as readelf prints them, others show as <unknown> */
+var gnu_machine = map[Elf64_Half]string{
+	EM_NONE:        "None",
+	EM_SPARC:       "Sparc",
+	EM_386:         "Intel 80386",
+	EM_68K:         "MC68000",
+	EM_IAMCU:       "Intel MCU",
+	EM_860:         "Intel 80860",
+	EM_MIPS:        "MIPS R3000",
+	EM_PARISC:      "HPPA",
+	EM_SPARC32PLUS: "Sparc v8+",
+	EM_PPC:         "PowerPC",
+	EM_PPC64:       "PowerPC64",
+	EM_S390:        "IBM S/390",
+	EM_SPU:         "SPU",
+	EM_ARM:         "ARM",
+	EM_SH:          "Renesas / SuperH SH",
+	EM_SPARCV9:     "Sparc v9",
+	EM_IA_64:       "Intel IA-64",
+	EM_X86_64:      "Advanced Micro Devices X86-64",
+	EM_VAX:         "Digital VAX",
+	EM_AVR:         "Atmel AVR 8-bit microcontroller",
+	EM_AARCH64:     "AArch64",
+	EM_AMDGPU:      "AMD GPU",
+	EM_RISCV:       "RISC-V",
+	EM_BPF:         "Linux BPF",
+	EM_CSKY:        "C-SKY",
+	EM_LOONGARCH:   "LoongArch",
+}
+
+var gnu_osabi = map[Elf_UChar]string{
+	ELFOSABI_NONE:    "UNIX - System V",
+	ELFOSABI_HPUX:    "UNIX - HP-UX",
+	ELFOSABI_NETBSD:  "UNIX - NetBSD",
+	ELFOSABI_GNU:     "UNIX - GNU",
+	ELFOSABI_SOLARIS: "UNIX - Solaris",
+	ELFOSABI_AIX:     "UNIX - AIX",
+	ELFOSABI_IRIX:    "UNIX - IRIX",
+	ELFOSABI_FREEBSD: "UNIX - FreeBSD",
+	ELFOSABI_TRU64:   "UNIX - TRU64",
+	ELFOSABI_MODESTO: "Novell - Modesto",
+	ELFOSABI_OPENBSD: "UNIX - OpenBSD",
+	13:               "VMS - OpenVMS",
+	14:               "HP - Non-Stop Kernel",
+	15:               "AROS",
+	16:               "FenixOS",
+	17:               "Nuxi CloudABI",
+	18:               "Stratus Technologies OpenVOS",
+}
+
+var gnu_segment_type = map[Elf64_Word]string{
+	PT_NULL:         "NULL",
+	PT_LOAD:         "LOAD",
+	PT_DYNAMIC:      "DYNAMIC",
+	PT_INTERP:       "INTERP",
+	PT_NOTE:         "NOTE",
+	PT_SHLIB:        "SHLIB",
+	PT_PHDR:         "PHDR",
+	PT_TLS:          "TLS",
+	PT_GNU_EH_FRAME: "GNU_EH_FRAME",
+	PT_GNU_STACK:    "GNU_STACK",
+	PT_GNU_RELRO:    "GNU_RELRO",
+	PT_GNU_PROPERTY: "GNU_PROPERTY",
+	PT_GNU_SFRAME:   "GNU_SFRAME",
+	0x65a3dbe5:      "OPENBSD_MUTABLE",
+	0x65a3dbe6:      "OPENBSD_RANDOMIZE",
+	0x65a3dbe7:      "OPENBSD_WXNEEDED",
+	0x65a41be6:      "OPENBSD_BOOTDATA",
+}
+
+var gnu_section_type = map[Elf64_Word]string{
+	SHT_NULL:           "NULL",
+	SHT_PROGBITS:       "PROGBITS",
+	SHT_SYMTAB:         "SYMTAB",
+	SHT_STRTAB:         "STRTAB",
+	SHT_RELA:           "RELA",
+	SHT_RELR:           "RELR",
+	SHT_HASH:           "HASH",
+	SHT_DYNAMIC:        "DYNAMIC",
+	SHT_NOTE:           "NOTE",
+	SHT_NOBITS:         "NOBITS",
+	SHT_REL:            "REL",
+	SHT_SHLIB:          "SHLIB",
+	SHT_DYNSYM:         "DYNSYM",
+	SHT_INIT_ARRAY:     "INIT_ARRAY",
+	SHT_FINI_ARRAY:     "FINI_ARRAY",
+	SHT_PREINIT_ARRAY:  "PREINIT_ARRAY",
+	SHT_GNU_HASH:       "GNU_HASH",
+	SHT_GROUP:          "GROUP",
+	SHT_SYMTAB_SHNDX:   "SYMTAB SECTION INDICES",
+	SHT_GNU_verdef:     "VERDEF",
+	SHT_GNU_verneed:    "VERNEED",
+	SHT_GNU_versym:     "VERSYM",
+	0x6ffffff0:         "VERSYM",
+	0x6ffffffc:         "VERDEF",
+	0x7ffffffd:         "AUXILIARY",
+	0x7fffffff:         "FILTER",
+	SHT_GNU_LIBLIST:    "GNU_LIBLIST",
+	SHT_GNU_ATTRIBUTES: "GNU_ATTRIBUTES",
+	0x6ffffff4:         "GNU_SFRAME",
+}
+
+/* section flag letters, in the order of the bits */
+var gnu_section_flag = map[Elf64_XWord]byte{
+	SHF_WRITE:            'W',
+	SHF_ALLOC:            'A',
+	SHF_EXECINSTR:        'X',
+	SHF_MERGE:            'M',
+	SHF_STRINGS:          'S',
+	SHF_INFO_LINK:        'I',
+	SHF_LINK_ORDER:       'L',
+	SHF_OS_NONCONFORMING: 'O',
+	SHF_GROUP:            'G',
+	SHF_TLS:              'T',
+	SHF_EXCLUDE:          'E',
+	SHF_COMPRESSED:       'C',
+}
+
+/*
+formats a name like readelf's print_symbol: a negative width pads the name to -width,
+a name longer than width is cut and ends in [...] unless wide. Control characters
+are shown as ^X.
+*/
+func gnuName(name string, width int, wide bool) string {
+	return gnuDemangledName(name, name, width, wide)
+}
+
+/* like gnuName for the demangled form of symbol, readelf -C still decides on the [...] by the length of symbol */
+func gnuDemangledName(symbol, name string, width int, wide bool) string {
+	pad := width < 0
+	if pad {
+		width = -width
+	}
+	if width == 0 {
+		return ""
+	}
+
+	remaining, dots := width, false
+	if wide {
+		remaining = math.MaxInt
+	} else if len(symbol) > width {
+		remaining, dots = max(width-5, 0), true
+	}
+
+	builder := new(strings.Builder)
+	printed := 0
+	for i := 0; i < len(name) && remaining > 0; i++ {
+		c := name[i]
+		if c < 0x20 || c == 0x7f {
+			if remaining < 2 {
+				break
+			}
+			builder.WriteByte('^')
+			builder.WriteByte(c + 0x40)
+			remaining -= 2
+			printed += 2
+			continue
+		}
+		builder.WriteByte(c)
+		remaining--
+		printed++
+	}
+	if dots {
+		builder.WriteString("[...]")
+		printed += 5
+	}
+	if pad && printed < width {
+		builder.WriteString(strings.Repeat(" ", width-printed))
+	}
+	return builder.String()
+}
+
+func (p *ElfParser) gnuFileType() string {
+	typ := p.ehdr.E_type
+	switch {
+	case typ == ET_DYN:
+		if flags, ok := p.GetDynVal(DT_FLAGS_1); ok && flags&DF_1_PIE != 0 {
+			return "DYN (Position-Independent Executable file)"
+		}
+		return "DYN (Shared object file)"
+	case typ < ET_NUM:
+		return e_type[typ]
+	case typ >= ET_LOPROC:
+		return fmt.Sprintf("Processor Specific: (%x)", typ)
+	case typ >= ET_LOOS && typ <= ET_HIOS:
+		return fmt.Sprintf("OS Specific: (%x)", typ)
+	}
+	return fmt.Sprintf("<unknown>: %x", typ)
+}
+
+func gnuMachineFlags(machine Elf64_Half, flags Elf64_Word) string {
+	s := ""
+	switch machine {
+	case EM_RISCV:
+		if flags&0x1 != 0 {
+			s += ", RVC"
+		}
+		if flags&0x8 != 0 {
+			s += ", RVE"
+		}
+		if flags&0x10 != 0 {
+			s += ", TSO"
+		}
+		s += []string{", soft-float ABI", ", single-float ABI", ", double-float ABI", ", quad-float ABI"}[flags>>1&3]
+	case EM_PPC64:
+		if flags&3 != 0 {
+			s += fmt.Sprintf(", abiv%d", flags&3)
+		}
+	case EM_S390:
+		if flags&1 != 0 {
+			s += ", highgprs"
+		}
+	}
+	return s
+}
+
+func gnuSegmentType(machine Elf64_Half, typ Elf64_Word) string {
+	if name, ok := gnu_segment_type[typ]; ok {
+		return name
+	}
+	switch {
+	case typ >= PT_LOPROC && typ <= PT_HIPROC:
+		switch {
+		case machine == EM_ARM && typ == 0x70000001:
+			return "EXIDX"
+		case machine == EM_AARCH64 && typ == 0x70000002:
+			return "AARCH64_MEMTAG_MTE"
+		case machine == EM_RISCV && typ == PT_RISCV_ATTRIBUTES:
+			return "RISCV_ATTRIBUTES"
+		}
+		return fmt.Sprintf("LOPROC+%#x", typ-PT_LOPROC)
+	case typ >= PT_GNU_MBIND_LO && typ <= PT_GNU_MBIND_HI:
+		return fmt.Sprintf("GNU_MBIND+%#x", typ-PT_GNU_MBIND_LO)
+	case typ >= PT_LOOS && typ <= PT_HIOS:
+		return fmt.Sprintf("LOOS+%#x", typ-PT_LOOS)
+	}
+	return fmt.Sprintf("<unknown>: %x", typ)
+}
+
+func gnuSectionType(machine Elf64_Half, typ Elf64_Word) string {
+	if name, ok := gnu_section_type[typ]; ok {
+		return name
+	}
+	switch {
+	case typ >= 0x70000000 && typ <= 0x7fffffff:
+		switch {
+		case machine == EM_X86_64 && typ == 0x70000001:
+			return "X86_64_UNWIND"
+		case machine == EM_RISCV && typ == 0x70000003:
+			return "RISCV_ATTRIBUTES"
+		case machine == EM_ARM && typ >= 0x70000001 && typ <= 0x70000005:
+			return []string{"ARM_EXIDX", "ARM_PREEMPTMAP", "ARM_ATTRIBUTES", "ARM_DEBUGOVERLAY", "ARM_OVERLAYSECTION"}[typ-0x70000001]
+		}
+		return fmt.Sprintf("LOPROC+%#x", typ-0x70000000)
+	case typ >= 0x60000000 && typ <= 0x6fffffff:
+		return fmt.Sprintf("LOOS+%#x", typ-0x60000000)
+	case typ >= 0x80000000:
+		return fmt.Sprintf("LOUSER+%#x", typ-0x80000000)
+	}
+	return fmt.Sprintf("<unknown>: %x", typ)
+}
+
+/* the flag letters of readelf -S, lowest bit first */
+func (p *ElfParser) gnuSectionFlags(flags Elf64_XWord) string {
+	osabi := p.ehdr.E_ident[EI_OSABI]
+	s := []byte{}
+	for flags != 0 {
+		flag := flags & -flags
+		flags &^= flag
+		if c, ok := gnu_section_flag[flag]; ok {
+			s = append(s, c)
+			continue
+		}
+		switch {
+		case p.ehdr.E_machine == EM_X86_64 && flag == SHF_X86_64_LARGE:
+			s = append(s, 'l')
+		case flag&SHF_MASKOS != 0:
+			gnu := osabi == ELFOSABI_GNU || osabi == ELFOSABI_FREEBSD
+			if gnu && flag == SHF_GNU_RETAIN {
+				s = append(s, 'R')
+			} else if (gnu || osabi == ELFOSABI_NONE) && flag == SHF_GNU_MBIND {
+				s = append(s, 'D')
+			} else {
+				s = append(s, 'o')
+				flags &^= SHF_MASKOS
+			}
+		case flag&SHF_MASKPROC != 0:
+			s = append(s, 'p')
+			flags &^= SHF_MASKPROC
+		default:
+			s = append(s, 'x')
+		}
+	}
+	return string(s)
+}
+
+func (p *ElfParser) gnuSymbolType(typ Elf_UChar) string {
+	osabi := p.ehdr.E_ident[EI_OSABI]
+	if name, ok := sym_type[typ]; ok {
+		return name
+	}
+	switch {
+	case typ >= STT_LOPROC:
+		return fmt.Sprintf("<processor specific>: %d", typ)
+	case typ == STT_GNU_IFUNC && (osabi == ELFOSABI_GNU || osabi == ELFOSABI_FREEBSD):
+		return "IFUNC"
+	case typ >= STT_LOOS:
+		return fmt.Sprintf("<OS specific>: %d", typ)
+	}
+	return fmt.Sprintf("<unknown>: %d", typ)
+}
+
+func (p *ElfParser) gnuSymbolBind(bind Elf_UChar) string {
+	if name, ok := sym_bind[bind]; ok {
+		return name
+	}
+	switch {
+	case bind >= STB_LOPROC:
+		return fmt.Sprintf("<processor specific>: %d", bind)
+	case bind == STB_GNU_UNIQUE && p.ehdr.E_ident[EI_OSABI] == ELFOSABI_GNU:
+		return "UNIQUE"
+	case bind >= STB_LOOS:
+		return fmt.Sprintf("<OS specific>: %d", bind)
+	}
+	return fmt.Sprintf("<unknown>: %d", bind)
+}
+
+func (p *ElfParser) gnuSymbolIndex(shndx Elf64_Half) string {
+	switch {
+	case shndx == SHN_UNDEF || shndx == SHN_ABS || shndx == SHN_COMMON:
+		return sym_idx[shndx]
+	case p.ehdr.E_machine == EM_X86_64 && shndx == SHN_X86_64_LCOMMON:
+		return "LARGE_COM"
+	case shndx >= SHN_LOPROC && shndx <= SHN_HIPROC:
+		return fmt.Sprintf("PRC[0x%04x]", shndx)
+	case shndx >= SHN_LOOS && shndx <= SHN_HIOS:
+		return fmt.Sprintf("OS [0x%04x]", shndx)
+	case shndx >= SHN_LORESERVE:
+		return fmt.Sprintf("RSV[0x%04x]", shndx)
+	case p.ehdr.E_shnum != 0 && shndx >= p.ehdr.E_shnum:
+		return fmt.Sprintf("bad section index[%3d]", shndx)
+	}
+	return fmt.Sprintf("%3d", shndx)
+}
+
+func (p *ElfParser) gnuSymbolOther(other Elf_UChar) string {
+	if other == 0x80 && (p.ehdr.E_machine == EM_AARCH64 || p.ehdr.E_machine == EM_RISCV) {
+		if p.ehdr.E_machine == EM_AARCH64 {
+			return "VARIANT_PCS"
+		}
+		return "VARIANT_CC"
+	}
+	return fmt.Sprintf("<other>: %x", other)
+}
+
+/* the file header of readelf -h */
+func (p *ElfParser) PrintGnuEhdr() {
+	ehdr := p.GetEhdr()
+	ident := ehdr.E_ident
+
+	fmt.Println("ELF Header:")
+	fmt.Print("  Magic:   ")
+	for _, b := range ident {
+		fmt.Printf("%02x ", b)
+	}
+	fmt.Println()
+
+	class := map[Elf_UChar]string{ELFCLASSNONE: "none", ELFCLASS32: "ELF32", ELFCLASS64: "ELF64"}[ident[EI_CLASS]]
+	if ident[EI_CLASS] > ELFCLASS64 {
+		class = fmt.Sprintf("<unknown: %x>", ident[EI_CLASS])
+	}
+	data := map[Elf_UChar]string{ELFDATANONE: "none", ELFDATA2LSB: "2's complement, little endian", ELFDATA2MSB: "2's complement, big endian"}[ident[EI_DATA]]
+	if ident[EI_DATA] > ELFDATA2MSB {
+		data = fmt.Sprintf("<unknown: %x>", ident[EI_DATA])
+	}
+	version := ""
+	if ident[EI_VERSION] == EV_CURRENT {
+		version = " (current)"
+	} else if ident[EI_VERSION] != EV_NONE {
+		version = " <unknown>"
+	}
+	osabi, ok := gnu_osabi[ident[EI_OSABI]]
+	if !ok && ehdr.E_machine == EM_ARM && ident[EI_OSABI] == ELFOSABI_ARM {
+		osabi, ok = "ARM", true
+	}
+	if !ok {
+		osabi = fmt.Sprintf("<unknown: %x>", ident[EI_OSABI])
+	}
+	machine, ok := gnu_machine[ehdr.E_machine]
+	if !ok {
+		machine = fmt.Sprintf("<unknown>: 0x%x", ehdr.E_machine)
+	}
+
+	fmt.Printf("  Class:                             %s\n", class)
+	fmt.Printf("  Data:                              %s\n", data)
+	fmt.Printf("  Version:                           %d%s\n", ident[EI_VERSION], version)
+	fmt.Printf("  OS/ABI:                            %s\n", osabi)
+	fmt.Printf("  ABI Version:                       %d\n", ident[EI_ABIVERSION])
+	fmt.Printf("  Type:                              %s\n", p.gnuFileType())
+	fmt.Printf("  Machine:                           %s\n", machine)
+	fmt.Printf("  Version:                           0x%x\n", ehdr.E_version)
+	fmt.Printf("  Entry point address:               0x%x\n", ehdr.E_entry)
+	fmt.Printf("  Start of program headers:          %d (bytes into file)\n", ehdr.E_phoff)
+	fmt.Printf("  Start of section headers:          %d (bytes into file)\n", ehdr.E_shoff)
+	fmt.Printf("  Flags:                             0x%x%s\n", ehdr.E_flags, gnuMachineFlags(ehdr.E_machine, ehdr.E_flags))
+	fmt.Printf("  Size of this header:               %d (bytes)\n", ehdr.E_ehsize)
+	fmt.Printf("  Size of program headers:           %d (bytes)\n", ehdr.E_phentsize)
+	fmt.Printf("  Number of program headers:         %d\n", ehdr.E_phnum)
+	fmt.Printf("  Size of section headers:           %d (bytes)\n", ehdr.E_shentsize)
+	fmt.Printf("  Number of section headers:         %d\n", ehdr.E_shnum)
+	fmt.Printf("  Section header string table index: %d", ehdr.E_shstrndx)
+	if ehdr.E_shstrndx != SHN_UNDEF && ehdr.E_shstrndx >= ehdr.E_shnum {
+		fmt.Print(" <corrupt: out of range>")
+	}
+	fmt.Println()
+}
+
+/* the section headers of readelf -S, followed by the key to the flags */
+func (p *ElfParser) PrintGnuShdrs(f GnuFormat) {
+	ehdr := p.ehdr
+	if ehdr.E_shnum == 0 {
+		if ehdr.E_shoff == 0 {
+			fmt.Println("\nThere are no sections in this file.")
+		}
+		return
+	}
+	if !f.header {
+		plural := "There are %d section headers"
+		if ehdr.E_shnum == 1 {
+			plural = "There is %d section header"
+		}
+		fmt.Printf(plural+", starting at offset 0x%x:\n", ehdr.E_shnum, ehdr.E_shoff)
+	}
+
+	if ehdr.E_shnum > 1 {
+		fmt.Println("\nSection Headers:")
+	} else {
+		fmt.Println("\nSection Header:")
+	}
+	if f.wide {
+		fmt.Println("  [Nr] Name              Type            Address          Off    Size   ES Flg Lk Inf Al")
+	} else {
+		fmt.Println("  [Nr] Name              Type             Address           Offset")
+		fmt.Println("       Size              EntSize          Flags  Link  Info  Align")
+	}
+
+	for _, desp := range p.GetShdrs() {
+		shdr := desp.shdr
+		name := gnuName(strings.TrimRight(desp.name, "\x00"), -17, f.wide)
+		typ := gnuSectionType(ehdr.E_machine, shdr.SH_type)
+		flags := p.gnuSectionFlags(shdr.SH_flags)
+		if f.wide {
+			fmt.Printf("  [%2d] %s %-15s %016x %06x %06x %02x %3s %2d %3d %2d\n", desp.idx, name, typ,
+				shdr.SH_addr, shdr.SH_offset, shdr.SH_size, shdr.SH_entsize, flags, shdr.SH_link, shdr.SH_info, shdr.SH_addralign)
+			continue
+		}
+		if len(typ) > 15 {
+			typ = typ[:15]
+		}
+		fmt.Printf("  [%2d] %s %-15s  %016x  %08x\n", desp.idx, name, typ, shdr.SH_addr, shdr.SH_offset)
+		fmt.Printf("       %016x  %016x %3s      %2d   %3d     %d\n", shdr.SH_size, shdr.SH_entsize, flags, shdr.SH_link, shdr.SH_info, shdr.SH_addralign)
+	}
+
+	osabi := ehdr.E_ident[EI_OSABI]
+	fmt.Print(`Key to Flags:
+  W (write), A (alloc), X (execute), M (merge), S (strings), I (info),
+  L (link order), O (extra OS processing required), G (group), T (TLS),
+  C (compressed), x (unknown), o (OS specific), E (exclude),
+  `)
+	if osabi == ELFOSABI_GNU || osabi == ELFOSABI_FREEBSD {
+		fmt.Print("R (retain), ")
+	}
+	if osabi == ELFOSABI_GNU || osabi == ELFOSABI_FREEBSD || osabi == ELFOSABI_NONE {
+		fmt.Print("D (mbind), ")
+	}
+	if ehdr.E_machine == EM_X86_64 {
+		fmt.Print("l (large), ")
+	}
+	fmt.Println("p (processor specific)")
+}
+
+/* the program headers of readelf -l, followed by the section to segment mapping */
+func (p *ElfParser) PrintGnuPhdrs(f GnuFormat) {
+	ehdr := p.ehdr
+	if ehdr.E_phnum == 0 {
+		if ehdr.E_phoff == 0 {
+			fmt.Println("\nThere are no program headers in this file.")
+		}
+		return
+	}
+	if !f.header {
+		fmt.Printf("\nElf file type is %s\n", p.gnuFileType())
+		fmt.Printf("Entry point 0x%x\n", ehdr.E_entry)
+		plural := "There are %d program headers"
+		if ehdr.E_phnum == 1 {
+			plural = "There is %d program header"
+		}
+		fmt.Printf(plural+", starting at offset %d\n", ehdr.E_phnum, ehdr.E_phoff)
+	}
+
+	fmt.Println("\nProgram Headers:")
+	if f.wide {
+		fmt.Println("  Type           Offset   VirtAddr           PhysAddr           FileSiz  MemSiz   Flg Align")
+	} else {
+		fmt.Println("  Type           Offset             VirtAddr           PhysAddr")
+		fmt.Println("                 FileSiz            MemSiz              Flags  Align")
+	}
+
+	phdrs := p.GetPhdrs()
+	for _, phdr := range phdrs {
+		typ := gnuSegmentType(ehdr.E_machine, phdr.P_type)
+		if len(typ) > 14 {
+			typ = typ[:14]
+		}
+		flags := []byte("   ")
+		if phdr.P_flags&PF_R != 0 {
+			flags[0] = 'R'
+		}
+		if phdr.P_flags&PF_W != 0 {
+			flags[1] = 'W'
+		}
+		if phdr.P_flags&PF_X != 0 {
+			flags[2] = 'E'
+		}
+
+		if f.wide {
+			// printf's %#lx, which prints 0 without the prefix
+			align := "0"
+			if phdr.P_align != 0 {
+				align = fmt.Sprintf("0x%x", phdr.P_align)
+			}
+			fmt.Printf("  %-14s 0x%06x 0x%016x 0x%016x 0x%06x 0x%06x %s %s\n", typ, phdr.P_offset,
+				phdr.P_vaddr, phdr.P_paddr, phdr.P_filesz, phdr.P_memsz, flags, align)
+		} else {
+			fmt.Printf("  %-14s 0x%016x 0x%016x 0x%016x\n", typ, phdr.P_offset, phdr.P_vaddr, phdr.P_paddr)
+			fmt.Printf("                 0x%016x 0x%016x  %s    0x%x\n", phdr.P_filesz, phdr.P_memsz, flags, phdr.P_align)
+		}
+		if phdr.P_type == PT_INTERP {
+			fmt.Printf("      [Requesting program interpreter: %s]\n", p.readString(int64(phdr.P_offset)))
+		}
+	}
+
+	if len(p.GetShdrs()) == 0 {
+		return
+	}
+	fmt.Println("\n Section to Segment mapping:")
+	fmt.Println("  Segment Sections...")
+	for _, mapping := range p.GetSegmentMapping() {
+		fmt.Printf("   %02d     ", mapping.idx)
+		for _, desp := range mapping.sections {
+			fmt.Printf("%s ", gnuName(strings.TrimRight(desp.name, "\x00"), math.MaxInt32, true))
+		}
+		fmt.Println()
+	}
+}
+
+/* the .gnu.version information readelf appends to a dynamic symbol name */
+type gnuVersions struct {
+	versyms  []Elf64_Half
+	verdefs  []*Elf64VerdefDesp
+	verneeds []*Elf64VerneedDesp
+}
+
+/* returns the version name of dynamic symbol idx and how it is attached: "@", "@@" or " (n)" for a needed version */
+func (v *gnuVersions) lookup(idx int, sym *Elf64SymbolHeader) (string, string) {
+	if idx >= len(v.versyms) || v.versyms[idx] == 0 {
+		return "", ""
+	}
+	data := v.versyms[idx]
+
+	if sym.ST_shndx != SHN_UNDEF && data != 0x8001 && len(v.verdefs) != 0 {
+		for _, verdef := range v.verdefs {
+			if verdef.ndx != data&VERSYM_VERSION {
+				continue
+			}
+			if verdef.ndx == 1 && verdef.flags == VER_FLG_BASE {
+				return "", ""
+			}
+			if len(verdef.names) != 0 {
+				if data&VERSYM_HIDDEN != 0 {
+					return verdef.names[0], "@"
+				}
+				return verdef.names[0], "@@"
+			}
+			break
+		}
+	}
+	for _, verneed := range v.verneeds {
+		if verneed.ndx == data {
+			return verneed.name, fmt.Sprintf(" (%d)", verneed.ndx)
+		}
+	}
+	return "", ""
+}
+
+/* the symbol tables of readelf -s, .dynsym symbols with their versions */
+func (p *ElfParser) PrintGnuSyms(f GnuFormat) {
+	versions := &gnuVersions{versyms: p.GetVersyms(), verdefs: p.GetVerdefs(), verneeds: p.GetVerneeds()}
+	desps := p.GetShdrs()
+	syms := p.GetSyms()
+
+	for _, tab := range desps {
+		if tab.shdr.SH_type != SHT_SYMTAB && tab.shdr.SH_type != SHT_DYNSYM {
+			continue
+		}
+		if tab.shdr.SH_entsize == 0 {
+			fmt.Printf("\nSymbol table '%s' has a sh_entsize of zero!\n", strings.TrimRight(tab.name, "\x00"))
+			continue
+		}
+		count := uint64(tab.shdr.SH_size / tab.shdr.SH_entsize)
+		plural := "entries"
+		if count == 1 {
+			plural = "entry"
+		}
+		fmt.Printf("\nSymbol table '%s' contains %d %s:\n", strings.TrimRight(tab.name, "\x00"), count, plural)
+		fmt.Println("   Num:    Value          Size Type    Bind   Vis      Ndx Name")
+
+		for _, desp := range syms {
+			if desp.tab != tab {
+				continue
+			}
+			sym := desp.sym
+			size := fmt.Sprintf("%5d", sym.ST_size)
+			if sym.ST_size > 99999 {
+				size = fmt.Sprintf("0x%x", sym.ST_size)
+			}
+			vis := sym.ST_other & 0x3
+			fmt.Printf("%6d: %016x %s %-7s %-6s %-7s", desp.idx, sym.ST_value, size,
+				p.gnuSymbolType(sym.ST_info&0xf), p.gnuSymbolBind(sym.ST_info>>4), sym_vis[vis])
+			if sym.ST_other != vis {
+				fmt.Printf(" [%s] ", p.gnuSymbolOther(sym.ST_other^vis))
+			}
+			fmt.Printf(" %4s ", p.gnuSymbolIndex(sym.ST_shndx))
+
+			name := strings.TrimRight(desp.name, "\x00")
+			if sym.ST_info&0xf == STT_SECTION && sym.ST_name == 0 && int(sym.ST_shndx) < len(desps) {
+				name = strings.TrimRight(desps[sym.ST_shndx].name, "\x00")
+			}
+			shown := name
+			if f.demangle {
+				shown = demangled(name, false)
+			}
+
+			version, attach := "", ""
+			if tab.shdr.SH_type == SHT_DYNSYM {
+				version, attach = versions.lookup(desp.idx, sym)
+			}
+			// the symbol naming a version definition is shown without it
+			if version == name && (attach == "@" || attach == "@@") {
+				version = ""
+			}
+			width := 21
+			if !f.wide && version != "" {
+				width -= 1 + len(version)
+				if attach == "@@" {
+					width--
+				} else if attach != "@" {
+					width -= len(attach)
+				}
+			}
+			fmt.Print(gnuDemangledName(name, shown, width, f.wide))
+			if version != "" {
+				if attach == "@" || attach == "@@" {
+					fmt.Printf("%s%s", attach, version)
+				} else {
+					fmt.Printf("@%s%s", version, attach)
+				}
+			}
+			fmt.Println()
+		}
+	}
+}
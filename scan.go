@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+/* what scan reports about one ELF file, Errors holds why it could not be read or what the parser skipped */
+type ScanResult struct {
+	Path     string   `json:"path"`
+	Type     string   `json:"type,omitempty"`
+	Machine  string   `json:"machine,omitempty"`
+	Interp   string   `json:"interpreter,omitempty"`
+	Soname   string   `json:"soname,omitempty"`
+	Needed   []string `json:"needed,omitempty"`
+	BuildID  string   `json:"build_id,omitempty"`
+	Go       bool     `json:"go"`
+	Stripped bool     `json:"stripped"`
+	Errors   []string `json:"errors,omitempty"`
+	failed   bool     /* the file is not in the output, only its errors */
+}
+
+/* a file or image found by the walk and where its results go, they are printed in the order of the jobs */
+type scanJob struct {
+	path   string
+	image  bool
+	result chan []*ScanResult
+}
+
+/* the jobs a walk can run ahead of the output, bounds the memory held by a slow file */
+const SCAN_BACKLOG = 1024
+
+/* one line like file(1): path: PIE, machine, interpreter ..., then the dependencies */
+func (r ScanResult) String() string {
+	fields := []string{r.Type, r.Machine}
+	if r.Interp != "" {
+		fields = append(fields, "interpreter "+r.Interp)
+	}
+	if r.Soname != "" {
+		fields = append(fields, "soname "+r.Soname)
+	}
+	if len(r.Needed) != 0 {
+		fields = append(fields, "needs "+strings.Join(r.Needed, " "))
+	}
+	if r.BuildID != "" {
+		fields = append(fields, "BuildID "+r.BuildID)
+	}
+	if r.Go {
+		fields = append(fields, "Go")
+	}
+	if r.Stripped {
+		fields = append(fields, "stripped")
+	} else {
+		fields = append(fields, "not stripped")
+	}
+	return r.Path + ": " + strings.Join(fields, ", ")
+}
+
+func runScan(args []string) error {
+	asJson := false
+	workers := runtime.NumCPU()
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--json":
+			asJson = true
+		case "-j", "--jobs":
+			if i+1 >= len(args) {
+				return usageError("elfparser: option requires an argument: %s", arg)
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				return usageError("elfparser: invalid number of jobs: %s", args[i])
+			}
+			workers = n
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+
+	order := make(chan chan []*ScanResult, SCAN_BACKLOG)
+	jobs := make(chan scanJob)
+	go func() {
+		walkScan(paths, func(path string, image bool, err error) {
+			result := make(chan []*ScanResult, 1)
+			order <- result
+			if err != nil {
+				result <- []*ScanResult{failedScan(path, err)}
+				return
+			}
+			jobs <- scanJob{path, image, result}
+		})
+		close(order)
+		close(jobs)
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				if !job.image {
+					job.result <- []*ScanResult{scanFile(job.path)}
+					continue
+				}
+				// an image has the workers of its own
+				results, err := ScanImage(job.path, workers)
+				if err != nil {
+					results = []*ScanResult{failedScan(job.path, err)}
+				}
+				job.result <- results
+			}
+		}()
+	}
+
+	for result := range order {
+		for _, r := range <-result {
+			if err := printScanResult(r, asJson); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func printScanResult(r *ScanResult, asJson bool) error {
+	if r == nil {
+		return nil
+	}
+	if asJson {
+		var v any = r
+		if r.failed {
+			v = struct {
+				Path   string   `json:"path"`
+				Errors []string `json:"errors"`
+			}{r.Path, r.Errors}
+		}
+		out, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	for _, err := range r.Errors {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", r.Path, err)
+	}
+	if !r.failed {
+		fmt.Println(r)
+	}
+	return nil
+}
+
+/*
+hands every regular file under paths to scan in walk order, symbolic links in the trees
+are not followed. What cannot be read is handed over with its error. Images and tarballs
+are only looked for in paths, not in the trees.
+*/
+func walkScan(paths []string, scan func(path string, image bool, err error)) {
+	for _, root := range paths {
+		if IsImage(root) {
+			scan(root, true, nil)
+			continue
+		}
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+			case entry.IsDir() || path != root && !entry.Type().IsRegular():
+				return nil
+			case path == root:
+				// a file given by name is read even through a link, but a device or FIFO is not
+				info, statErr := os.Stat(path)
+				if err = statErr; err == nil && !info.Mode().IsRegular() {
+					err = fmt.Errorf("error: not a regular file")
+				}
+			}
+			scan(path, false, err)
+			return nil
+		})
+	}
+}
+
+func failedScan(path string, err error) *ScanResult {
+	return &ScanResult{Path: path, Errors: []string{err.Error()}, failed: true}
+}
+
+/* parses one file, nil when it is not an ELF file */
+func scanFile(path string) *ScanResult {
+	file, err := os.Open(path)
+	if err != nil {
+		return failedScan(path, err)
+	}
+	defer file.Close()
+
+	if !IsElf(file) {
+		return nil
+	}
+	return scanReader(path, file)
+}
+
+/* parses an ELF file read into memory, as from a layer of an image */
+func scanData(path string, data []byte) *ScanResult {
+	return scanReader(path, bytes.NewReader(data))
+}
+
+func scanReader(path string, file ElfReader) *ScanResult {
+	parser, err := LoadData(file)
+	if err != nil {
+		return failedScan(path, err)
+	}
+	r := parser.GetScanResult()
+	r.Path = path
+	return r
+}
+
+/* the summary of the file that scan prints */
+func (p *ElfParser) GetScanResult() *ScanResult {
+	r := new(ScanResult)
+	ehdr := p.GetEhdr()
+	switch ehdr.E_type {
+	case ET_REL:
+		r.Type = "REL"
+	case ET_EXEC:
+		r.Type = "EXEC"
+	case ET_DYN:
+		r.Type = "DYN"
+		if p.pie() == "PIE enabled" {
+			r.Type = "PIE"
+		}
+	case ET_CORE:
+		r.Type = "CORE"
+	default:
+		r.Type = fmt.Sprintf("type 0x%x", ehdr.E_type)
+	}
+	if name, ok := e_machine[ehdr.E_machine]; ok {
+		r.Machine = name
+	} else {
+		r.Machine = fmt.Sprintf("machine %d", ehdr.E_machine)
+	}
+
+	r.Interp = p.GetInterp()
+	if sonames := p.GetDynStrings(DT_SONAME); len(sonames) != 0 {
+		r.Soname = sonames[0]
+	}
+	r.Needed = p.GetDynStrings(DT_NEEDED)
+	r.BuildID = p.GetBuildID()
+	r.Go = p.IsGo()
+	r.Stripped = true
+	for _, shdrDesp := range p.GetShdrs() {
+		if shdrDesp.shdr.SH_type == SHT_SYMTAB {
+			r.Stripped = false
+			break
+		}
+	}
+	for _, err := range p.Errors() {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	return r
+}
+
+/* returns the GNU build ID from the NT_GNU_BUILD_ID note in hex, "" when there is none */
+func (p *ElfParser) GetBuildID() string {
+	for _, note := range p.GetNotes() {
+		if note.name == "GNU" && note.typ == NT_GNU_BUILD_ID {
+			return hex.EncodeToString(note.desc)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/* a tree of fixtures and other files, scanned on several workers, prints the ELF files in walk order */
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, build := range fixtures {
+		write(name, build())
+		write(filepath.Join("lib", name+".so"), build())
+	}
+	write("notes.txt", []byte("not an ELF file\n"))
+	// a 32-bit file is reported and the scan goes on
+	write(filepath.Join("lib", "elf32"), []byte("\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+
+	out := captureStdout(t, func() {
+		if err := runScan([]string{"-j", "3", dir}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	checkGolden(t, "scan", bytes.ReplaceAll(out, []byte(dir), []byte("DIR")))
+
+	lines := bytes.Count(out, []byte("\n"))
+	if lines != 2*len(fixtures) {
+		t.Errorf("%d files reported, want %d", lines, 2*len(fixtures))
+	}
+}
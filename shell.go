@@ -0,0 +1,798 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* the shell stops listing matches of find-bytes after this many */
+const MAX_SHELL_MATCHES = 256
+
+/* a command of the shell: its arguments, what it prints and how many arguments it takes */
+type shellCommand struct {
+	name string
+	args string
+	help string
+	min  int
+	max  int /* -1 for any number */
+	run  func(s *ElfShell, args []string) error
+}
+
+var shell_commands = []shellCommand{
+	{"sections", "", "the section headers", 0, 0, (*ElfShell).printSections},
+	{"segments", "", "the program headers and the section to segment mapping", 0, 0, (*ElfShell).printSegments},
+	{"syms", "[pattern]", "the symbols whose name matches a glob or contains pattern", 0, 1, (*ElfShell).printSymbols},
+	{"sym", "<name>", "the symbols called name, with their section, segments and file offset", 1, 1, (*ElfShell).printSymbol},
+	{"hexdump", "<section> [off] [len]", "the contents of a section as readelf -x, from off for len bytes", 1, 3, (*ElfShell).hexdump},
+	{"addr", "<vaddr|symbol>", "the section, segments, file offset and symbol of an address", 1, 1, (*ElfShell).printAddr},
+	{"find-bytes", "<hex|\"string\">...", "the file offsets, sections and addresses holding the bytes", 1, -1, (*ElfShell).findBytes},
+}
+
+/* where the shell reads its command lines from */
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+/* an ELF file opened in the shell, one parser stays loaded so its headers and symbols are read once */
+type ElfShell struct {
+	path     string
+	parser   *ElfParser
+	sections []string                 /* the section names, for completion */
+	symbols  []string                 /* the distinct symbol names, sorted for completion */
+	byAddr   []*Elf64SymbolHeaderDesp /* the defined symbols by address, for addr */
+	reported int                      /* the parser errors already printed */
+}
+
+func NewElfShell(path string, parser *ElfParser) *ElfShell {
+	s := &ElfShell{path: path, parser: parser}
+	for _, desp := range parser.GetShdrs() {
+		if name := strings.TrimRight(desp.name, "\x00"); name != "" {
+			s.sections = append(s.sections, name)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, desp := range parser.GetSyms() {
+		name := strings.TrimRight(desp.name, "\x00")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			s.symbols = append(s.symbols, name)
+		}
+		typ := desp.sym.ST_info & 0xf
+		if name != "" && desp.sym.ST_shndx != SHN_UNDEF && desp.sym.ST_shndx < SHN_LORESERVE &&
+			typ != STT_SECTION && typ != STT_FILE && typ != STT_TLS {
+			s.byAddr = append(s.byAddr, desp)
+		}
+	}
+	sort.Strings(s.symbols)
+	sort.SliceStable(s.byAddr, func(i, j int) bool { return s.byAddr[i].sym.ST_value < s.byAddr[j].sym.ST_value })
+	return s
+}
+
+/* reads and runs commands until quit or the end of the input */
+func (s *ElfShell) Run(r lineReader) error {
+	for {
+		line, err := r.ReadLine("elf> ")
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		quit, err := s.Execute(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+/* runs one command line, reports whether it asks to leave the shell */
+func (s *ElfShell) Execute(line string) (bool, error) {
+	fields, err := shellFields(line)
+	if err != nil || len(fields) == 0 {
+		return false, err
+	}
+	defer s.reportErrors()
+
+	switch fields[0] {
+	case "quit", "exit":
+		return true, nil
+	case "help":
+		s.printHelp()
+		return false, nil
+	}
+	for _, c := range shell_commands {
+		if c.name != fields[0] {
+			continue
+		}
+		if len(fields)-1 < c.min || c.max >= 0 && len(fields)-1 > c.max {
+			return false, fmt.Errorf("elfparser: usage: %s %s", c.name, c.args)
+		}
+		return false, c.run(s, fields[1:])
+	}
+	return false, fmt.Errorf("elfparser: unknown command: %s, try help", fields[0])
+}
+
+/* prints what the parser could not read since the last command */
+func (s *ElfShell) reportErrors() {
+	errs := s.parser.Errors()
+	for _, err := range errs[s.reported:] {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", s.path, err)
+	}
+	s.reported = len(errs)
+}
+
+func (s *ElfShell) printHelp() {
+	for _, c := range shell_commands {
+		usage := strings.TrimSpace(c.name + " " + c.args)
+		if len(usage) > 26 {
+			fmt.Printf("  %s\n  %-26s  %s\n", usage, "", c.help)
+		} else {
+			fmt.Printf("  %-26s  %s\n", usage, c.help)
+		}
+	}
+	fmt.Printf("  %-26s  %s\n", "help", "this list")
+	fmt.Printf("  %-26s  %s\n", "quit", "leave the shell, as ^D does")
+}
+
+func (s *ElfShell) printSections(args []string) error {
+	s.parser.PrintShdrs()
+	return nil
+}
+
+func (s *ElfShell) printSegments(args []string) error {
+	s.parser.PrintPhdrs()
+	return nil
+}
+
+/* a pattern with glob characters matches the whole name, any other one a part of it */
+func shellMatch(pattern, name string) bool {
+	if strings.ContainsAny(pattern, "*?[") {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}
+	return strings.Contains(name, pattern)
+}
+
+func (s *ElfShell) printSymbols(args []string) error {
+	pattern := ""
+	if len(args) == 1 {
+		pattern = args[0]
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("elfparser: bad pattern: %s", pattern)
+	}
+
+	var table *Elf64SectionHeaderDesp
+	matched := 0
+	for _, desp := range s.parser.GetSyms() {
+		name := strings.TrimRight(desp.name, "\x00")
+		if !shellMatch(pattern, name) {
+			continue
+		}
+		if desp.tab != table {
+			table = desp.tab
+			fmt.Printf("\nSymbol table '%s':\n", strings.TrimRight(table.name, "\x00"))
+			fmt.Println("   Num:    Value          Size Type    Bind   Vis      Ndx Name")
+		}
+		shown := *desp
+		shown.name = name
+		fmt.Println(shown)
+		matched++
+	}
+	fmt.Printf("%d of %d symbols\n", matched, len(s.parser.GetSyms()))
+	return nil
+}
+
+func (s *ElfShell) printSymbol(args []string) error {
+	found := false
+	for _, desp := range s.parser.GetSyms() {
+		if strings.TrimRight(desp.name, "\x00") != args[0] {
+			continue
+		}
+		found = true
+		sym := desp.sym
+		typ := sym.ST_info & 0xf
+		fmt.Printf("%s: %s %s %s, %s[%d], value 0x%x, size %d\n", args[0], sym_type[typ], sym_bind[sym.ST_info>>4],
+			sym_vis[sym.ST_other&0x3], strings.TrimRight(desp.tab.name, "\x00"), desp.idx, sym.ST_value, sym.ST_size)
+
+		shdrs := s.parser.GetShdrs()
+		switch {
+		case sym.ST_shndx == SHN_UNDEF:
+			fmt.Println("  undefined")
+		case sym.ST_shndx == SHN_ABS:
+			fmt.Println("  absolute")
+		case sym.ST_shndx == SHN_COMMON:
+			fmt.Printf("  common, aligned to %d\n", sym.ST_value)
+		case int(sym.ST_shndx) >= len(shdrs):
+			fmt.Printf("  in section %d, which does not exist\n", sym.ST_shndx)
+		case s.parser.GetEhdr().E_type == ET_REL:
+			// the value is an offset into the section, which has no address yet
+			section := shdrs[sym.ST_shndx]
+			fmt.Printf("  %-13s[%d] %s +0x%x\n", "section:", section.idx, strings.TrimRight(section.name, "\x00"), sym.ST_value)
+			if section.shdr.SH_type != SHT_NOBITS {
+				fmt.Printf("  %-13s0x%x\n", "file offset:", uint64(section.shdr.SH_offset)+uint64(sym.ST_value))
+			}
+		case typ == STT_TLS:
+			// the value is an offset into the TLS segment, whose initial image has an address
+			for _, phdr := range s.parser.GetPhdrs() {
+				if phdr.P_type == PT_TLS {
+					fmt.Printf("  tls offset 0x%x, initialized from 0x%x\n", sym.ST_value, phdr.P_vaddr+sym.ST_value)
+					s.printLocation(phdr.P_vaddr + sym.ST_value)
+				}
+			}
+		default:
+			s.printLocation(sym.ST_value)
+		}
+	}
+	if !found {
+		return fmt.Errorf("elfparser: no symbol %s", args[0])
+	}
+	return nil
+}
+
+/* the section holding an address, the TLS sections without contents overlap the ones after them */
+func (s *ElfShell) sectionAt(addr Elf64_Addr) *Elf64SectionHeaderDesp {
+	for _, desp := range s.parser.GetShdrs() {
+		shdr := desp.shdr
+		if shdr.SH_flags&SHF_ALLOC == 0 || shdr.SH_type == SHT_NOBITS && shdr.SH_flags&SHF_TLS != 0 {
+			continue
+		}
+		if addr >= shdr.SH_addr && uint64(addr-shdr.SH_addr) < uint64(shdr.SH_size) {
+			return desp
+		}
+	}
+	return nil
+}
+
+/*
+name+offset of the symbol at an address, preferring one whose size covers it. A symbol
+without a size only names addresses in its own section, not everything after it.
+*/
+func (s *ElfShell) symbolAt(addr Elf64_Addr) string {
+	i := sort.Search(len(s.byAddr), func(i int) bool { return s.byAddr[i].sym.ST_value > addr }) - 1
+	if i < 0 {
+		return ""
+	}
+	section := s.sectionAt(addr)
+	var found *Elf64SymbolHeaderDesp
+	for j := i; j >= 0 && s.byAddr[j].sym.ST_value == s.byAddr[i].sym.ST_value; j-- {
+		sym := s.byAddr[j].sym
+		if sym.ST_size != 0 && uint64(addr-sym.ST_value) < uint64(sym.ST_size) {
+			found = s.byAddr[j]
+			break
+		}
+		if sym.ST_size == 0 && found == nil && section != nil && int(sym.ST_shndx) == section.idx {
+			found = s.byAddr[j]
+		}
+	}
+	if found == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s+0x%x", strings.TrimRight(found.name, "\x00"), addr-found.sym.ST_value)
+}
+
+/* prints the section, segments, file offset and symbol of an address */
+func (s *ElfShell) printLocation(addr Elf64_Addr) {
+	found := false
+	if desp := s.sectionAt(addr); desp != nil {
+		fmt.Printf("  %-13s[%d] %s +0x%x\n", "section:", desp.idx, strings.TrimRight(desp.name, "\x00"), addr-desp.shdr.SH_addr)
+		found = true
+	}
+	segments := []string{}
+	for i, phdr := range s.parser.GetPhdrs() {
+		// the .tbss part of the TLS segment takes no addresses, what follows it does
+		size := uint64(phdr.P_memsz)
+		if phdr.P_type == PT_TLS {
+			size = uint64(phdr.P_filesz)
+		}
+		if addr < phdr.P_vaddr || uint64(addr-phdr.P_vaddr) >= size {
+			continue
+		}
+		typ, ok := p_type[phdr.P_type]
+		if !ok {
+			typ = fmt.Sprintf("0x%x", phdr.P_type)
+		}
+		segments = append(segments, fmt.Sprintf("%d (%s %s) +0x%x", i, typ, strings.TrimSpace(getSegmentFlags(phdr.P_flags)),
+			addr-phdr.P_vaddr))
+	}
+	if len(segments) != 0 {
+		fmt.Printf("  %-13s%s\n", "segments:", strings.Join(segments, ", "))
+		found = true
+	}
+	if offset, ok := s.parser.vaddrToOffset(addr); ok {
+		fmt.Printf("  %-13s0x%x\n", "file offset:", offset)
+	}
+	if symbol := s.symbolAt(addr); symbol != "" {
+		fmt.Printf("  %-13s%s\n", "symbol:", symbol)
+	}
+	if !found {
+		fmt.Println("  not in any section or segment")
+	}
+}
+
+func (s *ElfShell) printAddr(args []string) error {
+	if s.parser.GetEhdr().E_type == ET_REL {
+		return fmt.Errorf("elfparser: %s is a relocatable object, its sections have no addresses yet", s.path)
+	}
+	addr, err := strconv.ParseUint(args[0], 0, 64)
+	if err != nil {
+		// a defined symbol stands for its value
+		found := false
+		for _, desp := range s.byAddr {
+			if strings.TrimRight(desp.name, "\x00") == args[0] {
+				addr, found = uint64(desp.sym.ST_value), true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("elfparser: %s is neither an address nor a defined symbol", args[0])
+		}
+	}
+	fmt.Printf("0x%x\n", addr)
+	s.printLocation(Elf64_Addr(addr))
+	return nil
+}
+
+/* a section by name or by index */
+func (s *ElfShell) section(name string) *Elf64SectionHeaderDesp {
+	shdrs := s.parser.GetShdrs()
+	for _, desp := range shdrs {
+		if strings.TrimRight(desp.name, "\x00") == name {
+			return desp
+		}
+	}
+	if idx, err := strconv.ParseUint(name, 0, 64); err == nil && idx < uint64(len(shdrs)) {
+		return shdrs[idx]
+	}
+	return nil
+}
+
+func (s *ElfShell) hexdump(args []string) error {
+	desp := s.section(args[0])
+	if desp == nil {
+		return fmt.Errorf("elfparser: no section %s", args[0])
+	}
+	name, shdr := strings.TrimRight(desp.name, "\x00"), desp.shdr
+	if shdr.SH_type == SHT_NOBITS || shdr.SH_size == 0 {
+		fmt.Printf("Section '%s' has no data to dump.\n", name)
+		return nil
+	}
+
+	offset, size := uint64(0), uint64(shdr.SH_size)
+	if len(args) > 1 {
+		var err error
+		if offset, err = strconv.ParseUint(args[1], 0, 64); err != nil {
+			return fmt.Errorf("elfparser: bad offset: %s", args[1])
+		}
+		if offset >= size {
+			return fmt.Errorf("elfparser: offset 0x%x is past the end of %s, which has 0x%x bytes", offset, name, size)
+		}
+		size -= offset
+	}
+	if len(args) > 2 {
+		length, err := strconv.ParseUint(args[2], 0, 64)
+		if err != nil {
+			return fmt.Errorf("elfparser: bad length: %s", args[2])
+		}
+		size = min(size, length)
+	}
+	data := s.parser.readBytes(int64(shdr.SH_offset)+int64(offset), int64(size))
+	if data == nil {
+		return nil
+	}
+
+	fmt.Printf("\nHex dump of section '%s':\n", name)
+	fmt.Print(hexdumpLines(uint64(shdr.SH_addr)+offset, data))
+	fmt.Println()
+	return nil
+}
+
+/* the lines of readelf -x: the address, 16 bytes in groups of 4 and the printable ones */
+func hexdumpLines(addr uint64, data []byte) string {
+	builder := new(strings.Builder)
+	for len(data) > 0 {
+		line := data[:min(16, len(data))]
+		fmt.Fprintf(builder, "  0x%08x ", addr)
+		for i := range 16 {
+			if i < len(line) {
+				fmt.Fprintf(builder, "%02x", line[i])
+			} else {
+				builder.WriteString("  ")
+			}
+			if i%4 == 3 {
+				builder.WriteByte(' ')
+			}
+		}
+		for _, b := range line {
+			if b < ' ' || b >= 0x7f {
+				b = '.'
+			}
+			builder.WriteByte(b)
+		}
+		builder.WriteByte('\n')
+		addr += uint64(len(line))
+		data = data[len(line):]
+	}
+	return builder.String()
+}
+
+/* the bytes of find-bytes: quoted Go strings and hex digits, which may be split into several arguments */
+func shellBytes(args []string) ([]byte, error) {
+	pattern := []byte{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "\"") {
+			text, err := strconv.Unquote(arg)
+			if err != nil {
+				return nil, fmt.Errorf("elfparser: bad string: %s", arg)
+			}
+			pattern = append(pattern, text...)
+			continue
+		}
+		data, err := hex.DecodeString(strings.TrimPrefix(arg, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("elfparser: bad hex bytes: %s", arg)
+		}
+		pattern = append(pattern, data...)
+	}
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("elfparser: nothing to find")
+	}
+	return pattern, nil
+}
+
+/* the section whose contents hold a file offset */
+func (s *ElfShell) sectionAtOffset(offset uint64) *Elf64SectionHeaderDesp {
+	for _, desp := range s.parser.GetShdrs() {
+		shdr := desp.shdr
+		if desp.idx != 0 && shdr.SH_type != SHT_NOBITS && offset >= uint64(shdr.SH_offset) &&
+			offset-uint64(shdr.SH_offset) < uint64(shdr.SH_size) {
+			return desp
+		}
+	}
+	return nil
+}
+
+func (s *ElfShell) findBytes(args []string) error {
+	pattern, err := shellBytes(args)
+	if err != nil {
+		return err
+	}
+
+	// read the file a chunk at a time, overlapping by the pattern so that no match is cut
+	const chunk = 1 << 20
+	matches := 0
+	for start := int64(0); start < s.parser.size; start += chunk {
+		data := s.parser.readBytes(start, min(chunk+int64(len(pattern))-1, s.parser.size-start))
+		if data == nil {
+			break
+		}
+		for i := 0; ; i++ {
+			j := bytes.Index(data[i:], pattern)
+			if j < 0 || i+j >= chunk {
+				break
+			}
+			i += j
+			if matches == MAX_SHELL_MATCHES {
+				fmt.Printf("more than %d matches, the rest are not shown\n", MAX_SHELL_MATCHES)
+				return nil
+			}
+			matches++
+
+			offset := uint64(start) + uint64(i)
+			where := []string{fmt.Sprintf("file offset 0x%x", offset)}
+			if desp := s.sectionAtOffset(offset); desp != nil {
+				where = append(where, fmt.Sprintf("[%d] %s +0x%x", desp.idx, strings.TrimRight(desp.name, "\x00"),
+					offset-uint64(desp.shdr.SH_offset)))
+			}
+			for _, phdr := range s.parser.GetPhdrs() {
+				if phdr.P_type == PT_LOAD && offset >= uint64(phdr.P_offset) && offset-uint64(phdr.P_offset) < uint64(phdr.P_filesz) {
+					addr := phdr.P_vaddr + Elf64_Addr(offset-uint64(phdr.P_offset))
+					if symbol := s.symbolAt(addr); symbol != "" {
+						where = append(where, fmt.Sprintf("address 0x%x (%s)", addr, symbol))
+					} else {
+						where = append(where, fmt.Sprintf("address 0x%x", addr))
+					}
+					break
+				}
+			}
+			fmt.Println(strings.Join(where, ", "))
+		}
+	}
+	if matches == 0 {
+		fmt.Println("not found")
+	}
+	return nil
+}
+
+/* splits a command line at spaces, a double quoted Go string is one field and keeps its quotes */
+func shellFields(line string) ([]string, error) {
+	fields := []string{}
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return fields, nil
+		}
+		end := strings.IndexAny(line, " \t")
+		if line[0] == '"' {
+			end = -1
+			for i := 1; i < len(line); i++ {
+				if line[i] == '\\' {
+					i++
+				} else if line[i] == '"' {
+					end = i + 1
+					break
+				}
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("elfparser: unterminated string: %s", line)
+			}
+		}
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+}
+
+/* the words that complete the last one of line: commands first, then sections or symbols */
+func (s *ElfShell) Complete(line string) []string {
+	fields := strings.Fields(line)
+	word := ""
+	if len(fields) != 0 && !strings.HasSuffix(line, " ") {
+		word, fields = fields[len(fields)-1], fields[:len(fields)-1]
+	}
+
+	var words []string
+	switch {
+	case len(fields) == 0:
+		for _, c := range shell_commands {
+			words = append(words, c.name)
+		}
+		words = append(words, "help", "quit")
+		sort.Strings(words)
+	case len(fields) == 1 && fields[0] == "hexdump":
+		words = s.sections
+	case len(fields) == 1 && (fields[0] == "sym" || fields[0] == "syms" || fields[0] == "addr"):
+		words = s.symbols
+	}
+	candidates := []string{}
+	for _, w := range words {
+		if strings.HasPrefix(w, word) {
+			candidates = append(candidates, w)
+		}
+	}
+	return candidates
+}
+
+/* reads the commands from a file or a pipe, without prompts */
+type scriptReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *scriptReader) ReadLine(prompt string) (string, error) {
+	if r.scanner.Scan() {
+		return r.scanner.Text(), nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+/* a line editor for a terminal in raw mode: the editing keys of readline, history and tab completion */
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	complete func(line string) []string /* the words that can replace the last one of line */
+	history  []string
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	line, pos := []rune{}, 0
+	browsed, draft := len(e.history), []rune{}
+	for {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		key := r
+		if r == 0x1b {
+			key = e.escape()
+		}
+		switch key {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			text := string(line)
+			if strings.TrimSpace(text) != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != text) {
+				e.history = append(e.history, text)
+			}
+			return text, nil
+		case 0x03: // ^C drops the line
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", nil
+		case 0x04: // ^D leaves on an empty line, deletes otherwise
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case 0x7f, 0x08:
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case 0x01, 'H' | 0x100:
+			pos = 0
+		case 0x05, 'F' | 0x100:
+			pos = len(line)
+		case 0x02, 'D' | 0x100:
+			pos = max(pos-1, 0)
+		case 0x06, 'C' | 0x100:
+			pos = min(pos+1, len(line))
+		case 0x0b:
+			line = line[:pos]
+		case 0x15:
+			line, pos = line[pos:], 0
+		case '3' | 0x100: // delete
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case 0x10, 'A' | 0x100:
+			if browsed > 0 {
+				if browsed == len(e.history) {
+					draft = line
+				}
+				browsed--
+				line = []rune(e.history[browsed])
+				pos = len(line)
+			}
+		case 0x0e, 'B' | 0x100:
+			if browsed < len(e.history) {
+				browsed++
+				line = draft
+				if browsed < len(e.history) {
+					line = []rune(e.history[browsed])
+				}
+				pos = len(line)
+			}
+		case '\t':
+			line, pos = e.completeLine(line, pos, prompt)
+		default:
+			if r >= ' ' && r != 0x7f && key == r {
+				line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+				pos++
+			}
+		}
+	}
+}
+
+/* reads the rest of an escape sequence, the arrows and home, end and delete come back as their letter | 0x100 */
+func (e *lineEditor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != '[' && r != 'O' {
+		return 0
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+	if r >= '0' && r <= '9' {
+		// ESC [ 3 ~, ESC [ 1 ~ and ESC [ 4 ~ are delete, home and end
+		code := r
+		for r >= '0' && r <= '9' || r == ';' {
+			if r, _, err = e.in.ReadRune(); err != nil {
+				return 0
+			}
+		}
+		switch code {
+		case '1', '7':
+			return 'H' | 0x100
+		case '4', '8':
+			return 'F' | 0x100
+		}
+		return code | 0x100
+	}
+	return r | 0x100
+}
+
+/* completes the word before the cursor, or lists the candidates when they share nothing more */
+func (e *lineEditor) completeLine(line []rune, pos int, prompt string) ([]rune, int) {
+	before := string(line[:pos])
+	word := []rune(before[strings.LastIndexAny(before, " \t")+1:])
+	candidates := e.complete(before)
+	if len(candidates) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return line, pos
+	}
+
+	common := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		r := []rune(c)
+		n := 0
+		for n < len(common) && n < len(r) && common[n] == r[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	insert := common[min(len(word), len(common)):]
+	if len(candidates) == 1 {
+		insert = append(insert, ' ')
+	}
+	if len(insert) == 0 {
+		shown := candidates[:min(len(candidates), 100)]
+		fmt.Fprintf(e.out, "\r\n%s", strings.Join(shown, "  "))
+		if len(candidates) > len(shown) {
+			fmt.Fprintf(e.out, "  ... %d more", len(candidates)-len(shown))
+		}
+		fmt.Fprint(e.out, "\r\n")
+		return line, pos
+	}
+	line = append(append(append([]rune{}, line[:pos]...), insert...), line[pos:]...)
+	return line, pos + len(insert)
+}
+
+func runShell(args []string) error {
+	if len(args) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+	if len(args) > 1 {
+		return usageError("elfparser: shell opens one file")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	parser, err := LoadData(file)
+	if err != nil {
+		return err
+	}
+	s := NewElfShell(args[0], parser)
+	s.reportErrors()
+
+	// the line editor needs a terminal, commands from a pipe are read as they come
+	fd := os.Stdin.Fd()
+	if restore, err := makeRaw(fd); err == nil {
+		restore()
+		fmt.Printf("%s: %d sections, %d symbols, try help\n", args[0], len(s.sections), len(parser.GetSyms()))
+		editor := &lineEditor{in: bufio.NewReader(os.Stdin), out: os.Stdout, complete: s.Complete}
+		return s.Run(&terminalReader{fd: fd, editor: editor})
+	}
+	return s.Run(&scriptReader{scanner: bufio.NewScanner(os.Stdin)})
+}
+
+/* the line editor with the terminal in raw mode while a line is read */
+type terminalReader struct {
+	fd     uintptr
+	editor *lineEditor
+}
+
+func (t *terminalReader) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(t.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	return t.editor.ReadLine(prompt)
+}
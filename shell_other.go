@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+/* the line editor only knows the termios of Linux, elsewhere the shell reads plain lines */
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, fmt.Errorf("error: no raw terminal mode on this system")
+}
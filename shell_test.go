@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShell(t *testing.T) {
+	script := []string{
+		"syms _s*",
+		"sym answer",
+		"sym tls_counter",
+		"sym __weak_hook",
+		"addr message",
+		"addr 0x1",
+		"hexdump .rodata",
+		"hexdump .text 2 5",
+		"hexdump .bss",
+		`find-bytes "fixture"`,
+		"find-bytes 0f 05",
+		"quit",
+		"sections",
+	}
+	exec := fixtureLoad(t)
+	shdrs := exec.GetShdrs()
+	out := captureStdout(t, func() {
+		s := NewElfShell("exec", exec)
+		if err := s.Run(&scriptReader{scanner: bufio.NewScanner(strings.NewReader(strings.Join(script, "\n")))}); err != nil {
+			t.Fatal(err)
+		}
+		// a relocatable object has no addresses, its symbols are at offsets into their sections
+		rel, err := LoadData(bytes.NewReader(fixtureRelocatable().Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = NewElfShell("relocatable", rel)
+		for _, line := range []string{"sym counter", "sym shared_buffer"} {
+			if _, err := s.Execute(line); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.Execute("addr counter"); err == nil {
+			t.Errorf("addr in a relocatable object succeeded")
+		}
+	})
+	checkGolden(t, "shell", out)
+	if &exec.GetShdrs()[0] != &shdrs[0] {
+		t.Errorf("the section headers were read again")
+	}
+}
+
+/* keys as a terminal sends them: completion, editing, history and ^D */
+func TestLineEditor(t *testing.T) {
+	s := NewElfShell("exec", fixtureLoad(t))
+	input := "hex\t.ro\t\r" + // hexdump .rodata
+		"sy\t _st\t\r" + // sym _start
+		"x\x7fsyms an\x1b[D\x1b[D\x01\x05\x15\x1b[A\x1b[A\r" + // the line is dropped for the history
+		"addr\x1b[Dx\r" +
+		"\x04"
+	e := &lineEditor{in: bufio.NewReader(strings.NewReader(input)), out: io.Discard, complete: s.Complete}
+	lines := []string{}
+	for {
+		line, err := e.ReadLine("elf> ")
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	want := []string{"hexdump .rodata ", "sym _start ", "hexdump .rodata ", "addxr"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("read %q, want %q", lines, want)
+	}
+	if got := s.Complete("sym _"); !reflect.DeepEqual(got, []string{"__weak_hook", "_start"}) {
+		t.Errorf("sym _ completes to %q", got)
+	}
+}
+
+func fixtureLoad(t *testing.T) *ElfParser {
+	t.Helper()
+	p, err := LoadData(bytes.NewReader(fixtureExec(binary.LittleEndian, EM_X86_64, false).Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+/* a symbol without a size names the rest of its section, not the addresses after it */
+func TestShellSymbolAt(t *testing.T) {
+	f := fixtureExec(binary.LittleEndian, EM_X86_64, true)
+	f.addSymbols(".symtab", ".strtab", []fixtureSymbol{
+		{name: "data_start", bind: STB_GLOBAL, typ: STT_NOTYPE, section: ".data"},
+		{name: "buffer", bind: STB_GLOBAL, typ: STT_OBJECT, section: ".bss", size: 0x10},
+		{name: "_end", bind: STB_GLOBAL, typ: STT_NOTYPE, section: ".bss", value: 0x100},
+	}, -1)
+	p, err := LoadData(bytes.NewReader(f.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewElfShell("exec", p)
+	data, bss := s.section(".data").shdr.SH_addr, s.section(".bss").shdr.SH_addr
+	for addr, want := range map[Elf64_Addr]string{
+		data + 4:           "data_start+0x4",
+		bss + 8:            "buffer+0x8",
+		bss + 0x20:         "",
+		bss + 0x100:        "",
+		0xffffffffffffffff: "",
+	} {
+		if got := s.symbolAt(addr); got != want {
+			t.Errorf("0x%x is %q, want %q", addr, got, want)
+		}
+	}
+}
+
+/* addr and find-bytes read from a script print where an address or the bytes are, an error prints nothing */
+func TestShellScript(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+		err  string
+	}{
+		{line: "addr 0x4001b2", want: "0x4001b2\n" +
+			"  section:     [2] .text +0x2\n" +
+			"  segments:    1 (LOAD R E) +0x1b2\n" +
+			"  file offset: 0x1b2\n" +
+			"  symbol:      _start+0x2\n"},
+		{line: "addr answer", want: "0x4011d8\n" +
+			"  section:     [6] .data +0x0\n" +
+			"  segments:    2 (LOAD RW) +0x8\n" +
+			"  file offset: 0x1d8\n" +
+			"  symbol:      answer+0x0\n"},
+		// .bss takes no room in the file
+		{line: "addr buffer", want: "0x4011e0\n" +
+			"  section:     [7] .bss +0x0\n" +
+			"  segments:    2 (LOAD RW) +0x10\n" +
+			"  symbol:      buffer+0x0\n"},
+		{line: "addr 0x4001d0", want: "0x4001d0\n  not in any section or segment\n"},
+		{line: "addr __weak_hook", err: "elfparser: __weak_hook is neither an address nor a defined symbol"},
+		{line: `find-bytes "hello"`, want: "file offset 0x1c0, [3] .rodata +0x0, address 0x4001c0 (message+0x0)\n"},
+		{line: `find-bytes "fixture" 00`, want: "file offset 0x1c7, [3] .rodata +0x7, address 0x4001c7 (message+0x7)\n"},
+		{line: "find-bytes 2a 00 00 00 00 00 00 00", want: "file offset 0x1d8, [6] .data +0x0, address 0x4011d8 (answer+0x0)\n"},
+		{line: `find-bytes "GNU"`, want: "file offset 0x19c, [1] .note.ABI-tag +0xc, address 0x40019c\n"},
+		{line: "find-bytes de ad be ef", want: "not found\n"},
+		{line: "find-bytes 0g", err: "elfparser: bad hex bytes: 0g"},
+	}
+	for _, test := range tests {
+		out := captureStdout(t, func() {
+			s := NewElfShell("exec", fixtureLoad(t))
+			if test.err != "" {
+				if _, err := s.Execute(test.line); err == nil || err.Error() != test.err {
+					t.Errorf("%s: returned %v, want %s", test.line, err, test.err)
+				}
+				return
+			}
+			if err := s.Run(&scriptReader{scanner: bufio.NewScanner(strings.NewReader(test.line))}); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if string(out) != test.want {
+			t.Errorf("%s: printed\n%s\nwant\n%s", test.line, out, test.want)
+		}
+	}
+}
+
+/* the first word completes to a command, the argument of hexdump to a section, of sym, syms and addr to a symbol */
+func TestShellComplete(t *testing.T) {
+	s := NewElfShell("exec", fixtureLoad(t))
+	for line, want := range map[string][]string{
+		"":            {"addr", "find-bytes", "help", "hexdump", "quit", "sections", "segments", "sym", "syms"},
+		"he":          {"help", "hexdump"},
+		"hexdump .t":  {".text", ".tdata", ".tbss"},
+		"hexdump .x":  {},
+		"addr a":      {"answer"},
+		"syms t":      {"tls_counter"},
+		"sections ":   {},
+		"find-bytes ": {},
+	} {
+		if got := s.Complete(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q completes to %q, want %q", line, got, want)
+		}
+	}
+}
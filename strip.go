@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* reports whether the section holds debugging information: DWARF, compressed DWARF or stabs */
+func isDebugSection(s *ElfSection) bool {
+	return strings.HasPrefix(s.name, ".debug") || strings.HasPrefix(s.name, ".zdebug") ||
+		strings.HasPrefix(s.name, ".stab") || s.name == ".gdb_index"
+}
+
+/* removes the debugging sections, the relocations and section symbols that refer to them go as well */
+func (e *ElfFile) StripDebug() error {
+	for _, s := range append([]*ElfSection{}, e.sections...) {
+		if isDebugSection(s) {
+			e.RemoveSection(s)
+		}
+	}
+	return e.stripSectionSymbols(e.removedSections())
+}
+
+/* removes the debugging sections and the symbol table, which a relocatable file cannot do without */
+func (e *ElfFile) StripAll() error {
+	if e.ehdr.E_type == ET_REL {
+		return fmt.Errorf("error: a relocatable file needs its symbol table, use --strip-debug")
+	}
+	if err := e.StripDebug(); err != nil {
+		return err
+	}
+	for _, s := range append([]*ElfSection{}, e.sections...) {
+		if s.shdr.SH_type == SHT_SYMTAB {
+			e.RemoveSection(s)
+			if s.link != nil && s.link != e.names {
+				e.RemoveSection(s.link)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+removes the debugging sections and the symbols no relocation needs, as `strip --strip-unneeded`:
+executables and shared objects lose the symbol table, a relocatable file keeps its global
+and weak symbols and the local ones its relocations and section groups use
+*/
+func (e *ElfFile) StripUnneeded() error {
+	if e.ehdr.E_type != ET_REL {
+		return e.StripAll()
+	}
+	if err := e.StripDebug(); err != nil {
+		return err
+	}
+	symtab := e.symtab()
+	if symtab == nil {
+		return nil
+	}
+
+	used := map[int]bool{}
+	for _, s := range e.sections {
+		if (s.shdr.SH_type == SHT_REL || s.shdr.SH_type == SHT_RELA) && s.link == symtab {
+			entsize := relEntsize(s)
+			for i := 0; i+entsize <= len(s.data); i += entsize {
+				used[int(e.order.Uint64(s.data[i+8:])>>32)] = true
+			}
+		}
+		if s.shdr.SH_type == SHT_GROUP && s.link == symtab {
+			used[int(s.shdr.SH_info)] = true
+		}
+	}
+	return e.EditSymbols(func(syms []*ElfSymbol) ([]*ElfSymbol, error) {
+		kept := []*ElfSymbol{}
+		for _, s := range syms {
+			if s.sym.ST_info>>4 != STB_LOCAL || used[s.index] {
+				kept = append(kept, s)
+			}
+		}
+		return kept, nil
+	})
+}
+
+/*
+turns the file into a separate debug file as `objcopy --only-keep-debug` does: section headers
+and addresses stay, but only the debugging sections, the symbol table and the notes keep their
+contents, the rest becomes SHT_NOBITS
+*/
+func (e *ElfFile) OnlyKeepDebug() {
+	for _, s := range e.sections {
+		keep := isDebugSection(s) || s == e.names || s.shdr.SH_type == SHT_NOTE ||
+			s.shdr.SH_type == SHT_SYMTAB || s.shdr.SH_type == SHT_NULL
+		for _, symtab := range e.sections {
+			keep = keep || (symtab.shdr.SH_type == SHT_SYMTAB && symtab.link == s)
+		}
+		if keep || s.shdr.SH_type == SHT_NOBITS {
+			continue
+		}
+		s.shdr.SH_type = SHT_NOBITS
+		s.data = nil
+	}
+
+	// segments keep their addresses but only cover the headers and notes left in the file
+	phdrsEnd := Elf64_Off(e.ehdr.E_phoff) + Elf64_Off(len(e.phdrs))*Elf64_Off(e.ehdr.E_phentsize)
+	for _, phdr := range e.phdrs {
+		end := phdr.P_offset + Elf64_Off(phdr.P_filesz)
+		filesz := Elf64_Off(0)
+		if phdr.P_offset <= e.ehdr.E_phoff && phdrsEnd <= end {
+			filesz = phdrsEnd - phdr.P_offset
+		}
+		for _, s := range e.sections {
+			if s.shdr.SH_type != SHT_NOBITS && s.shdr.SH_flags&SHF_ALLOC != 0 &&
+				s.shdr.SH_offset >= phdr.P_offset && s.shdr.SH_offset < end {
+				filesz = max(filesz, s.shdr.SH_offset+Elf64_Off(len(s.data))-phdr.P_offset)
+			}
+		}
+		phdr.P_filesz = Elf64_XWord(filesz)
+	}
+	e.repack = true
+}
+
+/*
+adds a .gnu_debuglink section naming the debug file: the base name padded to
+4 bytes followed by the CRC-32 of the debug file in the byte order of the target
+*/
+func (e *ElfFile) AddDebuglink(path string) error {
+	debug, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if old := e.Section(".gnu_debuglink"); old != nil {
+		e.RemoveSection(old)
+	}
+
+	name := filepath.Base(path)
+	data := make([]byte, alignUp(int64(len(name)+1), 4)+4)
+	copy(data, name)
+	e.order.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(debug))
+
+	s := NewElfSection(".gnu_debuglink", SHT_PROGBITS, 0, data)
+	s.shdr.SH_addralign = 4
+	e.AddSection(s)
+	return nil
+}
+
+/* returns the file name and CRC-32 stored in the .gnu_debuglink section */
+func (p *ElfParser) GetDebuglink() (string, uint32, bool) {
+	for _, shdrDesp := range p.GetShdrs() {
+		shdr := shdrDesp.shdr
+		if strings.Trim(shdrDesp.name, "\x00") != ".gnu_debuglink" || shdr.SH_size < 8 {
+			continue
+		}
+		data := p.readBytes(int64(shdr.SH_offset), int64(shdr.SH_size))
+		name := cString(data)
+		crcpos := alignUp(int64(len(name)+1), 4)
+		if crcpos+4 > int64(len(data)) {
+			return "", 0, false
+		}
+		return name, p.order.Uint32(data[crcpos:]), true
+	}
+	return "", 0, false
+}
+
+func runStrip(args []string) error {
+	mode := "--strip-all"
+	output := ""
+	debuglink := ""
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-s", "--strip-all":
+			mode = "--strip-all"
+		case "-g", "-S", "--strip-debug":
+			mode = "--strip-debug"
+		case "--strip-unneeded", "--only-keep-debug":
+			mode = arg
+		case "-o", "--add-gnu-debuglink":
+			if i+1 >= len(args) {
+				return usageError("elfparser: option requires an argument: %s", arg)
+			}
+			i++
+			if arg == "-o" {
+				output = args[i]
+			} else {
+				debuglink = args[i]
+			}
+		default:
+			if value, ok := strings.CutPrefix(arg, "--add-gnu-debuglink="); ok {
+				debuglink = value
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+	if output != "" && len(paths) != 1 {
+		return usageError("elfparser: -o can only be used with a single file")
+	}
+
+	for _, path := range paths {
+		out := output
+		if out == "" {
+			out = path
+		}
+		if err := stripFile(path, out, mode, debuglink); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func stripFile(path string, output string, mode string, debuglink string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	parser, err := LoadData(file)
+	if err != nil {
+		return err
+	}
+	e, err := NewElfFile(parser)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case "--strip-all":
+		err = e.StripAll()
+	case "--strip-debug":
+		err = e.StripDebug()
+	case "--strip-unneeded":
+		err = e.StripUnneeded()
+	case "--only-keep-debug":
+		e.OnlyKeepDebug()
+	}
+	if err != nil {
+		return err
+	}
+	if debuglink != "" {
+		if err := e.AddDebuglink(debuglink); err != nil {
+			return err
+		}
+	}
+	if err := e.WriteFile(output, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return verifyStrip(output, mode, debuglink)
+}
+
+/* re-reads the written file and checks that the requested sections are gone and the debug link matches */
+func verifyStrip(path string, mode string, debuglink string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	parser, err := LoadData(file)
+	if err != nil {
+		return err
+	}
+
+	for _, shdrDesp := range parser.GetShdrs() {
+		name := strings.Trim(shdrDesp.name, "\x00")
+		debug := isDebugSection(&ElfSection{name: name})
+		symtab := shdrDesp.shdr.SH_type == SHT_SYMTAB
+		unneeded := debug || symtab && parser.GetEhdr().E_type != ET_REL
+		if mode == "--strip-debug" && debug || mode == "--strip-all" && (debug || symtab) || mode == "--strip-unneeded" && unneeded {
+			return fmt.Errorf("error: %s still has section %s", path, name)
+		}
+	}
+
+	if debuglink != "" {
+		data, err := os.ReadFile(debuglink)
+		if err != nil {
+			return err
+		}
+		name, crc, ok := parser.GetDebuglink()
+		if !ok || name != filepath.Base(debuglink) || crc != crc32.ChecksumIEEE(data) {
+			return fmt.Errorf("error: %s has a bad .gnu_debuglink section", path)
+		}
+	}
+	return nil
+}
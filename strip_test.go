@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/* adds DWARF sections, with a relocation against counter in a relocatable file */
+func addDebugSections(f *fixture) *fixture {
+	f.add(&fixtureSection{name: ".debug_info", typ: SHT_PROGBITS, load: -1, data: make([]byte, 16)})
+	if f.typ == ET_REL {
+		rela := binary.LittleEndian.AppendUint64(nil, 8)
+		rela = binary.LittleEndian.AppendUint64(rela, 5<<32|1)
+		rela = binary.LittleEndian.AppendUint64(rela, 0)
+		f.add(&fixtureSection{name: ".rela.debug_info", typ: SHT_RELA, flags: SHF_INFO_LINK, align: 8, entsize: 24, link: ".symtab",
+			load: -1, data: rela, fill: func(f *fixture) []byte {
+				f.section(".rela.debug_info").info = f.index(".debug_info")
+				return rela
+			}})
+	}
+	f.add(&fixtureSection{name: ".debug_str", typ: SHT_PROGBITS, flags: SHF_MERGE | SHF_STRINGS, entsize: 1, load: -1,
+		data: []byte("object.c\x00counter\x00")})
+	f.add(&fixtureSection{name: ".debug_line", typ: SHT_PROGBITS, load: -1, data: make([]byte, 8)})
+	return f
+}
+
+/* a relocatable file whose .rela.text also uses the section symbol of .data, a local symbol */
+func fixtureStrippable() *fixture {
+	f := addDebugSections(fixtureRelocatable())
+	rela := f.section(".rela.text")
+	entry := binary.LittleEndian.AppendUint64(nil, 12)
+	entry = binary.LittleEndian.AppendUint64(entry, 3<<32|2)
+	entry = binary.LittleEndian.AppendUint64(entry, 0)
+	fill := rela.fill
+	rela.data = append(rela.data, entry...)
+	rela.fill = func(f *fixture) []byte { return append(fill(f), entry...) }
+	return f
+}
+
+func symbolNames(p *ElfParser, typ Elf64_Word) []string {
+	names := []string{}
+	for _, desp := range p.GetSyms() {
+		if desp.tab.shdr.SH_type == typ {
+			names = append(names, strings.TrimRight(desp.name, "\x00"))
+		}
+	}
+	return names
+}
+
+func TestStrip(t *testing.T) {
+	exec := []string{"", ".note.ABI-tag", ".text", ".rodata", ".tdata", ".tbss", ".data", ".bss", ".comment"}
+	execSyms := []string{"", "start.c", "", "message", "tls_counter", "_start", "answer", "buffer", "__weak_hook"}
+	object := []string{"", ".group", ".text", ".text.inline", ".rela.text", ".data", ".bss", ".note.GNU-stack"}
+	objectSyms := []string{"", "object.c", "", "", "inline_helper", "counter", "helper", "shared_buffer", "object_main"}
+	relocated := []string{"counter", "helper", ".data"}
+
+	tests := []struct {
+		name     string
+		fixture  *fixture
+		strip    func(e *ElfFile) error
+		sections []string
+		symbols  []string
+	}{
+		{"strip-debug exec", addDebugSections(fixtureExec(binary.LittleEndian, EM_X86_64, false)), (*ElfFile).StripDebug,
+			append(exec, ".symtab", ".strtab", ".shstrtab"), execSyms},
+		{"strip-unneeded exec", addDebugSections(fixtureExec(binary.LittleEndian, EM_X86_64, false)), (*ElfFile).StripUnneeded,
+			append(exec, ".shstrtab"), []string{}},
+		{"strip-all exec", addDebugSections(fixtureExec(binary.LittleEndian, EM_X86_64, false)), (*ElfFile).StripAll,
+			append(exec, ".shstrtab"), []string{}},
+		// the relocation of .debug_info goes with it
+		{"strip-debug object", fixtureStrippable(), (*ElfFile).StripDebug,
+			append(object, ".symtab", ".strtab", ".shstrtab"), objectSyms},
+		// the file and .text symbols are unused locals, the section symbol of .data is relocated against
+		{"strip-unneeded object", fixtureStrippable(), (*ElfFile).StripUnneeded,
+			append(object, ".symtab", ".strtab", ".shstrtab"),
+			[]string{"", "", "inline_helper", "counter", "helper", "shared_buffer", "object_main"}},
+	}
+	for _, test := range tests {
+		e := loadElfFile(t, test.fixture.Bytes())
+		if err := test.strip(e); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		p := writeAndLoad(t, e)
+		if got := sectionNames(p); !reflect.DeepEqual(got, test.sections) {
+			t.Errorf("%s: sections %q, want %q", test.name, got, test.sections)
+		}
+		if got := symbolNames(p, SHT_SYMTAB); !reflect.DeepEqual(got, test.symbols) {
+			t.Errorf("%s: symbols %q, want %q", test.name, got, test.symbols)
+		}
+		if test.fixture.typ == ET_REL {
+			if got := relocationSymbols(t, p, ".rela.text"); !reflect.DeepEqual(got, relocated) {
+				t.Errorf("%s: .rela.text relocates against %q, want %q", test.name, got, relocated)
+			}
+		}
+	}
+
+	e := loadElfFile(t, fixtureStrippable().Bytes())
+	if err := e.StripAll(); err == nil {
+		t.Errorf("strip-all removed the symbol table of a relocatable file")
+	}
+}
+
+/* the debug file keeps the debugging sections, the symbols and the notes, the executable links to it */
+func TestStripSplitDebug(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "exec")
+	if err := os.WriteFile(path, addDebugSections(fixtureExec(binary.LittleEndian, EM_X86_64, false)).Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	debug := filepath.Join(dir, "exec.debug")
+	if err := runStrip([]string{"--only-keep-debug", "-o", debug, path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runStrip([]string{"--strip-unneeded", "--add-gnu-debuglink", debug, path}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(debug)
+	p, err := LoadData(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := sectionNames(p)
+	for i, desp := range p.GetShdrs() {
+		keep := strings.HasPrefix(names[i], ".debug_") || names[i] == ".note.ABI-tag" ||
+			names[i] == ".symtab" || names[i] == ".strtab" || names[i] == ".shstrtab"
+		alloc := desp.shdr.SH_flags&SHF_ALLOC != 0
+		switch {
+		case i == 0:
+		case keep && desp.shdr.SH_type == SHT_NOBITS:
+			t.Errorf("the debug file lost the contents of %s", names[i])
+		case !keep && desp.shdr.SH_type != SHT_NOBITS:
+			t.Errorf("the debug file keeps the contents of %s", names[i])
+		case alloc && desp.shdr.SH_addr == 0:
+			t.Errorf("%s lost its address in the debug file", names[i])
+		}
+	}
+	if got := symbolNames(p, SHT_SYMTAB); len(got) != 9 {
+		t.Errorf("the debug file has the symbols %q", got)
+	}
+	// the segments only cover what is left in the file
+	for _, phdr := range p.GetPhdrs() {
+		if phdr.P_type == PT_LOAD && phdr.P_flags&PF_W != 0 && phdr.P_filesz != 0 {
+			t.Errorf("the data segment keeps 0x%x bytes", phdr.P_filesz)
+		}
+	}
+
+	stripped, _ := os.ReadFile(path)
+	if p, err = LoadData(bytes.NewReader(stripped)); err != nil {
+		t.Fatal(err)
+	}
+	name, crc, ok := p.GetDebuglink()
+	if !ok || name != "exec.debug" || crc != crc32.ChecksumIEEE(data) {
+		t.Errorf(".gnu_debuglink names %q with CRC 0x%08x, want exec.debug with 0x%08x", name, crc, crc32.ChecksumIEEE(data))
+	}
+	for _, name := range sectionNames(p) {
+		if strings.HasPrefix(name, ".debug_") || name == ".symtab" {
+			t.Errorf("the stripped file keeps %s", name)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+/* the dynamic symbols of one loaded object, with their versions resolved to names */
+type SymcheckObject struct {
+	obj      *LddObject
+	syms     []*Elf64SymbolHeaderDesp
+	versions []string /* version name of each symbol, "" when unversioned */
+	hidden   []bool   /* the symbol is a non-default (sym@VER rather than sym@@VER) version */
+	defined  map[string][]int
+	copied   map[string]bool /* data the executable defines by an R_*_COPY relocation */
+}
+
+/* how one undefined symbol of an object is bound by the dynamic loader */
+type SymcheckBinding struct {
+	object     *LddObject
+	name       string
+	version    string
+	weak       bool
+	boundTo    *LddObject   /* nil when no library provides the symbol */
+	copyOf     *LddObject   /* the library whose data boundTo holds a copy of */
+	interposed []*LddObject /* other libraries that define the symbol, hidden by boundTo */
+}
+
+func (b SymcheckBinding) String() string {
+	name := b.name
+	if b.version != "" {
+		name += "@" + b.version
+	}
+	if b.boundTo == nil {
+		if b.weak {
+			return fmt.Sprintf("  %-40s => unresolved (weak)", name)
+		}
+		return fmt.Sprintf("  %-40s => not found", name)
+	}
+
+	line := fmt.Sprintf("  %-40s => %s", name, b.boundTo.path)
+	if b.copyOf != nil {
+		line += fmt.Sprintf(" (copy of %s)", b.copyOf.path)
+	}
+	if len(b.interposed) != 0 {
+		others := []string{}
+		for _, obj := range b.interposed {
+			others = append(others, obj.path)
+		}
+		line += fmt.Sprintf(" (interposes %s)", strings.Join(others, ", "))
+	}
+	return line
+}
+
+func loadSymcheckObject(obj *LddObject) (*SymcheckObject, error) {
+	file, err := os.Open(obj.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	parser, err := LoadData(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(SymcheckObject)
+	s.obj = obj
+	s.syms = parser.GetDynSyms()
+	s.defined = map[string][]int{}
+
+	names := map[Elf64_Half]string{}
+	for _, verdef := range parser.GetVerdefs() {
+		if verdef.flags&VER_FLG_BASE == 0 && len(verdef.names) != 0 {
+			names[verdef.ndx] = verdef.names[0]
+		}
+	}
+	for _, verneed := range parser.GetVerneeds() {
+		names[verneed.ndx] = verneed.name
+	}
+
+	versyms := parser.GetVersyms()
+	s.versions = make([]string, len(s.syms))
+	s.hidden = make([]bool, len(s.syms))
+	for i, desp := range s.syms {
+		if i < len(versyms) {
+			s.versions[i] = names[versyms[i]&VERSYM_VERSION]
+			s.hidden[i] = versyms[i]&VERSYM_HIDDEN != 0
+		}
+
+		sym := desp.sym
+		bind := sym.ST_info >> 4
+		typ := sym.ST_info & 0xf
+		vis := sym.ST_other & 0x03
+		if sym.ST_shndx == SHN_UNDEF || bind == STB_LOCAL || typ == STT_SECTION || typ == STT_FILE {
+			continue
+		}
+		if vis == STV_HIDDEN || vis == STV_INTERNAL {
+			continue
+		}
+		name := strings.Trim(desp.name, "\x00")
+		s.defined[name] = append(s.defined[name], i)
+	}
+
+	// the relocations against .dynsym, where an executable's copy relocations are
+	s.copied = map[string]bool{}
+	copyType, ok := r_copy[parser.ehdr.E_machine]
+	for _, desp := range parser.GetShdrs() {
+		shdr := desp.shdr
+		if !ok || len(s.syms) == 0 || int(shdr.SH_link) != s.syms[0].tab.idx {
+			continue
+		}
+		entsize := 0
+		switch shdr.SH_type {
+		case SHT_REL:
+			entsize = 16
+		case SHT_RELA:
+			entsize = 24
+		default:
+			continue
+		}
+		data := parser.readBytes(int64(shdr.SH_offset), int64(shdr.SH_size))
+		for i := 0; i+entsize <= len(data); i += entsize {
+			info := parser.order.Uint64(data[i+8:])
+			if uint32(info) == copyType && info>>32 < uint64(len(s.syms)) {
+				s.copied[strings.Trim(s.syms[info>>32].name, "\x00")] = true
+			}
+		}
+	}
+
+	return s, nil
+}
+
+/* reports whether s defines name in a way that satisfies a reference to version (or to no version) */
+func (s *SymcheckObject) provides(name string, version string) bool {
+	for _, i := range s.defined[name] {
+		if s.versions[i] == "" {
+			return true
+		}
+		if version == "" && !s.hidden[i] {
+			return true
+		}
+		if version != "" && s.versions[i] == version {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+binds every undefined .dynsym entry of each loaded object against the global scope,
+which ld.so searches in load order: the executable first, then its dependencies breadth-first
+*/
+func CheckSymbols(r *LddResolver) ([]*SymcheckBinding, error) {
+	scope := []*SymcheckObject{}
+	for _, obj := range r.order {
+		s, err := loadSymcheckObject(obj)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", obj.path, err)
+		}
+		scope = append(scope, s)
+	}
+
+	bindings := []*SymcheckBinding{}
+	for _, s := range scope {
+		for i, desp := range s.syms {
+			sym := desp.sym
+			name := strings.Trim(desp.name, "\x00")
+			if sym.ST_shndx != SHN_UNDEF || name == "" || sym.ST_info>>4 == STB_LOCAL {
+				continue
+			}
+
+			b := new(SymcheckBinding)
+			b.object = s.obj
+			b.name = name
+			b.version = s.versions[i]
+			b.weak = sym.ST_info>>4 == STB_WEAK
+			var bound *SymcheckObject
+			for _, provider := range scope {
+				if !provider.provides(b.name, b.version) {
+					continue
+				}
+				switch {
+				case bound == nil:
+					bound = provider
+					b.boundTo = provider.obj
+				case b.copyOf == nil && bound.copied[b.name]:
+					// the copy is initialized from the next definition, which it does not interpose
+					b.copyOf = provider.obj
+				default:
+					b.interposed = append(b.interposed, provider.obj)
+				}
+			}
+			bindings = append(bindings, b)
+		}
+	}
+	return bindings, nil
+}
+
+func runSymcheck(args []string) error {
+	sysroot := ""
+	verbose := false
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--sysroot":
+			if i+1 >= len(args) {
+				return usageError("elfparser: option requires an argument: %s", arg)
+			}
+			i++
+			sysroot = args[i]
+		case "-v", "--verbose":
+			verbose = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usageError("elfparser: unrecognized option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return usageError("elfparser: Warning: Nothing to do")
+	}
+
+	failed := false
+	for _, path := range paths {
+		r := NewLddResolver(sysroot)
+		if _, err := r.Resolve(path); err != nil {
+			return err
+		}
+		for _, obj := range r.missing {
+			fmt.Fprintf(os.Stderr, "%s: error: %s not found (required by %s)\n", path, obj.name, obj.parent.path)
+			failed = true
+		}
+
+		bindings, err := CheckSymbols(r)
+		if err != nil {
+			return err
+		}
+
+		var object *LddObject
+		for _, b := range bindings {
+			problem := (b.boundTo == nil && !b.weak) || len(b.interposed) != 0
+			if !verbose && !problem {
+				continue
+			}
+			if b.object != object {
+				object = b.object
+				fmt.Printf("%s:\n", object.path)
+			}
+			fmt.Println(b)
+			if b.boundTo == nil && !b.weak {
+				failed = true
+			}
+		}
+	}
+
+	// like ld.so, exit with a failure status when a symbol lookup would fail
+	if failed {
+		return errExitStatus
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSymcheck(t *testing.T) {
+	t.Setenv("LD_LIBRARY_PATH", "")
+	sysroot := t.TempDir()
+	function := func(name string) fixtureSymbol {
+		return fixtureSymbol{name: name, bind: STB_GLOBAL, typ: STT_FUNC, size: 9}
+	}
+	object := func(name string) fixtureSymbol {
+		return fixtureSymbol{name: name, bind: STB_GLOBAL, typ: STT_OBJECT, size: 8}
+	}
+	libc := writeFixture(t, sysroot, "/lib64/libc.so.6", fixtureDynamic(ET_DYN, fixtureLink{soname: "libc.so.6",
+		exports: []fixtureSymbol{function("puts"), object("stdout")}}))
+	// libfoo defines puts as well, and reads the stdout of libc
+	libfoo := writeFixture(t, sysroot, "/lib64/libfoo.so.1", fixtureDynamic(ET_DYN, fixtureLink{soname: "libfoo.so.1",
+		needed: []string{"libc.so.6"}, imports: []fixtureSymbol{{name: "stdout", bind: STB_GLOBAL, typ: STT_OBJECT}},
+		exports: []fixtureSymbol{function("foo_init"), function("puts")}}))
+	// the program copies stdout into its .bss, which makes it the definition everybody binds to
+	program := writeFixture(t, sysroot, "/app/program", fixtureDynamic(ET_DYN, fixtureLink{
+		needed: []string{"libfoo.so.1", "libc.so.6"},
+		imports: []fixtureSymbol{{name: "puts", bind: STB_GLOBAL, typ: STT_FUNC}, {name: "foo_init", bind: STB_GLOBAL, typ: STT_FUNC},
+			{name: "missing", bind: STB_GLOBAL, typ: STT_FUNC}, {name: "hook", bind: STB_WEAK, typ: STT_FUNC}},
+		copies: []fixtureSymbol{object("stdout")}}))
+
+	r, _ := resolveFixture(t, sysroot, program)
+	bindings, err := CheckSymbols(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, b := range bindings {
+		got = append(got, strings.ReplaceAll(b.String(), sysroot, ""))
+	}
+	want := []string{
+		fmt.Sprintf("  %-40s => /lib64/libfoo.so.1 (interposes /lib64/libc.so.6)", "puts"),
+		fmt.Sprintf("  %-40s => /lib64/libfoo.so.1", "foo_init"),
+		fmt.Sprintf("  %-40s => not found", "missing"),
+		fmt.Sprintf("  %-40s => unresolved (weak)", "hook"),
+		fmt.Sprintf("  %-40s => /app/program (copy of /lib64/libc.so.6)", "stdout"),
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("bindings\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if bindings[4].object.path != libfoo || bindings[4].copyOf.path != libc {
+		t.Errorf("stdout of %s is a copy of %s", bindings[4].object.path, bindings[4].copyOf.path)
+	}
+
+	// without -v only the problems are printed: the missing symbol and the interposed one, not the copy
+	var status error
+	out := captureStdout(t, func() { status = runSymcheck([]string{"--sysroot", sysroot, program}) })
+	report := program + ":\n" + want[0] + "\n" + want[2] + "\n"
+	if got := strings.ReplaceAll(string(out), sysroot+"/lib64", "/lib64"); got != report || status != errExitStatus {
+		t.Errorf("symcheck printed\n%s\nwant\n%s\nand returned %v", got, report, status)
+	}
+}
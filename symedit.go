@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+/* a .symtab entry being edited, index is its position before the edit */
+type ElfSymbol struct {
+	name  string
+	sym   Elf64SymbolHeader
+	index int
+}
+
+/* the symbol operations of an objcopy run */
+type SymbolEditOptions struct {
+	redefine   map[string]string
+	localize   map[string]bool
+	weaken     map[string]bool
+	strip      map[string]bool
+	visibility map[string]Elf_UChar
+}
+
+func NewSymbolEditOptions() *SymbolEditOptions {
+	return &SymbolEditOptions{
+		redefine:   map[string]string{},
+		localize:   map[string]bool{},
+		weaken:     map[string]bool{},
+		strip:      map[string]bool{},
+		visibility: map[string]Elf_UChar{},
+	}
+}
+
+func (o *SymbolEditOptions) empty() bool {
+	return len(o.redefine)+len(o.localize)+len(o.weaken)+len(o.strip)+len(o.visibility) == 0
+}
+
+var symbol_visibility = map[string]Elf_UChar{
+	"default":   STV_DEFAULT,
+	"internal":  STV_INTERNAL,
+	"hidden":    STV_HIDDEN,
+	"protected": STV_PROTECTED,
+}
+
+func (e *ElfFile) symtab() *ElfSection {
+	for _, s := range e.sections {
+		if s.shdr.SH_type == SHT_SYMTAB {
+			return s
+		}
+	}
+	return nil
+}
+
+/*
+decodes .symtab, lets edit change, drop or reorder the entries and writes the table back:
+locals are moved first as the ELF specification requires, .strtab is rebuilt and the
+symbol indices in relocations and section groups follow the entries to their new place
+*/
+func (e *ElfFile) EditSymbols(edit func(syms []*ElfSymbol) ([]*ElfSymbol, error)) error {
+	symtab := e.symtab()
+	if symtab == nil {
+		return fmt.Errorf("error: no symbol table")
+	}
+	strtab := symtab.link
+	if strtab == nil {
+		return fmt.Errorf("error: the symbol table has no string table")
+	}
+
+	syms := []*ElfSymbol{}
+	reader := bytes.NewReader(symtab.data)
+	for i := 0; reader.Len() >= 24; i++ {
+		s := &ElfSymbol{index: i}
+		binary.Read(reader, e.order, &s.sym)
+		if int(s.sym.ST_name) < len(strtab.data) {
+			s.name = cString(strtab.data[s.sym.ST_name:])
+		}
+		syms = append(syms, s)
+	}
+	if len(syms) == 0 {
+		return nil
+	}
+
+	first := syms[0]
+	edited, err := edit(syms[1:])
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(edited, func(i, j int) bool {
+		return edited[i].sym.ST_info>>4 == STB_LOCAL && edited[j].sym.ST_info>>4 != STB_LOCAL
+	})
+	edited = append([]*ElfSymbol{first}, edited...)
+
+	index := make([]int, len(syms))
+	for i := range index {
+		index[i] = -1
+	}
+	for i, s := range edited {
+		index[s.index] = i
+	}
+
+	// a removed symbol must not be used by a relocation or name a section group
+	rels := []*ElfSection{}
+	for _, s := range e.sections {
+		if (s.shdr.SH_type == SHT_REL || s.shdr.SH_type == SHT_RELA) && s.link == symtab {
+			rels = append(rels, s)
+		}
+	}
+	for _, rel := range rels {
+		entsize := relEntsize(rel)
+		for i := 0; i+entsize <= len(rel.data); i += entsize {
+			sym := e.order.Uint64(rel.data[i+8:]) >> 32
+			if int(sym) < len(index) && index[sym] < 0 {
+				return fmt.Errorf("error: not stripping symbol `%s' because it is named in a relocation", e.symbolName(syms[sym]))
+			}
+		}
+	}
+	for _, s := range e.sections {
+		if s.shdr.SH_type == SHT_GROUP && s.link == symtab && int(s.shdr.SH_info) < len(index) && index[s.shdr.SH_info] < 0 {
+			return fmt.Errorf("error: not stripping symbol `%s' because it names section group %s", e.symbolName(syms[s.shdr.SH_info]), s.name)
+		}
+	}
+
+	names := NewElfStrtab()
+	buf := new(bytes.Buffer)
+	locals := 0
+	for i, s := range edited {
+		s.sym.ST_name = names.Add(s.name)
+		binary.Write(buf, e.order, &s.sym)
+		if s.sym.ST_info>>4 == STB_LOCAL {
+			locals = i + 1
+		}
+	}
+	e.SetData(symtab, buf.Bytes())
+	symtab.shdr.SH_info = Elf64_Word(locals)
+	if strtab == e.names {
+		// do not rebuild the section names along with the symbol names
+		strtab = NewElfSection(".strtab", SHT_STRTAB, 0, nil)
+		e.AddSection(strtab)
+		symtab.link = strtab
+	}
+	e.SetData(strtab, names.data)
+
+	for _, rel := range rels {
+		entsize := relEntsize(rel)
+		data := append([]byte{}, rel.data...)
+		for i := 0; i+entsize <= len(data); i += entsize {
+			info := e.order.Uint64(data[i+8:])
+			if sym := info >> 32; int(sym) < len(index) {
+				e.order.PutUint64(data[i+8:], uint64(index[sym])<<32|info&0xffffffff)
+			}
+		}
+		e.SetData(rel, data)
+	}
+	for _, s := range e.sections {
+		if s.shdr.SH_type == SHT_GROUP && s.link == symtab && int(s.shdr.SH_info) < len(index) {
+			s.shdr.SH_info = Elf64_Word(index[s.shdr.SH_info])
+		}
+		if s.shdr.SH_type == SHT_SYMTAB_SHNDX && s.link == symtab {
+			// the extended section indices run parallel to the symbols
+			data := make([]byte, 4*len(edited))
+			for i, sym := range edited {
+				if 4*sym.index+4 <= len(s.data) {
+					copy(data[4*i:], s.data[4*sym.index:4*sym.index+4])
+				}
+			}
+			e.SetData(s, data)
+		}
+	}
+	return nil
+}
+
+/* the name of a symbol in messages, a section symbol goes by the name of its section */
+func (e *ElfFile) symbolName(s *ElfSymbol) string {
+	if ndx := int(s.sym.ST_shndx); s.sym.ST_info&0xf == STT_SECTION && ndx < SHN_LORESERVE && ndx < len(e.origs) {
+		return e.origs[ndx].name
+	}
+	return s.name
+}
+
+func relEntsize(rel *ElfSection) int {
+	if rel.shdr.SH_type == SHT_REL {
+		return 16
+	}
+	return 24
+}
+
+/* renames, rebinds, hides or removes .symtab entries by name */
+func (e *ElfFile) EditSymbolsByName(opts *SymbolEditOptions) error {
+	return e.EditSymbols(func(syms []*ElfSymbol) ([]*ElfSymbol, error) {
+		kept := []*ElfSymbol{}
+		for _, s := range syms {
+			typ := s.sym.ST_info & 0xf
+			if typ == STT_SECTION || typ == STT_FILE {
+				kept = append(kept, s)
+				continue
+			}
+			// the other options may name a symbol by its old or its new name
+			name := s.name
+			if redefined, ok := opts.redefine[s.name]; ok {
+				name = redefined
+			}
+			match := func(names map[string]bool) bool { return names[s.name] || names[name] }
+			if match(opts.strip) {
+				continue
+			}
+
+			bind := s.sym.ST_info >> 4
+			if match(opts.localize) && s.sym.ST_shndx != SHN_UNDEF {
+				bind = STB_LOCAL
+			}
+			if match(opts.weaken) && bind == STB_GLOBAL {
+				bind = STB_WEAK
+			}
+			s.sym.ST_info = bind<<4 | typ
+			vis, ok := opts.visibility[name]
+			if !ok {
+				vis, ok = opts.visibility[s.name]
+			}
+			if ok {
+				s.sym.ST_other = s.sym.ST_other&^0x3 | vis
+			}
+			s.name = name
+			kept = append(kept, s)
+		}
+		return kept, nil
+	})
+}
+
+/*
+drops the symbols defined in the given sections, used when the sections are removed.
+Like GNU objcopy this fails when a relocation that is kept still uses one of them.
+*/
+func (e *ElfFile) stripSectionSymbols(removed map[*ElfSection]bool) error {
+	if e.symtab() == nil || len(removed) == 0 {
+		return nil
+	}
+	return e.EditSymbols(func(syms []*ElfSymbol) ([]*ElfSymbol, error) {
+		kept := []*ElfSymbol{}
+		for _, s := range syms {
+			ndx := int(s.sym.ST_shndx)
+			if ndx != SHN_UNDEF && ndx < SHN_LORESERVE && ndx < len(e.origs) && removed[e.origs[ndx]] {
+				continue
+			}
+			kept = append(kept, s)
+		}
+		return kept, nil
+	})
+}
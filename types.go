@@ -70,6 +70,17 @@ func (ehdr Elf64Header) String() string {
 	return builder.String()
 }
 
+/* Archive member header, every field is space padded ASCII text */
+type ArHeader struct {
+	AR_name [16]byte /* Member file name, sometimes / terminated. */
+	AR_date [12]byte /* File date, decimal seconds since Epoch.  */
+	AR_uid  [6]byte  /* User ID, in ASCII decimal.  */
+	AR_gid  [6]byte  /* Group ID, in ASCII decimal.  */
+	AR_mode [8]byte  /* File mode, in ASCII octal.  */
+	AR_size [10]byte /* File size, in ASCII decimal.  */
+	AR_fmag [2]byte  /* Always contains ARFMAG.  */
+}
+
 /* Program segment header (Phdr) */
 type Elf64ProgramHeader struct {
 	P_type   Elf64_Word  /* Segment type */
@@ -131,8 +142,9 @@ type Elf64SectionHeaderDesp struct {
 	shdr *Elf64SectionHeader
 }
 
+/* the name is printed without its terminating NUL, in the 18 columns of the header */
 func (d Elf64SectionHeaderDesp) String() string {
-	return fmt.Sprintf("  [%2d] %-19s%s", d.idx, d.name, d.shdr)
+	return fmt.Sprintf("  [%2d] %-18s%s", d.idx, d.name, d.shdr)
 }
 
 /* Symbol table entry  */
@@ -149,6 +161,7 @@ type Elf64SymbolHeaderDesp struct {
 	name string
 	idx  int
 	sym  *Elf64SymbolHeader
+	tab  *Elf64SectionHeaderDesp /* the .symtab or .dynsym section holding the symbol */
 }
 
 func (desp Elf64SymbolHeaderDesp) String() string {
@@ -175,3 +188,163 @@ func (sym Elf64SymbolHeader) String() string {
 	fmt.Fprintf(builder, "%3s ", idx)
 	return builder.String()
 }
+
+/* Dynamic section entry */
+type Elf64Dyn struct {
+	D_tag Elf64_SXWord /* Dynamic entry type */
+	D_val Elf64_XWord  /* Integer or address value */
+}
+
+func (dyn Elf64Dyn) String() string {
+	tag, ok := d_tag[dyn.D_tag]
+	if !ok {
+		tag = fmt.Sprintf("0x%x", dyn.D_tag)
+	}
+	return fmt.Sprintf(" 0x%016x %-20s 0x%x", dyn.D_tag, "("+tag+")", dyn.D_val)
+}
+
+/* Note section contents.  Each entry in the note section begins with a header of a fixed form.  */
+type Elf64Nhdr struct {
+	N_namesz Elf64_Word /* Length of the note's name.  */
+	N_descsz Elf64_Word /* Length of the note's descriptor.  */
+	N_type   Elf64_Word /* Type of the note.  */
+}
+
+/* a decoded note: the owner name and the raw descriptor bytes */
+type Elf64NoteDesp struct {
+	name string
+	typ  Elf64_Word
+	desc []byte
+}
+
+/* Version definition sections.  */
+type Elf64Verdef struct {
+	VD_version Elf64_Half /* Version revision */
+	VD_flags   Elf64_Half /* Version information */
+	VD_ndx     Elf64_Half /* Version Index */
+	VD_cnt     Elf64_Half /* Number of associated aux entries */
+	VD_hash    Elf64_Word /* Version name hash value */
+	VD_aux     Elf64_Word /* Offset in bytes to verdaux array */
+	VD_next    Elf64_Word /* Offset in bytes to next verdef entry */
+}
+
+/* Auxialiary version information.  */
+type Elf64Verdaux struct {
+	VDA_name Elf64_Word /* Version or dependency names */
+	VDA_next Elf64_Word /* Offset in bytes to next verdaux entry */
+}
+
+/* Version dependency section.  */
+type Elf64Verneed struct {
+	VN_version Elf64_Half /* Version of structure */
+	VN_cnt     Elf64_Half /* Number of associated aux entries */
+	VN_file    Elf64_Word /* Offset of filename for this dependency */
+	VN_aux     Elf64_Word /* Offset in bytes to vernaux array */
+	VN_next    Elf64_Word /* Offset in bytes to next verneed entry */
+}
+
+/* Auxiliary needed version information.  */
+type Elf64Vernaux struct {
+	VNA_hash  Elf64_Word /* Hash value of dependency name */
+	VNA_flags Elf64_Half /* Dependency specific information */
+	VNA_other Elf64_Half /* Unused */
+	VNA_name  Elf64_Word /* Dependency name string offset */
+	VNA_next  Elf64_Word /* Offset in bytes to next vernaux entry */
+}
+
+/* a version defined by this object, names[0] is the version itself and the rest are its parents */
+type Elf64VerdefDesp struct {
+	ndx   Elf64_Half
+	flags Elf64_Half
+	names []string
+}
+
+/* a version this object needs from the library named file */
+type Elf64VerneedDesp struct {
+	file  string
+	name  string
+	ndx   Elf64_Half
+	flags Elf64_Half
+}
+
+/* Header of the GNU-style hash table (SHT_GNU_HASH). */
+type Elf64GnuHashHeader struct {
+	GH_nbuckets   Elf64_Word /* Number of hash buckets */
+	GH_symoffset  Elf64_Word /* Index of the first symbol reachable through the table */
+	GH_bloomsize  Elf64_Word /* Number of words in the bloom filter */
+	GH_bloomshift Elf64_Word /* Shift count used by the bloom filter */
+}
+
+/* the decoded SysV hash table (SHT_HASH) */
+type Elf64HashTable struct {
+	buckets []Elf64_Word
+	chains  []Elf64_Word
+}
+
+/* the decoded GNU hash table (SHT_GNU_HASH) */
+type Elf64GnuHashTable struct {
+	hdr     Elf64GnuHashHeader
+	bloom   []Elf64_XWord
+	buckets []Elf64_Word
+	chains  []Elf64_Word /* hash values of symbols symoffset.., the low bit ends a chain */
+}
+
+/* Process status (struct elf_prstatus) of a thread, followed in NT_PRSTATUS by its registers */
+type Elf64Prstatus struct {
+	PR_info_signo int32    /* Signal number.  */
+	PR_info_code  int32    /* Extra code.  */
+	PR_info_errno int32    /* Errno.  */
+	PR_cursig     int16    /* Current signal.  */
+	_             [2]byte  /* Padding */
+	PR_sigpend    uint64   /* Set of pending signals.  */
+	PR_sighold    uint64   /* Set of held signals.  */
+	PR_pid        int32    /* Process ID */
+	PR_ppid       int32    /* Parent process ID */
+	PR_pgrp       int32    /* Process group ID */
+	PR_sid        int32    /* Session ID */
+	PR_utime      [2]int64 /* User time.  */
+	PR_stime      [2]int64 /* System time.  */
+	PR_cutime     [2]int64 /* Cumulative user time.  */
+	PR_cstime     [2]int64 /* Cumulative system time.  */
+}
+
+/* Process information (struct elf_prpsinfo) */
+type Elf64Prpsinfo struct {
+	PR_state  int8     /* Numeric process state.  */
+	PR_sname  byte     /* Char for pr_state.  */
+	PR_zomb   byte     /* Zombie.  */
+	PR_nice   int8     /* Nice val.  */
+	_         [4]byte  /* Padding */
+	PR_flag   uint64   /* Flags.  */
+	PR_uid    uint32   /* User ID */
+	PR_gid    uint32   /* Group ID */
+	PR_pid    int32    /* Process ID */
+	PR_ppid   int32    /* Parent process ID */
+	PR_pgrp   int32    /* Process group ID */
+	PR_sid    int32    /* Session ID */
+	PR_fname  [16]byte /* Filename of executable.  */
+	PR_psargs [80]byte /* Initial part of arg list.  */
+}
+
+/* The leading fields of siginfo_t, followed by the fault address for SIGSEGV, SIGBUS, SIGILL and SIGFPE */
+type Elf64Siginfo struct {
+	SI_signo int32  /* Signal number.  */
+	SI_errno int32  /* If non-zero, an errno value associated with this signal.  */
+	SI_code  int32  /* Signal code.  */
+	_        int32  /* Padding */
+	SI_addr  uint64 /* Faulting address, or the sender pid and uid for kill().  */
+}
+
+/* Auxiliary vector entry */
+type Elf64Auxv struct {
+	A_type Elf64_XWord /* Entry type */
+	A_val  Elf64_XWord /* Integer or address value */
+}
+
+/* A file mapping from the NT_FILE note, the offset is in units of the note's page size */
+type Elf64FileMapping struct {
+	start  Elf64_Addr
+	end    Elf64_Addr
+	offset Elf64_XWord
+	path   string
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/binary"
+)
+
+/* reads the version definitions from the .gnu.version_d (SHT_GNU_verdef) section */
+func (p *ElfParser) GetVerdefs() []*Elf64VerdefDesp {
+	desps := []*Elf64VerdefDesp{}
+
+	shdrDesps := p.GetShdrs()
+	for _, shdrDesp := range shdrDesps {
+		shdr := shdrDesp.shdr
+		if shdr.SH_type != SHT_GNU_verdef || int(shdr.SH_link) >= len(shdrDesps) {
+			continue
+		}
+		if !p.inFile(uint64(shdr.SH_offset), uint64(shdr.SH_size)) {
+			p.fail("error: section %d extends past the end of the file", shdrDesp.idx)
+			continue
+		}
+		stroffset := int64(shdrDesps[shdr.SH_link].shdr.SH_offset)
+
+		pos := int64(shdr.SH_offset)
+		end := pos + int64(shdr.SH_size)
+		for pos+int64(binary.Size(Elf64Verdef{})) <= end {
+			verdef := new(Elf64Verdef)
+			if err := read(p.order, p.file, pos, verdef); err != nil {
+				break
+			}
+
+			desp := new(Elf64VerdefDesp)
+			desp.ndx = verdef.VD_ndx
+			desp.flags = verdef.VD_flags
+
+			auxpos := pos + int64(verdef.VD_aux)
+			for i := 0; i < int(verdef.VD_cnt) && auxpos < end; i++ {
+				aux := new(Elf64Verdaux)
+				if err := read(p.order, p.file, auxpos, aux); err != nil {
+					break
+				}
+				desp.names = append(desp.names, p.readString(stroffset+int64(aux.VDA_name)))
+				if aux.VDA_next == 0 {
+					break
+				}
+				auxpos += int64(aux.VDA_next)
+			}
+			desps = append(desps, desp)
+
+			if verdef.VD_next == 0 {
+				break
+			}
+			pos += int64(verdef.VD_next)
+		}
+	}
+
+	return desps
+}
+
+/* reads the version dependencies from the .gnu.version_r (SHT_GNU_verneed) section */
+func (p *ElfParser) GetVerneeds() []*Elf64VerneedDesp {
+	desps := []*Elf64VerneedDesp{}
+
+	shdrDesps := p.GetShdrs()
+	for _, shdrDesp := range shdrDesps {
+		shdr := shdrDesp.shdr
+		if shdr.SH_type != SHT_GNU_verneed || int(shdr.SH_link) >= len(shdrDesps) {
+			continue
+		}
+		if !p.inFile(uint64(shdr.SH_offset), uint64(shdr.SH_size)) {
+			p.fail("error: section %d extends past the end of the file", shdrDesp.idx)
+			continue
+		}
+		stroffset := int64(shdrDesps[shdr.SH_link].shdr.SH_offset)
+
+		pos := int64(shdr.SH_offset)
+		end := pos + int64(shdr.SH_size)
+		for pos+int64(binary.Size(Elf64Verneed{})) <= end {
+			verneed := new(Elf64Verneed)
+			if err := read(p.order, p.file, pos, verneed); err != nil {
+				break
+			}
+			file := p.readString(stroffset + int64(verneed.VN_file))
+
+			auxpos := pos + int64(verneed.VN_aux)
+			for i := 0; i < int(verneed.VN_cnt) && auxpos < end; i++ {
+				aux := new(Elf64Vernaux)
+				if err := read(p.order, p.file, auxpos, aux); err != nil {
+					break
+				}
+
+				desp := new(Elf64VerneedDesp)
+				desp.file = file
+				desp.name = p.readString(stroffset + int64(aux.VNA_name))
+				desp.ndx = aux.VNA_other
+				desp.flags = aux.VNA_flags
+				desps = append(desps, desp)
+
+				if aux.VNA_next == 0 {
+					break
+				}
+				auxpos += int64(aux.VNA_next)
+			}
+
+			if verneed.VN_next == 0 {
+				break
+			}
+			pos += int64(verneed.VN_next)
+		}
+	}
+
+	return desps
+}
+
+/* reads the .gnu.version (SHT_GNU_versym) section, one entry per .dynsym symbol */
+func (p *ElfParser) GetVersyms() []Elf64_Half {
+	versyms := []Elf64_Half{}
+	for _, shdrDesp := range p.GetShdrs() {
+		shdr := shdrDesp.shdr
+		if shdr.SH_type != SHT_GNU_versym {
+			continue
+		}
+		if !p.inFile(uint64(shdr.SH_offset), uint64(shdr.SH_size)) {
+			p.fail("error: section %d extends past the end of the file", shdrDesp.idx)
+			break
+		}
+		versyms = make([]Elf64_Half, shdr.SH_size/2)
+		if err := read(p.order, p.file, int64(shdr.SH_offset), &versyms); err != nil {
+			versyms = []Elf64_Half{}
+		}
+		break
+	}
+	return versyms
+}
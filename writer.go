@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+/* limits on the layout of a written file, hostile headers must not make it allocate without bound */
+const (
+	MAX_ALIGN   = 1 << 16 /* largest alignment a written section or segment is given */
+	MAX_PADDING = 1 << 30 /* largest gap a new segment leaves in the file to line up with the first PT_LOAD */
+)
+
+/* a section of an ElfFile, sh_link and sh_info references are kept as pointers so indices can change */
+type ElfSection struct {
+	name string
+	shdr Elf64SectionHeader
+	data []byte /* nil for SHT_NOBITS */
+	link *ElfSection
+	info *ElfSection /* only when SHF_INFO_LINK is set */
+}
+
+/* returns a section to be added to an ElfFile */
+func NewElfSection(name string, typ Elf64_Word, flags Elf64_XWord, data []byte) *ElfSection {
+	s := new(ElfSection)
+	s.name = name
+	s.shdr.SH_type = typ
+	s.shdr.SH_flags = flags
+	s.shdr.SH_addralign = 1
+	s.shdr.SH_size = Elf64_XWord(len(data))
+	s.data = data
+	return s
+}
+
+/*
+an editable copy of an ELF file, built from an ElfParser and written back with Bytes.
+Offsets that are tied to addresses are kept, everything else is laid out again when
+a section is added, removed or resized, so an unmodified file round-trips unchanged.
+*/
+type ElfFile struct {
+	order    binary.ByteOrder
+	ehdr     Elf64Header
+	phdrs    []*Elf64ProgramHeader
+	sections []*ElfSection
+	origs    []*ElfSection /* the sections by their index in the original file */
+	names    *ElfSection   /* the section name string table */
+	image    []byte        /* the original file, for bytes that belong to no section */
+	repack   bool          /* the section layout changed and must be recomputed */
+	packed   bool          /* the layout differs from the original file */
+	padding  int64         /* the gap MoveSections left before the new segment */
+}
+
+func NewElfFile(p *ElfParser) (*ElfFile, error) {
+	size := p.size
+	e := new(ElfFile)
+	e.order = p.order
+	e.ehdr = *p.GetEhdr()
+	e.image = make([]byte, size)
+	if _, err := p.file.ReadAt(e.image, 0); err != nil {
+		return nil, err
+	}
+
+	for i, phdr := range p.GetPhdrs() {
+		if end := phdr.P_offset + Elf64_Off(phdr.P_filesz); end < phdr.P_offset || end > Elf64_Off(size) {
+			return nil, fmt.Errorf("error: segment %d extends past the end of the file", i)
+		}
+		copied := *phdr
+		e.phdrs = append(e.phdrs, &copied)
+	}
+
+	shdrDesps := p.GetShdrs()
+	// a header that cannot be read would be dropped from the output
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, errs[0]
+	}
+	for _, desp := range shdrDesps {
+		s := new(ElfSection)
+		s.name = strings.Trim(desp.name, "\x00")
+		s.shdr = *desp.shdr
+		if desp.idx == 0 && s.shdr.SH_offset > Elf64_Off(size) {
+			return nil, fmt.Errorf("error: section 0 has a bad offset 0x%x", s.shdr.SH_offset)
+		}
+		if s.shdr.SH_type != SHT_NOBITS && desp.idx != 0 {
+			end := s.shdr.SH_offset + Elf64_Off(s.shdr.SH_size)
+			if end < s.shdr.SH_offset || end > Elf64_Off(size) {
+				return nil, fmt.Errorf("error: section %d (%s) extends past the end of the file", desp.idx, s.name)
+			}
+			s.data = e.image[s.shdr.SH_offset:end:end]
+		}
+		e.sections = append(e.sections, s)
+	}
+	for _, s := range e.sections {
+		if int(s.shdr.SH_link) < len(e.sections) && s.shdr.SH_link != 0 {
+			s.link = e.sections[s.shdr.SH_link]
+		}
+		if s.shdr.SH_flags&SHF_INFO_LINK != 0 && int(s.shdr.SH_info) < len(e.sections) && s.shdr.SH_info != 0 {
+			s.info = e.sections[s.shdr.SH_info]
+		}
+	}
+	e.origs = append([]*ElfSection{}, e.sections...)
+	if int(e.ehdr.E_shstrndx) < len(e.sections) && e.ehdr.E_shstrndx != 0 {
+		e.names = e.sections[e.ehdr.E_shstrndx]
+	}
+
+	return e, nil
+}
+
+/* returns the first section with the given name, or nil */
+func (e *ElfFile) Section(name string) *ElfSection {
+	for _, s := range e.sections {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+/* returns the current index of the section, or -1 when it is not part of the file */
+func (e *ElfFile) Index(s *ElfSection) int {
+	for i, section := range e.sections {
+		if section == s {
+			return i
+		}
+	}
+	return -1
+}
+
+/* adds a section before the section name string table when that is last, as linkers place it */
+func (e *ElfFile) AddSection(s *ElfSection) {
+	if len(e.sections) == 0 {
+		e.sections = append(e.sections, new(ElfSection))
+	}
+	at := len(e.sections)
+	if at > 1 && e.sections[at-1] == e.names {
+		at--
+	}
+	e.sections = append(e.sections[:at], append([]*ElfSection{s}, e.sections[at:]...)...)
+	e.repack = true
+}
+
+/* removes a section together with the relocation sections that apply to it */
+func (e *ElfFile) RemoveSection(s *ElfSection) {
+	sections := []*ElfSection{}
+	for _, section := range e.sections {
+		if section != s && (section.info != s || section.shdr.SH_flags&SHF_INFO_LINK == 0) {
+			sections = append(sections, section)
+		}
+	}
+	e.sections = sections
+	e.repack = true
+}
+
+/* returns the sections of the original file that have been removed since */
+func (e *ElfFile) removedSections() map[*ElfSection]bool {
+	removed := map[*ElfSection]bool{}
+	for _, s := range e.origs {
+		if e.Index(s) < 0 {
+			removed[s] = true
+		}
+	}
+	return removed
+}
+
+/* renames a section, .shstrtab is rebuilt when the file is written */
+func (e *ElfFile) RenameSection(s *ElfSection, name string) {
+	s.name = name
+	e.repack = true
+}
+
+/* replaces the contents of a section, a change of size moves the non-allocated sections */
+func (e *ElfFile) SetData(s *ElfSection, data []byte) {
+	if Elf64_XWord(len(data)) != s.shdr.SH_size {
+		e.repack = true
+	}
+	s.data = data
+	s.shdr.SH_size = Elf64_XWord(len(data))
+}
+
+/*
+moves allocated sections that outgrew their place into a new PT_LOAD segment after the end
+of the loaded image. The program header table moves to the start of the segment to make room
+for the new entry, and PT_PHDR, PT_INTERP and PT_DYNAMIC follow the sections they describe.
+*/
+func (e *ElfFile) MoveSections(sections ...*ElfSection) error {
+	if len(e.phdrs) == 0 || e.ehdr.E_phentsize == 0 {
+		return fmt.Errorf("error: cannot add a segment to a file without program headers")
+	}
+
+	var pagesize, top int64 = 0x1000, 0
+	var first *Elf64ProgramHeader
+	last := -1
+	for i, phdr := range e.phdrs {
+		if phdr.P_type == PT_LOAD {
+			// larger pages than the loader needs only waste address space and file
+			pagesize = max(pagesize, min(int64(phdr.P_align), MAX_ALIGN))
+			top = max(top, int64(phdr.P_vaddr)+int64(phdr.P_memsz))
+			if first == nil {
+				first = phdr
+			}
+			last = i
+		}
+	}
+	if last < 0 {
+		return fmt.Errorf("error: no PT_LOAD segment")
+	}
+
+	// bytes of the original file past the loaded image belong to sections that get repacked
+	end := e.fixedEnd()
+	e.image = e.image[:min(int64(len(e.image)), end)]
+
+	// the kernel places the program headers at e_phoff plus p_vaddr - p_offset of the first PT_LOAD,
+	// the new segment keeps that difference and the file is padded up to the end of the image in memory
+	delta := int64(first.P_vaddr) - int64(first.P_offset)
+	if delta%pagesize != 0 {
+		return fmt.Errorf("error: the first PT_LOAD segment is not aligned to 0x%x", pagesize)
+	}
+	offset := max(alignUp(end, pagesize), alignUp(top, pagesize)-delta)
+	vaddr := offset + delta
+	if offset-end > MAX_PADDING {
+		return fmt.Errorf("error: a new segment after 0x%x would need 0x%x bytes of padding", top, offset-end)
+	}
+	e.padding = offset - end
+
+	phnum := int64(len(e.phdrs)) + 1
+	phdrsize := phnum * int64(e.ehdr.E_phentsize)
+	pos := phdrsize
+	for _, s := range sections {
+		if s.shdr.SH_addralign > MAX_ALIGN {
+			return fmt.Errorf("error: section %s has a bad alignment 0x%x", s.name, s.shdr.SH_addralign)
+		}
+		pos = alignUp(pos, int64(s.shdr.SH_addralign))
+		old := s.shdr.SH_offset
+		s.shdr.SH_offset = Elf64_Off(offset + pos)
+		s.shdr.SH_addr = Elf64_Addr(vaddr + pos)
+		pos += int64(len(s.data))
+
+		for _, phdr := range e.phdrs {
+			if phdr.P_type != PT_LOAD && phdr.P_offset == old {
+				phdr.P_offset = s.shdr.SH_offset
+				phdr.P_vaddr = s.shdr.SH_addr
+				phdr.P_paddr = s.shdr.SH_addr
+				phdr.P_filesz = Elf64_XWord(len(s.data))
+				phdr.P_memsz = Elf64_XWord(len(s.data))
+			}
+		}
+	}
+
+	e.ehdr.E_phoff = Elf64_Off(offset)
+	for _, phdr := range e.phdrs {
+		if phdr.P_type == PT_PHDR {
+			phdr.P_offset = Elf64_Off(offset)
+			phdr.P_vaddr = Elf64_Addr(vaddr)
+			phdr.P_paddr = Elf64_Addr(vaddr)
+			phdr.P_filesz = Elf64_XWord(phdrsize)
+			phdr.P_memsz = Elf64_XWord(phdrsize)
+		}
+	}
+
+	// the loader expects PT_LOAD entries sorted by address
+	load := &Elf64ProgramHeader{
+		P_type:   PT_LOAD,
+		P_flags:  PF_R | PF_W,
+		P_offset: Elf64_Off(offset),
+		P_vaddr:  Elf64_Addr(vaddr),
+		P_paddr:  Elf64_Addr(vaddr),
+		P_filesz: Elf64_XWord(pos),
+		P_memsz:  Elf64_XWord(pos),
+		P_align:  Elf64_XWord(pagesize),
+	}
+	e.phdrs = append(e.phdrs[:last+1], append([]*Elf64ProgramHeader{load}, e.phdrs[last+1:]...)...)
+	e.repack = true
+	return nil
+}
+
+/* recomputes the file offsets of the sections and of the section header table */
+func (e *ElfFile) layout() error {
+	if len(e.sections) >= SHN_LORESERVE {
+		return fmt.Errorf("error: too many sections: %d", len(e.sections))
+	}
+
+	// the names of removed sections are dropped along with them
+	if e.repack && e.Index(e.names) <= 0 && len(e.sections) > 1 {
+		e.names = NewElfSection(".shstrtab", SHT_STRTAB, 0, nil)
+		e.sections = append(e.sections, e.names)
+	}
+	if e.repack && e.Index(e.names) > 0 {
+		strtab := NewElfStrtab()
+		for _, s := range e.sections {
+			s.shdr.SH_name = strtab.Add(s.name)
+		}
+		e.SetData(e.names, strtab.data)
+	}
+
+	e.ehdr.E_phnum = Elf64_Half(len(e.phdrs))
+	e.ehdr.E_shnum = Elf64_Half(len(e.sections))
+	e.ehdr.E_shstrndx = 0
+	if i := e.Index(e.names); i > 0 {
+		e.ehdr.E_shstrndx = Elf64_Half(i)
+	}
+	if len(e.sections) == 0 {
+		e.ehdr.E_shoff = 0
+	}
+
+	for _, s := range e.sections {
+		// a reference to a removed section becomes 0
+		if s.link != nil {
+			s.shdr.SH_link = Elf64_Word(max(e.Index(s.link), 0))
+		}
+		if s.info != nil && s.shdr.SH_flags&SHF_INFO_LINK != 0 {
+			s.shdr.SH_info = Elf64_Word(max(e.Index(s.info), 0))
+		}
+	}
+
+	e.renumber()
+
+	if !e.repack {
+		return nil
+	}
+
+	// allocated sections and segment contents stay where they are, the rest and new sections are packed after them
+	fixed := e.fixedEnd()
+	loose := []*ElfSection{}
+	for _, s := range e.sections {
+		if s.shdr.SH_type != SHT_NULL && (s.shdr.SH_flags&SHF_ALLOC == 0 || s.shdr.SH_offset == 0) {
+			loose = append(loose, s)
+		}
+	}
+	sort.SliceStable(loose, func(i, j int) bool {
+		// sections added since the file was read have no offset yet and go last
+		a, b := loose[i].shdr.SH_offset, loose[j].shdr.SH_offset
+		return a != 0 && (b == 0 || a < b)
+	})
+
+	cursor := fixed
+	for _, s := range loose {
+		if s.shdr.SH_type == SHT_NOBITS {
+			s.shdr.SH_offset = Elf64_Off(cursor)
+			continue
+		}
+		if s.shdr.SH_addralign > MAX_ALIGN {
+			return fmt.Errorf("error: section %s has a bad alignment 0x%x", s.name, s.shdr.SH_addralign)
+		}
+		s.shdr.SH_offset = Elf64_Off(alignUp(cursor, int64(s.shdr.SH_addralign)))
+		cursor = int64(s.shdr.SH_offset) + int64(len(s.data))
+	}
+
+	if len(e.sections) != 0 {
+		e.ehdr.E_shoff = Elf64_Off(alignUp(cursor, 8))
+	}
+	e.repack = false
+	e.packed = true
+	return nil
+}
+
+/*
+rewrites the section indices stored in symbol tables and section groups after sections moved.
+The symbols of removed sections have been dropped from .symtab by then; .dynsym cannot lose
+entries, which the hash tables and symbol versions index, so its symbols there become absolute.
+*/
+func (e *ElfFile) renumber() {
+	index := make([]int, len(e.origs))
+	moved := false
+	for i, s := range e.origs {
+		index[i] = e.Index(s)
+		moved = moved || index[i] != i
+	}
+	if !moved {
+		return
+	}
+
+	remap := func(ndx uint32) (uint32, bool) {
+		if ndx == 0 || ndx >= SHN_LORESERVE || int(ndx) >= len(index) {
+			return ndx, true
+		}
+		return uint32(index[ndx]), index[ndx] >= 0
+	}
+	for _, s := range e.sections {
+		switch s.shdr.SH_type {
+		case SHT_SYMTAB, SHT_DYNSYM:
+			data := append([]byte{}, s.data...)
+			for i := 0; i+24 <= len(data); i += 24 {
+				ndx, ok := remap(uint32(e.order.Uint16(data[i+6:])))
+				if !ok {
+					ndx = SHN_ABS
+				}
+				e.order.PutUint16(data[i+6:], uint16(ndx))
+			}
+			s.data = data
+		case SHT_GROUP:
+			// a flag word followed by the indices of the member sections, removed members leave the group
+			data := append([]byte{}, s.data[:min(4, len(s.data))]...)
+			for i := 4; i+4 <= len(s.data); i += 4 {
+				if ndx, ok := remap(e.order.Uint32(s.data[i:])); ok {
+					data = append(data, 0, 0, 0, 0)
+					e.order.PutUint32(data[len(data)-4:], ndx)
+				}
+			}
+			e.SetData(s, data)
+		}
+	}
+
+	// the new indices are now the reference for the next layout
+	e.origs = append([]*ElfSection{}, e.sections...)
+}
+
+/* the end of the part of the file whose offsets cannot change: headers, segments and allocated sections */
+func (e *ElfFile) fixedEnd() int64 {
+	end := int64(e.ehdr.E_ehsize)
+	if len(e.phdrs) != 0 {
+		end = max(end, int64(e.ehdr.E_phoff)+int64(len(e.phdrs))*int64(e.ehdr.E_phentsize))
+	}
+	for _, phdr := range e.phdrs {
+		if phdr.P_filesz != 0 {
+			end = max(end, int64(phdr.P_offset)+int64(phdr.P_filesz))
+		}
+	}
+	for _, s := range e.sections {
+		if s.shdr.SH_flags&SHF_ALLOC != 0 && s.shdr.SH_type != SHT_NOBITS && s.shdr.SH_offset != 0 {
+			end = max(end, int64(s.shdr.SH_offset)+int64(len(s.data)))
+		}
+	}
+	return end
+}
+
+/* serializes the file: ELF header, program headers, section data and section headers */
+func (e *ElfFile) Bytes() ([]byte, error) {
+	if err := e.layout(); err != nil {
+		return nil, err
+	}
+
+	// nothing is larger than the original file, the section contents and the headers with their padding
+	shentsize := int64(binary.Size(Elf64SectionHeader{}))
+	limit := int64(len(e.image)) + e.padding + int64(len(e.phdrs))*int64(e.ehdr.E_phentsize) + int64(len(e.sections))*shentsize + 2*MAX_ALIGN
+	for _, s := range e.sections {
+		limit += int64(len(s.data)) + int64(min(s.shdr.SH_addralign, MAX_ALIGN))
+	}
+	bound := func(what string, end uint64) error {
+		if end > uint64(limit) {
+			return fmt.Errorf("error: %s ends at 0x%x, past any reasonable file size", what, end)
+		}
+		return nil
+	}
+
+	if len(e.phdrs) != 0 {
+		if err := bound("the program header table", uint64(e.ehdr.E_phoff)+uint64(len(e.phdrs))*uint64(e.ehdr.E_phentsize)); err != nil {
+			return nil, err
+		}
+	}
+	size := e.fixedEnd()
+	if err := bound("the loaded image", uint64(size)); err != nil {
+		return nil, err
+	}
+	for _, s := range e.sections {
+		if s.shdr.SH_type != SHT_NOBITS {
+			if err := bound("section "+s.name, uint64(s.shdr.SH_offset)+uint64(len(s.data))); err != nil {
+				return nil, err
+			}
+			size = max(size, int64(s.shdr.SH_offset)+int64(len(s.data)))
+		}
+	}
+	if len(e.sections) != 0 {
+		if err := bound("the section header table", uint64(e.ehdr.E_shoff)+uint64(shentsize)*uint64(len(e.sections))); err != nil {
+			return nil, err
+		}
+		size = max(size, int64(e.ehdr.E_shoff)+shentsize*int64(len(e.sections)))
+	}
+
+	// padding and unused bytes are carried over from the original file, trailing data too unless the layout changed
+	if !e.packed {
+		size = max(size, int64(len(e.image)))
+	}
+	out := make([]byte, size)
+	if e.packed {
+		copy(out, e.image[:min(int64(len(e.image)), e.fixedEnd())])
+	} else {
+		copy(out, e.image)
+	}
+
+	buf := new(bytes.Buffer)
+	put := func(offset int64, obj any) {
+		buf.Reset()
+		binary.Write(buf, e.order, obj)
+		copy(out[offset:], buf.Bytes())
+	}
+
+	put(0, &e.ehdr)
+	for i, phdr := range e.phdrs {
+		put(int64(e.ehdr.E_phoff)+int64(i)*int64(e.ehdr.E_phentsize), phdr)
+	}
+	for _, s := range e.sections {
+		if s.shdr.SH_type != SHT_NOBITS {
+			copy(out[s.shdr.SH_offset:], s.data)
+		}
+	}
+	for i, s := range e.sections {
+		put(int64(e.ehdr.E_shoff)+int64(i)*shentsize, &s.shdr)
+	}
+	return out, nil
+}
+
+func (e *ElfFile) WriteFile(path string, perm os.FileMode) error {
+	out, err := e.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, perm)
+}
+
+/* builds a string table, each distinct string is stored once */
+type ElfStrtab struct {
+	data    []byte
+	offsets map[string]Elf64_Word
+}
+
+func NewElfStrtab() *ElfStrtab {
+	return &ElfStrtab{data: []byte{0}, offsets: map[string]Elf64_Word{"": 0}}
+}
+
+func (t *ElfStrtab) Add(s string) Elf64_Word {
+	if off, ok := t.offsets[s]; ok {
+		return off
+	}
+	off := Elf64_Word(len(t.data))
+	t.data = append(append(t.data, s...), 0)
+	t.offsets[s] = off
+	return off
+}
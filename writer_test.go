@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+/* writes an ElfFile and reads the result back, failing on parse errors and lint errors */
+func writeAndLoad(t *testing.T, e *ElfFile) *ElfParser {
+	t.Helper()
+	out, err := e.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadData(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.GetShdrs()
+	p.GetSyms()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("the written file does not parse: %v", errs)
+	}
+	for _, issue := range p.Lint() {
+		if issue.severity == LINT_ERROR {
+			t.Errorf("the written file: %s", issue)
+		}
+	}
+	return p
+}
+
+func loadElfFile(t *testing.T, data []byte) *ElfFile {
+	t.Helper()
+	p, err := LoadData(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewElfFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func sectionNames(p *ElfParser) []string {
+	names := []string{}
+	for _, desp := range p.GetShdrs() {
+		names = append(names, strings.TrimRight(desp.name, "\x00"))
+	}
+	return names
+}
+
+/* returns the file contents and the header of the named section */
+func sectionBytes(p *ElfParser, name string) ([]byte, *Elf64SectionHeader) {
+	for _, desp := range p.GetShdrs() {
+		if strings.TrimRight(desp.name, "\x00") == name && desp.shdr.SH_type != SHT_NOBITS {
+			return p.readBytes(int64(desp.shdr.SH_offset), int64(desp.shdr.SH_size)), desp.shdr
+		}
+	}
+	return nil, nil
+}
+
+/* returns the name of the section a symbol is defined in, "" for none */
+func symbolSection(t *testing.T, p *ElfParser, name string) string {
+	t.Helper()
+	for _, desp := range p.GetSyms() {
+		if strings.TrimRight(desp.name, "\x00") == name {
+			if shndx := int(desp.sym.ST_shndx); shndx != 0 && shndx < len(p.GetShdrs()) {
+				return strings.TrimRight(p.GetShdrs()[shndx].name, "\x00")
+			}
+			return ""
+		}
+	}
+	t.Fatalf("no symbol %s", name)
+	return ""
+}
+
+/* names the symbol of each relocation in a section, a section symbol by its section */
+func relocationSymbols(t *testing.T, p *ElfParser, name string) []string {
+	t.Helper()
+	data, shdr := sectionBytes(p, name)
+	if shdr == nil {
+		t.Fatalf("no section %s", name)
+	}
+	syms := []*Elf64SymbolHeaderDesp{}
+	for _, desp := range p.GetSyms() {
+		if desp.tab.idx == int(shdr.SH_link) {
+			syms = append(syms, desp)
+		}
+	}
+	names := []string{}
+	for i := 0; i+24 <= len(data); i += 24 {
+		sym := p.order.Uint64(data[i+8:]) >> 32
+		if sym >= uint64(len(syms)) {
+			t.Fatalf("%s: relocation %d uses symbol %d of %d", name, i/24, sym, len(syms))
+		}
+		desp := syms[sym]
+		if desp.sym.ST_info&0xf == STT_SECTION {
+			names = append(names, strings.TrimRight(p.GetShdrs()[desp.sym.ST_shndx].name, "\x00"))
+		} else {
+			names = append(names, strings.TrimRight(desp.name, "\x00"))
+		}
+	}
+	return names
+}
+
+/* an unmodified file is written back byte for byte */
+func TestElfFileRoundTrip(t *testing.T) {
+	for name, build := range fixtures {
+		data := build()
+		out, err := loadElfFile(t, data).Bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Errorf("%s: the file changed when written back", name)
+		}
+	}
+}
+
+/* sections added, removed and renamed show up in the written file, the symbols keep their sections */
+func TestElfFileEdits(t *testing.T) {
+	e := loadElfFile(t, fixtureExec(binary.LittleEndian, EM_X86_64, false).Bytes())
+	note := []byte("added\x00\x00\x00")
+	e.AddSection(NewElfSection(".note.added", SHT_NOTE, 0, note))
+	e.RemoveSection(e.Section(".comment"))
+	e.RenameSection(e.Section(".rodata"), ".rodata.renamed")
+	p := writeAndLoad(t, e)
+
+	want := []string{"", ".note.ABI-tag", ".text", ".rodata.renamed", ".tdata", ".tbss", ".data", ".bss", ".symtab", ".strtab",
+		".note.added", ".shstrtab"}
+	if got := sectionNames(p); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("sections %q, want %q", got, want)
+	}
+	if got, _ := sectionBytes(p, ".note.added"); !bytes.Equal(got, note) {
+		t.Errorf(".note.added holds %q", got)
+	}
+	for name, section := range map[string]string{"message": ".rodata.renamed", "answer": ".data", "_start": ".text"} {
+		if got := symbolSection(t, p, name); got != section {
+			t.Errorf("%s is in %q, want %s", name, got, section)
+		}
+	}
+}
+
+/* a non-allocated section that grows pushes the sections after it, the loaded image stays in place */
+func TestElfFileRepack(t *testing.T) {
+	data := fixtureExec(binary.LittleEndian, EM_X86_64, false).Bytes()
+	before, err := LoadData(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := loadElfFile(t, data)
+	comment := e.Section(".comment")
+	grown := append(append([]byte{}, comment.data...), bytes.Repeat([]byte("x"), 100)...)
+	e.SetData(comment, grown)
+	p := writeAndLoad(t, e)
+
+	if got, shdr := sectionBytes(p, ".comment"); !bytes.Equal(got, grown) || shdr.SH_size != Elf64_XWord(len(grown)) {
+		t.Errorf(".comment holds %q", got)
+	}
+	for _, name := range sectionNames(before) {
+		want, old := sectionBytes(before, name)
+		got, shdr := sectionBytes(p, name)
+		if name == "" || name == ".comment" || old == nil {
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s changed when the file was repacked", name)
+		}
+		if shdr.SH_addralign > 1 && uint64(shdr.SH_offset)%uint64(shdr.SH_addralign) != 0 {
+			t.Errorf("%s at 0x%x is not aligned to %d", name, shdr.SH_offset, shdr.SH_addralign)
+		}
+		if old.SH_flags&SHF_ALLOC != 0 && shdr.SH_offset != old.SH_offset {
+			t.Errorf("the allocated section %s moved from 0x%x to 0x%x", name, old.SH_offset, shdr.SH_offset)
+		}
+	}
+	if p.GetEhdr().E_shoff <= before.GetEhdr().E_shoff {
+		t.Errorf("the section header table did not move after .comment grew")
+	}
+	if symbolSection(t, p, "message") != ".rodata" {
+		t.Errorf("message left .rodata")
+	}
+}
+
+/* a section that outgrew its place moves to a new PT_LOAD after the loaded image */
+func TestElfFileMoveSections(t *testing.T) {
+	data := fixtureShared().Bytes()
+	e := loadElfFile(t, data)
+	dynamic := e.Section(".dynamic")
+	grown := append(append([]byte{}, dynamic.data...), make([]byte, 32)...)
+	e.SetData(dynamic, grown)
+	if err := e.MoveSections(dynamic); err != nil {
+		t.Fatal(err)
+	}
+	p := writeAndLoad(t, e)
+
+	shdr := p.GetShdrs()[e.Index(dynamic)].shdr
+	loads := []*Elf64ProgramHeader{}
+	var phdr, dyn *Elf64ProgramHeader
+	for _, segment := range p.GetPhdrs() {
+		switch segment.P_type {
+		case PT_LOAD:
+			loads = append(loads, segment)
+		case PT_PHDR:
+			phdr = segment
+		case PT_DYNAMIC:
+			dyn = segment
+		}
+	}
+	if len(loads) != 3 {
+		t.Fatalf("%d PT_LOAD segments, want 3", len(loads))
+	}
+	load := loads[2]
+	if loads[1].P_vaddr+Elf64_Addr(loads[1].P_memsz) > load.P_vaddr || uint64(load.P_offset)%uint64(load.P_align) != 0 ||
+		uint64(load.P_vaddr)%uint64(load.P_align) != 0 {
+		t.Errorf("the new segment %+v is misplaced", load)
+	}
+	// the program headers come first in the new segment, the section after them
+	if p.GetEhdr().E_phoff != load.P_offset || phdr.P_offset != load.P_offset || phdr.P_vaddr != load.P_vaddr ||
+		phdr.P_filesz != Elf64_XWord(len(p.GetPhdrs())*binary.Size(Elf64ProgramHeader{})) {
+		t.Errorf("the program headers are at 0x%x, PT_PHDR %+v, the segment %+v", p.GetEhdr().E_phoff, phdr, load)
+	}
+	if shdr.SH_offset < load.P_offset || shdr.SH_addr-load.P_vaddr != Elf64_Addr(shdr.SH_offset-load.P_offset) ||
+		shdr.SH_size != Elf64_XWord(len(grown)) {
+		t.Errorf(".dynamic %+v is outside the new segment %+v", shdr, load)
+	}
+	if dyn.P_offset != shdr.SH_offset || dyn.P_vaddr != shdr.SH_addr || dyn.P_filesz != shdr.SH_size {
+		t.Errorf("PT_DYNAMIC %+v does not follow .dynamic %+v", dyn, shdr)
+	}
+	if data, _ := sectionBytes(p, ".dynamic"); !bytes.Equal(data, grown) {
+		t.Errorf(".dynamic changed when it moved")
+	}
+	// the sections that did not move keep their contents in place
+	if text, _ := sectionBytes(p, ".text"); !bytes.Equal(text, fixtureText) {
+		t.Errorf(".text holds % x", text)
+	}
+}
+
+/* header values that would make the written file huge are capped or refused */
+func TestElfFileHostileLayout(t *testing.T) {
+	e := loadElfFile(t, fixtureShared().Bytes())
+	for _, phdr := range e.phdrs {
+		if phdr.P_type == PT_LOAD {
+			phdr.P_align = 1 << 40
+		}
+	}
+	dynamic := e.Section(".dynamic")
+	e.SetData(dynamic, make([]byte, 2*len(dynamic.data)))
+	if err := e.MoveSections(dynamic); err != nil {
+		t.Fatal(err)
+	}
+	out, err := e.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > 4*MAX_ALIGN {
+		t.Errorf("a 1 TiB p_align wrote %d bytes", len(out))
+	}
+
+	e = loadElfFile(t, fixtureShared().Bytes())
+	e.ehdr.E_shoff = 1 << 40
+	if _, err := e.Bytes(); err == nil {
+		t.Errorf("a section header table at 1 TiB was written")
+	}
+	e = loadElfFile(t, fixtureShared().Bytes())
+	strtab := e.Section(".strtab")
+	strtab.shdr.SH_addralign = 1 << 40
+	e.SetData(strtab, append(append([]byte{}, strtab.data...), "moved\x00"...))
+	if _, err := e.Bytes(); err == nil {
+		t.Errorf("a section aligned to 1 TiB was written")
+	}
+}